@@ -1,9 +1,118 @@
 package discoveryimpl
 
 import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/ipfs/go-cid"
+
 	"github.com/filecoin-project/go-fil-markets/discovery"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 )
 
-func Multi(r discovery.PeerResolver) discovery.PeerResolver { // TODO: actually support multiple mechanisms
-	return r
+// Multi returns a PeerResolver that combines the peers of the given
+// resolvers, in priority order. A peer returned by more than one resolver is
+// only included once, at the position of the highest priority resolver that
+// returned it. An error is only returned if every resolver fails.
+func Multi(resolvers ...discovery.PeerResolver) discovery.PeerResolver {
+	if len(resolvers) == 1 {
+		return resolvers[0]
+	}
+	return &multiResolver{resolvers: resolvers}
+}
+
+type multiResolver struct {
+	resolvers []discovery.PeerResolver
 }
+
+func (m *multiResolver) GetPeers(payloadCID cid.Cid) ([]retrievalmarket.RetrievalPeer, error) {
+	peers := []retrievalmarket.RetrievalPeer{}
+	seen := make(map[string]struct{})
+	var merr error
+	failed := 0
+	for _, r := range m.resolvers {
+		rpeers, err := r.GetPeers(payloadCID)
+		if err != nil {
+			log.Warnf("resolving peers for %s: %s", payloadCID, err)
+			merr = multierror.Append(merr, err)
+			failed++
+			continue
+		}
+		for _, p := range rpeers {
+			key := peerKey(p)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			peers = append(peers, p)
+		}
+	}
+	if failed > 0 && failed == len(m.resolvers) {
+		return nil, merr
+	}
+	return peers, nil
+}
+
+// StreamPeers sends the peers of each resolver on the returned channel, in
+// priority order, as they are found. Peers are streamed from resolvers that
+// implement PeerStreamer, and resolvers that fail are skipped.
+func (m *multiResolver) StreamPeers(ctx context.Context, payloadCID cid.Cid) (<-chan retrievalmarket.RetrievalPeer, error) {
+	out := make(chan retrievalmarket.RetrievalPeer)
+	go func() {
+		defer close(out)
+		seen := make(map[string]struct{})
+		send := func(p retrievalmarket.RetrievalPeer) bool {
+			key := peerKey(p)
+			if _, ok := seen[key]; ok {
+				return true
+			}
+			seen[key] = struct{}{}
+			select {
+			case out <- p:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for _, r := range m.resolvers {
+			if ps, ok := r.(discovery.PeerStreamer); ok {
+				peers, err := ps.StreamPeers(ctx, payloadCID)
+				if err != nil {
+					log.Warnf("resolving peers for %s: %s", payloadCID, err)
+					continue
+				}
+				for p := range peers {
+					if !send(p) {
+						return
+					}
+				}
+				continue
+			}
+
+			peers, err := r.GetPeers(payloadCID)
+			if err != nil {
+				log.Warnf("resolving peers for %s: %s", payloadCID, err)
+				continue
+			}
+			for _, p := range peers {
+				if !send(p) {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// peerKey identifies a peer by value, including its piece CID
+func peerKey(p retrievalmarket.RetrievalPeer) string {
+	pieceCID := cid.Undef
+	if p.PieceCID != nil {
+		pieceCID = *p.PieceCID
+	}
+	return fmt.Sprintf("%s/%s/%s", p.Address, p.ID, pieceCID)
+}
+
+var _ discovery.PeerStreamer = &multiResolver{}
@@ -0,0 +1,248 @@
+package discoveryimpl
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipni/go-libipni/find/model"
+	"github.com/ipni/go-libipni/metadata"
+	"github.com/multiformats/go-multicodec"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/discovery"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+)
+
+// DefaultIndexerCacheTTL is how long the results of a query to the indexer
+// are cached by default
+const DefaultIndexerCacheTTL = 5 * time.Minute
+
+// DefaultIndexerCacheSize is the number of payload CIDs whose results are
+// cached by default
+const DefaultIndexerCacheSize = 1024
+
+// DefaultIndexerTimeout is the default timeout for a query to the indexer
+const DefaultIndexerTimeout = 30 * time.Second
+
+// maxIndexerResponseBytes limits the size of a response from the indexer
+const maxIndexerResponseBytes = 16 << 20
+
+// IndexerOption configures an Indexer
+type IndexerOption func(i *Indexer)
+
+// IndexerCacheTTL sets how long the results of a query to the indexer are
+// cached. A TTL of zero disables the cache.
+func IndexerCacheTTL(ttl time.Duration) IndexerOption {
+	return func(i *Indexer) {
+		i.ttl = ttl
+	}
+}
+
+// IndexerCacheSize sets the most payload CIDs whose results are cached. When
+// the cache is full, the least recently used results are evicted. A size of
+// zero disables the cache.
+func IndexerCacheSize(size int) IndexerOption {
+	return func(i *Indexer) {
+		i.cacheSize = size
+	}
+}
+
+// IndexerHTTPClient sets the HTTP client used to query the indexer
+func IndexerHTTPClient(c *http.Client) IndexerOption {
+	return func(i *Indexer) {
+		i.client = c
+	}
+}
+
+// Indexer is a PeerResolver that looks up the providers of a payload CID
+// with the find API of an IPNI indexer, eg https://cid.contact.
+//
+// Only providers that advertise the payload over Graphsync with Filecoin
+// data transfer are returned. The indexer identifies providers by peer ID,
+// so the Address of the returned peers is undefined, and must be looked up
+// (eg from the miner's on chain peer ID) before proposing a retrieval deal.
+type Indexer struct {
+	findURL   *url.URL
+	client    *http.Client
+	ttl       time.Duration
+	cacheSize int
+	now       func() time.Time
+
+	lk    sync.Mutex
+	cache map[string]*list.Element
+	lru   *list.List
+}
+
+type indexerCacheEntry struct {
+	key     string
+	peers   []retrievalmarket.RetrievalPeer
+	expires time.Time
+}
+
+// NewIndexer returns a PeerResolver that queries the indexer at the given
+// URL
+func NewIndexer(indexerURL string, opts ...IndexerOption) (*Indexer, error) {
+	u, err := url.Parse(indexerURL)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing indexer url %s: %w", indexerURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, xerrors.Errorf("indexer url %s must use http or https", indexerURL)
+	}
+	i := &Indexer{
+		findURL:   u.JoinPath("multihash"),
+		client:    &http.Client{Timeout: DefaultIndexerTimeout},
+		ttl:       DefaultIndexerCacheTTL,
+		cacheSize: DefaultIndexerCacheSize,
+		now:       time.Now,
+		cache:     make(map[string]*list.Element),
+		lru:       list.New(),
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i, nil
+}
+
+// GetPeers queries the indexer for the providers of the given payload CID
+func (i *Indexer) GetPeers(payloadCID cid.Cid) ([]retrievalmarket.RetrievalPeer, error) {
+	key := string(payloadCID.Hash())
+	if peers, ok := i.cached(key); ok {
+		return peers, nil
+	}
+
+	peers, err := i.find(context.TODO(), payloadCID)
+	if err != nil {
+		return nil, err
+	}
+
+	i.store(key, peers)
+	return peers, nil
+}
+
+func (i *Indexer) cached(key string) ([]retrievalmarket.RetrievalPeer, bool) {
+	i.lk.Lock()
+	defer i.lk.Unlock()
+
+	elem, ok := i.cache[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*indexerCacheEntry)
+	if !i.now().Before(entry.expires) {
+		i.lru.Remove(elem)
+		delete(i.cache, key)
+		return nil, false
+	}
+	i.lru.MoveToFront(elem)
+	return entry.peers, true
+}
+
+// store caches the peers for a key, evicting the least recently used
+// entries if the cache is full
+func (i *Indexer) store(key string, peers []retrievalmarket.RetrievalPeer) {
+	if i.ttl <= 0 || i.cacheSize <= 0 {
+		return
+	}
+
+	i.lk.Lock()
+	defer i.lk.Unlock()
+
+	entry := &indexerCacheEntry{key: key, peers: peers, expires: i.now().Add(i.ttl)}
+	if elem, ok := i.cache[key]; ok {
+		elem.Value = entry
+		i.lru.MoveToFront(elem)
+		return
+	}
+	i.cache[key] = i.lru.PushFront(entry)
+	for i.lru.Len() > i.cacheSize {
+		oldest := i.lru.Back()
+		i.lru.Remove(oldest)
+		delete(i.cache, oldest.Value.(*indexerCacheEntry).key)
+	}
+}
+
+func (i *Indexer) find(ctx context.Context, payloadCID cid.Cid) ([]retrievalmarket.RetrievalPeer, error) {
+	u := i.findURL.JoinPath(payloadCID.Hash().B58String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("querying indexer for %s: %w", payloadCID, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	// the indexer responds with not found if it has no providers
+	if resp.StatusCode == http.StatusNotFound {
+		return []retrievalmarket.RetrievalPeer{}, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxIndexerResponseBytes))
+	if err != nil {
+		return nil, xerrors.Errorf("reading indexer response for %s: %w", payloadCID, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("indexer responded to query for %s with %d: %s",
+			payloadCID, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	findResp, err := model.UnmarshalFindResponse(body)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding indexer response for %s: %w", payloadCID, err)
+	}
+	return retrievalPeers(findResp), nil
+}
+
+// retrievalPeers returns a peer for each distinct provider and piece in the
+// response that can be retrieved from with Graphsync
+func retrievalPeers(resp *model.FindResponse) []retrievalmarket.RetrievalPeer {
+	peers := []retrievalmarket.RetrievalPeer{}
+	seen := make(map[string]struct{})
+	for _, mhr := range resp.MultihashResults {
+		for _, pr := range mhr.ProviderResults {
+			if pr.Provider == nil {
+				continue
+			}
+			pieceCID, ok := graphsyncPieceCID(pr.Metadata)
+			if !ok {
+				continue
+			}
+			key := fmt.Sprintf("%s/%s", pr.Provider.ID, pieceCID)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			peers = append(peers, retrievalmarket.RetrievalPeer{
+				ID:       pr.Provider.ID,
+				PieceCID: &pieceCID,
+			})
+		}
+	}
+	return peers
+}
+
+// graphsyncPieceCID returns the piece CID in GraphsyncFilecoinV1 metadata
+func graphsyncPieceCID(data []byte) (cid.Cid, bool) {
+	md := metadata.Default.New()
+	if err := md.UnmarshalBinary(data); err != nil {
+		return cid.Undef, false
+	}
+	gs, ok := md.Get(multicodec.TransportGraphsyncFilecoinv1).(*metadata.GraphsyncFilecoinV1)
+	if !ok || !gs.PieceCID.Defined() {
+		return cid.Undef, false
+	}
+	return gs.PieceCID, true
+}
+
+var _ discovery.PeerResolver = &Indexer{}
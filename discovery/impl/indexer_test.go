@@ -0,0 +1,211 @@
+package discoveryimpl_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipni/go-libipni/find/model"
+	"github.com/ipni/go-libipni/metadata"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+
+	discoveryimpl "github.com/filecoin-project/go-fil-markets/discovery/impl"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+)
+
+func TestIndexer(t *testing.T) {
+	payloadCID := testCid(t, "payload")
+	pieceCID := testCid(t, "piece")
+	gsProvider := testPeer(t, "graphsync provider")
+	bsProvider := testPeer(t, "bitswap provider")
+
+	gsMetadata := marshalMetadata(t, &metadata.GraphsyncFilecoinV1{PieceCID: pieceCID})
+	bsMetadata := marshalMetadata(t, metadata.Bitswap{})
+	resp, err := model.MarshalFindResponse(&model.FindResponse{
+		MultihashResults: []model.MultihashResult{{
+			Multihash: payloadCID.Hash(),
+			ProviderResults: []model.ProviderResult{
+				{Metadata: gsMetadata, Provider: &peer.AddrInfo{ID: gsProvider}},
+				// the same provider and piece with a different context ID
+				{ContextID: []byte("other"), Metadata: gsMetadata, Provider: &peer.AddrInfo{ID: gsProvider}},
+				{Metadata: bsMetadata, Provider: &peer.AddrInfo{ID: bsProvider}},
+			},
+		}},
+	})
+	require.NoError(t, err)
+
+	var queries int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		switch r.URL.Path {
+		case "/multihash/" + payloadCID.Hash().B58String():
+			_, _ = w.Write(resp)
+		case "/multihash/" + pieceCID.Hash().B58String():
+			http.Error(w, "indexer unavailable", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	t.Run("returns graphsync providers", func(t *testing.T) {
+		idx, err := discoveryimpl.NewIndexer(srv.URL)
+		require.NoError(t, err)
+		peers, err := idx.GetPeers(payloadCID)
+		require.NoError(t, err)
+		require.Equal(t, []retrievalmarket.RetrievalPeer{{ID: gsProvider, PieceCID: &pieceCID}}, peers)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		idx, err := discoveryimpl.NewIndexer(srv.URL)
+		require.NoError(t, err)
+		peers, err := idx.GetPeers(testCid(t, "unknown"))
+		require.NoError(t, err)
+		require.Empty(t, peers)
+	})
+
+	t.Run("indexer error", func(t *testing.T) {
+		idx, err := discoveryimpl.NewIndexer(srv.URL)
+		require.NoError(t, err)
+		_, err = idx.GetPeers(pieceCID)
+		require.Error(t, err)
+		require.True(t, strings.Contains(err.Error(), "indexer unavailable"))
+	})
+
+	t.Run("caches results", func(t *testing.T) {
+		idx, err := discoveryimpl.NewIndexer(srv.URL, discoveryimpl.IndexerCacheTTL(100*time.Millisecond))
+		require.NoError(t, err)
+		atomic.StoreInt32(&queries, 0)
+		for i := 0; i < 3; i++ {
+			peers, err := idx.GetPeers(payloadCID)
+			require.NoError(t, err)
+			require.Len(t, peers, 1)
+		}
+		require.EqualValues(t, 1, atomic.LoadInt32(&queries))
+
+		// results are fetched again once the TTL expires
+		time.Sleep(150 * time.Millisecond)
+		_, err = idx.GetPeers(payloadCID)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, atomic.LoadInt32(&queries))
+	})
+
+	t.Run("evicts the least recently used results", func(t *testing.T) {
+		idx, err := discoveryimpl.NewIndexer(srv.URL, discoveryimpl.IndexerCacheSize(2))
+		require.NoError(t, err)
+		other1, other2 := testCid(t, "other 1"), testCid(t, "other 2")
+		atomic.StoreInt32(&queries, 0)
+		for _, c := range []cid.Cid{payloadCID, other1, payloadCID, other2} {
+			_, err := idx.GetPeers(c)
+			require.NoError(t, err)
+		}
+		require.EqualValues(t, 3, atomic.LoadInt32(&queries))
+
+		// other1 was evicted to make room for other2, payloadCID was used
+		// more recently so it is still cached
+		_, err = idx.GetPeers(payloadCID)
+		require.NoError(t, err)
+		require.EqualValues(t, 3, atomic.LoadInt32(&queries))
+		_, err = idx.GetPeers(other1)
+		require.NoError(t, err)
+		require.EqualValues(t, 4, atomic.LoadInt32(&queries))
+	})
+
+	t.Run("cache disabled", func(t *testing.T) {
+		idx, err := discoveryimpl.NewIndexer(srv.URL, discoveryimpl.IndexerCacheTTL(0))
+		require.NoError(t, err)
+		atomic.StoreInt32(&queries, 0)
+		for i := 0; i < 3; i++ {
+			_, err := idx.GetPeers(payloadCID)
+			require.NoError(t, err)
+		}
+		require.EqualValues(t, 3, atomic.LoadInt32(&queries))
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		_, err := discoveryimpl.NewIndexer("ftp://indexer")
+		require.Error(t, err)
+	})
+}
+
+func TestMulti(t *testing.T) {
+	payloadCID := testCid(t, "payload")
+	pieceCID := testCid(t, "piece")
+	pieceCIDCopy := pieceCID
+	addr, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	local := retrievalmarket.RetrievalPeer{Address: addr, ID: peer.ID("local"), PieceCID: &pieceCID}
+	remote := retrievalmarket.RetrievalPeer{ID: peer.ID("remote"), PieceCID: &pieceCID}
+
+	t.Run("combines peers in priority order", func(t *testing.T) {
+		r := discoveryimpl.Multi(
+			fakeResolver{peers: []retrievalmarket.RetrievalPeer{local}},
+			fakeResolver{peers: []retrievalmarket.RetrievalPeer{
+				remote,
+				// the same peer as the first resolver, with a different piece CID pointer
+				{Address: addr, ID: peer.ID("local"), PieceCID: &pieceCIDCopy},
+			}},
+		)
+		peers, err := r.GetPeers(payloadCID)
+		require.NoError(t, err)
+		require.Equal(t, []retrievalmarket.RetrievalPeer{local, remote}, peers)
+	})
+
+	t.Run("ignores a failing resolver", func(t *testing.T) {
+		r := discoveryimpl.Multi(
+			fakeResolver{err: errors.New("indexer unavailable")},
+			fakeResolver{peers: []retrievalmarket.RetrievalPeer{local}},
+		)
+		peers, err := r.GetPeers(payloadCID)
+		require.NoError(t, err)
+		require.Equal(t, []retrievalmarket.RetrievalPeer{local}, peers)
+	})
+
+	t.Run("fails if every resolver fails", func(t *testing.T) {
+		r := discoveryimpl.Multi(
+			fakeResolver{err: errors.New("indexer unavailable")},
+			fakeResolver{err: errors.New("datastore closed")},
+		)
+		_, err := r.GetPeers(payloadCID)
+		require.Error(t, err)
+	})
+}
+
+type fakeResolver struct {
+	peers []retrievalmarket.RetrievalPeer
+	err   error
+}
+
+func (f fakeResolver) GetPeers(cid.Cid) ([]retrievalmarket.RetrievalPeer, error) {
+	return f.peers, f.err
+}
+
+func marshalMetadata(t *testing.T, protocol metadata.Protocol) []byte {
+	md := metadata.Default.New(protocol)
+	data, err := md.MarshalBinary()
+	require.NoError(t, err)
+	return data
+}
+
+// testPeer returns a valid peer ID, so that it survives the indexer's JSON
+// encoding
+func testPeer(t *testing.T, name string) peer.ID {
+	mh, err := multihash.Sum([]byte(name), multihash.IDENTITY, -1)
+	require.NoError(t, err)
+	return peer.ID(mh)
+}
+
+func testCid(t *testing.T, data string) cid.Cid {
+	mh, err := multihash.Sum([]byte(data), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	return cid.NewCidV1(cid.Raw, mh)
+}
@@ -3,12 +3,17 @@ package discoveryimpl
 import (
 	"bytes"
 	"context"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/hannahhoward/go-pubsub"
 	dshelp "github.com/ipfs/boxo/datastore/dshelp"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p/core/peer"
 
 	cborutil "github.com/filecoin-project/go-cbor-util"
 	versioning "github.com/filecoin-project/go-ds-versioning/pkg"
@@ -22,20 +27,56 @@ import (
 
 var log = logging.Logger("retrieval-discovery")
 
+// LocalOption configures a Local peer store
+type LocalOption func(l *Local)
+
+// LocalPeerTTL sets how long a peer is kept after it was last seen, ie since
+// it was last added or a retrieval from it last succeeded. Expired peers are
+// not returned by GetPeers, and are deleted by ExpirePeers. A TTL of zero
+// (the default) keeps peers forever.
+func LocalPeerTTL(ttl time.Duration) LocalOption {
+	return func(l *Local) {
+		l.ttl = ttl
+	}
+}
+
+// LocalClock sets the function a Local peer store uses to get the current
+// time, which decides when peers expire. It defaults to time.Now.
+func LocalClock(now func() time.Time) LocalOption {
+	return func(l *Local) {
+		l.now = now
+	}
+}
+
+// Local is a PeerResolver for the peers that this node has made storage
+// deals with, which is kept in a datastore
 type Local struct {
-	ds        datastore.Datastore
+	ds        datastore.Batching
 	migrateDs func(context.Context) error
 	readySub  *pubsub.PubSub
+	ttl       time.Duration
+	now       func() time.Time
+
+	// lk serializes updates to peer records, which are read-modify-write
+	lk sync.Mutex
 }
 
-func NewLocal(ds datastore.Batching) (*Local, error) {
+func NewLocal(ds datastore.Batching, opts ...LocalOption) (*Local, error) {
 	migrations, err := migrations.RetrievalPeersMigrations.Build()
 	if err != nil {
 		return nil, err
 	}
-	versionedDs, migrateDs := versionedds.NewVersionedDatastore(ds, migrations, versioning.VersionKey("1"))
-	readySub := pubsub.New(shared.ReadyDispatcher)
-	return &Local{versionedDs, migrateDs, readySub}, nil
+	versionedDs, migrateDs := versionedds.NewVersionedDatastore(ds, migrations, versioning.VersionKey("2"))
+	l := &Local{
+		ds:        versionedDs,
+		migrateDs: migrateDs,
+		readySub:  pubsub.New(shared.ReadyDispatcher),
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l, nil
 }
 
 func (l *Local) Start(ctx context.Context) error {
@@ -57,65 +98,255 @@ func (l *Local) OnReady(ready shared.ReadyFunc) {
 	l.readySub.Subscribe(ready)
 }
 
+// AddPeer adds a peer for the payload CID, or marks it as seen now if it is
+// already present
 func (l *Local) AddPeer(ctx context.Context, cid cid.Cid, peer retrievalmarket.RetrievalPeer) error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
 	key := dshelp.MultihashToDsKey(cid.Hash())
-	exists, err := l.ds.Has(ctx, key)
+	records, err := l.getRecords(ctx, key)
 	if err != nil {
 		return err
 	}
 
-	var newRecord bytes.Buffer
-
-	if !exists {
-		peers := discovery.RetrievalPeers{Peers: []retrievalmarket.RetrievalPeer{peer}}
-		err = cborutil.WriteCborRPC(&newRecord, &peers)
-		if err != nil {
-			return err
-		}
-	} else {
-		entry, err := l.ds.Get(ctx, key)
-		if err != nil {
-			return err
-		}
-		var peers discovery.RetrievalPeers
-		if err = cborutil.ReadCborRPC(bytes.NewReader(entry), &peers); err != nil {
-			return err
+	now := l.now().UnixNano()
+	found := false
+	for i := range records.Peers {
+		if samePeer(records.Peers[i].Peer, peer) {
+			records.Peers[i].LastSeen = now
+			found = true
+			break
 		}
-		if hasPeer(peers, peer) {
-			return nil
+	}
+	if !found {
+		records.Peers = append(records.Peers, discovery.PeerRecord{Peer: peer, LastSeen: now})
+	}
+	return l.putRecords(ctx, key, records)
+}
+
+// RemovePeer removes a peer for the payload CID
+func (l *Local) RemovePeer(ctx context.Context, cid cid.Cid, peer retrievalmarket.RetrievalPeer) error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	key := dshelp.MultihashToDsKey(cid.Hash())
+	records, err := l.getRecords(ctx, key)
+	if err != nil {
+		return err
+	}
+	return l.filterRecords(ctx, key, records, func(r discovery.PeerRecord) bool {
+		return !samePeer(r.Peer, peer)
+	})
+}
+
+// RemoveProvider removes the peer with the given ID for every payload CID,
+// eg because the provider has shut down
+func (l *Local) RemoveProvider(ctx context.Context, id peer.ID) error {
+	return l.filterAll(ctx, func(r discovery.PeerRecord) bool {
+		return r.Peer.ID != id
+	})
+}
+
+// ExpirePeers deletes the peers that have not been seen within the TTL
+func (l *Local) ExpirePeers(ctx context.Context) error {
+	if l.ttl == 0 {
+		return nil
+	}
+	now := l.now()
+	return l.filterAll(ctx, func(r discovery.PeerRecord) bool {
+		return !l.expired(r, now)
+	})
+}
+
+// RecordRetrieval updates the health of the peers with the given ID for the
+// payload CID with the outcome of a retrieval from it. A successful
+// retrieval also marks the peers as seen.
+func (l *Local) RecordRetrieval(ctx context.Context, cid cid.Cid, id peer.ID, success bool) error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	key := dshelp.MultihashToDsKey(cid.Hash())
+	records, err := l.getRecords(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	now := l.now().UnixNano()
+	updated := false
+	for i := range records.Peers {
+		r := &records.Peers[i]
+		if r.Peer.ID != id {
+			continue
 		}
-		peers.Peers = append(peers.Peers, peer)
-		err = cborutil.WriteCborRPC(&newRecord, &peers)
-		if err != nil {
-			return err
+		if success {
+			r.Successes++
+			r.LastSuccess = now
+			r.LastSeen = now
+		} else {
+			r.Failures++
+			r.LastFailure = now
 		}
+		updated = true
+	}
+	if !updated {
+		return nil
 	}
+	return l.putRecords(ctx, key, records)
+}
 
-	return l.ds.Put(ctx, key, newRecord.Bytes())
+// OnClientEvent records the outcome of retrieval deals, so that peers are
+// ranked by how retrievals from them have gone. It can be registered with
+// RetrievalClient.SubscribeToEvents.
+func (l *Local) OnClientEvent(event retrievalmarket.ClientEvent, state retrievalmarket.ClientDealState) {
+	var success bool
+	switch state.Status {
+	case retrievalmarket.DealStatusCompleted:
+		success = true
+	case retrievalmarket.DealStatusErrored,
+		retrievalmarket.DealStatusRejected,
+		retrievalmarket.DealStatusDealNotFound,
+		retrievalmarket.DealStatusIncomplete:
+		success = false
+	default:
+		return
+	}
+	if err := l.RecordRetrieval(context.TODO(), state.PayloadCID, state.Sender, success); err != nil {
+		log.Errorf("recording retrieval of %s from %s: %s", state.PayloadCID, state.Sender, err)
+	}
 }
 
-func hasPeer(peerList discovery.RetrievalPeers, peer retrievalmarket.RetrievalPeer) bool {
-	for _, p := range peerList.Peers {
-		if p == peer {
-			return true
+// GetPeerRecords returns the records of the peers for the payload CID that
+// have not expired, healthiest first
+func (l *Local) GetPeerRecords(ctx context.Context, payloadCID cid.Cid) ([]discovery.PeerRecord, error) {
+	records, err := l.getRecords(ctx, dshelp.MultihashToDsKey(payloadCID.Hash()))
+	if err != nil {
+		return nil, err
+	}
+
+	now := l.now()
+	live := make([]discovery.PeerRecord, 0, len(records.Peers))
+	for _, r := range records.Peers {
+		if !l.expired(r, now) {
+			live = append(live, r)
 		}
 	}
-	return false
+	sort.SliceStable(live, func(i, j int) bool {
+		return live[i].Score() > live[j].Score()
+	})
+	return live, nil
 }
 
+// GetPeers returns the peers for the payload CID that have not expired,
+// healthiest first
 func (l *Local) GetPeers(payloadCID cid.Cid) ([]retrievalmarket.RetrievalPeer, error) {
-	entry, err := l.ds.Get(context.TODO(), dshelp.MultihashToDsKey(payloadCID.Hash()))
+	records, err := l.GetPeerRecords(context.TODO(), payloadCID)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]retrievalmarket.RetrievalPeer, 0, len(records))
+	for _, r := range records {
+		peers = append(peers, r.Peer)
+	}
+	return peers, nil
+}
+
+// StreamPeers sends the peers for the payload CID that have not expired on
+// the returned channel, healthiest first
+func (l *Local) StreamPeers(ctx context.Context, payloadCID cid.Cid) (<-chan retrievalmarket.RetrievalPeer, error) {
+	records, err := l.GetPeerRecords(ctx, payloadCID)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan retrievalmarket.RetrievalPeer)
+	go func() {
+		defer close(out)
+		for _, r := range records {
+			select {
+			case out <- r.Peer:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (l *Local) expired(r discovery.PeerRecord, now time.Time) bool {
+	return l.ttl > 0 && now.Sub(time.Unix(0, r.LastSeen)) >= l.ttl
+}
+
+func (l *Local) getRecords(ctx context.Context, key datastore.Key) (*discovery.PeerRecords, error) {
+	entry, err := l.ds.Get(ctx, key)
 	if err == datastore.ErrNotFound {
-		return []retrievalmarket.RetrievalPeer{}, nil
+		return &discovery.PeerRecords{}, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	var peers discovery.RetrievalPeers
-	if err := cborutil.ReadCborRPC(bytes.NewReader(entry), &peers); err != nil {
+	var records discovery.PeerRecords
+	if err := cborutil.ReadCborRPC(bytes.NewReader(entry), &records); err != nil {
 		return nil, err
 	}
-	return peers.Peers, nil
+	return &records, nil
+}
+
+func (l *Local) putRecords(ctx context.Context, key datastore.Key, records *discovery.PeerRecords) error {
+	var buf bytes.Buffer
+	if err := cborutil.WriteCborRPC(&buf, records); err != nil {
+		return err
+	}
+	return l.ds.Put(ctx, key, buf.Bytes())
+}
+
+// filterRecords keeps the records for which keep returns true, deleting the
+// entry if there are none left
+func (l *Local) filterRecords(ctx context.Context, key datastore.Key, records *discovery.PeerRecords, keep func(discovery.PeerRecord) bool) error {
+	kept := records.Peers[:0]
+	for _, r := range records.Peers {
+		if keep(r) {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == len(records.Peers) {
+		return nil
+	}
+	if len(kept) == 0 {
+		return l.ds.Delete(ctx, key)
+	}
+	records.Peers = kept
+	return l.putRecords(ctx, key, records)
+}
+
+// filterAll applies filterRecords to the records of every payload CID
+func (l *Local) filterAll(ctx context.Context, keep func(discovery.PeerRecord) bool) error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	res, err := l.ds.Query(ctx, query.Query{})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		var records discovery.PeerRecords
+		if err := cborutil.ReadCborRPC(bytes.NewReader(entry.Value), &records); err != nil {
+			return err
+		}
+		if err := l.filterRecords(ctx, datastore.NewKey(entry.Key), &records, keep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// samePeer compares peers by value, including their piece CID
+func samePeer(a, b retrievalmarket.RetrievalPeer) bool {
+	return peerKey(a) == peerKey(b)
 }
 
 var _ discovery.PeerResolver = &Local{}
+var _ discovery.PeerStreamer = &Local{}
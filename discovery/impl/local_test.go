@@ -1,15 +1,20 @@
 package discoveryimpl_test
 
 import (
+	"bytes"
 	"context"
 	"testing"
 	"time"
 
+	dshelp "github.com/ipfs/boxo/datastore/dshelp"
 	"github.com/ipfs/go-datastore"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	cborutil "github.com/filecoin-project/go-cbor-util"
+
+	"github.com/filecoin-project/go-fil-markets/discovery"
 	discoveryimpl "github.com/filecoin-project/go-fil-markets/discovery/impl"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-fil-markets/shared_testutil"
@@ -64,3 +69,153 @@ func TestLocal_AddPeer(t *testing.T) {
 		})
 	}
 }
+
+func TestLocal_RemovePeer(t *testing.T) {
+	ctx := context.Background()
+	l := newLocal(ctx, t)
+	payloadCID := shared_testutil.GenerateCids(1)[0]
+	otherCID := shared_testutil.GenerateCids(1)[0]
+	peers := shared_testutil.GeneratePeers(2)
+	peer1 := retrievalmarket.RetrievalPeer{Address: shared_testutil.NewIDAddr(t, 1), ID: peers[0]}
+	peer2 := retrievalmarket.RetrievalPeer{Address: shared_testutil.NewIDAddr(t, 2), ID: peers[1]}
+	require.NoError(t, l.AddPeer(ctx, payloadCID, peer1))
+	require.NoError(t, l.AddPeer(ctx, payloadCID, peer2))
+	require.NoError(t, l.AddPeer(ctx, otherCID, peer1))
+
+	require.NoError(t, l.RemovePeer(ctx, payloadCID, peer2))
+	actualPeers, err := l.GetPeers(payloadCID)
+	require.NoError(t, err)
+	require.Equal(t, []retrievalmarket.RetrievalPeer{peer1}, actualPeers)
+
+	// removing a provider removes it for every payload
+	require.NoError(t, l.RemoveProvider(ctx, peer1.ID))
+	actualPeers, err = l.GetPeers(payloadCID)
+	require.NoError(t, err)
+	require.Empty(t, actualPeers)
+	actualPeers, err = l.GetPeers(otherCID)
+	require.NoError(t, err)
+	require.Empty(t, actualPeers)
+}
+
+func TestLocal_PeerTTL(t *testing.T) {
+	ctx := context.Background()
+	ttl := time.Hour
+	now := time.Now()
+	l := newLocal(ctx, t, discoveryimpl.LocalPeerTTL(ttl), discoveryimpl.LocalClock(func() time.Time { return now }))
+	payloadCID := shared_testutil.GenerateCids(1)[0]
+	peers := shared_testutil.GeneratePeers(2)
+	stale := retrievalmarket.RetrievalPeer{Address: shared_testutil.NewIDAddr(t, 1), ID: peers[0]}
+	fresh := retrievalmarket.RetrievalPeer{Address: shared_testutil.NewIDAddr(t, 2), ID: peers[1]}
+	require.NoError(t, l.AddPeer(ctx, payloadCID, stale))
+	now = now.Add(ttl / 2)
+	require.NoError(t, l.AddPeer(ctx, payloadCID, fresh))
+	now = now.Add(ttl/2 + ttl/4)
+
+	// the stale peer has expired
+	actualPeers, err := l.GetPeers(payloadCID)
+	require.NoError(t, err)
+	require.Equal(t, []retrievalmarket.RetrievalPeer{fresh}, actualPeers)
+
+	// adding the stale peer again marks it as seen
+	require.NoError(t, l.AddPeer(ctx, payloadCID, stale))
+	actualPeers, err = l.GetPeers(payloadCID)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []retrievalmarket.RetrievalPeer{stale, fresh}, actualPeers)
+
+	// expired peers are deleted
+	now = now.Add(ttl / 2)
+	require.NoError(t, l.ExpirePeers(ctx))
+	require.NoError(t, l.RecordRetrieval(ctx, payloadCID, fresh.ID, true))
+	now = now.Add(ttl)
+	require.NoError(t, l.ExpirePeers(ctx))
+	actualPeers, err = l.GetPeers(payloadCID)
+	require.NoError(t, err)
+	require.Empty(t, actualPeers)
+}
+
+func TestLocal_Health(t *testing.T) {
+	ctx := context.Background()
+	l := newLocal(ctx, t)
+	payloadCID := shared_testutil.GenerateCids(1)[0]
+	peers := shared_testutil.GeneratePeers(3)
+	var retrievalPeers []retrievalmarket.RetrievalPeer
+	for i, p := range peers {
+		rp := retrievalmarket.RetrievalPeer{Address: shared_testutil.NewIDAddr(t, uint64(i)), ID: p}
+		require.NoError(t, l.AddPeer(ctx, payloadCID, rp))
+		retrievalPeers = append(retrievalPeers, rp)
+	}
+
+	// the first peer fails, and the last succeeds
+	deal := retrievalmarket.ClientDealState{
+		DealProposal: retrievalmarket.DealProposal{PayloadCID: payloadCID},
+		Sender:       peers[0],
+		Status:       retrievalmarket.DealStatusRejected,
+	}
+	l.OnClientEvent(retrievalmarket.ClientEventDealRejected, deal)
+	deal.Sender = peers[2]
+	deal.Status = retrievalmarket.DealStatusCompleted
+	l.OnClientEvent(retrievalmarket.ClientEventComplete, deal)
+	// events for deals in progress are ignored
+	deal.Sender = peers[1]
+	deal.Status = retrievalmarket.DealStatusOngoing
+	l.OnClientEvent(retrievalmarket.ClientEventBlocksReceived, deal)
+
+	actualPeers, err := l.GetPeers(payloadCID)
+	require.NoError(t, err)
+	require.Equal(t, []retrievalmarket.RetrievalPeer{retrievalPeers[2], retrievalPeers[1], retrievalPeers[0]}, actualPeers)
+
+	records, err := l.GetPeerRecords(ctx, payloadCID)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.EqualValues(t, 1, records[0].Successes)
+	require.NotZero(t, records[0].LastSuccess)
+	require.EqualValues(t, 0, records[1].Successes+records[1].Failures)
+	require.EqualValues(t, 1, records[2].Failures)
+	require.NotZero(t, records[2].LastFailure)
+
+	// peers are streamed in the same order
+	stream, err := l.StreamPeers(ctx, payloadCID)
+	require.NoError(t, err)
+	var streamed []retrievalmarket.RetrievalPeer
+	for p := range stream {
+		streamed = append(streamed, p)
+	}
+	require.Equal(t, actualPeers, streamed)
+}
+
+func newLocal(ctx context.Context, t *testing.T, opts ...discoveryimpl.LocalOption) *discoveryimpl.Local {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	l, err := discoveryimpl.NewLocal(datastore.NewMapDatastore(), opts...)
+	require.NoError(t, err)
+	shared_testutil.StartAndWaitForReady(ctx, t, l)
+	return l
+}
+
+func TestLocal_Migration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	payloadCID := shared_testutil.GenerateCids(1)[0]
+	oldPeer := retrievalmarket.RetrievalPeer{
+		Address: shared_testutil.NewIDAddr(t, 1),
+		ID:      shared_testutil.GeneratePeers(1)[0],
+	}
+
+	// write a list of peers in the version 1 format
+	ds := datastore.NewMapDatastore()
+	var buf bytes.Buffer
+	require.NoError(t, cborutil.WriteCborRPC(&buf, &discovery.RetrievalPeers{Peers: []retrievalmarket.RetrievalPeer{oldPeer}}))
+	oldKey := datastore.NewKey("1").Child(dshelp.MultihashToDsKey(payloadCID.Hash()))
+	require.NoError(t, ds.Put(ctx, oldKey, buf.Bytes()))
+	require.NoError(t, ds.Put(ctx, datastore.NewKey("versions/current"), []byte("1")))
+
+	l, err := discoveryimpl.NewLocal(ds)
+	require.NoError(t, err)
+	shared_testutil.StartAndWaitForReady(ctx, t, l)
+
+	records, err := l.GetPeerRecords(ctx, payloadCID)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, oldPeer, records[0].Peer)
+	require.NotZero(t, records[0].LastSeen)
+}
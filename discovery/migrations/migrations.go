@@ -1,8 +1,29 @@
 package migrations
 
 import (
+	"time"
+
 	"github.com/filecoin-project/go-ds-versioning/pkg/versioned"
+
+	"github.com/filecoin-project/go-fil-markets/discovery"
 )
 
+// MigrateRetrievalPeers1To2 migrates a list of retrieval peers to a list of
+// peer records. The time the peers were added was not recorded, so they are
+// treated as seen at the time of the migration.
+func MigrateRetrievalPeers1To2(oldPeers *discovery.RetrievalPeers) (*discovery.PeerRecords, error) {
+	now := time.Now().UnixNano()
+	records := make([]discovery.PeerRecord, 0, len(oldPeers.Peers))
+	for _, p := range oldPeers.Peers {
+		records = append(records, discovery.PeerRecord{
+			Peer:     p,
+			LastSeen: now,
+		})
+	}
+	return &discovery.PeerRecords{Peers: records}, nil
+}
+
 // RetrievalPeersMigrations are migrations for the store local discovery list of peers we can retrieve from
-var RetrievalPeersMigrations = versioned.BuilderList{}
+var RetrievalPeersMigrations = versioned.BuilderList{
+	versioned.NewVersionedBuilder(MigrateRetrievalPeers1To2, "2").OldVersion("1"),
+}
@@ -1,19 +1,57 @@
 package discovery
 
 import (
+	"context"
+
 	"github.com/ipfs/go-cid"
 
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 )
 
-//go:generate cbor-gen-for --map-encoding RetrievalPeers
+//go:generate cbor-gen-for --map-encoding RetrievalPeers PeerRecord PeerRecords
 
 // RetrievalPeers is a convenience struct for encoding slices of RetrievalPeer
 type RetrievalPeers struct {
 	Peers []retrievalmarket.RetrievalPeer
 }
 
+// PeerRecord is a retrieval peer in the local discovery store, along with
+// when it was seen and how retrievals from it have gone. Times are Unix
+// timestamps in nanoseconds, and zero if the event has not happened.
+type PeerRecord struct {
+	Peer retrievalmarket.RetrievalPeer
+	// LastSeen is the last time the peer was added or a retrieval from it
+	// succeeded
+	LastSeen int64
+	// LastSuccess is the last time a retrieval from the peer succeeded
+	LastSuccess int64
+	// LastFailure is the last time a retrieval from the peer failed
+	LastFailure int64
+	// Successes is the number of retrievals from the peer that succeeded
+	Successes uint64
+	// Failures is the number of retrievals from the peer that failed
+	Failures uint64
+}
+
+// Score is the health of the peer, between 0 and 1, based on the outcome of
+// retrievals from it. A peer without any retrievals scores 0.5.
+func (pr PeerRecord) Score() float64 {
+	return float64(pr.Successes+1) / float64(pr.Successes+pr.Failures+2)
+}
+
+// PeerRecords is a convenience struct for encoding slices of PeerRecord
+type PeerRecords struct {
+	Peers []PeerRecord
+}
+
 // PeerResolver is an interface for looking up providers that may have a piece
 type PeerResolver interface {
-	GetPeers(payloadCID cid.Cid) ([]retrievalmarket.RetrievalPeer, error) // TODO: channel
+	GetPeers(payloadCID cid.Cid) ([]retrievalmarket.RetrievalPeer, error)
+}
+
+// PeerStreamer is implemented by PeerResolvers that can return peers as they
+// are found, rather than all at once. The channel is closed once all peers
+// have been sent, or the context is cancelled.
+type PeerStreamer interface {
+	StreamPeers(ctx context.Context, payloadCID cid.Cid) (<-chan retrievalmarket.RetrievalPeer, error)
 }
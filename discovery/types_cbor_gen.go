@@ -134,3 +134,411 @@ func (t *RetrievalPeers) UnmarshalCBOR(r io.Reader) (err error) {
 
 	return nil
 }
+func (t *PeerRecord) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+
+	cw := cbg.NewCborWriter(w)
+
+	if _, err := cw.Write([]byte{166}); err != nil {
+		return err
+	}
+
+	// t.Peer (retrievalmarket.RetrievalPeer) (struct)
+	if len("Peer") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Peer\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Peer"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Peer")); err != nil {
+		return err
+	}
+
+	if err := t.Peer.MarshalCBOR(cw); err != nil {
+		return err
+	}
+
+	// t.Failures (uint64) (uint64)
+	if len("Failures") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Failures\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Failures"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Failures")); err != nil {
+		return err
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.Failures)); err != nil {
+		return err
+	}
+
+	// t.LastSeen (int64) (int64)
+	if len("LastSeen") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"LastSeen\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("LastSeen"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("LastSeen")); err != nil {
+		return err
+	}
+
+	if t.LastSeen >= 0 {
+		if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.LastSeen)); err != nil {
+			return err
+		}
+	} else {
+		if err := cw.WriteMajorTypeHeader(cbg.MajNegativeInt, uint64(-t.LastSeen-1)); err != nil {
+			return err
+		}
+	}
+
+	// t.Successes (uint64) (uint64)
+	if len("Successes") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Successes\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Successes"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Successes")); err != nil {
+		return err
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.Successes)); err != nil {
+		return err
+	}
+
+	// t.LastFailure (int64) (int64)
+	if len("LastFailure") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"LastFailure\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("LastFailure"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("LastFailure")); err != nil {
+		return err
+	}
+
+	if t.LastFailure >= 0 {
+		if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.LastFailure)); err != nil {
+			return err
+		}
+	} else {
+		if err := cw.WriteMajorTypeHeader(cbg.MajNegativeInt, uint64(-t.LastFailure-1)); err != nil {
+			return err
+		}
+	}
+
+	// t.LastSuccess (int64) (int64)
+	if len("LastSuccess") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"LastSuccess\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("LastSuccess"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("LastSuccess")); err != nil {
+		return err
+	}
+
+	if t.LastSuccess >= 0 {
+		if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.LastSuccess)); err != nil {
+			return err
+		}
+	} else {
+		if err := cw.WriteMajorTypeHeader(cbg.MajNegativeInt, uint64(-t.LastSuccess-1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *PeerRecord) UnmarshalCBOR(r io.Reader) (err error) {
+	*t = PeerRecord{}
+
+	cr := cbg.NewCborReader(r)
+
+	maj, extra, err := cr.ReadHeader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("PeerRecord: map struct too large (%d)", extra)
+	}
+
+	var name string
+	n := extra
+
+	for i := uint64(0); i < n; i++ {
+
+		{
+			sval, err := cbg.ReadString(cr)
+			if err != nil {
+				return err
+			}
+
+			name = string(sval)
+		}
+
+		switch name {
+		// t.Peer (retrievalmarket.RetrievalPeer) (struct)
+		case "Peer":
+
+			{
+
+				if err := t.Peer.UnmarshalCBOR(cr); err != nil {
+					return xerrors.Errorf("unmarshaling t.Peer: %w", err)
+				}
+
+			}
+			// t.Failures (uint64) (uint64)
+		case "Failures":
+
+			{
+
+				maj, extra, err = cr.ReadHeader()
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.Failures = uint64(extra)
+
+			}
+			// t.LastSeen (int64) (int64)
+		case "LastSeen":
+			{
+				maj, extra, err := cr.ReadHeader()
+				var extraI int64
+				if err != nil {
+					return err
+				}
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative overflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.LastSeen = int64(extraI)
+			}
+			// t.Successes (uint64) (uint64)
+		case "Successes":
+
+			{
+
+				maj, extra, err = cr.ReadHeader()
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.Successes = uint64(extra)
+
+			}
+			// t.LastFailure (int64) (int64)
+		case "LastFailure":
+			{
+				maj, extra, err := cr.ReadHeader()
+				var extraI int64
+				if err != nil {
+					return err
+				}
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative overflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.LastFailure = int64(extraI)
+			}
+			// t.LastSuccess (int64) (int64)
+		case "LastSuccess":
+			{
+				maj, extra, err := cr.ReadHeader()
+				var extraI int64
+				if err != nil {
+					return err
+				}
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative overflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.LastSuccess = int64(extraI)
+			}
+
+		default:
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
+		}
+	}
+
+	return nil
+}
+func (t *PeerRecords) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+
+	cw := cbg.NewCborWriter(w)
+
+	if _, err := cw.Write([]byte{161}); err != nil {
+		return err
+	}
+
+	// t.Peers ([]discovery.PeerRecord) (slice)
+	if len("Peers") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Peers\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Peers"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Peers")); err != nil {
+		return err
+	}
+
+	if len(t.Peers) > cbg.MaxLength {
+		return xerrors.Errorf("Slice value in field t.Peers was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajArray, uint64(len(t.Peers))); err != nil {
+		return err
+	}
+	for _, v := range t.Peers {
+		if err := v.MarshalCBOR(cw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *PeerRecords) UnmarshalCBOR(r io.Reader) (err error) {
+	*t = PeerRecords{}
+
+	cr := cbg.NewCborReader(r)
+
+	maj, extra, err := cr.ReadHeader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("PeerRecords: map struct too large (%d)", extra)
+	}
+
+	var name string
+	n := extra
+
+	for i := uint64(0); i < n; i++ {
+
+		{
+			sval, err := cbg.ReadString(cr)
+			if err != nil {
+				return err
+			}
+
+			name = string(sval)
+		}
+
+		switch name {
+		// t.Peers ([]discovery.PeerRecord) (slice)
+		case "Peers":
+
+			maj, extra, err = cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+
+			if extra > cbg.MaxLength {
+				return fmt.Errorf("t.Peers: array too large (%d)", extra)
+			}
+
+			if maj != cbg.MajArray {
+				return fmt.Errorf("expected cbor array")
+			}
+
+			if extra > 0 {
+				t.Peers = make([]PeerRecord, extra)
+			}
+
+			for i := 0; i < int(extra); i++ {
+
+				var v PeerRecord
+				if err := v.UnmarshalCBOR(cr); err != nil {
+					return err
+				}
+
+				t.Peers[i] = v
+			}
+
+		default:
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
+		}
+	}
+
+	return nil
+}
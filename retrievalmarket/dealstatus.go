@@ -136,6 +136,16 @@ const (
 	// DealStatusFinalizingBlockstore means that all blocks have been received,
 	// and the blockstore is being finalized
 	DealStatusFinalizingBlockstore
+
+	// DealStatusIncomplete means that the provider completed the deal, but
+	// the client's blockstore does not hold all the blocks selected by the
+	// deal, or some of the blocks are corrupt
+	DealStatusIncomplete
+
+	// DealStatusUnsealQueued is sent by a provider while an accepted deal is
+	// waiting for its piece to be unsealed. The response message holds the
+	// deal's position in the provider's unseal queue.
+	DealStatusUnsealQueued
 )
 
 // DealStatuses maps deal status to a human readable representation
@@ -175,6 +185,8 @@ var DealStatuses = map[DealStatus]string{
 	DealStatusRejecting:                        "DealStatusRejecting",
 	DealStatusDealNotFoundCleanup:              "DealStatusDealNotFoundCleanup",
 	DealStatusFinalizingBlockstore:             "DealStatusFinalizingBlockstore",
+	DealStatusIncomplete:                       "DealStatusIncomplete",
+	DealStatusUnsealQueued:                     "DealStatusUnsealQueued",
 }
 
 func (s DealStatus) String() string {
@@ -138,6 +138,30 @@ const (
 	// ClientEventFinalizeBlockstoreErrored is fired when there is an error
 	// finalizing the blockstore
 	ClientEventFinalizeBlockstoreErrored
+
+	// ClientEventUnsealQueued is fired when the provider reports the deal's
+	// position in its queue of pieces waiting to be unsealed
+	ClientEventUnsealQueued
+
+	// ClientEventBudgetExceeded is fired when a payment would exceed the
+	// client's spending budget
+	ClientEventBudgetExceeded
+
+	// ClientEventAutoTopUpStarted is fired when the client automatically adds
+	// funds to the payment channel to cover a shortfall
+	ClientEventAutoTopUpStarted
+
+	// ClientEventAutoTopUpDeclined is fired when a shortfall is not covered
+	// automatically because it is outside the limits of the top-up policy
+	ClientEventAutoTopUpDeclined
+
+	// ClientEventAutoTopUpErrored is fired when the client fails to add funds
+	// to the payment channel automatically
+	ClientEventAutoTopUpErrored
+
+	// ClientEventBlockstoreIncomplete is fired when verifying the blockstore
+	// after all blocks have been received finds missing or corrupt blocks
+	ClientEventBlockstoreIncomplete
 )
 
 // ClientEvents is a human readable map of client event name -> event description
@@ -181,6 +205,12 @@ var ClientEvents = map[ClientEvent]string{
 	ClientEventPaymentNotSent:                "ClientEventPaymentNotSent",
 	ClientEventBlockstoreFinalized:           "ClientEventBlockstoreFinalized",
 	ClientEventFinalizeBlockstoreErrored:     "ClientEventFinalizeBlockstoreErrored",
+	ClientEventUnsealQueued:                  "ClientEventUnsealQueued",
+	ClientEventBudgetExceeded:                "ClientEventBudgetExceeded",
+	ClientEventAutoTopUpStarted:              "ClientEventAutoTopUpStarted",
+	ClientEventAutoTopUpDeclined:             "ClientEventAutoTopUpDeclined",
+	ClientEventAutoTopUpErrored:              "ClientEventAutoTopUpErrored",
+	ClientEventBlockstoreIncomplete:          "ClientEventBlockstoreIncomplete",
 }
 
 func (e ClientEvent) String() string {
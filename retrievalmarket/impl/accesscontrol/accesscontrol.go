@@ -0,0 +1,262 @@
+// Package accesscontrol decides which peers may query a retrieval provider,
+// and which data they may retrieve from it.
+//
+// A Policy has
+//   - a deny list of peers, which may not query or retrieve anything
+//   - an allow list of peers. If it is not empty, only the peers on it may
+//     query or retrieve anything.
+//   - access control lists (ACLs) on payloads and pieces. Data with an ACL
+//     is only served to the peers on the ACL, and to clients that present an
+//     access token signed by one of the owners on the ACL. Data without an
+//     ACL is served to any peer the lists allow.
+//
+// Data owners create access tokens with SignToken and hand them to the
+// clients they authorise, which send them in retrievalmarket.QueryParams and
+// retrievalmarket.Params.
+package accesscontrol
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/crypto"
+
+	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/shared"
+)
+
+// ErrDenied is returned when a peer may not query or retrieve the data
+var ErrDenied = errors.New("access denied")
+
+// Verifier verifies the signatures of access tokens. It is implemented by
+// storagemarket.StorageCommon.
+type Verifier interface {
+	VerifySignature(ctx context.Context, signature crypto.Signature, signer address.Address, plaintext []byte, tok shared.TipSetToken) (bool, error)
+}
+
+// SignFunc signs bytes with the key of an address
+type SignFunc func(ctx context.Context, signer address.Address, b []byte) (*crypto.Signature, error)
+
+// SignToken signs an access token with the key of its signer
+func SignToken(ctx context.Context, token rm.AccessToken, sign SignFunc) (*rm.AccessToken, error) {
+	if token.PayloadCID == nil && token.PieceCID == nil {
+		return nil, xerrors.New("access token must name a payload or a piece")
+	}
+	b, err := token.SigningBytes()
+	if err != nil {
+		return nil, xerrors.Errorf("serializing access token: %w", err)
+	}
+	sig, err := sign(ctx, token.Signer, b)
+	if err != nil {
+		return nil, xerrors.Errorf("signing access token: %w", err)
+	}
+	token.Signature = sig
+	return &token, nil
+}
+
+// ACL is an access control list on a payload or piece
+type ACL struct {
+	// Peers are the peers that may retrieve the data
+	Peers []peer.ID
+	// Owners are the addresses whose access tokens authorise retrieving the
+	// data
+	Owners []address.Address
+}
+
+// Policy decides which peers may query the provider and retrieve which
+// data. A policy with no lists and no ACLs allows everything.
+type Policy struct {
+	verifier Verifier
+	now      func() time.Time
+
+	lk          sync.RWMutex
+	allowed     map[peer.ID]struct{}
+	denied      map[peer.ID]struct{}
+	payloadACLs map[cid.Cid]ACL
+	pieceACLs   map[cid.Cid]ACL
+}
+
+// NewPolicy returns a policy that allows everything, which verifies access
+// tokens with the given verifier. If the verifier is nil, access tokens are
+// not accepted.
+func NewPolicy(verifier Verifier) *Policy {
+	return &Policy{
+		verifier:    verifier,
+		now:         time.Now,
+		allowed:     make(map[peer.ID]struct{}),
+		denied:      make(map[peer.ID]struct{}),
+		payloadACLs: make(map[cid.Cid]ACL),
+		pieceACLs:   make(map[cid.Cid]ACL),
+	}
+}
+
+// Allow adds peers to the allow list. While the allow list is not empty,
+// only the peers on it may query or retrieve.
+func (p *Policy) Allow(peers ...peer.ID) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	for _, pid := range peers {
+		p.allowed[pid] = struct{}{}
+	}
+}
+
+// RemoveAllowed removes peers from the allow list
+func (p *Policy) RemoveAllowed(peers ...peer.ID) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	for _, pid := range peers {
+		delete(p.allowed, pid)
+	}
+}
+
+// Deny adds peers to the deny list. Peers on the deny list may not query or
+// retrieve, even if they are on the allow list.
+func (p *Policy) Deny(peers ...peer.ID) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	for _, pid := range peers {
+		p.denied[pid] = struct{}{}
+	}
+}
+
+// RemoveDenied removes peers from the deny list
+func (p *Policy) RemoveDenied(peers ...peer.ID) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	for _, pid := range peers {
+		delete(p.denied, pid)
+	}
+}
+
+// SetPayloadACL sets the ACL of a payload, replacing any it had
+func (p *Policy) SetPayloadACL(payloadCid cid.Cid, acl ACL) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.payloadACLs[payloadCid] = acl
+}
+
+// RemovePayloadACL removes the ACL of a payload
+func (p *Policy) RemovePayloadACL(payloadCid cid.Cid) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	delete(p.payloadACLs, payloadCid)
+}
+
+// SetPieceACL sets the ACL of a piece, which applies to every payload in the
+// piece, replacing any it had
+func (p *Policy) SetPieceACL(pieceCid cid.Cid, acl ACL) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.pieceACLs[pieceCid] = acl
+}
+
+// RemovePieceACL removes the ACL of a piece
+func (p *Policy) RemovePieceACL(pieceCid cid.Cid) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	delete(p.pieceACLs, pieceCid)
+}
+
+// CheckPeer returns ErrDenied if the lists don't allow the peer to query or
+// retrieve anything
+func (p *Policy) CheckPeer(client peer.ID) error {
+	p.lk.RLock()
+	defer p.lk.RUnlock()
+	return p.checkPeer(client)
+}
+
+func (p *Policy) checkPeer(client peer.ID) error {
+	if _, ok := p.denied[client]; ok {
+		return ErrDenied
+	}
+	if len(p.allowed) == 0 {
+		return nil
+	}
+	if _, ok := p.allowed[client]; !ok {
+		return ErrDenied
+	}
+	return nil
+}
+
+// Check returns an error wrapping ErrDenied if the peer may not retrieve the
+// payload from the piece. The token is the access token the peer presented,
+// if any.
+func (p *Policy) Check(ctx context.Context, client peer.ID, payloadCid cid.Cid, pieceCid cid.Cid, token *rm.AccessToken) error {
+	p.lk.RLock()
+	err := p.checkPeer(client)
+	payloadACL, hasPayloadACL := p.payloadACLs[payloadCid]
+	pieceACL, hasPieceACL := p.pieceACLs[pieceCid]
+	p.lk.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// the peer must be authorised by every ACL on the data
+	if hasPayloadACL {
+		if err := p.checkACL(ctx, payloadACL, client, payloadCid, pieceCid, token); err != nil {
+			return xerrors.Errorf("payload %s: %w", payloadCid, err)
+		}
+	}
+	if hasPieceACL {
+		if err := p.checkACL(ctx, pieceACL, client, payloadCid, pieceCid, token); err != nil {
+			return xerrors.Errorf("piece %s: %w", pieceCid, err)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) checkACL(ctx context.Context, acl ACL, client peer.ID, payloadCid cid.Cid, pieceCid cid.Cid, token *rm.AccessToken) error {
+	for _, pid := range acl.Peers {
+		if pid == client {
+			return nil
+		}
+	}
+	if token == nil {
+		return ErrDenied
+	}
+	for _, owner := range acl.Owners {
+		if owner == token.Signer {
+			return p.checkToken(ctx, token, client, payloadCid, pieceCid)
+		}
+	}
+	return xerrors.Errorf("access token is not signed by an owner of the data: %w", ErrDenied)
+}
+
+func (p *Policy) checkToken(ctx context.Context, token *rm.AccessToken, client peer.ID, payloadCid cid.Cid, pieceCid cid.Cid) error {
+	switch {
+	case token.PayloadCID == nil && token.PieceCID == nil:
+		return xerrors.Errorf("access token names no data: %w", ErrDenied)
+	case token.PayloadCID != nil && !token.PayloadCID.Equals(payloadCid):
+		return xerrors.Errorf("access token is for another payload: %w", ErrDenied)
+	case token.PieceCID != nil && !token.PieceCID.Equals(pieceCid):
+		return xerrors.Errorf("access token is for another piece: %w", ErrDenied)
+	case token.Client != "" && token.Client != client:
+		return xerrors.Errorf("access token is for another peer: %w", ErrDenied)
+	case p.now().Unix() >= token.Expiration:
+		return xerrors.Errorf("access token expired: %w", ErrDenied)
+	case token.Signature == nil:
+		return xerrors.Errorf("access token is not signed: %w", ErrDenied)
+	case p.verifier == nil:
+		return xerrors.Errorf("access tokens are not accepted: %w", ErrDenied)
+	}
+
+	b, err := token.SigningBytes()
+	if err != nil {
+		return xerrors.Errorf("serializing access token: %w", err)
+	}
+	valid, err := p.verifier.VerifySignature(ctx, *token.Signature, token.Signer, b, nil)
+	if err != nil {
+		return xerrors.Errorf("verifying access token signature: %w", err)
+	}
+	if !valid {
+		return xerrors.Errorf("access token signature is invalid: %w", ErrDenied)
+	}
+	return nil
+}
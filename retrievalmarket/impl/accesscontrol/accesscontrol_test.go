@@ -0,0 +1,148 @@
+package accesscontrol_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/crypto"
+
+	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/accesscontrol"
+	"github.com/filecoin-project/go-fil-markets/shared"
+)
+
+func TestPeerLists(t *testing.T) {
+	ctx := context.Background()
+	payload, piece := testCid(t, "payload"), testCid(t, "piece")
+	alice, bob := peer.ID("alice"), peer.ID("bob")
+
+	policy := accesscontrol.NewPolicy(fakeVerifier{})
+	require.NoError(t, policy.CheckPeer(alice))
+	require.NoError(t, policy.Check(ctx, alice, payload, piece, nil))
+
+	policy.Deny(alice)
+	require.ErrorIs(t, policy.CheckPeer(alice), accesscontrol.ErrDenied)
+	require.ErrorIs(t, policy.Check(ctx, alice, payload, piece, nil), accesscontrol.ErrDenied)
+	require.NoError(t, policy.CheckPeer(bob))
+
+	// the deny list wins over the allow list
+	policy.Allow(alice)
+	require.ErrorIs(t, policy.CheckPeer(alice), accesscontrol.ErrDenied)
+	policy.RemoveDenied(alice)
+	require.NoError(t, policy.CheckPeer(alice))
+
+	// only peers on a non-empty allow list are allowed
+	require.ErrorIs(t, policy.CheckPeer(bob), accesscontrol.ErrDenied)
+	policy.RemoveAllowed(alice)
+	require.NoError(t, policy.CheckPeer(bob))
+}
+
+func TestACLs(t *testing.T) {
+	ctx := context.Background()
+	payload, otherPayload, piece := testCid(t, "payload"), testCid(t, "other payload"), testCid(t, "piece")
+	alice, bob := peer.ID("alice"), peer.ID("bob")
+	owner, stranger := testAddress(t, "owner"), testAddress(t, "stranger")
+
+	policy := accesscontrol.NewPolicy(fakeVerifier{})
+	policy.SetPayloadACL(payload, accesscontrol.ACL{Peers: []peer.ID{alice}, Owners: []address.Address{owner}})
+
+	require.NoError(t, policy.Check(ctx, alice, payload, piece, nil))
+	require.ErrorIs(t, policy.Check(ctx, bob, payload, piece, nil), accesscontrol.ErrDenied)
+	// data without an ACL is not restricted
+	require.NoError(t, policy.Check(ctx, bob, otherPayload, piece, nil))
+
+	sign := func(token rm.AccessToken) *rm.AccessToken {
+		signed, err := accesscontrol.SignToken(ctx, token, fakeSign)
+		require.NoError(t, err)
+		return signed
+	}
+	expiration := time.Now().Add(time.Hour).Unix()
+
+	t.Run("valid token", func(t *testing.T) {
+		token := sign(rm.AccessToken{PayloadCID: &payload, Expiration: expiration, Signer: owner})
+		require.NoError(t, policy.Check(ctx, bob, payload, piece, token))
+
+		token = sign(rm.AccessToken{PayloadCID: &payload, Client: bob, Expiration: expiration, Signer: owner})
+		require.NoError(t, policy.Check(ctx, bob, payload, piece, token))
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		for name, token := range map[string]*rm.AccessToken{
+			"not signed by an owner": sign(rm.AccessToken{PayloadCID: &payload, Expiration: expiration, Signer: stranger}),
+			"for another payload":    sign(rm.AccessToken{PayloadCID: &otherPayload, Expiration: expiration, Signer: owner}),
+			"for another piece":      sign(rm.AccessToken{PayloadCID: &payload, PieceCID: &otherPayload, Expiration: expiration, Signer: owner}),
+			"for another peer":       sign(rm.AccessToken{PayloadCID: &payload, Client: alice, Expiration: expiration, Signer: owner}),
+			"expired":                sign(rm.AccessToken{PayloadCID: &payload, Expiration: time.Now().Add(-time.Minute).Unix(), Signer: owner}),
+			"not signed":             {PayloadCID: &payload, Expiration: expiration, Signer: owner},
+		} {
+			require.ErrorIs(t, policy.Check(ctx, bob, payload, piece, token), accesscontrol.ErrDenied, name)
+		}
+
+		// a token that is changed after it is signed is not valid
+		token := sign(rm.AccessToken{PayloadCID: &payload, Client: alice, Expiration: expiration, Signer: owner})
+		token.Client = bob
+		require.ErrorIs(t, policy.Check(ctx, bob, payload, piece, token), accesscontrol.ErrDenied)
+	})
+
+	t.Run("piece ACL", func(t *testing.T) {
+		pieceOwner := testAddress(t, "piece owner")
+		policy.SetPieceACL(piece, accesscontrol.ACL{Owners: []address.Address{pieceOwner}})
+		defer policy.RemovePieceACL(piece)
+
+		// a peer must be authorised by the ACLs of both the payload and the
+		// piece
+		require.ErrorIs(t, policy.Check(ctx, alice, payload, piece, nil), accesscontrol.ErrDenied)
+		token := sign(rm.AccessToken{PieceCID: &piece, Expiration: expiration, Signer: pieceOwner})
+		require.NoError(t, policy.Check(ctx, alice, payload, piece, token))
+		require.NoError(t, policy.Check(ctx, bob, otherPayload, piece, token))
+		require.ErrorIs(t, policy.Check(ctx, bob, payload, piece, token), accesscontrol.ErrDenied)
+	})
+
+	t.Run("removed ACL", func(t *testing.T) {
+		policy.RemovePayloadACL(payload)
+		require.NoError(t, policy.Check(ctx, bob, payload, piece, nil))
+	})
+}
+
+func TestSignTokenRequiresData(t *testing.T) {
+	_, err := accesscontrol.SignToken(context.Background(), rm.AccessToken{Signer: testAddress(t, "owner")}, fakeSign)
+	require.Error(t, err)
+}
+
+func testCid(t *testing.T, data string) cid.Cid {
+	c, err := cid.V1Builder{Codec: cid.Raw, MhType: multihash.SHA2_256}.Sum([]byte(data))
+	require.NoError(t, err)
+	return c
+}
+
+func testAddress(t *testing.T, name string) address.Address {
+	addr, err := address.NewSecp256k1Address([]byte(name))
+	require.NoError(t, err)
+	return addr
+}
+
+// fakeSign signs with a hash of the signer and the bytes, which fakeVerifier
+// checks
+func fakeSign(_ context.Context, signer address.Address, b []byte) (*crypto.Signature, error) {
+	return &crypto.Signature{Type: crypto.SigTypeSecp256k1, Data: fakeSignature(signer, b)}, nil
+}
+
+func fakeSignature(signer address.Address, b []byte) []byte {
+	sum := sha256.Sum256(append(signer.Bytes(), b...))
+	return sum[:]
+}
+
+type fakeVerifier struct{}
+
+func (fakeVerifier) VerifySignature(_ context.Context, signature crypto.Signature, signer address.Address, plaintext []byte, _ shared.TipSetToken) (bool, error) {
+	return bytes.Equal(signature.Data, fakeSignature(signer, plaintext)), nil
+}
@@ -0,0 +1,359 @@
+// Package budget limits how much a retrieval client may spend on retrieval
+// deals.
+//
+// A Manager enforces per-deal limits on the price per byte and unseal price,
+// and per-wallet limits on the funds committed to in-progress deals and on
+// the funds committed or spent within a rolling time window.
+// When a deal is proposed, its total funds are reserved against the wallet's
+// budget. If a deal later needs to pay more than it reserved, the extra funds
+// are reserved before each payment is made; if that would exceed the budget,
+// the deal is paused in the DealStatusInsufficientFunds state until the
+// budget allows it to continue.
+//
+// The Manager keeps its accounting in memory. In-progress deals are
+// re-registered when the client restarts, but spending by deals that finished
+// before the restart is not counted towards the time window.
+package budget
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+
+	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+)
+
+// ErrBudgetExceeded is returned when a deal or payment would exceed a budget
+var ErrBudgetExceeded = errors.New("retrieval budget exceeded")
+
+// Limits are the spending limits for a wallet.
+// A limit that is left unset (a nil token amount) is not enforced.
+type Limits struct {
+	// MaxCommitted is the maximum amount of funds that may be committed to
+	// in-progress deals at any one time
+	MaxCommitted abi.TokenAmount
+	// MaxPerWindow is the maximum amount of funds that may be committed to
+	// deals started within Window
+	MaxPerWindow abi.TokenAmount
+	// Window is the length of the rolling time window for MaxPerWindow
+	Window time.Duration
+	// MaxPricePerByte is the maximum price per byte a single deal may pay
+	MaxPricePerByte abi.TokenAmount
+	// MaxUnsealPrice is the maximum unseal price a single deal may pay
+	MaxUnsealPrice abi.TokenAmount
+}
+
+// Usage summarizes the funds committed and spent by a wallet
+type Usage struct {
+	// Committed is the funds reserved by in-progress deals
+	Committed abi.TokenAmount
+	// Spent is the funds paid to providers by deals tracked by the manager
+	Spent abi.TokenAmount
+	// WindowUsed is the amount counted against the MaxPerWindow limit:
+	// funds reserved by in-progress deals and funds spent by completed
+	// deals that started within the window
+	WindowUsed abi.TokenAmount
+	// ActiveDeals is the number of in-progress deals
+	ActiveDeals int
+}
+
+type reservation struct {
+	wallet   address.Address
+	start    time.Time
+	reserved abi.TokenAmount
+	spent    abi.TokenAmount
+	done     bool
+}
+
+// windowAmount is the amount a deal counts towards the time window:
+// everything it reserved while it is in progress, and what it actually spent
+// once it has finished
+func (r *reservation) windowAmount() abi.TokenAmount {
+	if r.done {
+		return r.spent
+	}
+	return big.Max(r.reserved, r.spent)
+}
+
+// Manager tracks the funds committed and spent by retrieval deals and
+// enforces spending limits on them
+type Manager struct {
+	lk       sync.Mutex
+	defaults Limits
+	limits   map[address.Address]Limits
+	deals    map[rm.DealID]*reservation
+	spent    map[address.Address]abi.TokenAmount
+	now      func() time.Time
+}
+
+// NewManager returns a new Manager that applies the given limits to every
+// wallet that does not have its own limits
+func NewManager(defaults Limits) *Manager {
+	return &Manager{
+		defaults: defaults,
+		limits:   make(map[address.Address]Limits),
+		deals:    make(map[rm.DealID]*reservation),
+		spent:    make(map[address.Address]abi.TokenAmount),
+		now:      time.Now,
+	}
+}
+
+// SetWalletLimits sets the limits for a single wallet, overriding the
+// defaults. Lowering a limit does not affect funds that are already reserved.
+func (m *Manager) SetWalletLimits(wallet address.Address, limits Limits) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.limits[wallet] = limits
+}
+
+// WalletLimits returns the limits that apply to a wallet
+func (m *Manager) WalletLimits(wallet address.Address) Limits {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	return m.walletLimits(wallet)
+}
+
+// Reserve checks a new deal against the per-deal limits, and reserves the
+// deal's total funds against its wallet's budget.
+// It returns an error wrapping ErrBudgetExceeded if the deal is not allowed.
+func (m *Manager) Reserve(deal rm.ClientDealState) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if r, ok := m.deals[deal.ID]; ok && !r.done {
+		return xerrors.Errorf("deal %d already has a reservation", deal.ID)
+	}
+
+	limits := m.walletLimits(deal.ClientWallet)
+	if isSet(limits.MaxPricePerByte) && deal.PricePerByte.GreaterThan(limits.MaxPricePerByte) {
+		return xerrors.Errorf("price per byte %s is above maximum %s: %w",
+			deal.PricePerByte, limits.MaxPricePerByte, ErrBudgetExceeded)
+	}
+	if isSet(limits.MaxUnsealPrice) && deal.UnsealPrice.GreaterThan(limits.MaxUnsealPrice) {
+		return xerrors.Errorf("unseal price %s is above maximum %s: %w",
+			deal.UnsealPrice, limits.MaxUnsealPrice, ErrBudgetExceeded)
+	}
+
+	amount := fundsOrZero(deal.TotalFunds)
+	if err := m.checkAvailable(deal.ClientWallet, limits, amount); err != nil {
+		return err
+	}
+	m.deals[deal.ID] = &reservation{
+		wallet:   deal.ClientWallet,
+		start:    m.now(),
+		reserved: amount,
+		spent:    big.Zero(),
+	}
+	return nil
+}
+
+// Authorize is called before a deal makes a payment that brings the total
+// funds it has spent up to total. If total is more than the deal has
+// reserved, the difference is reserved against the wallet's budget.
+// It returns an error wrapping ErrBudgetExceeded if the extra funds are not
+// available.
+func (m *Manager) Authorize(deal rm.ClientDealState, total abi.TokenAmount) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	r := m.track(deal)
+	if total.LessThanEqual(r.reserved) {
+		return nil
+	}
+
+	extra := big.Sub(total, r.reserved)
+	if err := m.checkAvailable(r.wallet, m.walletLimits(r.wallet), extra); err != nil {
+		return xerrors.Errorf("payment of %s for deal %d: %w", total, deal.ID, err)
+	}
+	r.reserved = total
+	return nil
+}
+
+// Track registers an in-progress deal without checking it against any
+// limits, eg when the client restarts
+func (m *Manager) Track(deal rm.ClientDealState) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.track(deal)
+}
+
+// Release is called when a deal finishes. Funds the deal reserved but did
+// not spend become available to other deals.
+func (m *Manager) Release(deal rm.ClientDealState) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	r, ok := m.deals[deal.ID]
+	if !ok || r.done {
+		return
+	}
+	m.recordSpend(r, fundsOrZero(deal.FundsSpent))
+	r.done = true
+	m.prune()
+}
+
+// OnClientEvent keeps the manager up to date with the funds spent by deals.
+// It is a retrievalmarket.ClientSubscriber.
+func (m *Manager) OnClientEvent(event rm.ClientEvent, deal rm.ClientDealState) {
+	if finished(deal.Status) {
+		m.Release(deal)
+		return
+	}
+	if event != rm.ClientEventPaymentSent {
+		return
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	r, ok := m.deals[deal.ID]
+	if !ok || r.done {
+		return
+	}
+	m.recordSpend(r, fundsOrZero(deal.FundsSpent))
+}
+
+// Usage returns the funds committed and spent by a wallet
+func (m *Manager) Usage(wallet address.Address) Usage {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	m.prune()
+	usage := Usage{
+		Committed:  m.committed(wallet),
+		Spent:      big.Zero(),
+		WindowUsed: m.windowUsed(wallet, m.walletLimits(wallet)),
+	}
+	if spent, ok := m.spent[wallet]; ok {
+		usage.Spent = spent
+	}
+	for _, r := range m.deals {
+		if r.wallet == wallet && !r.done {
+			usage.ActiveDeals++
+		}
+	}
+	return usage
+}
+
+// checkAvailable checks that amount can be reserved for the wallet.
+// It must be called with the lock held.
+func (m *Manager) checkAvailable(wallet address.Address, limits Limits, amount abi.TokenAmount) error {
+	if isSet(limits.MaxCommitted) {
+		committed := big.Add(m.committed(wallet), amount)
+		if committed.GreaterThan(limits.MaxCommitted) {
+			return xerrors.Errorf("committed funds %s would be above maximum %s: %w",
+				committed, limits.MaxCommitted, ErrBudgetExceeded)
+		}
+	}
+	if isSet(limits.MaxPerWindow) {
+		used := big.Add(m.windowUsed(wallet, limits), amount)
+		if used.GreaterThan(limits.MaxPerWindow) {
+			return xerrors.Errorf("funds used in the last %s %s would be above maximum %s: %w",
+				limits.Window, used, limits.MaxPerWindow, ErrBudgetExceeded)
+		}
+	}
+	return nil
+}
+
+// track returns the reservation for a deal, creating one if the manager
+// has not seen the deal before.
+// It must be called with the lock held.
+func (m *Manager) track(deal rm.ClientDealState) *reservation {
+	r, ok := m.deals[deal.ID]
+	if ok {
+		return r
+	}
+	spent := fundsOrZero(deal.FundsSpent)
+	r = &reservation{
+		wallet:   deal.ClientWallet,
+		start:    m.now(),
+		reserved: big.Max(fundsOrZero(deal.TotalFunds), spent),
+		spent:    big.Zero(),
+	}
+	m.deals[deal.ID] = r
+	m.recordSpend(r, spent)
+	return r
+}
+
+// recordSpend updates the funds spent by a deal to the deal's current
+// FundsSpent.
+// It must be called with the lock held.
+func (m *Manager) recordSpend(r *reservation, spent abi.TokenAmount) {
+	if spent.LessThanEqual(r.spent) {
+		return
+	}
+	total, ok := m.spent[r.wallet]
+	if !ok {
+		total = big.Zero()
+	}
+	m.spent[r.wallet] = big.Add(total, big.Sub(spent, r.spent))
+	r.spent = spent
+}
+
+func (m *Manager) committed(wallet address.Address) abi.TokenAmount {
+	committed := big.Zero()
+	for _, r := range m.deals {
+		if r.wallet == wallet && !r.done {
+			committed = big.Add(committed, r.reserved)
+		}
+	}
+	return committed
+}
+
+func (m *Manager) windowUsed(wallet address.Address, limits Limits) abi.TokenAmount {
+	used := big.Zero()
+	since := m.now().Add(-limits.Window)
+	for _, r := range m.deals {
+		if r.wallet != wallet {
+			continue
+		}
+		if r.done && !r.start.After(since) {
+			continue
+		}
+		used = big.Add(used, r.windowAmount())
+	}
+	return used
+}
+
+// prune removes finished deals that no longer count towards any time window.
+// It must be called with the lock held.
+func (m *Manager) prune() {
+	now := m.now()
+	for id, r := range m.deals {
+		if r.done && !r.start.After(now.Add(-m.walletLimits(r.wallet).Window)) {
+			delete(m.deals, id)
+		}
+	}
+}
+
+func (m *Manager) walletLimits(wallet address.Address) Limits {
+	if limits, ok := m.limits[wallet]; ok {
+		return limits
+	}
+	return m.defaults
+}
+
+// finished returns true if a deal with the given status will not make any
+// more payments
+func finished(status rm.DealStatus) bool {
+	return rm.IsTerminalStatus(status) ||
+		status == rm.DealStatusErrored ||
+		status == rm.DealStatusCancelling ||
+		status == rm.DealStatusCancelled
+}
+
+func isSet(amount abi.TokenAmount) bool {
+	return amount.Int != nil
+}
+
+func fundsOrZero(amount abi.TokenAmount) abi.TokenAmount {
+	if amount.Int == nil {
+		return big.Zero()
+	}
+	return amount
+}
@@ -0,0 +1,120 @@
+package budget
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+
+	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+)
+
+func TestManager(t *testing.T) {
+	wallet, err := address.NewIDAddress(100)
+	require.NoError(t, err)
+
+	newDeal := func(id rm.DealID, totalFunds int64) rm.ClientDealState {
+		return rm.ClientDealState{
+			DealProposal: rm.DealProposal{
+				ID: id,
+				Params: rm.Params{
+					PricePerByte: abi.NewTokenAmount(1),
+					UnsealPrice:  abi.NewTokenAmount(0),
+				},
+			},
+			ClientWallet: wallet,
+			TotalFunds:   abi.NewTokenAmount(totalFunds),
+			FundsSpent:   big.Zero(),
+			Status:       rm.DealStatusOngoing,
+		}
+	}
+
+	t.Run("per-deal price limits", func(t *testing.T) {
+		m := NewManager(Limits{
+			MaxPricePerByte: abi.NewTokenAmount(1),
+			MaxUnsealPrice:  abi.NewTokenAmount(10),
+		})
+
+		deal := newDeal(1, 100)
+		deal.PricePerByte = abi.NewTokenAmount(2)
+		require.ErrorIs(t, m.Reserve(deal), ErrBudgetExceeded)
+
+		deal = newDeal(2, 100)
+		deal.UnsealPrice = abi.NewTokenAmount(11)
+		require.ErrorIs(t, m.Reserve(deal), ErrBudgetExceeded)
+
+		require.NoError(t, m.Reserve(newDeal(3, 100)))
+	})
+
+	t.Run("committed funds limit", func(t *testing.T) {
+		m := NewManager(Limits{MaxCommitted: abi.NewTokenAmount(150)})
+		deal1 := newDeal(1, 100)
+		require.NoError(t, m.Reserve(deal1))
+		require.ErrorIs(t, m.Reserve(newDeal(2, 100)), ErrBudgetExceeded)
+
+		// once the first deal completes having spent only part of its
+		// funds, the rest become available again
+		deal1.FundsSpent = abi.NewTokenAmount(60)
+		deal1.Status = rm.DealStatusCompleted
+		m.OnClientEvent(rm.ClientEventComplete, deal1)
+		require.NoError(t, m.Reserve(newDeal(2, 100)))
+
+		usage := m.Usage(wallet)
+		require.Equal(t, abi.NewTokenAmount(100), usage.Committed)
+		require.Equal(t, abi.NewTokenAmount(60), usage.Spent)
+		require.Equal(t, 1, usage.ActiveDeals)
+	})
+
+	t.Run("time window limit", func(t *testing.T) {
+		now := time.Now()
+		m := NewManager(Limits{MaxPerWindow: abi.NewTokenAmount(150), Window: time.Hour})
+		m.now = func() time.Time { return now }
+
+		deal1 := newDeal(1, 100)
+		require.NoError(t, m.Reserve(deal1))
+		deal1.FundsSpent = abi.NewTokenAmount(100)
+		deal1.Status = rm.DealStatusCompleted
+		m.OnClientEvent(rm.ClientEventComplete, deal1)
+
+		// the completed deal still counts towards the window
+		require.ErrorIs(t, m.Reserve(newDeal(2, 100)), ErrBudgetExceeded)
+		require.Equal(t, abi.NewTokenAmount(100), m.Usage(wallet).WindowUsed)
+
+		now = now.Add(time.Hour + time.Second)
+		require.NoError(t, m.Reserve(newDeal(2, 100)))
+		require.Equal(t, abi.NewTokenAmount(100), m.Usage(wallet).WindowUsed)
+	})
+
+	t.Run("payments above the reserved funds", func(t *testing.T) {
+		m := NewManager(Limits{MaxCommitted: abi.NewTokenAmount(150)})
+		deal := newDeal(1, 100)
+		require.NoError(t, m.Reserve(deal))
+
+		require.NoError(t, m.Authorize(deal, abi.NewTokenAmount(100)))
+		require.NoError(t, m.Authorize(deal, abi.NewTokenAmount(150)))
+		require.ErrorIs(t, m.Authorize(deal, abi.NewTokenAmount(151)), ErrBudgetExceeded)
+
+		// raising the limit allows the deal to continue
+		m.SetWalletLimits(wallet, Limits{MaxCommitted: abi.NewTokenAmount(200)})
+		require.NoError(t, m.Authorize(deal, abi.NewTokenAmount(151)))
+		require.Equal(t, abi.NewTokenAmount(151), m.Usage(wallet).Committed)
+	})
+
+	t.Run("tracks spending of deals it has not seen", func(t *testing.T) {
+		m := NewManager(Limits{})
+		deal := newDeal(1, 100)
+		deal.FundsSpent = abi.NewTokenAmount(40)
+		m.Track(deal)
+
+		deal.FundsSpent = abi.NewTokenAmount(70)
+		m.OnClientEvent(rm.ClientEventPaymentSent, deal)
+
+		usage := m.Usage(wallet)
+		require.Equal(t, abi.NewTokenAmount(100), usage.Committed)
+		require.Equal(t, abi.NewTokenAmount(70), usage.Spent)
+	})
+}
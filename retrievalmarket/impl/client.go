@@ -10,8 +10,10 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipld/go-ipld-prime/datamodel"
 	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-address"
 	datatransfer "github.com/filecoin-project/go-data-transfer/v2"
@@ -23,11 +25,15 @@ import (
 
 	"github.com/filecoin-project/go-fil-markets/discovery"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/budget"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/clientstates"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/donotsend"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/dtutils"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/verify"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/migrations"
 	rmnet "github.com/filecoin-project/go-fil-markets/retrievalmarket/network"
 	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/shared/retention"
 )
 
 var log = logging.Logger("retrieval")
@@ -45,11 +51,32 @@ type Client struct {
 	stateMachines        fsm.Group
 	migrateStateMachines func(context.Context) error
 	bstores              retrievalmarket.BlockstoreAccessor
+	budget               *budget.Manager
+	topUps               *autoTopUps
+	doNotSend            *donotsend.Exchange
+	verifyBlockstores    bool
+	archive              *retention.Archive
+	retentionPolicy      retention.Policy
+	retention            *retention.Manager
 
 	// Guards concurrent access to Retrieve method
 	retrieveLk sync.Mutex
 }
 
+// RetrievalClientOption is a function that configures a retrieval client
+type RetrievalClientOption func(c *Client)
+
+// BudgetManagerOpt limits how much the client may spend on retrieval deals.
+// Deals that would exceed the budget are rejected when they are proposed, or
+// paused in the DealStatusInsufficientFunds state if a payment would exceed
+// the budget. Paused deals can be resumed with TryRestartInsufficientFunds
+// once there is budget for them.
+func BudgetManagerOpt(m *budget.Manager) RetrievalClientOption {
+	return func(c *Client) {
+		c.budget = m
+	}
+}
+
 type internalEvent struct {
 	evt   retrievalmarket.ClientEvent
 	state retrievalmarket.ClientDealState
@@ -71,6 +98,48 @@ func dispatcher(evt pubsub.Event, subscriberFn pubsub.SubscriberFn) error {
 
 var _ retrievalmarket.RetrievalClient = &Client{}
 
+// AutoTopUpOpt makes the client add funds to a deal's payment channel
+// automatically when the deal runs out of funds, within the limits of the
+// given policy. Deals that are waiting for funds when the client starts are
+// restarted.
+func AutoTopUpOpt(policy AutoTopUpPolicy) RetrievalClientOption {
+	return func(c *Client) {
+		c.topUps = newAutoTopUps(policy)
+	}
+}
+
+// DoNotSendOpt makes the client ask providers not to send the blocks of a
+// deal that are already in the deal's blockstore, eg after an earlier partial
+// retrieval or when the transfer is restarted. The exchange must wrap the graphsync instance used by the
+// client's data transfer manager.
+func DoNotSendOpt(e *donotsend.Exchange) RetrievalClientOption {
+	return func(c *Client) {
+		c.doNotSend = e
+	}
+}
+
+// VerifyBlockstoreOpt makes the client walk the deal's selector over the
+// deal's blockstore once all blocks have been received, checking that every
+// block is present and matches its CID. Deals that are missing blocks, or
+// have corrupt blocks, end in the DealStatusIncomplete state rather than
+// DealStatusCompleted.
+func VerifyBlockstoreOpt() RetrievalClientOption {
+	return func(c *Client) {
+		c.verifyBlockstores = true
+	}
+}
+
+// ClientRetentionOpt moves deals that have been in a terminal state for
+// longer than the policy's maximum age from the client's deal store to the
+// archive. Archived deals are no longer returned by ListDeals, but can still
+// be looked up with GetDeal.
+func ClientRetentionOpt(archive *retention.Archive, policy retention.Policy) RetrievalClientOption {
+	return func(c *Client) {
+		c.archive = archive
+		c.retentionPolicy = policy
+	}
+}
+
 // NewClient creates a new retrieval client
 func NewClient(
 	network rmnet.RetrievalMarketNetwork,
@@ -79,6 +148,7 @@ func NewClient(
 	resolver discovery.PeerResolver,
 	ds datastore.Batching,
 	ba retrievalmarket.BlockstoreAccessor,
+	opts ...RetrievalClientOption,
 ) (retrievalmarket.RetrievalClient, error) {
 	c := &Client{
 		network:      network,
@@ -90,6 +160,15 @@ func NewClient(
 		readySub:     pubsub.New(shared.ReadyDispatcher),
 		bstores:      ba,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.budget != nil {
+		c.subscribers.Subscribe(retrievalmarket.ClientSubscriber(c.budget.OnClientEvent))
+	}
+	if c.doNotSend != nil {
+		c.subscribers.Subscribe(retrievalmarket.ClientSubscriber(c.clearDoNotSend))
+	}
 	retrievalMigrations, err := migrations.ClientMigrations.Build()
 	if err != nil {
 		return nil, err
@@ -106,6 +185,10 @@ func NewClient(
 	if err != nil {
 		return nil, err
 	}
+	if c.archive != nil {
+		c.retention = retention.NewManager(c.archive, c.stateMachines, c.retentionDeals, c.retentionPolicy)
+		c.stateMachines = c.archive.Group(c.stateMachines)
+	}
 	err = dataTransfer.RegisterVoucherType(retrievalmarket.DealProposalType, nil)
 	if err != nil {
 		return nil, err
@@ -135,6 +218,16 @@ func (c *Client) Start(ctx context.Context) error {
 			log.Errorf("Migrating retrieval client state machines: %s", err.Error())
 		}
 
+		if err == nil && c.budget != nil {
+			c.trackBudget()
+		}
+		if err == nil && c.topUps != nil {
+			c.restartInsufficientFunds()
+		}
+		if err == nil && c.retention != nil {
+			c.retention.Start()
+		}
+
 		err = c.readySub.Publish(err)
 		if err != nil {
 			log.Warnf("Publish retrieval client ready event: %s", err.Error())
@@ -143,6 +236,57 @@ func (c *Client) Start(ctx context.Context) error {
 	return nil
 }
 
+// trackBudget registers in-progress deals with the budget manager, so that
+// their funds count towards the budget after a restart
+func (c *Client) trackBudget() {
+	var deals []retrievalmarket.ClientDealState
+	if err := c.stateMachines.List(&deals); err != nil {
+		log.Errorf("listing retrieval deals for budget: %s", err)
+		return
+	}
+	for _, deal := range deals {
+		if !clientstates.IsFinalityState(deal.Status) {
+			c.budget.Track(deal)
+		}
+	}
+}
+
+// restartInsufficientFunds rechecks the funds of deals that were waiting for
+// funds to be added, so that they can be topped up automatically
+func (c *Client) restartInsufficientFunds() {
+	var deals []retrievalmarket.ClientDealState
+	if err := c.stateMachines.List(&deals); err != nil {
+		log.Errorf("listing retrieval deals to top up: %s", err)
+		return
+	}
+	for _, deal := range deals {
+		if deal.Status != retrievalmarket.DealStatusInsufficientFunds {
+			continue
+		}
+		if err := c.stateMachines.Send(deal.ID, retrievalmarket.ClientEventRecheckFunds); err != nil {
+			log.Errorf("restarting retrieval deal %d: %s", deal.ID, err)
+		}
+	}
+}
+
+// retentionDeals lists the deals in the live deal store for the retention
+// manager
+func (c *Client) retentionDeals() ([]retention.Deal, error) {
+	var deals []retrievalmarket.ClientDealState
+	if err := c.stateMachines.List(&deals); err != nil {
+		return nil, err
+	}
+	out := make([]retention.Deal, 0, len(deals))
+	for i := range deals {
+		out = append(out, retention.Deal{
+			ID:       deals[i].ID,
+			Terminal: clientstates.IsFinalityState(deals[i].Status),
+			State:    &deals[i],
+		})
+	}
+	return out, nil
+}
+
 // OnReady registers a listener for when the client has finished starting up
 func (c *Client) OnReady(ready shared.ReadyFunc) {
 	c.readySub.Subscribe(ready)
@@ -263,11 +407,22 @@ func (c *Client) Retrieve(
 		Status:           retrievalmarket.DealStatusNew,
 		Sender:           p.ID,
 		UnsealFundsPaid:  big.Zero(),
+		AutoTopUpAdded:   big.Zero(),
+	}
+
+	// reserve the deal's funds against the spending budget
+	if c.budget != nil {
+		if err := c.budget.Reserve(dealState); err != nil {
+			return 0, err
+		}
 	}
 
 	// start the deal processing
 	err = c.stateMachines.Begin(dealState.ID, &dealState)
 	if err != nil {
+		if c.budget != nil {
+			c.budget.Release(dealState)
+		}
 		return 0, err
 	}
 
@@ -279,6 +434,14 @@ func (c *Client) Retrieve(
 	return id, nil
 }
 
+// clearDoNotSend forgets the blocks a provider was asked not to send once
+// the deal is finished
+func (c *Client) clearDoNotSend(evt retrievalmarket.ClientEvent, state retrievalmarket.ClientDealState) {
+	if clientstates.IsFinalityState(state.Status) {
+		c.doNotSend.Clear(state.Sender, state.PayloadCID)
+	}
+}
+
 func (c *Client) notifySubscribers(eventName fsm.EventName, state fsm.StateType) {
 	evt := eventName.(retrievalmarket.ClientEvent)
 	ds := state.(retrievalmarket.ClientDealState)
@@ -370,10 +533,26 @@ func (c *clientDealEnvironment) OpenDataTransfer(ctx context.Context, to peer.ID
 	if proposal.SelectorSpecified() {
 		sel = proposal.Selector.Node
 	}
+	if c.c.doNotSend != nil {
+		if err := c.skipLocalBlocks(to, proposal, sel); err != nil {
+			return datatransfer.ChannelID{}, err
+		}
+	}
 	vouch := retrievalmarket.BindnodeRegistry.TypeToNode(proposal)
 	return c.c.dataTransfer.OpenPullDataChannel(ctx, to, datatransfer.TypedVoucher{Voucher: vouch, Type: retrievalmarket.DealProposalType}, proposal.PayloadCID, sel)
 }
 
+// skipLocalBlocks asks the provider not to send the blocks that the deal's
+// blockstore already has
+func (c *clientDealEnvironment) skipLocalBlocks(to peer.ID, proposal *retrievalmarket.DealProposal, sel datamodel.Node) error {
+	bs, err := c.c.bstores.Get(proposal.ID, proposal.PayloadCID)
+	if err != nil {
+		return xerrors.Errorf("getting blockstore for deal %d: %w", proposal.ID, err)
+	}
+	c.c.doNotSend.Track(to, proposal.PayloadCID, bs, sel)
+	return nil
+}
+
 func (c *clientDealEnvironment) SendDataTransferVoucher(ctx context.Context, channelID datatransfer.ChannelID, payment *retrievalmarket.DealPayment) error {
 	vouch := retrievalmarket.BindnodeRegistry.TypeToNode(payment)
 	return c.c.dataTransfer.SendVoucher(ctx, channelID, datatransfer.TypedVoucher{Voucher: vouch, Type: retrievalmarket.DealPaymentType})
@@ -399,6 +578,46 @@ func (c *clientDealEnvironment) FinalizeBlockstore(ctx context.Context, dealID r
 	return c.c.bstores.Done(dealID)
 }
 
+// AuthorizePayment checks a payment against the client's spending budget
+func (c *clientDealEnvironment) AuthorizePayment(ctx context.Context, deal retrievalmarket.ClientDealState, total abi.TokenAmount) error {
+	if c.c.budget == nil {
+		return nil
+	}
+	return c.c.budget.Authorize(deal, total)
+}
+
+// AutoTopUpAmount returns the amount to add to the payment channel to cover
+// a shortfall, according to the client's automatic top-up policy
+func (c *clientDealEnvironment) AutoTopUpAmount(deal retrievalmarket.ClientDealState, shortfall abi.TokenAmount) (abi.TokenAmount, error) {
+	if c.c.topUps == nil {
+		return big.Zero(), nil
+	}
+	return c.c.topUps.amount(deal, shortfall)
+}
+
+// VerifyBlockstore checks that the deal's blockstore holds all the blocks
+// selected by the deal, if blockstore verification is enabled
+func (c *clientDealEnvironment) VerifyBlockstore(ctx context.Context, deal retrievalmarket.ClientDealState) error {
+	if !c.c.verifyBlockstores {
+		return nil
+	}
+	bs, err := c.c.bstores.Get(deal.ID, deal.PayloadCID)
+	if err != nil {
+		return xerrors.Errorf("getting blockstore: %w", err)
+	}
+	sel := selectorparse.CommonSelector_ExploreAllRecursively
+	if deal.SelectorSpecified() {
+		sel = deal.Selector.Node
+	}
+	res, err := verify.Blockstore(ctx, bs, deal.PayloadCID, sel)
+	if err != nil {
+		return err
+	}
+	log.Infow("verified retrieval blockstore", "deal", deal.ID, "blocks", res.Blocks,
+		"missing", len(res.Missing), "corrupt", len(res.Corrupt))
+	return res.Err()
+}
+
 type clientStoreGetter struct {
 	c *Client
 }
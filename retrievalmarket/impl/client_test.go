@@ -498,6 +498,7 @@ func TestMigrations(t *testing.T) {
 			WaitMsgCID:       nil,
 			VoucherShortfall: voucherShortfalls[i],
 			LegacyProtocol:   true,
+			AutoTopUpAdded:   big.Zero(),
 		}
 		require.Equal(t, expectedDeal, deal)
 	}
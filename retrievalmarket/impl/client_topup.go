@@ -0,0 +1,66 @@
+package retrievalimpl
+
+import (
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+)
+
+// AutoTopUpPolicy configures how the client adds funds to a payment channel
+// automatically when a deal runs out of funds, instead of waiting for
+// TryRestartInsufficientFunds to be called.
+// A limit that is left unset (a nil token amount) is not enforced.
+type AutoTopUpPolicy struct {
+	// MinTopUp is the smallest amount added in a single top-up. Adding more
+	// than the shortfall reduces the number of top-ups a long retrieval needs.
+	MinTopUp abi.TokenAmount
+	// MaxTopUp is the largest amount added in a single top-up. Shortfalls
+	// above this amount are left for the user to cover.
+	MaxTopUp abi.TokenAmount
+	// MaxPerDeal is the most that is added automatically over the lifetime
+	// of a deal
+	MaxPerDeal abi.TokenAmount
+}
+
+// autoTopUps applies an AutoTopUpPolicy. The amount added automatically to
+// each deal is kept in the deal state, so that the per-deal limit holds
+// across restarts.
+type autoTopUps struct {
+	policy AutoTopUpPolicy
+}
+
+func newAutoTopUps(policy AutoTopUpPolicy) *autoTopUps {
+	return &autoTopUps{policy: policy}
+}
+
+// amount returns the amount to add to the payment channel to cover the
+// deal's shortfall, within the limits of the policy
+func (a *autoTopUps) amount(deal retrievalmarket.ClientDealState, shortfall abi.TokenAmount) (abi.TokenAmount, error) {
+	if a.policy.MaxTopUp.Int != nil && shortfall.GreaterThan(a.policy.MaxTopUp) {
+		return big.Zero(), xerrors.Errorf("shortfall is above maximum top-up of %s", a.policy.MaxTopUp)
+	}
+
+	amount := shortfall
+	if a.policy.MinTopUp.Int != nil {
+		amount = big.Max(amount, a.policy.MinTopUp)
+	}
+	if a.policy.MaxTopUp.Int != nil {
+		amount = big.Min(amount, a.policy.MaxTopUp)
+	}
+
+	if a.policy.MaxPerDeal.Int != nil {
+		added := deal.AutoTopUpAdded
+		if added.Nil() {
+			added = big.Zero()
+		}
+		remaining := big.Sub(a.policy.MaxPerDeal, added)
+		if shortfall.GreaterThan(remaining) {
+			return big.Zero(), xerrors.Errorf("deal has already had %s of maximum %s added automatically", added, a.policy.MaxPerDeal)
+		}
+		amount = big.Min(amount, remaining)
+	}
+	return amount, nil
+}
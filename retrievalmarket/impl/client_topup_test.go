@@ -0,0 +1,64 @@
+package retrievalimpl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+)
+
+func TestAutoTopUps(t *testing.T) {
+	deal := retrievalmarket.ClientDealState{DealProposal: retrievalmarket.DealProposal{ID: 1}}
+
+	t.Run("tops up at least the minimum", func(t *testing.T) {
+		a := newAutoTopUps(AutoTopUpPolicy{MinTopUp: abi.NewTokenAmount(100)})
+		amount, err := a.amount(deal, abi.NewTokenAmount(10))
+		require.NoError(t, err)
+		require.Equal(t, abi.NewTokenAmount(100), amount)
+
+		amount, err = a.amount(deal, abi.NewTokenAmount(150))
+		require.NoError(t, err)
+		require.Equal(t, abi.NewTokenAmount(150), amount)
+	})
+
+	t.Run("declines shortfalls above the maximum top-up", func(t *testing.T) {
+		a := newAutoTopUps(AutoTopUpPolicy{
+			MinTopUp: abi.NewTokenAmount(100),
+			MaxTopUp: abi.NewTokenAmount(50),
+		})
+		amount, err := a.amount(deal, abi.NewTokenAmount(10))
+		require.NoError(t, err)
+		require.Equal(t, abi.NewTokenAmount(50), amount)
+
+		_, err = a.amount(deal, abi.NewTokenAmount(51))
+		require.Error(t, err)
+	})
+
+	t.Run("limits the total per deal", func(t *testing.T) {
+		a := newAutoTopUps(AutoTopUpPolicy{
+			MinTopUp:   abi.NewTokenAmount(100),
+			MaxPerDeal: abi.NewTokenAmount(150),
+		})
+		amount, err := a.amount(deal, abi.NewTokenAmount(10))
+		require.NoError(t, err)
+		require.Equal(t, abi.NewTokenAmount(100), amount)
+
+		// only the remaining 50 can be added
+		deal.AutoTopUpAdded = abi.NewTokenAmount(100)
+		amount, err = a.amount(deal, abi.NewTokenAmount(10))
+		require.NoError(t, err)
+		require.Equal(t, abi.NewTokenAmount(50), amount)
+
+		deal.AutoTopUpAdded = abi.NewTokenAmount(150)
+		_, err = a.amount(deal, abi.NewTokenAmount(10))
+		require.Error(t, err)
+
+		// the total is read from the deal state, so the limit holds after a
+		// restart
+		_, err = newAutoTopUps(a.policy).amount(deal, abi.NewTokenAmount(10))
+		require.Error(t, err)
+	})
+}
@@ -68,6 +68,12 @@ var ClientEvents = fsm.Events{
 		}),
 	fsm.Event(rm.ClientEventDealAccepted).
 		FromMany(rm.DealStatusWaitForAcceptance, rm.DealStatusWaitForAcceptanceLegacy).To(rm.DealStatusAccepted),
+	fsm.Event(rm.ClientEventUnsealQueued).
+		FromAny().ToJustRecord().
+		Action(func(deal *rm.ClientDealState, message string) error {
+			deal.Message = message
+			return nil
+		}),
 	fsm.Event(rm.ClientEventUnknownResponseReceived).
 		FromAny().To(rm.DealStatusFailing).
 		Action(func(deal *rm.ClientDealState, status rm.DealStatus) error {
@@ -236,6 +242,40 @@ var ClientEvents = fsm.Events{
 			deal.Message = fmt.Sprintf("not enough current or pending funds in payment channel, shortfall of %s", shortfall.String())
 			return nil
 		}),
+	fsm.Event(rm.ClientEventAutoTopUpStarted).
+		From(rm.DealStatusCheckFunds).To(rm.DealStatusPaymentChannelAddingFunds).
+		Action(func(deal *rm.ClientDealState, amount abi.TokenAmount, msgCID cid.Cid, payCh address.Address) error {
+			deal.WaitMsgCID = &msgCID
+			if deal.PaymentInfo == nil {
+				deal.PaymentInfo = &rm.PaymentInfo{
+					PayCh: payCh,
+				}
+			}
+			if deal.AutoTopUpAdded.Nil() {
+				deal.AutoTopUpAdded = big.Zero()
+			}
+			deal.AutoTopUpAdded = big.Add(deal.AutoTopUpAdded, amount)
+			deal.Message = fmt.Sprintf("automatically adding %s to payment channel to cover shortfall", amount.String())
+			return nil
+		}),
+	fsm.Event(rm.ClientEventAutoTopUpDeclined).
+		From(rm.DealStatusCheckFunds).To(rm.DealStatusInsufficientFunds).
+		Action(func(deal *rm.ClientDealState, shortfall abi.TokenAmount, err error) error {
+			deal.Message = xerrors.Errorf("not enough funds in payment channel, shortfall of %s not added automatically: %w", shortfall.String(), err).Error()
+			return nil
+		}),
+	fsm.Event(rm.ClientEventAutoTopUpErrored).
+		From(rm.DealStatusCheckFunds).To(rm.DealStatusInsufficientFunds).
+		Action(func(deal *rm.ClientDealState, err error) error {
+			deal.Message = xerrors.Errorf("adding funds to payment channel automatically: %w", err).Error()
+			return nil
+		}),
+	fsm.Event(rm.ClientEventBudgetExceeded).
+		FromMany(rm.DealStatusSendFunds, rm.DealStatusSendFundsLastPayment).To(rm.DealStatusInsufficientFunds).
+		Action(func(deal *rm.ClientDealState, err error) error {
+			deal.Message = xerrors.Errorf("payment not authorized: %w", err).Error()
+			return nil
+		}),
 	fsm.Event(rm.ClientEventBadPaymentRequested).
 		FromMany(rm.DealStatusSendFunds, rm.DealStatusSendFundsLastPayment).To(rm.DealStatusFailing).
 		Action(func(deal *rm.ClientDealState, message string) error {
@@ -251,6 +291,7 @@ var ClientEvents = fsm.Events{
 	fsm.Event(rm.ClientEventVoucherShortfall).
 		FromMany(rm.DealStatusSendFunds, rm.DealStatusSendFundsLastPayment).To(rm.DealStatusCheckFunds).
 		Action(func(deal *rm.ClientDealState, shortfall abi.TokenAmount) error {
+			deal.VoucherShortfall = shortfall
 			return nil
 		}),
 
@@ -286,6 +327,7 @@ var ClientEvents = fsm.Events{
 
 			// Update the total funds sent to the provider
 			deal.FundsSpent = voucherAmt
+			deal.VoucherShortfall = big.Zero()
 
 			// If the unseal price hasn't yet been met, set the unseal funds
 			// paid to the amount sent to the provider
@@ -357,6 +399,14 @@ var ClientEvents = fsm.Events{
 			return nil
 		}),
 
+	// Verifying the blockstore found missing or corrupt blocks
+	fsm.Event(rm.ClientEventBlockstoreIncomplete).
+		From(rm.DealStatusFinalizingBlockstore).To(rm.DealStatusIncomplete).
+		Action(func(deal *rm.ClientDealState, err error) error {
+			deal.Message = xerrors.Errorf("verifying blockstore: %w", err).Error()
+			return nil
+		}),
+
 	// after cancelling a deal is complete
 	fsm.Event(rm.ClientEventCancelComplete).
 		From(rm.DealStatusFailing).To(rm.DealStatusErrored).
@@ -393,6 +443,7 @@ var ClientFinalityStates = []fsm.StateKey{
 	rm.DealStatusCancelled,
 	rm.DealStatusRejected,
 	rm.DealStatusDealNotFound,
+	rm.DealStatusIncomplete,
 }
 
 func IsFinalityState(st fsm.StateKey) bool {
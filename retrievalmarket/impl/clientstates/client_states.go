@@ -27,6 +27,18 @@ type ClientDealEnvironment interface {
 	SendDataTransferVoucher(context.Context, datatransfer.ChannelID, *rm.DealPayment) error
 	CloseDataTransfer(context.Context, datatransfer.ChannelID) error
 	FinalizeBlockstore(context.Context, rm.DealID) error
+	// AuthorizePayment checks that the deal may spend a total of the given
+	// amount against the client's spending budget
+	AuthorizePayment(context.Context, rm.ClientDealState, abi.TokenAmount) error
+	// AutoTopUpAmount returns the amount of funds to add to the payment
+	// channel automatically to cover a shortfall. It returns zero if
+	// automatic top-ups are disabled, and an error if the shortfall is
+	// outside the limits of the top-up policy.
+	AutoTopUpAmount(rm.ClientDealState, abi.TokenAmount) (abi.TokenAmount, error)
+	// VerifyBlockstore checks that the deal's blockstore holds all the
+	// blocks selected by the deal. It returns an error describing the
+	// missing or corrupt blocks if it doesn't.
+	VerifyBlockstore(context.Context, rm.ClientDealState) error
 }
 
 // ProposeDeal sends the proposal to the other party
@@ -166,6 +178,13 @@ func SendFunds(ctx fsm.Context, environment ClientDealEnvironment, deal rm.Clien
 		return ctx.Trigger(rm.ClientEventPaymentNotSent)
 	}
 
+	// Check that the payment is within the client's spending budget. If not,
+	// pause the deal until there is budget for it
+	if err := environment.AuthorizePayment(ctx.Context(), deal, totalPrice); err != nil {
+		log.Debugf("client: not sending voucher for %d: %s", totalPrice, err)
+		return ctx.Trigger(rm.ClientEventBudgetExceeded, err)
+	}
+
 	log.Debugf("client: sending voucher for %d = transfer price %d + unseal price %d (payment requested %d)",
 		totalPrice, transferPrice, deal.UnsealPrice, deal.PaymentRequested)
 
@@ -217,11 +236,45 @@ func CheckFunds(ctx fsm.Context, environment ClientDealEnvironment, deal rm.Clie
 	totalInFlight := big.Add(availableFunds.PendingAmt, availableFunds.QueuedAmt)
 	if totalInFlight.LessThan(shortfall) || availableFunds.PendingWaitSentinel == nil {
 		finalShortfall := big.Sub(shortfall, totalInFlight)
-		return ctx.Trigger(rm.ClientEventFundsExpended, finalShortfall)
+		return autoTopUp(ctx, environment, deal, finalShortfall)
 	}
 	return ctx.Trigger(rm.ClientEventPaymentChannelAddingFunds, *availableFunds.PendingWaitSentinel, deal.PaymentInfo.PayCh)
 }
 
+// autoTopUp adds funds to the payment channel to cover a shortfall, if the
+// client has an automatic top-up policy. Otherwise the deal waits for funds
+// to be added manually.
+func autoTopUp(ctx fsm.Context, environment ClientDealEnvironment, deal rm.ClientDealState, shortfall abi.TokenAmount) error {
+	// The shortfall reported when creating the voucher is more accurate than
+	// the one calculated from the available funds, so use it if it's larger
+	if !deal.VoucherShortfall.Nil() && deal.VoucherShortfall.GreaterThan(shortfall) {
+		shortfall = deal.VoucherShortfall
+	}
+
+	amount, err := environment.AutoTopUpAmount(deal, shortfall)
+	if err != nil {
+		return ctx.Trigger(rm.ClientEventAutoTopUpDeclined, shortfall, err)
+	}
+	if amount.IsZero() {
+		return ctx.Trigger(rm.ClientEventFundsExpended, shortfall)
+	}
+
+	tok, _, err := environment.Node().GetChainHead(ctx.Context())
+	if err != nil {
+		return ctx.Trigger(rm.ClientEventAutoTopUpErrored, err)
+	}
+
+	paych, msgCID, err := environment.Node().GetOrCreatePaymentChannel(ctx.Context(), deal.ClientWallet, deal.MinerWallet, amount, tok)
+	if err != nil {
+		return ctx.Trigger(rm.ClientEventAutoTopUpErrored, err)
+	}
+
+	if msgCID == cid.Undef {
+		return ctx.Trigger(rm.ClientEventPaymentChannelReady, paych)
+	}
+	return ctx.Trigger(rm.ClientEventAutoTopUpStarted, amount, msgCID, paych)
+}
+
 // CancelDeal clears a deal that went wrong for an unknown reason
 func CancelDeal(ctx fsm.Context, environment ClientDealEnvironment, deal rm.ClientDealState) error {
 	// Attempt to finalize the blockstore. If it fails just log an error as
@@ -266,11 +319,17 @@ func CheckComplete(ctx fsm.Context, environment ClientDealEnvironment, deal rm.C
 }
 
 // FinalizeBlockstore is called once all blocks have been received and the
-// blockstore needs to be finalized before completing the deal
+// blockstore needs to be finalized before completing the deal. The
+// blockstore is verified before it is finalized, as it may no longer be
+// readable afterwards.
 func FinalizeBlockstore(ctx fsm.Context, environment ClientDealEnvironment, deal rm.ClientDealState) error {
+	verifyErr := environment.VerifyBlockstore(ctx.Context(), deal)
 	if err := environment.FinalizeBlockstore(ctx.Context(), deal.ID); err != nil {
 		return ctx.Trigger(rm.ClientEventFinalizeBlockstoreErrored, err)
 	}
+	if verifyErr != nil {
+		return ctx.Trigger(rm.ClientEventBlockstoreIncomplete, verifyErr)
+	}
 	return ctx.Trigger(rm.ClientEventBlockstoreFinalized)
 }
 
@@ -38,6 +38,10 @@ type fakeEnvironment struct {
 	SendDataTransferVoucherError error
 	CloseDataTransferError       error
 	FinalizeBlockstoreError      error
+	VerifyBlockstoreError        error
+	AuthorizePaymentError        error
+	AutoTopUp                    abi.TokenAmount
+	AutoTopUpError               error
 }
 
 func (e *fakeEnvironment) Node() retrievalmarket.RetrievalClientNode {
@@ -60,6 +64,21 @@ func (e *fakeEnvironment) FinalizeBlockstore(ctx context.Context, id rm.DealID)
 	return e.FinalizeBlockstoreError
 }
 
+func (e *fakeEnvironment) VerifyBlockstore(_ context.Context, _ rm.ClientDealState) error {
+	return e.VerifyBlockstoreError
+}
+
+func (e *fakeEnvironment) AuthorizePayment(_ context.Context, _ rm.ClientDealState, _ abi.TokenAmount) error {
+	return e.AuthorizePaymentError
+}
+
+func (e *fakeEnvironment) AutoTopUpAmount(_ rm.ClientDealState, _ abi.TokenAmount) (abi.TokenAmount, error) {
+	if e.AutoTopUp.Nil() {
+		return big.Zero(), e.AutoTopUpError
+	}
+	return e.AutoTopUp, e.AutoTopUpError
+}
+
 func TestProposeDeal(t *testing.T) {
 	ctx := context.Background()
 	node := testnodes.NewTestRetrievalClientNode(testnodes.TestRetrievalClientNodeParams{})
@@ -634,6 +653,30 @@ func TestSendFunds(t *testing.T) {
 		require.NotEmpty(t, dealState.Message)
 		require.Equal(t, dealState.Status, retrievalmarket.DealStatusErroring)
 	})
+
+	t.Run("payment exceeds budget", func(t *testing.T) {
+		dealState := makeDealState(retrievalmarket.DealStatusSendFunds)
+		dealState.PricePerByte = abi.NewTokenAmount(1)
+		dealState.UnsealPrice = abi.NewTokenAmount(0)
+		dealState.UnsealFundsPaid = abi.NewTokenAmount(0)
+		dealState.BytesPaidFor = 0
+		dealState.FundsSpent = abi.NewTokenAmount(0)
+		dealState.PaymentRequested = abi.NewTokenAmount(1000)
+		dealState.CurrentInterval = 1000
+		dealState.TotalReceived = 1000
+		dealState.ChannelID = &datatransfer.ChannelID{Initiator: "initiator", Responder: dealState.Sender, ID: 1}
+
+		node := testnodes.NewTestRetrievalClientNode(testnodes.TestRetrievalClientNodeParams{Voucher: testVoucher})
+		environment := &fakeEnvironment{node: node, AuthorizePaymentError: errors.New("budget exceeded")}
+		fsmCtx := fsmtest.NewTestContext(ctx, eventMachine)
+		err := clientstates.SendFunds(fsmCtx, environment, *dealState)
+		require.NoError(t, err)
+		fsmCtx.ReplayEvents(t, dealState)
+
+		require.Contains(t, dealState.Message, "budget exceeded")
+		require.Equal(t, abi.NewTokenAmount(0), dealState.FundsSpent)
+		require.Equal(t, retrievalmarket.DealStatusInsufficientFunds, dealState.Status)
+	})
 }
 
 func TestCheckFunds(t *testing.T) {
@@ -699,6 +742,58 @@ func TestCheckFunds(t *testing.T) {
 		runCheckFunds(t, nodeParams, dealState)
 		require.Equal(t, dealState.Status, retrievalmarket.DealStatusInsufficientFunds)
 	})
+
+	runAutoTopUp := func(t *testing.T,
+		params testnodes.TestRetrievalClientNodeParams,
+		environment *fakeEnvironment,
+		dealState *retrievalmarket.ClientDealState) {
+		environment.node = testnodes.NewTestRetrievalClientNode(params)
+		fsmCtx := fsmtest.NewTestContext(ctx, eventMachine)
+		err := clientstates.CheckFunds(fsmCtx, environment, *dealState)
+		require.NoError(t, err)
+		fsmCtx.ReplayEvents(t, dealState)
+	}
+	payCh := address.TestAddress
+
+	t.Run("shortfall topped up automatically", func(t *testing.T) {
+		dealState := makeDealState(retrievalmarket.DealStatusCheckFunds)
+		dealState.PaymentRequested = abi.NewTokenAmount(10000)
+		var fundsAdded abi.TokenAmount
+		nodeParams := testnodes.TestRetrievalClientNodeParams{
+			AddFundsOnly: true,
+			PayCh:        payCh,
+			AddFundsCID:  msgCid,
+			PaymentChannelRecorder: func(_ address.Address, _ address.Address, amt abi.TokenAmount) {
+				fundsAdded = amt
+			},
+		}
+		runAutoTopUp(t, nodeParams, &fakeEnvironment{AutoTopUp: abi.NewTokenAmount(12000)}, dealState)
+		require.Equal(t, retrievalmarket.DealStatusPaymentChannelAddingFunds, dealState.Status)
+		require.True(t, dealState.WaitMsgCID.Equals(msgCid))
+		require.Equal(t, abi.NewTokenAmount(12000), fundsAdded)
+		require.Contains(t, dealState.Message, "automatically adding")
+		require.Equal(t, abi.NewTokenAmount(12000), dealState.AutoTopUpAdded)
+	})
+
+	t.Run("automatic top up declined", func(t *testing.T) {
+		dealState := makeDealState(retrievalmarket.DealStatusCheckFunds)
+		dealState.PaymentRequested = abi.NewTokenAmount(10000)
+		environment := &fakeEnvironment{AutoTopUpError: errors.New("over limit")}
+		runAutoTopUp(t, testnodes.TestRetrievalClientNodeParams{}, environment, dealState)
+		require.Equal(t, retrievalmarket.DealStatusInsufficientFunds, dealState.Status)
+		require.Contains(t, dealState.Message, "over limit")
+	})
+
+	t.Run("automatic top up fails", func(t *testing.T) {
+		dealState := makeDealState(retrievalmarket.DealStatusCheckFunds)
+		dealState.PaymentRequested = abi.NewTokenAmount(10000)
+		nodeParams := testnodes.TestRetrievalClientNodeParams{
+			PayChErr: errors.New("no funds in wallet"),
+		}
+		runAutoTopUp(t, nodeParams, &fakeEnvironment{AutoTopUp: abi.NewTokenAmount(10000)}, dealState)
+		require.Equal(t, retrievalmarket.DealStatusInsufficientFunds, dealState.Status)
+		require.Contains(t, dealState.Message, "no funds in wallet")
+	})
 }
 
 func TestCancelDeal(t *testing.T) {
@@ -804,11 +899,16 @@ func TestFinalizeBlockstore(t *testing.T) {
 	require.NoError(t, err)
 	runFinalizeBlockstore := func(t *testing.T,
 		finalizeBlockstoreError error,
+		verifyBlockstoreError error,
 		dealState *retrievalmarket.ClientDealState,
 	) {
 		params := testnodes.TestRetrievalClientNodeParams{}
 		node := testnodes.NewTestRetrievalClientNode(params)
-		environment := &fakeEnvironment{node: node, FinalizeBlockstoreError: finalizeBlockstoreError}
+		environment := &fakeEnvironment{
+			node:                    node,
+			FinalizeBlockstoreError: finalizeBlockstoreError,
+			VerifyBlockstoreError:   verifyBlockstoreError,
+		}
 		fsmCtx := fsmtest.NewTestContext(ctx, eventMachine)
 		err := clientstates.FinalizeBlockstore(fsmCtx, environment, *dealState)
 		require.NoError(t, err)
@@ -817,17 +917,32 @@ func TestFinalizeBlockstore(t *testing.T) {
 
 	t.Run("it succeeds", func(t *testing.T) {
 		dealState := makeDealState(retrievalmarket.DealStatusFinalizingBlockstore)
-		runFinalizeBlockstore(t, nil, dealState)
+		runFinalizeBlockstore(t, nil, nil, dealState)
 		require.Equal(t, retrievalmarket.DealStatusCompleted, dealState.Status)
 	})
 
 	t.Run("if FinalizeBlockstore fails", func(t *testing.T) {
 		dealState := makeDealState(retrievalmarket.DealStatusFinalizingBlockstore)
 		err := errors.New("boom")
-		runFinalizeBlockstore(t, err, dealState)
+		runFinalizeBlockstore(t, err, nil, dealState)
 		require.Contains(t, dealState.Message, "boom")
 		require.Equal(t, dealState.Status, retrievalmarket.DealStatusErrored)
 	})
+
+	t.Run("if the blockstore is incomplete", func(t *testing.T) {
+		dealState := makeDealState(retrievalmarket.DealStatusFinalizingBlockstore)
+		err := errors.New("1 missing")
+		runFinalizeBlockstore(t, nil, err, dealState)
+		require.Contains(t, dealState.Message, "1 missing")
+		require.Equal(t, retrievalmarket.DealStatusIncomplete, dealState.Status)
+	})
+
+	t.Run("if FinalizeBlockstore fails on an incomplete blockstore", func(t *testing.T) {
+		dealState := makeDealState(retrievalmarket.DealStatusFinalizingBlockstore)
+		runFinalizeBlockstore(t, errors.New("boom"), errors.New("1 missing"), dealState)
+		require.Contains(t, dealState.Message, "boom")
+		require.Equal(t, retrievalmarket.DealStatusErrored, dealState.Status)
+	})
 }
 
 func TestFailsafeFinalizeBlockstore(t *testing.T) {
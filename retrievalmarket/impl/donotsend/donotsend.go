@@ -0,0 +1,232 @@
+// Package donotsend lets a retrieval client skip the blocks it already has.
+//
+// Each time the client makes a graphsync request for a deal, when the
+// retrieval starts and again whenever the transfer is restarted, it walks the
+// deal's selector over its local blockstore to find the blocks it already
+// holds, and asks the provider not to send them using the graphsync
+// do-not-send-cids extension. The
+// provider's graphsync still traverses those blocks, but does not send them,
+// and data transfer only reports blocks that go over the wire, so the
+// provider only asks for payment for the bytes it actually sends.
+//
+// Data transfer does not expose the graphsync request it makes, so the
+// extension is added by an Exchange that wraps the client's graphsync
+// instance, which must be the one used by the client's data transfer
+// transport.
+package donotsend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	bstore "github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync"
+	"github.com/ipfs/go-graphsync/cidset"
+	"github.com/ipfs/go-graphsync/storeutil"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipfs/go-unixfsnode"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("retrieval-donotsend")
+
+// DefaultMaxCids is the default maximum number of CIDs sent in a do not send
+// set. It keeps the graphsync request well within the maximum libp2p message
+// size (4MiB).
+const DefaultMaxCids = 64 * 1024
+
+var errMaxCids = errors.New("maximum number of CIDs reached")
+
+type requestKey struct {
+	p    peer.ID
+	root cid.Cid
+}
+
+// localBlocks is where to look for the blocks the client already has
+type localBlocks struct {
+	bs  bstore.Blockstore
+	sel ipld.Node
+}
+
+// Exchange is a graphsync.GraphExchange that adds the do-not-send-cids
+// extension to requests for which a local blockstore has been registered
+type Exchange struct {
+	graphsync.GraphExchange
+
+	lk      sync.Mutex
+	tracked map[requestKey]localBlocks
+}
+
+// NewExchange wraps the given graphsync exchange
+func NewExchange(gs graphsync.GraphExchange) *Exchange {
+	return &Exchange{
+		GraphExchange: gs,
+		tracked:       make(map[requestKey]localBlocks),
+	}
+}
+
+// Track registers the blockstore that holds the blocks already received for
+// requests to the peer for the given root. The blocks the selector reaches
+// in the blockstore are found again for each request, so a transfer that is
+// restarted skips the blocks received before it was interrupted. If there is
+// more than one request for the same root to the same peer at the same time,
+// the last blockstore registered applies to all of them.
+func (e *Exchange) Track(p peer.ID, root cid.Cid, bs bstore.Blockstore, sel ipld.Node) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	e.tracked[requestKey{p: p, root: root}] = localBlocks{bs: bs, sel: sel}
+}
+
+// Clear removes the blockstore registered for the peer and root
+func (e *Exchange) Clear(p peer.ID, root cid.Cid) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	delete(e.tracked, requestKey{p: p, root: root})
+}
+
+// Request makes a graphsync request, adding the do-not-send-cids extension if
+// a blockstore has been registered for the peer and root and already has some
+// of the blocks, and the request does not already have the extension
+func (e *Exchange) Request(ctx context.Context, p peer.ID, root ipld.Link, sel ipld.Node, extensions ...graphsync.ExtensionData) (<-chan graphsync.ResponseProgress, <-chan error) {
+	if !hasExtension(extensions, graphsync.ExtensionDoNotSendCIDs) {
+		if cids := e.localCids(ctx, p, root); cids != nil && cids.Len() > 0 {
+			log.Infow("asking peer not to send local blocks", "peer", p, "root", root, "blocks", cids.Len())
+			extensions = append(extensions, graphsync.ExtensionData{
+				Name: graphsync.ExtensionDoNotSendCIDs,
+				Data: cidset.EncodeCidSet(cids),
+			})
+		}
+	}
+	return e.GraphExchange.Request(ctx, p, root, sel, extensions...)
+}
+
+// localCids returns the blocks already in the blockstore registered for the
+// peer and root, or nil if there is none
+func (e *Exchange) localCids(ctx context.Context, p peer.ID, root ipld.Link) *cid.Set {
+	lnk, ok := root.(cidlink.Link)
+	if !ok {
+		return nil
+	}
+
+	e.lk.Lock()
+	local, ok := e.tracked[requestKey{p: p, root: lnk.Cid}]
+	e.lk.Unlock()
+	if !ok {
+		return nil
+	}
+
+	cids, err := LocalCids(ctx, local.bs, lnk.Cid, local.sel, DefaultMaxCids)
+	if err != nil {
+		// the provider sends every block, as if the client had none
+		log.Warnf("finding local blocks of %s: %s", lnk.Cid, err)
+		return nil
+	}
+	return cids
+}
+
+func hasExtension(extensions []graphsync.ExtensionData, name graphsync.ExtensionName) bool {
+	for _, ext := range extensions {
+		if ext.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LocalCids walks the selector over the blocks in the blockstore, starting at
+// root, and returns the CIDs of the blocks that the blockstore already has.
+// Parts of the DAG below a missing block are not walked, and matched large
+// bytes, such as a range of a UnixFS file, are read up to the first missing
+// block. At most max CIDs are returned.
+func LocalCids(ctx context.Context, bs bstore.Blockstore, root cid.Cid, sel ipld.Node, max int) (*cid.Set, error) {
+	cids := cid.NewSet()
+
+	compiled, err := selector.CompileSelector(sel)
+	if err != nil {
+		return nil, xerrors.Errorf("compiling selector: %w", err)
+	}
+
+	lsys := storeutil.LinkSystemForBlockstore(bs)
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	readOpener := lsys.StorageReadOpener
+	lsys.StorageReadOpener = func(lctx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+		c := lnk.(cidlink.Link).Cid
+		has, err := bs.Has(lctx.Ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			return nil, traversal.SkipMe{}
+		}
+		if !cids.Visit(c) {
+			return readOpener(lctx, lnk)
+		}
+		if cids.Len() > max {
+			cids.Remove(c)
+			return nil, errMaxCids
+		}
+		return readOpener(lctx, lnk)
+	}
+	chooser := dagpb.AddSupportToChooser(func(datamodel.Link, linking.LinkContext) (datamodel.NodePrototype, error) {
+		return basicnode.Prototype.Any, nil
+	})
+
+	rootLnk := cidlink.Link{Cid: root}
+	lctx := linking.LinkContext{Ctx: ctx}
+	np, err := chooser(rootLnk, lctx)
+	if err != nil {
+		return nil, err
+	}
+	rootNode, err := lsys.Load(lctx, rootLnk, np)
+	if err != nil {
+		if _, ok := err.(traversal.SkipMe); ok || errors.Is(err, errMaxCids) {
+			// the blockstore doesn't have the root, or max is zero
+			return cids, nil
+		}
+		return nil, xerrors.Errorf("loading root %s: %w", root, err)
+	}
+
+	err = traversal.Progress{
+		Cfg: &traversal.Config{
+			Ctx:                            ctx,
+			LinkSystem:                     lsys,
+			LinkTargetNodePrototypeChooser: chooser,
+		},
+	}.WalkAdv(rootNode, compiled, func(_ traversal.Progress, n datamodel.Node, reason traversal.VisitReason) error {
+		return readMatched(n, reason)
+	})
+	if err != nil && !errors.Is(err, errMaxCids) {
+		return nil, xerrors.Errorf("walking local blocks of %s: %w", root, err)
+	}
+	return cids, nil
+}
+
+// readMatched reads a matched node with large bytes, such as a range of a
+// UnixFS file, as graphsync does when it sends it, so that the blocks holding
+// the bytes are loaded
+func readMatched(n datamodel.Node, reason traversal.VisitReason) error {
+	lbn, ok := n.(datamodel.LargeBytesNode)
+	if !ok || reason != traversal.VisitReason_SelectionMatch {
+		return nil
+	}
+	r, err := lbn.AsLargeBytes()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil && !errors.Is(err, traversal.SkipMe{}) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package donotsend_test
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/blockservice"
+	bstore "github.com/ipfs/boxo/blockstore"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-graphsync"
+	"github.com/ipfs/go-graphsync/cidset"
+	gsimpl "github.com/ipfs/go-graphsync/impl"
+	gsnet "github.com/ipfs/go-graphsync/network"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/donotsend"
+	tut "github.com/filecoin-project/go-fil-markets/shared_testutil"
+	"github.com/filecoin-project/go-fil-markets/shared_testutil/unixfs"
+)
+
+func TestLocalCids(t *testing.T) {
+	ctx := context.Background()
+	sel := selectorparse.CommonSelector_ExploreAllRecursively
+	root, src := createFile(t)
+	all, err := src.AllKeysChan(ctx)
+	require.NoError(t, err)
+	// the blockstore is keyed by multihash
+	var allHashes []string
+	for c := range all {
+		allHashes = append(allHashes, c.Hash().String())
+	}
+
+	t.Run("all blocks", func(t *testing.T) {
+		cids, err := donotsend.LocalCids(ctx, src, root, sel, donotsend.DefaultMaxCids)
+		require.NoError(t, err)
+		var hashes []string
+		for _, c := range cids.Keys() {
+			hashes = append(hashes, c.Hash().String())
+		}
+		require.ElementsMatch(t, allHashes, hashes)
+	})
+
+	t.Run("no blocks", func(t *testing.T) {
+		cids, err := donotsend.LocalCids(ctx, newBlockstore(), root, sel, donotsend.DefaultMaxCids)
+		require.NoError(t, err)
+		require.Zero(t, cids.Len())
+	})
+
+	t.Run("some blocks", func(t *testing.T) {
+		// copy the root and its first child, which is the start of a
+		// partial retrieval
+		bs := newBlockstore()
+		rootBlk, err := src.Get(ctx, root)
+		require.NoError(t, err)
+		require.NoError(t, bs.Put(ctx, rootBlk))
+		nd, err := merkledag.DecodeProtobuf(rootBlk.RawData())
+		require.NoError(t, err)
+		child, err := src.Get(ctx, nd.Links()[0].Cid)
+		require.NoError(t, err)
+		require.NoError(t, bs.Put(ctx, child))
+
+		cids, err := donotsend.LocalCids(ctx, bs, root, sel, donotsend.DefaultMaxCids)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []cid.Cid{root, child.Cid()}, cids.Keys())
+	})
+
+	t.Run("byte range", func(t *testing.T) {
+		// the leaves holding the range are found, as well as the nodes above
+		// them
+		ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+		rangeSel := retrievalmarket.ByteRange{Offset: 3 << 19, Length: 100}.Selector(ssb).Node()
+		cids, err := donotsend.LocalCids(ctx, src, root, rangeSel, donotsend.DefaultMaxCids)
+		require.NoError(t, err)
+		var leaves []cid.Cid
+		for _, c := range cids.Keys() {
+			if c.Prefix().Codec == cid.Raw {
+				leaves = append(leaves, c)
+			}
+		}
+		require.Len(t, leaves, 1)
+		require.True(t, cids.Has(root))
+		require.Less(t, cids.Len(), len(allHashes))
+	})
+
+	t.Run("limits the number of CIDs", func(t *testing.T) {
+		cids, err := donotsend.LocalCids(ctx, src, root, sel, 3)
+		require.NoError(t, err)
+		require.Equal(t, 3, cids.Len())
+		require.True(t, cids.Has(root))
+	})
+}
+
+func TestExchange(t *testing.T) {
+	ctx := context.Background()
+	p := peer.ID("provider")
+	root, src := createFile(t)
+	other, _ := createFile(t)
+	sel := selectorparse.CommonSelector_ExploreAllRecursively
+
+	gs := &fakeExchange{}
+	e := donotsend.NewExchange(gs)
+	local := newBlockstore()
+	e.Track(p, root, local, sel)
+
+	// requests for the root only have the extension once there are local
+	// blocks
+	e.Request(ctx, p, cidlink.Link{Cid: root}, sel)
+	require.Empty(t, gs.extensions)
+
+	// the local blocks are found again for each request, eg when the
+	// transfer is restarted
+	rootBlk, err := src.Get(ctx, root)
+	require.NoError(t, err)
+	require.NoError(t, local.Put(ctx, rootBlk))
+	e.Request(ctx, p, cidlink.Link{Cid: root}, sel)
+	require.Len(t, gs.extensions, 1)
+	require.Equal(t, graphsync.ExtensionDoNotSendCIDs, gs.extensions[0].Name)
+	decoded, err := cidset.DecodeCidSet(gs.extensions[0].Data)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{root}, decoded.Keys())
+
+	// other requests are unchanged
+	e.Request(ctx, p, cidlink.Link{Cid: other}, sel)
+	require.Empty(t, gs.extensions)
+	e.Request(ctx, peer.ID("other"), cidlink.Link{Cid: root}, sel)
+	require.Empty(t, gs.extensions)
+
+	e.Clear(p, root)
+	e.Request(ctx, p, cidlink.Link{Cid: root}, sel)
+	require.Empty(t, gs.extensions)
+}
+
+func TestProviderSkipsLocalBlocks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	td := tut.NewLibp2pTestData(ctx, t)
+	sel := selectorparse.CommonSelector_ExploreAllRecursively
+
+	// the provider has the whole file, the client has the root and its
+	// first child from an earlier partial retrieval
+	data := make([]byte, 2<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	root := unixfs.WriteUnixfsDAGTo(t, path, td.DagService2)
+	rootBlk, err := td.Bs2.Get(ctx, root)
+	require.NoError(t, err)
+	require.NoError(t, td.Bs1.Put(ctx, rootBlk))
+	nd, err := merkledag.DecodeProtobuf(rootBlk.RawData())
+	require.NoError(t, err)
+	child, err := td.Bs2.Get(ctx, nd.Links()[0].Cid)
+	require.NoError(t, err)
+	require.NoError(t, td.Bs1.Put(ctx, child))
+
+	provider := gsimpl.New(ctx, gsnet.NewFromLibp2pHost(td.Host2), td.LinkSystem2)
+	provider.RegisterIncomingRequestHook(func(p peer.ID, request graphsync.RequestData, hookActions graphsync.IncomingRequestHookActions) {
+		hookActions.ValidateRequest()
+	})
+	var lk sync.Mutex
+	sent := cid.NewSet()
+	provider.RegisterOutgoingBlockHook(func(p peer.ID, request graphsync.RequestData, block graphsync.BlockData, hookActions graphsync.OutgoingBlockHookActions) {
+		if block.BlockSizeOnWire() > 0 {
+			lk.Lock()
+			sent.Add(block.Link().(cidlink.Link).Cid)
+			lk.Unlock()
+		}
+	})
+
+	client := donotsend.NewExchange(gsimpl.New(ctx, gsnet.NewFromLibp2pHost(td.Host1), td.LinkSystem1))
+	client.Track(td.Host2.ID(), root, td.Bs1, sel)
+	progress, errs := client.Request(ctx, td.Host2.ID(), cidlink.Link{Cid: root}, sel)
+	for range progress {
+	}
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// every block was sent except the ones the client already had
+	all, err := donotsend.LocalCids(ctx, td.Bs2, root, sel, donotsend.DefaultMaxCids)
+	require.NoError(t, err)
+	lk.Lock()
+	defer lk.Unlock()
+	require.Equal(t, all.Len()-2, sent.Len())
+	require.False(t, sent.Has(root))
+	require.False(t, sent.Has(child.Cid()))
+
+	// and the client ends up with the whole file
+	received, err := donotsend.LocalCids(ctx, td.Bs1, root, sel, donotsend.DefaultMaxCids)
+	require.NoError(t, err)
+	require.Equal(t, all.Len(), received.Len())
+}
+
+type fakeExchange struct {
+	graphsync.GraphExchange
+	extensions []graphsync.ExtensionData
+}
+
+func (fe *fakeExchange) Request(ctx context.Context, p peer.ID, root ipld.Link, sel ipld.Node, extensions ...graphsync.ExtensionData) (<-chan graphsync.ResponseProgress, <-chan error) {
+	fe.extensions = extensions
+	return nil, nil
+}
+
+func newBlockstore() bstore.Blockstore {
+	return bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+}
+
+func createFile(t *testing.T) (cid.Cid, bstore.Blockstore) {
+	data := make([]byte, 2<<20)
+	rand.New(rand.NewSource(rand.Int63())).Read(data)
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	bs := newBlockstore()
+	dagSvc := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	return unixfs.WriteUnixfsDAGTo(t, path, dagSvc), bs
+}
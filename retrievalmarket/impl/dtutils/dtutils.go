@@ -9,6 +9,7 @@ import (
 	bstore "github.com/ipfs/boxo/blockstore"
 	"github.com/ipfs/go-graphsync/storeutil"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipfs/go-unixfsnode"
 	peer "github.com/libp2p/go-libp2p/core/peer"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer/v2"
@@ -98,6 +99,8 @@ func clientEventForResponse(response *rm.DealResponse) (rm.ClientEvent, []interf
 		return rm.ClientEventDealNotFound, []interface{}{response.Message}
 	case rm.DealStatusAccepted:
 		return rm.ClientEventDealAccepted, nil
+	case rm.DealStatusUnsealQueued:
+		return rm.ClientEventUnsealQueued, []interface{}{response.Message}
 	case rm.DealStatusFundsNeededUnseal:
 		return rm.ClientEventUnsealPaymentRequested, []interface{}{response.PaymentOwed}
 	case rm.DealStatusFundsNeededLastPayment:
@@ -194,6 +197,12 @@ func TransportConfigurer(thisPeer peer.ID, storeGetter StoreGetter) datatransfer
 		if store == nil {
 			return nil
 		}
-		return []datatransfer.TransportOption{dtgs.UseStore(storeutil.LinkSystemForBlockstore(store))}
+		lsys := storeutil.LinkSystemForBlockstore(store)
+		// deals for a UnixFS path or range have selectors that interpret
+		// nodes as UnixFS
+		if dealProposal.SelectsUnixFS() {
+			unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+		}
+		return []datatransfer.TransportOption{dtgs.UseStore(lsys)}
 	}
 }
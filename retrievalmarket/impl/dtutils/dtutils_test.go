@@ -193,6 +193,20 @@ func TestClientDataTransferSubscriber(t *testing.T) {
 			expectedID:    dealProposal.ID,
 			expectedEvent: rm.ClientEventDealAccepted,
 		},
+		"new voucher result - unseal queued": {
+			code: datatransfer.NewVoucherResult,
+			state: shared_testutil.TestChannelParams{
+				Vouchers: []datatransfer.TypedVoucher{dealProposalVoucher},
+				VoucherResults: []datatransfer.TypedVoucher{dealResponseVoucher(retrievalmarket.DealResponse{
+					Status:  retrievalmarket.DealStatusUnsealQueued,
+					ID:      dealProposal.ID,
+					Message: "queued for unsealing: position 2 of 3",
+				})},
+				Status: datatransfer.Ongoing},
+			expectedID:    dealProposal.ID,
+			expectedEvent: rm.ClientEventUnsealQueued,
+			expectedArgs:  []interface{}{"queued for unsealing: position 2 of 3"},
+		},
 		"new voucher result - funds needed last payment": {
 			code: datatransfer.NewVoucherResult,
 			state: shared_testutil.TestChannelParams{
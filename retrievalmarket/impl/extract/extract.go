@@ -0,0 +1,341 @@
+// Package extract writes the UnixFS files and directories of a finished
+// retrieval to the filesystem.
+//
+// The retrieval client leaves the blocks it receives in the blockstore that
+// the BlockstoreAccessor gave it. Extract checks that the blockstore holds
+// the whole UnixFS DAG that is to be written, so that a partial retrieval
+// fails up front instead of leaving partial files behind, and then writes
+// the DAG to a target path, with the permissions and modification times
+// recorded in the DAG. For a retrieval of a byte range of a file, it writes
+// exactly the bytes in the range.
+package extract
+
+import (
+	"context"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bstore "github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync/storeutil"
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipfs/go-unixfsnode/file"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+	"golang.org/x/xerrors"
+
+	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/verify"
+)
+
+// Option configures an extraction
+type Option func(*extractor)
+
+// Path selects the file or directory at the given slash-separated path under
+// the root to extract, instead of the root itself
+func Path(path string) Option {
+	return func(e *extractor) {
+		e.path = path
+	}
+}
+
+// Range extracts only the given range of bytes of the file at the path, as
+// retrieved with a selector from retrievalmarket.UnixFSRangeSelector. A deal
+// for a range must be extracted with it, as the deal's blocks hold more than
+// the bytes in the range.
+func Range(byteRange rm.ByteRange) Option {
+	return func(e *extractor) {
+		e.byteRange = &byteRange
+	}
+}
+
+type extractor struct {
+	ctx       context.Context
+	lsys      linking.LinkSystem
+	path      string
+	byteRange *rm.ByteRange
+}
+
+// Deal extracts the result of a completed retrieval deal to target, using the
+// blockstore that the deal's blocks were written to
+func Deal(ctx context.Context, client rm.RetrievalClient, bstores rm.BlockstoreAccessor, id rm.DealID, target string, options ...Option) error {
+	deal, err := client.GetDeal(id)
+	if err != nil {
+		return xerrors.Errorf("getting deal %d: %w", id, err)
+	}
+	if deal.Status != rm.DealStatusCompleted {
+		return xerrors.Errorf("deal %d is %s, not completed", id, rm.DealStatuses[deal.Status])
+	}
+
+	bs, err := bstores.Get(id, deal.PayloadCID)
+	if err != nil {
+		return xerrors.Errorf("getting blockstore of deal %d: %w", id, err)
+	}
+	err = Extract(ctx, bs, deal.PayloadCID, target, options...)
+	if doneErr := bstores.Done(id); doneErr != nil && err == nil {
+		err = xerrors.Errorf("releasing blockstore of deal %d: %w", id, doneErr)
+	}
+	return err
+}
+
+// Extract writes the UnixFS file or directory under root in the blockstore to
+// target, which must not exist. It fails without writing anything if the
+// blockstore does not hold every block of the file or directory.
+func Extract(ctx context.Context, bs bstore.Blockstore, root cid.Cid, target string, options ...Option) error {
+	e := &extractor{
+		ctx:  ctx,
+		lsys: storeutil.LinkSystemForBlockstore(bstore.NewIdStore(bs)),
+	}
+	for _, option := range options {
+		option(e)
+	}
+
+	c, err := e.resolve(root)
+	if err != nil {
+		return err
+	}
+
+	sel := selectorparse.CommonSelector_ExploreAllRecursively
+	if e.byteRange != nil {
+		if err := e.checkFile(c); err != nil {
+			return err
+		}
+		sel = e.byteRange.Selector(builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)).Node()
+	}
+	res, err := verify.Blockstore(ctx, bs, c, sel)
+	if err != nil {
+		return xerrors.Errorf("verifying %s: %w", c, err)
+	}
+	if err := res.Err(); err != nil {
+		return xerrors.Errorf("verifying %s: %w", c, err)
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		return xerrors.Errorf("extracting to %s: %w", target, os.ErrExist)
+	}
+	return e.write(c, target)
+}
+
+// resolve returns the CID of the node at the extractor's path under root
+func (e *extractor) resolve(root cid.Cid) (cid.Cid, error) {
+	c := root
+	for _, name := range strings.Split(e.path, "/") {
+		if name == "" {
+			continue
+		}
+		nd, err := e.load(c)
+		if err != nil {
+			return cid.Undef, err
+		}
+		ufs, err := unixfsData(c, nd)
+		if err != nil {
+			return cid.Undef, err
+		}
+		if t := ufs.FieldDataType().Int(); t != data.Data_Directory && t != data.Data_HAMTShard {
+			return cid.Undef, xerrors.Errorf("resolving %s: %s is a %s, not a directory", e.path, c, data.DataTypeNames[t])
+		}
+		dir, err := unixfsnode.Reify(e.linkContext(), nd, &e.lsys)
+		if err != nil {
+			return cid.Undef, xerrors.Errorf("reading directory %s: %w", c, err)
+		}
+		entry, err := dir.LookupByString(name)
+		if err != nil {
+			return cid.Undef, xerrors.Errorf("resolving %s: no entry %q in %s: %w", e.path, name, c, err)
+		}
+		lnk, err := entry.AsLink()
+		if err != nil {
+			return cid.Undef, xerrors.Errorf("resolving %s: %w", e.path, err)
+		}
+		c = lnk.(cidlink.Link).Cid
+	}
+	return c, nil
+}
+
+// checkFile checks that the node with the given CID is a file
+func (e *extractor) checkFile(c cid.Cid) error {
+	if c.Prefix().Codec == cid.Raw {
+		return nil
+	}
+	nd, err := e.load(c)
+	if err != nil {
+		return err
+	}
+	ufs, err := unixfsData(c, nd)
+	if err != nil {
+		return err
+	}
+	if t := ufs.FieldDataType().Int(); t != data.Data_File && t != data.Data_Raw {
+		return xerrors.Errorf("extracting a range of %s: %s is a %s, not a file", e.path, c, data.DataTypeNames[t])
+	}
+	return nil
+}
+
+// write writes the node with the given CID to path
+func (e *extractor) write(c cid.Cid, path string) error {
+	nd, err := e.load(c)
+	if err != nil {
+		return err
+	}
+	if c.Prefix().Codec == cid.Raw {
+		// a file with a single raw block
+		return e.writeFile(path, nd, data.FilePermissionsDefault)
+	}
+
+	ufs, err := unixfsData(c, nd)
+	if err != nil {
+		return err
+	}
+	switch t := ufs.FieldDataType().Int(); t {
+	case data.Data_File, data.Data_Raw:
+		err = e.writeFile(path, nd, ufs.Permissions())
+		if e.byteRange != nil && err == nil {
+			// a range is not the whole file, so it doesn't get the file's times
+			return nil
+		}
+	case data.Data_Directory, data.Data_HAMTShard:
+		err = e.writeDirectory(c, path, nd, ufs.Permissions())
+	case data.Data_Symlink:
+		if !ufs.FieldData().Exists() {
+			return xerrors.Errorf("symlink %s has no target", c)
+		}
+		// symlinks have no permissions, and their times can't be set
+		return os.Symlink(string(ufs.FieldData().Must().Bytes()), path)
+	default:
+		return xerrors.Errorf("%s is a %s, which can't be extracted", c, data.DataTypeNames[t])
+	}
+	if err != nil {
+		return err
+	}
+	return setTimes(path, ufs)
+}
+
+func (e *extractor) writeFile(path string, nd datamodel.Node, perm int) error {
+	fileNode, err := file.NewUnixFSFile(e.ctx, nd, &e.lsys)
+	if err != nil {
+		return xerrors.Errorf("reading file: %w", err)
+	}
+	rs, err := fileNode.AsLargeBytes()
+	if err != nil {
+		return xerrors.Errorf("reading file: %w", err)
+	}
+	var r io.Reader = rs
+	if e.byteRange != nil {
+		if _, err := rs.Seek(int64(e.byteRange.Offset), io.SeekStart); err != nil {
+			return xerrors.Errorf("reading file: %w", err)
+		}
+		if e.byteRange.Length != 0 && e.byteRange.Length <= math.MaxInt64 {
+			r = io.LimitReader(rs, int64(e.byteRange.Length))
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(perm)&os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return xerrors.Errorf("writing %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// the permissions given to OpenFile are masked by the umask
+	return os.Chmod(path, os.FileMode(perm)&os.ModePerm)
+}
+
+func (e *extractor) writeDirectory(c cid.Cid, path string, nd datamodel.Node, perm int) error {
+	dir, err := unixfsnode.Reify(e.linkContext(), nd, &e.lsys)
+	if err != nil {
+		return xerrors.Errorf("reading directory %s: %w", c, err)
+	}
+	if err := os.Mkdir(path, 0700); err != nil {
+		return err
+	}
+
+	it := dir.MapIterator()
+	if it == nil {
+		return xerrors.Errorf("directory %s can't be listed", c)
+	}
+	for !it.Done() {
+		k, v, err := it.Next()
+		if err != nil {
+			return xerrors.Errorf("listing directory %s: %w", c, err)
+		}
+		name, err := k.AsString()
+		if err != nil {
+			return xerrors.Errorf("listing directory %s: %w", c, err)
+		}
+		// an entry must not write outside the directory
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return xerrors.Errorf("directory %s has an entry with invalid name %q", c, name)
+		}
+		lnk, err := v.AsLink()
+		if err != nil {
+			return xerrors.Errorf("listing directory %s: %w", c, err)
+		}
+		if err := e.write(lnk.(cidlink.Link).Cid, filepath.Join(path, name)); err != nil {
+			return err
+		}
+	}
+
+	// the permissions are set after the entries are written, in case they
+	// don't allow writing
+	return os.Chmod(path, os.FileMode(perm)&os.ModePerm)
+}
+
+func (e *extractor) load(c cid.Cid) (datamodel.Node, error) {
+	var proto datamodel.NodePrototype = basicnode.Prototype.Bytes
+	if c.Prefix().Codec == cid.DagProtobuf {
+		proto = dagpb.Type.PBNode
+	} else if c.Prefix().Codec != cid.Raw {
+		return nil, xerrors.Errorf("%s is not UnixFS: unexpected codec %x", c, c.Prefix().Codec)
+	}
+	nd, err := e.lsys.Load(e.linkContext(), cidlink.Link{Cid: c}, proto)
+	if err != nil {
+		return nil, xerrors.Errorf("loading %s: %w", c, err)
+	}
+	return nd, nil
+}
+
+func (e *extractor) linkContext() ipld.LinkContext {
+	return ipld.LinkContext{Ctx: e.ctx}
+}
+
+// unixfsData decodes the UnixFS data of a dag-pb node
+func unixfsData(c cid.Cid, nd datamodel.Node) (data.UnixFSData, error) {
+	pbnode, ok := nd.(dagpb.PBNode)
+	if !ok || !pbnode.FieldData().Exists() {
+		return nil, xerrors.Errorf("%s is not UnixFS", c)
+	}
+	ufs, err := data.DecodeUnixFSData(pbnode.FieldData().Must().Bytes())
+	if err != nil {
+		return nil, xerrors.Errorf("decoding UnixFS data of %s: %w", c, err)
+	}
+	return ufs, nil
+}
+
+// setTimes sets the modification time of the file at path to the one in the
+// UnixFS data, if there is one
+func setTimes(path string, ufs data.UnixFSData) error {
+	if !ufs.FieldMtime().Exists() {
+		return nil
+	}
+	mtime := ufs.FieldMtime().Must()
+	var nsecs int64
+	if mtime.FieldFractionalNanoseconds().Exists() {
+		nsecs = mtime.FieldFractionalNanoseconds().Must().Int()
+	}
+	t := time.Unix(mtime.FieldSeconds().Int(), nsecs)
+	return os.Chtimes(path, t, t)
+}
@@ -0,0 +1,236 @@
+package extract_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/blockservice"
+	bstore "github.com/ipfs/boxo/blockstore"
+	chunk "github.com/ipfs/boxo/chunker"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/ipld/unixfs/hamt"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	ihelper "github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/stretchr/testify/require"
+
+	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/extract"
+)
+
+var mtime = time.Unix(1600000000, 500)
+
+func TestExtract(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("directory", func(t *testing.T) {
+		tree := buildTree(t)
+		target := filepath.Join(t.TempDir(), "out")
+		require.NoError(t, extract.Extract(ctx, tree.bs, tree.root, target))
+
+		got, err := os.ReadFile(filepath.Join(target, "sub", "large"))
+		require.NoError(t, err)
+		require.Equal(t, tree.large, got)
+
+		got, err = os.ReadFile(filepath.Join(target, "sub", "private"))
+		require.NoError(t, err)
+		require.Equal(t, tree.private, got)
+		stat, err := os.Stat(filepath.Join(target, "sub", "private"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+		require.True(t, mtime.Equal(stat.ModTime()))
+
+		for i := 0; i < shardedEntries; i++ {
+			got, err := os.ReadFile(filepath.Join(target, "sharded", fmt.Sprintf("file%d", i)))
+			require.NoError(t, err)
+			require.Equal(t, []byte(fmt.Sprintf("contents of file %d", i)), got)
+		}
+
+		link, err := os.Readlink(filepath.Join(target, "link"))
+		require.NoError(t, err)
+		require.Equal(t, "sub/large", link)
+	})
+
+	t.Run("path", func(t *testing.T) {
+		tree := buildTree(t)
+		target := filepath.Join(t.TempDir(), "out")
+		require.NoError(t, extract.Extract(ctx, tree.bs, tree.root, target, extract.Path("sharded/file7")))
+		got, err := os.ReadFile(target)
+		require.NoError(t, err)
+		require.Equal(t, []byte("contents of file 7"), got)
+
+		target = filepath.Join(t.TempDir(), "out")
+		require.NoError(t, extract.Extract(ctx, tree.bs, tree.root, target, extract.Path("/sub/")))
+		got, err = os.ReadFile(filepath.Join(target, "large"))
+		require.NoError(t, err)
+		require.Equal(t, tree.large, got)
+
+		target = filepath.Join(t.TempDir(), "out")
+		require.Error(t, extract.Extract(ctx, tree.bs, tree.root, target, extract.Path("sub/missing")))
+		require.Error(t, extract.Extract(ctx, tree.bs, tree.root, target, extract.Path("sub/large/file")))
+	})
+
+	t.Run("range", func(t *testing.T) {
+		tree := buildTree(t)
+		// the first leaf isn't needed for a range that starts after it
+		require.NoError(t, tree.bs.DeleteBlock(ctx, tree.largeLeaf))
+
+		target := filepath.Join(t.TempDir(), "out")
+		byteRange := rm.ByteRange{Offset: 50000, Length: 10000}
+		require.NoError(t, extract.Extract(ctx, tree.bs, tree.root, target, extract.Path("sub/large"), extract.Range(byteRange)))
+		got, err := os.ReadFile(target)
+		require.NoError(t, err)
+		require.Equal(t, tree.large[50000:60000], got)
+
+		// a range without a length runs to the end of the file
+		target = filepath.Join(t.TempDir(), "out")
+		require.NoError(t, extract.Extract(ctx, tree.bs, tree.root, target, extract.Path("sub/large"), extract.Range(rm.ByteRange{Offset: 90000})))
+		got, err = os.ReadFile(target)
+		require.NoError(t, err)
+		require.Equal(t, tree.large[90000:], got)
+
+		target = filepath.Join(t.TempDir(), "out")
+		err = extract.Extract(ctx, tree.bs, tree.root, target, extract.Path("sub/large"), extract.Range(rm.ByteRange{Length: 10}))
+		require.ErrorContains(t, err, tree.largeLeaf.String())
+		require.ErrorContains(t, extract.Extract(ctx, tree.bs, tree.root, target, extract.Path("sub"), extract.Range(byteRange)), "not a file")
+	})
+
+	t.Run("incomplete", func(t *testing.T) {
+		tree := buildTree(t)
+		require.NoError(t, tree.bs.DeleteBlock(ctx, tree.largeLeaf))
+
+		target := filepath.Join(t.TempDir(), "out")
+		err := extract.Extract(ctx, tree.bs, tree.root, target)
+		require.ErrorContains(t, err, tree.largeLeaf.String())
+		_, err = os.Lstat(target)
+		require.True(t, os.IsNotExist(err))
+
+		// the parts of the DAG that are complete can still be extracted
+		require.NoError(t, extract.Extract(ctx, tree.bs, tree.root, target, extract.Path("sharded")))
+	})
+
+	t.Run("target exists", func(t *testing.T) {
+		tree := buildTree(t)
+		target := t.TempDir()
+		require.ErrorIs(t, extract.Extract(ctx, tree.bs, tree.root, target), os.ErrExist)
+	})
+
+	t.Run("entry outside directory", func(t *testing.T) {
+		bs := newBlockstore()
+		dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+		dir := unixfs.EmptyDirNode()
+		require.NoError(t, dir.AddNodeLink("../evil", importFile(t, dag, []byte("evil"))))
+		require.NoError(t, dag.Add(ctx, dir))
+
+		tmp := t.TempDir()
+		err := extract.Extract(ctx, bs, dir.Cid(), filepath.Join(tmp, "out"))
+		require.ErrorContains(t, err, "invalid name")
+		_, err = os.Stat(filepath.Join(tmp, "evil"))
+		require.True(t, os.IsNotExist(err))
+	})
+}
+
+const shardedEntries = 20
+
+type tree struct {
+	bs        bstore.Blockstore
+	root      cid.Cid
+	large     []byte
+	largeLeaf cid.Cid
+	private   []byte
+}
+
+// buildTree builds a directory with a subdirectory holding a large file and
+// a file with a mode and mtime, a HAMT sharded directory, and a symlink
+func buildTree(t *testing.T) tree {
+	ctx := context.Background()
+	tr := tree{bs: newBlockstore()}
+	dag := merkledag.NewDAGService(blockservice.New(tr.bs, offline.Exchange(tr.bs)))
+
+	tr.large = make([]byte, 100<<10)
+	rand.New(rand.NewSource(1)).Read(tr.large)
+	large := importFile(t, dag, tr.large)
+	tr.largeLeaf = large.Links()[0].Cid
+
+	tr.private = []byte("a private file")
+	private := fileWithMetadata(t, tr.private)
+	require.NoError(t, dag.Add(ctx, private))
+
+	sub := unixfs.EmptyDirNode()
+	require.NoError(t, sub.AddNodeLink("large", large))
+	require.NoError(t, sub.AddNodeLink("private", private))
+	require.NoError(t, dag.Add(ctx, sub))
+
+	shard, err := hamt.NewShard(dag, 16)
+	require.NoError(t, err)
+	for i := 0; i < shardedEntries; i++ {
+		file := importFile(t, dag, []byte(fmt.Sprintf("contents of file %d", i)))
+		require.NoError(t, shard.Set(ctx, fmt.Sprintf("file%d", i), file))
+	}
+	sharded, err := shard.Node()
+	require.NoError(t, err)
+
+	symlinkData, err := unixfs.SymlinkData("sub/large")
+	require.NoError(t, err)
+	symlink := merkledag.NodeWithData(symlinkData)
+	require.NoError(t, dag.Add(ctx, symlink))
+
+	root := unixfs.EmptyDirNode()
+	require.NoError(t, root.AddNodeLink("link", symlink))
+	require.NoError(t, root.AddNodeLink("sharded", sharded))
+	require.NoError(t, root.AddNodeLink("sub", sub))
+	require.NoError(t, dag.Add(ctx, root))
+	tr.root = root.Cid()
+	return tr
+}
+
+func importFile(t *testing.T, dag ipldformat.DAGService, contents []byte) ipldformat.Node {
+	params := ihelper.DagBuilderParams{
+		Maxlinks:  ihelper.DefaultLinksPerBlock,
+		RawLeaves: true,
+		Dagserv:   dag,
+	}
+	prefix, err := merkledag.PrefixForCidVersion(1)
+	require.NoError(t, err)
+	params.CidBuilder = prefix
+	db, err := params.New(chunk.NewSizeSplitter(bytes.NewReader(contents), 1024))
+	require.NoError(t, err)
+	nd, err := balanced.Layout(db)
+	require.NoError(t, err)
+	return nd
+}
+
+// fileWithMetadata returns a single block file with mode 0600 and an mtime
+func fileWithMetadata(t *testing.T, contents []byte) *merkledag.ProtoNode {
+	ufs, err := qp.BuildMap(data.Type.UnixFSData, -1, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, data.Field__DataType, qp.Int(data.Data_File))
+		qp.MapEntry(ma, data.Field__Data, qp.Bytes(contents))
+		qp.MapEntry(ma, data.Field__FileSize, qp.Int(int64(len(contents))))
+		qp.MapEntry(ma, data.Field__BlockSizes, qp.List(0, func(datamodel.ListAssembler) {}))
+		qp.MapEntry(ma, data.Field__Mode, qp.Int(0600))
+		qp.MapEntry(ma, data.Field__Mtime, qp.Map(-1, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, data.Field__Seconds, qp.Int(mtime.Unix()))
+			qp.MapEntry(ma, data.Field__Nanoseconds, qp.Int(int64(mtime.Nanosecond())))
+		}))
+	})
+	require.NoError(t, err)
+	return merkledag.NodeWithData(data.EncodeUnixFSData(ufs.(data.UnixFSData)))
+}
+
+func newBlockstore() bstore.Blockstore {
+	return bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+}
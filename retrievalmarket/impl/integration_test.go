@@ -3,6 +3,7 @@ package retrievalimpl_test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
@@ -30,13 +31,16 @@ import (
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/go-state-types/builtin/v8/paych"
+	"github.com/filecoin-project/go-state-types/crypto"
 
 	"github.com/filecoin-project/go-fil-markets/piecestore"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	retrievalimpl "github.com/filecoin-project/go-fil-markets/retrievalmarket/impl"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/accesscontrol"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/testnodes"
 	rmnet "github.com/filecoin-project/go-fil-markets/retrievalmarket/network"
 	rmtesting "github.com/filecoin-project/go-fil-markets/retrievalmarket/testing"
+	"github.com/filecoin-project/go-fil-markets/shared"
 	tut "github.com/filecoin-project/go-fil-markets/shared_testutil"
 	"github.com/filecoin-project/go-fil-markets/stores"
 )
@@ -225,6 +229,7 @@ func TestClientCanMakeDealWithProvider(t *testing.T) {
 		channelAvailableFunds   retrievalmarket.ChannelAvailableFunds
 		fundsReplenish          abi.TokenAmount
 		cancelled               bool
+		accessToken             bool
 	}{
 		{name: "1 block file retrieval succeeds",
 			filename:    "lorem_under_1_block.txt",
@@ -315,6 +320,12 @@ func TestClientCanMakeDealWithProvider(t *testing.T) {
 			filesize:    410,
 			voucherAmts: []abi.TokenAmount{abi.NewTokenAmount(410000)},
 		},
+		{name: "succeeds with an access token",
+			filename:    "lorem_under_1_block.txt",
+			filesize:    410,
+			voucherAmts: []abi.TokenAmount{abi.NewTokenAmount(410000)},
+			accessToken: true,
+		},
 		{name: "succeeds for regular blockstore",
 			filename:    "lorem.txt",
 			filesize:    19000,
@@ -446,8 +457,27 @@ func TestClientCanMakeDealWithProvider(t *testing.T) {
 			ctx, cancel := context.WithTimeout(bgCtx, 60*time.Second)
 			defer cancel()
 
+			// the provider only serves the payload to clients with a token
+			// signed by its owner
+			var providerOpts []retrievalimpl.RetrievalProviderOption
+			var token *retrievalmarket.AccessToken
+			if testCase.accessToken {
+				owner, err := address.NewSecp256k1Address([]byte("owner"))
+				require.NoError(t, err)
+				policy := accesscontrol.NewPolicy(hashVerifier{})
+				policy.SetPayloadACL(payloadCID, accesscontrol.ACL{Owners: []address.Address{owner}})
+				providerOpts = append(providerOpts, retrievalimpl.AccessControlOpt(policy))
+				token, err = accesscontrol.SignToken(bgCtx, retrievalmarket.AccessToken{
+					PayloadCID: &payloadCID,
+					Client:     testData.Host1.ID(),
+					Expiration: time.Now().Add(time.Hour).Unix(),
+					Signer:     owner,
+				}, hashSign)
+				require.NoError(t, err)
+			}
+
 			provider := setupProvider(bgCtx, t, testData, payloadCID, pieceInfo, carFile.Name(), expectedQR,
-				providerPaymentAddr, providerNode, sectorAccessor, decider)
+				providerPaymentAddr, providerNode, sectorAccessor, decider, providerOpts...)
 			tut.StartAndWaitForReady(ctx, t, provider)
 
 			retrievalPeer := retrievalmarket.RetrievalPeer{Address: providerPaymentAddr, ID: testData.Host2.ID()}
@@ -524,6 +554,11 @@ Message:		 %s
 			// set up retrieval params
 			resp, err := client.Query(bgCtx, retrievalPeer, payloadCID, retrievalmarket.QueryParams{})
 			require.NoError(t, err)
+			if token != nil {
+				require.Equal(t, retrievalmarket.QueryResponseUnavailable, resp.Status)
+				resp, err = client.Query(bgCtx, retrievalPeer, payloadCID, retrievalmarket.QueryParams{AccessToken: token})
+				require.NoError(t, err)
+			}
 			require.Equal(t, retrievalmarket.QueryResponseAvailable, resp.Status)
 
 			var rmParams retrievalmarket.Params
@@ -533,6 +568,7 @@ Message:		 %s
 			} else {
 				rmParams = retrievalmarket.NewParamsV0(pricePerByte, paymentInterval, paymentIntervalIncrease)
 			}
+			rmParams.AccessToken = token
 
 			// *** Retrieve the piece
 			_, err = client.Retrieve(bgCtx, 0, payloadCID, rmParams, expectedTotal, retrievalPeer, clientPaymentChannel, retrievalPeer.Address)
@@ -667,6 +703,7 @@ func setupProvider(
 	providerNode retrievalmarket.RetrievalProviderNode,
 	sectorAccessor retrievalmarket.SectorAccessor,
 	decider retrievalimpl.DealDecider,
+	extraOpts ...retrievalimpl.RetrievalProviderOption,
 ) retrievalmarket.RetrievalProvider {
 	nw2 := rmnet.NewFromLibp2pHost(testData.Host2, rmnet.RetryParameters(0, 0, 0, 0))
 	pieceStore := tut.NewTestPieceStore()
@@ -689,7 +726,7 @@ func setupProvider(
 	require.NoError(t, err)
 	providerDs := namespace.Wrap(testData.Ds2, datastore.NewKey("/retrievals/provider"))
 
-	opts := []retrievalimpl.RetrievalProviderOption{retrievalimpl.DealDeciderOpt(decider)}
+	opts := append([]retrievalimpl.RetrievalProviderOption{retrievalimpl.DealDeciderOpt(decider)}, extraOpts...)
 
 	priceFunc := func(ctx context.Context, dealPricingParams retrievalmarket.PricingInput) (retrievalmarket.Ask, error) {
 		ask := retrievalmarket.Ask{}
@@ -719,6 +756,23 @@ func setupProvider(
 	return provider
 }
 
+// hashSign signs with a hash of the signer and the bytes, which hashVerifier
+// checks
+func hashSign(_ context.Context, signer address.Address, b []byte) (*crypto.Signature, error) {
+	return &crypto.Signature{Type: crypto.SigTypeSecp256k1, Data: hashSignature(signer, b)}, nil
+}
+
+func hashSignature(signer address.Address, b []byte) []byte {
+	sum := sha256.Sum256(append(signer.Bytes(), b...))
+	return sum[:]
+}
+
+type hashVerifier struct{}
+
+func (hashVerifier) VerifySignature(_ context.Context, signature crypto.Signature, signer address.Address, plaintext []byte, _ shared.TipSetToken) (bool, error) {
+	return bytes.Equal(signature.Data, hashSignature(signer, plaintext)), nil
+}
+
 type pmtChan struct {
 	client, miner address.Address
 	amt           abi.TokenAmount
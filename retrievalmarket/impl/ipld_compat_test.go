@@ -105,6 +105,7 @@ func TestIpldCompat_DealProposal(t *testing.T) {
 		assert.Equal(t, drExpected.Params.PaymentInterval, drActual.Params.PaymentInterval, "PaymentInterval")
 		assert.Equal(t, drExpected.Params.PaymentIntervalIncrease, drActual.Params.PaymentIntervalIncrease, "PaymentIntervalIncrease")
 		compareBigInt(t, drExpected.Params.UnsealPrice, drActual.Params.UnsealPrice, "UnsealPrice")
+		assert.Equal(t, drExpected.Params.AccessToken, drActual.Params.AccessToken, "AccessToken")
 	}
 
 	for _, testCase := range []struct {
@@ -124,6 +125,31 @@ func TestIpldCompat_DealProposal(t *testing.T) {
 				UnsealPrice:             abi.NewTokenAmount(2002),
 			},
 		}},
+		// the signer can't be null, so we have to insert it
+		{"empty token", retrievalmarket.DealProposal{
+			PayloadCID: acid,
+			Params: retrievalmarket.Params{
+				AccessToken: &retrievalmarket.AccessToken{Signer: address.TestAddress},
+			},
+		}},
+		{"token", retrievalmarket.DealProposal{
+			PayloadCID: acid,
+			ID:         1010,
+			Params: retrievalmarket.Params{
+				PricePerByte:            abi.NewTokenAmount(1001),
+				PaymentInterval:         20,
+				PaymentIntervalIncrease: 30,
+				UnsealPrice:             abi.NewTokenAmount(2002),
+				AccessToken: &retrievalmarket.AccessToken{
+					PayloadCID: &acid,
+					PieceCID:   &acid,
+					Client:     "client",
+					Expiration: 3003,
+					Signer:     address.TestAddress,
+					Signature:  &crypto.Signature{Type: crypto.SigTypeBLS, Data: []byte("signature")},
+				},
+			},
+		}},
 		{"full", retrievalmarket.DealProposal{
 			PayloadCID: acid,
 			ID:         1010,
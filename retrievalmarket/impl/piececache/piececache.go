@@ -0,0 +1,449 @@
+// Package piececache provides an on-disk, size-bounded LRU cache of unsealed
+// pieces for the retrieval provider.
+//
+// Each cached piece is stored as an indexed CARv2 file named after its piece
+// CID, so that repeated retrievals of a piece that is only held in a sealed
+// sector do not need to unseal it again.
+package piececache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/blockstore"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/stores"
+)
+
+var log = logging.Logger("piececache")
+
+const carExt = ".car"
+const tmpExt = ".tmp"
+
+// ErrNotFound is returned when a piece is not in the cache
+var ErrNotFound = errors.New("piece not found in cache")
+
+// ErrTooLarge is returned when a piece is larger than the size budget of the cache
+var ErrTooLarge = errors.New("piece is larger than the cache size budget")
+
+// FetchFunc returns a reader over the unsealed data for a piece
+type FetchFunc func(ctx context.Context) (io.ReadCloser, error)
+
+type entry struct {
+	pieceCid cid.Cid
+	size     uint64
+	refs     int
+	removed  bool
+	elem     *list.Element
+}
+
+type fetch struct {
+	done chan struct{}
+	err  error
+}
+
+// Cache is an LRU cache of unsealed pieces, stored as CAR files in a
+// directory on disk. The total size of the cached files is kept under a
+// configured budget by evicting the least recently used pieces.
+type Cache struct {
+	dir     string
+	maxSize uint64
+
+	lk       sync.Mutex
+	size     uint64
+	entries  map[cid.Cid]*entry
+	lru      *list.List
+	fetching map[cid.Cid]*fetch
+}
+
+// NewCache returns a cache that stores pieces in dir, using at most maxSize
+// bytes of disk space. Any pieces already in dir are loaded into the cache,
+// ordered by modification time.
+func NewCache(dir string, maxSize uint64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, xerrors.Errorf("creating piece cache directory %s: %w", dir, err)
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxSize:  maxSize,
+		entries:  make(map[cid.Cid]*entry),
+		lru:      list.New(),
+		fetching: make(map[cid.Cid]*fetch),
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("reading piece cache directory %s: %w", dir, err)
+	}
+
+	var infos []os.FileInfo
+	for _, de := range dirEntries {
+		name := de.Name()
+		if strings.HasSuffix(name, tmpExt) {
+			// left over from an interrupted fetch
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if de.IsDir() || !strings.HasSuffix(name, carExt) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			return nil, xerrors.Errorf("reading piece cache file info %s: %w", name, err)
+		}
+		infos = append(infos, info)
+	}
+
+	// the most recently modified files are the most recently used
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		pieceCid, err := cid.Parse(strings.TrimSuffix(info.Name(), carExt))
+		if err != nil {
+			log.Warnf("ignoring unrecognized file %s in piece cache", info.Name())
+			continue
+		}
+		c.insert(pieceCid, uint64(info.Size()))
+	}
+	c.evict(nil)
+
+	return c, nil
+}
+
+// Has returns true if the piece is in the cache
+func (c *Cache) Has(pieceCid cid.Cid) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.entries[pieceCid]
+	return ok && !e.removed
+}
+
+// Get opens a read-only blockstore over a cached piece, marking the piece
+// as most recently used. It returns ErrNotFound if the piece is not cached.
+// The piece will not be evicted until the blockstore is closed.
+func (c *Cache) Get(pieceCid cid.Cid) (stores.ClosableBlockstore, error) {
+	c.lk.Lock()
+	e, ok := c.entries[pieceCid]
+	if !ok || e.removed {
+		c.lk.Unlock()
+		return nil, ErrNotFound
+	}
+	e.refs++
+	c.lru.MoveToFront(e.elem)
+	c.lk.Unlock()
+
+	now := time.Now()
+	_ = os.Chtimes(c.path(pieceCid), now, now)
+
+	bs, err := stores.OpenReadOnly(c.path(pieceCid),
+		carv2.ZeroLengthSectionAsEOF(true),
+		blockstore.UseWholeCIDs(true),
+	)
+	if err != nil {
+		c.release(e)
+		return nil, xerrors.Errorf("opening cached piece %s: %w", pieceCid, err)
+	}
+
+	var once sync.Once
+	return &cachedBlockstore{ReadOnly: bs, closeFn: func() {
+		once.Do(func() { c.release(e) })
+	}}, nil
+}
+
+// GetOrFetch opens a read-only blockstore over the piece, first fetching the
+// unsealed piece into the cache if it is not already there.
+// Concurrent calls for the same piece only fetch the piece once.
+// sizeHint is the expected size of the piece; if it is larger than the size
+// budget of the cache, ErrTooLarge is returned without fetching the piece.
+func (c *Cache) GetOrFetch(ctx context.Context, pieceCid cid.Cid, sizeHint uint64, fetchPiece FetchFunc) (stores.ClosableBlockstore, error) {
+	if sizeHint > c.maxSize {
+		return nil, ErrTooLarge
+	}
+
+	for {
+		bs, err := c.Get(pieceCid)
+		if !errors.Is(err, ErrNotFound) {
+			return bs, err
+		}
+
+		c.lk.Lock()
+		f, ok := c.fetching[pieceCid]
+		if !ok {
+			f = &fetch{done: make(chan struct{})}
+			c.fetching[pieceCid] = f
+			c.lk.Unlock()
+
+			f.err = c.add(ctx, pieceCid, fetchPiece)
+
+			c.lk.Lock()
+			delete(c.fetching, pieceCid)
+			c.lk.Unlock()
+			close(f.done)
+			if f.err != nil {
+				return nil, f.err
+			}
+			continue
+		}
+		c.lk.Unlock()
+
+		// another caller is already fetching this piece, so wait for it to finish
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-f.done:
+		}
+		if f.err != nil {
+			return nil, f.err
+		}
+	}
+}
+
+// Remove invalidates a cached piece. If the piece is in use, its file is
+// deleted once the last blockstore over it is closed.
+func (c *Cache) Remove(pieceCid cid.Cid) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.entries[pieceCid]
+	if !ok || e.removed {
+		return nil
+	}
+	return c.remove(e)
+}
+
+// Size returns the total size in bytes of the cached pieces
+func (c *Cache) Size() uint64 {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.size
+}
+
+// List returns the CIDs of the cached pieces, most recently used first
+func (c *Cache) List() []cid.Cid {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	pieces := make([]cid.Cid, 0, c.lru.Len())
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		if e := elem.Value.(*entry); !e.removed {
+			pieces = append(pieces, e.pieceCid)
+		}
+	}
+	return pieces
+}
+
+// DealLister lists the deals of a storage provider. It is implemented by
+// storagemarket.StorageProvider.
+type DealLister interface {
+	ListLocalDeals() ([]storagemarket.MinerDeal, error)
+}
+
+// endedStates are the states of deals that no longer need their piece
+var endedStates = map[storagemarket.StorageDealStatus]struct{}{
+	storagemarket.StorageDealExpired:   {},
+	storagemarket.StorageDealSlashed:   {},
+	storagemarket.StorageDealRejecting: {},
+	storagemarket.StorageDealFailing:   {},
+	storagemarket.StorageDealError:     {},
+}
+
+// InvalidateOnDealExpiry returns a storage provider subscriber that removes
+// a piece from the cache when a storage deal for that piece expires or is
+// slashed, and no other deal the storage provider lists for the piece is
+// still going. Subscribe it with the storage provider's SubscribeToEvents,
+// passing the same provider as the deal lister.
+func InvalidateOnDealExpiry(c *Cache, deals DealLister) storagemarket.ProviderSubscriber {
+	return func(event storagemarket.ProviderEvent, deal storagemarket.MinerDeal) {
+		if event != storagemarket.ProviderEventDealExpired && event != storagemarket.ProviderEventDealSlashed {
+			return
+		}
+		pieceCid := deal.Proposal.PieceCID
+		others, err := deals.ListLocalDeals()
+		if err != nil {
+			log.Warnf("listing deals to check if piece %s is still in use, keeping it in the cache: %s", pieceCid, err)
+			return
+		}
+		for _, other := range others {
+			if other.ProposalCid == deal.ProposalCid || !other.Proposal.PieceCID.Equals(pieceCid) {
+				continue
+			}
+			if _, ok := endedStates[other.State]; !ok {
+				log.Debugf("keeping piece %s in the cache for deal %d after deal %d ended", pieceCid, other.DealID, deal.DealID)
+				return
+			}
+		}
+		if err := c.Remove(pieceCid); err != nil {
+			log.Warnf("removing piece %s from cache after deal %d ended: %s", pieceCid, deal.DealID, err)
+		}
+	}
+}
+
+// add fetches a piece and writes it to the cache as an indexed CARv2 file
+func (c *Cache) add(ctx context.Context, pieceCid cid.Cid, fetchPiece FetchFunc) error {
+	rdr, err := fetchPiece(ctx)
+	if err != nil {
+		return xerrors.Errorf("fetching piece %s: %w", pieceCid, err)
+	}
+	defer rdr.Close() //nolint:errcheck
+
+	v1Path := c.path(pieceCid) + ".v1" + tmpExt
+	v2Path := c.path(pieceCid) + tmpExt
+	defer os.Remove(v1Path) //nolint:errcheck
+	defer os.Remove(v2Path) //nolint:errcheck
+
+	if err := writeFile(v1Path, rdr); err != nil {
+		return xerrors.Errorf("writing piece %s to cache: %w", pieceCid, err)
+	}
+	if err := wrapV1File(v1Path, v2Path); err != nil {
+		return xerrors.Errorf("indexing piece %s: %w", pieceCid, err)
+	}
+
+	info, err := os.Stat(v2Path)
+	if err != nil {
+		return err
+	}
+	if uint64(info.Size()) > c.maxSize {
+		return ErrTooLarge
+	}
+	if err := os.Rename(v2Path, c.path(pieceCid)); err != nil {
+		return xerrors.Errorf("moving piece %s into cache: %w", pieceCid, err)
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	// don't evict the piece we just added before the caller can open it
+	c.evict(c.insert(pieceCid, uint64(info.Size())))
+	return nil
+}
+
+// insert adds an entry to the front of the LRU list.
+// It must be called with the lock held.
+func (c *Cache) insert(pieceCid cid.Cid, size uint64) *entry {
+	if e, ok := c.entries[pieceCid]; ok {
+		c.size -= e.size
+		e.size = size
+		e.removed = false
+		c.size += size
+		c.lru.MoveToFront(e.elem)
+		return e
+	}
+	e := &entry{pieceCid: pieceCid, size: size}
+	e.elem = c.lru.PushFront(e)
+	c.entries[pieceCid] = e
+	c.size += size
+	return e
+}
+
+// evict removes the least recently used pieces that are not in use (other
+// than keep) until the cache is within its size budget.
+// It must be called with the lock held.
+func (c *Cache) evict(keep *entry) {
+	elem := c.lru.Back()
+	for c.size > c.maxSize && elem != nil {
+		prev := elem.Prev()
+		e := elem.Value.(*entry)
+		if e.refs == 0 && e != keep {
+			log.Debugw("evicting piece from cache", "piece", e.pieceCid, "size", e.size)
+			if err := c.remove(e); err != nil {
+				log.Warnf("evicting piece %s from cache: %s", e.pieceCid, err)
+			}
+		}
+		elem = prev
+	}
+}
+
+// remove deletes an entry, or marks it to be deleted once it is no longer
+// in use.
+// It must be called with the lock held.
+func (c *Cache) remove(e *entry) error {
+	e.removed = true
+	if e.refs > 0 {
+		return nil
+	}
+	c.lru.Remove(e.elem)
+	delete(c.entries, e.pieceCid)
+	c.size -= e.size
+	if err := os.Remove(c.path(e.pieceCid)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *Cache) release(e *entry) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e.refs--
+	if e.refs > 0 {
+		return
+	}
+	if e.removed {
+		if err := c.remove(e); err != nil {
+			log.Warnf("removing piece %s from cache: %s", e.pieceCid, err)
+		}
+		return
+	}
+	c.evict(nil)
+}
+
+func (c *Cache) path(pieceCid cid.Cid) string {
+	return filepath.Join(c.dir, pieceCid.String()+carExt)
+}
+
+type cachedBlockstore struct {
+	*stores.ReadOnly
+	closeFn func()
+}
+
+func (cb *cachedBlockstore) Close() error {
+	defer cb.closeFn()
+	return cb.ReadOnly.Close()
+}
+
+func writeFile(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// wrapV1File indexes an unsealed piece (a CARv1 followed by zero padding)
+// and writes it out as a CARv2 file
+func wrapV1File(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close() //nolint:errcheck
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	if err := carv2.WrapV1(src, dst, carv2.ZeroLengthSectionAsEOF(true)); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
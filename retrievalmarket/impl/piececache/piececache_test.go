@@ -0,0 +1,230 @@
+package piececache_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/piececache"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/stores"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fetches a piece once and serves it from the cache", func(t *testing.T) {
+		c, err := piececache.NewCache(t.TempDir(), 1<<20)
+		require.NoError(t, err)
+
+		pieceCid := testCid(t, "piece")
+		data, blks := testPiece(t, 10)
+		var fetches int32
+		fetch := func(ctx context.Context) (io.ReadCloser, error) {
+			atomic.AddInt32(&fetches, 1)
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+
+		require.False(t, c.Has(pieceCid))
+		_, err = c.Get(pieceCid)
+		require.ErrorIs(t, err, piececache.ErrNotFound)
+
+		for i := 0; i < 2; i++ {
+			bs, err := c.GetOrFetch(ctx, pieceCid, 0, fetch)
+			require.NoError(t, err)
+			for _, blk := range blks {
+				got, err := bs.Get(ctx, blk.Cid())
+				require.NoError(t, err)
+				require.Equal(t, blk.RawData(), got.RawData())
+			}
+			require.NoError(t, bs.Close())
+		}
+		require.EqualValues(t, 1, fetches)
+		require.True(t, c.Has(pieceCid))
+		require.Equal(t, []cid.Cid{pieceCid}, c.List())
+	})
+
+	t.Run("de-duplicates concurrent fetches", func(t *testing.T) {
+		c, err := piececache.NewCache(t.TempDir(), 1<<20)
+		require.NoError(t, err)
+
+		pieceCid := testCid(t, "piece")
+		data, _ := testPiece(t, 10)
+		var fetches int32
+		fetch := func(ctx context.Context) (io.ReadCloser, error) {
+			atomic.AddInt32(&fetches, 1)
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				bs, err := c.GetOrFetch(ctx, pieceCid, 0, fetch)
+				require.NoError(t, err)
+				require.NoError(t, bs.Close())
+			}()
+		}
+		wg.Wait()
+		require.EqualValues(t, 1, fetches)
+	})
+
+	t.Run("evicts least recently used pieces", func(t *testing.T) {
+		data, _ := testPiece(t, 10)
+		pieceA, pieceB, pieceC := testCid(t, "a"), testCid(t, "b"), testCid(t, "c")
+
+		// find the size of a single cached piece
+		sizer, err := piececache.NewCache(t.TempDir(), 1<<20)
+		require.NoError(t, err)
+		put(t, sizer, pieceA, data)
+		pieceSize := sizer.Size()
+
+		c, err := piececache.NewCache(t.TempDir(), 2*pieceSize)
+		require.NoError(t, err)
+		put(t, c, pieceA, data)
+		put(t, c, pieceB, data)
+		// touch piece A so that piece B is the least recently used
+		put(t, c, pieceA, data)
+		put(t, c, pieceC, data)
+
+		require.Equal(t, []cid.Cid{pieceC, pieceA}, c.List())
+		require.Equal(t, 2*pieceSize, c.Size())
+	})
+
+	t.Run("does not evict pieces that are in use", func(t *testing.T) {
+		data, _ := testPiece(t, 10)
+		sizer, err := piececache.NewCache(t.TempDir(), 1<<20)
+		require.NoError(t, err)
+		put(t, sizer, testCid(t, "a"), data)
+		pieceSize := sizer.Size()
+
+		c, err := piececache.NewCache(t.TempDir(), pieceSize)
+		require.NoError(t, err)
+		pieceA, pieceB := testCid(t, "a"), testCid(t, "b")
+		bsA, err := c.GetOrFetch(ctx, pieceA, 0, readerFetch(data))
+		require.NoError(t, err)
+		// piece B can be served while it is in use, but it is the only piece
+		// that can be evicted once it is released
+		put(t, c, pieceB, data)
+		require.Equal(t, []cid.Cid{pieceA}, c.List())
+		require.Equal(t, pieceSize, c.Size())
+
+		require.NoError(t, bsA.Close())
+		require.True(t, c.Has(pieceA))
+	})
+
+	t.Run("rejects pieces larger than the budget", func(t *testing.T) {
+		c, err := piececache.NewCache(t.TempDir(), 100)
+		require.NoError(t, err)
+		_, err = c.GetOrFetch(ctx, testCid(t, "piece"), 200, func(ctx context.Context) (io.ReadCloser, error) {
+			return nil, errors.New("should not fetch")
+		})
+		require.ErrorIs(t, err, piececache.ErrTooLarge)
+	})
+
+	t.Run("reloads pieces from disk", func(t *testing.T) {
+		dir := t.TempDir()
+		data, _ := testPiece(t, 10)
+		c, err := piececache.NewCache(dir, 1<<20)
+		require.NoError(t, err)
+		put(t, c, testCid(t, "piece"), data)
+
+		c2, err := piececache.NewCache(dir, 1<<20)
+		require.NoError(t, err)
+		require.True(t, c2.Has(testCid(t, "piece")))
+		require.Equal(t, c.Size(), c2.Size())
+	})
+
+	t.Run("invalidates pieces when a deal expires", func(t *testing.T) {
+		c, err := piececache.NewCache(t.TempDir(), 1<<20)
+		require.NoError(t, err)
+		data, _ := testPiece(t, 10)
+		pieceCid := testCid(t, "piece")
+		put(t, c, pieceCid, data)
+
+		deal := storagemarket.MinerDeal{ProposalCid: testCid(t, "deal"), State: storagemarket.StorageDealExpired}
+		deal.Proposal.PieceCID = pieceCid
+		other := storagemarket.MinerDeal{ProposalCid: testCid(t, "other"), State: storagemarket.StorageDealActive}
+		other.Proposal.PieceCID = pieceCid
+		unrelated := storagemarket.MinerDeal{ProposalCid: testCid(t, "unrelated"), State: storagemarket.StorageDealActive}
+		unrelated.Proposal.PieceCID = testCid(t, "other piece")
+		lister := &dealLister{deals: []storagemarket.MinerDeal{deal, other, unrelated}}
+		subscriber := piececache.InvalidateOnDealExpiry(c, lister)
+
+		subscriber(storagemarket.ProviderEventDealActivated, deal)
+		require.True(t, c.Has(pieceCid))
+
+		// another deal for the piece is still active
+		subscriber(storagemarket.ProviderEventDealExpired, deal)
+		require.True(t, c.Has(pieceCid))
+
+		// the piece is kept if the deals can't be listed
+		lister.deals[1].State = storagemarket.StorageDealSlashed
+		lister.err = errors.New("listing failed")
+		subscriber(storagemarket.ProviderEventDealExpired, deal)
+		require.True(t, c.Has(pieceCid))
+
+		lister.err = nil
+		subscriber(storagemarket.ProviderEventDealSlashed, lister.deals[1])
+		require.False(t, c.Has(pieceCid))
+		require.Zero(t, c.Size())
+	})
+}
+
+type dealLister struct {
+	deals []storagemarket.MinerDeal
+	err   error
+}
+
+func (l *dealLister) ListLocalDeals() ([]storagemarket.MinerDeal, error) {
+	return l.deals, l.err
+}
+
+func put(t *testing.T, c *piececache.Cache, pieceCid cid.Cid, data []byte) {
+	bs, err := c.GetOrFetch(context.Background(), pieceCid, 0, readerFetch(data))
+	require.NoError(t, err)
+	require.NoError(t, bs.Close())
+}
+
+func readerFetch(data []byte) piececache.FetchFunc {
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+}
+
+// testPiece returns the contents of an unsealed piece: a CARv1 followed by
+// zero padding
+func testPiece(t *testing.T, count int) ([]byte, []blocks.Block) {
+	var blks []blocks.Block
+	for i := 0; i < count; i++ {
+		data := []byte(fmt.Sprintf("block %d", i))
+		blk, err := blocks.NewBlockWithCid(data, testCid(t, string(data)))
+		require.NoError(t, err)
+		blks = append(blks, blk)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, stores.WriteHeader(&stores.CarHeader{Roots: []cid.Cid{blks[0].Cid()}, Version: 1}, &buf))
+	for _, blk := range blks {
+		require.NoError(t, stores.LdWrite(&buf, blk.Cid().Bytes(), blk.RawData()))
+	}
+	buf.Write(make([]byte, 128))
+	return buf.Bytes(), blks
+}
+
+func testCid(t *testing.T, name string) cid.Cid {
+	mh, err := multihash.Sum([]byte(name), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	return cid.NewCidV1(cid.Raw, mh)
+}
@@ -21,13 +21,21 @@ import (
 
 	"github.com/filecoin-project/go-fil-markets/piecestore"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/accesscontrol"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/askstore"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/dtutils"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/piececache"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/providerstates"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/requestvalidation"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/settlement"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/unsealqueue"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/migrations"
 	rmnet "github.com/filecoin-project/go-fil-markets/retrievalmarket/network"
 	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/shared/askgossip"
+	"github.com/filecoin-project/go-fil-markets/shared/denylist"
+	"github.com/filecoin-project/go-fil-markets/shared/drain"
+	"github.com/filecoin-project/go-fil-markets/shared/retention"
 	"github.com/filecoin-project/go-fil-markets/stores"
 )
 
@@ -69,6 +77,17 @@ type Provider struct {
 	retrievalPricingFunc RetrievalPricingFunc
 	dagStore             stores.DAGStoreWrapper
 	stores               *stores.ReadOnlyBlockstores
+	unsealQueue          *unsealqueue.Queue
+	pieceBlockstores     *sharedBlockstores
+	pieceCache           *piececache.Cache
+	settlement           *settlement.Manager
+	archive              *retention.Archive
+	retentionPolicy      retention.Policy
+	retention            *retention.Manager
+	askPublisher         *askgossip.Publisher
+	drainer              *drain.Drainer
+	accessControl        *accesscontrol.Policy
+	denylist             *denylist.Denylist
 }
 
 type internalProviderEvent struct {
@@ -99,6 +118,79 @@ func DealDeciderOpt(dd DealDecider) RetrievalProviderOption {
 	}
 }
 
+// MaxConcurrentUnsealsOpt limits the number of pieces the provider will
+// unseal at the same time. Zero (the default) means no limit.
+//
+// A deal holds its place until the piece's blockstore has been loaded. With an
+// unsealed piece cache (see UnsealedPieceCacheOpt), that is when the whole
+// piece has been unsealed into the cache, so the limit covers the unseal.
+// Without one, the DAG store may unseal the piece lazily as its blocks are
+// read during the transfer, after the deal has given up its place, so the
+// limit only covers acquiring the shard.
+func MaxConcurrentUnsealsOpt(maxConcurrent int) RetrievalProviderOption {
+	return func(provider *Provider) {
+		provider.unsealQueue = unsealqueue.NewQueue(maxConcurrent)
+	}
+}
+
+// UnsealedPieceCacheOpt configures a cache of unsealed pieces, so that
+// pieces that are only held in sealed sectors are unsealed once and then
+// served from the cache on subsequent retrievals. Subscribe
+// piececache.InvalidateOnDealExpiry to the storage provider's events, so that
+// pieces are removed from the cache when their deals expire.
+func UnsealedPieceCacheOpt(cache *piececache.Cache) RetrievalProviderOption {
+	return func(provider *Provider) {
+		provider.pieceCache = cache
+	}
+}
+
+// VoucherSettlementOpt records the payment vouchers the provider receives
+// with the given settlement manager, so that they are redeemed and collected
+// when their payment channels settle. The manager is started and stopped
+// with the provider.
+func VoucherSettlementOpt(m *settlement.Manager) RetrievalProviderOption {
+	return func(provider *Provider) {
+		provider.settlement = m
+		provider.node = m.WrapNode(provider.node)
+	}
+}
+
+// ProviderRetentionOpt moves deals that have been in a terminal state for
+// longer than the policy's maximum age from the provider's deal store to the
+// archive. Archived deals are no longer returned by ListDeals. The archive
+// is swept while the provider is running.
+func ProviderRetentionOpt(archive *retention.Archive, policy retention.Policy) RetrievalProviderOption {
+	return func(p *Provider) {
+		p.archive = archive
+		p.retentionPolicy = policy
+	}
+}
+
+// AskPublisherOpt publishes the provider's retrieval ask with the given
+// publisher when the provider starts and whenever the ask is set
+func AskPublisherOpt(publisher *askgossip.Publisher) RetrievalProviderOption {
+	return func(p *Provider) {
+		p.askPublisher = publisher
+	}
+}
+
+// AccessControlOpt only lets the peers that the policy allows query the
+// provider and retrieve data from it
+func AccessControlOpt(policy *accesscontrol.Policy) RetrievalProviderOption {
+	return func(p *Provider) {
+		p.accessControl = policy
+	}
+}
+
+// DenylistOpt refuses queries and deals for payloads on the denylist. The
+// caller starts and stops the denylist, so that it can be shared with a
+// storage provider.
+func DenylistOpt(dl *denylist.Denylist) RetrievalProviderOption {
+	return func(p *Provider) {
+		p.denylist = dl
+	}
+}
+
 // NewProvider returns a new retrieval Provider
 func NewProvider(minerAddress address.Address,
 	node retrievalmarket.RetrievalProviderNode,
@@ -129,6 +221,13 @@ func NewProvider(minerAddress address.Address,
 		retrievalPricingFunc: retrievalPricingFunc,
 		dagStore:             dagStore,
 		stores:               stores.NewReadOnlyBlockstores(),
+		unsealQueue:          unsealqueue.NewQueue(0),
+		pieceBlockstores:     newSharedBlockstores(),
+	}
+	var err error
+	p.drainer, err = drain.NewDrainer(namespace.Wrap(ds, datastore.NewKey("drain")), p.dealsInFlight, 0)
+	if err != nil {
+		return nil, err
 	}
 
 	askStore, err := askstore.NewAskStore(namespace.Wrap(ds, datastore.NewKey("retrieval-ask")), datastore.NewKey("latest"))
@@ -157,6 +256,10 @@ func NewProvider(minerAddress address.Address,
 		return nil, err
 	}
 	p.Configure(opts...)
+	if p.archive != nil {
+		p.retention = retention.NewManager(p.archive, p.stateMachines, p.retentionDeals, p.retentionPolicy)
+		p.stateMachines = p.archive.Group(p.stateMachines)
+	}
 	p.requestValidator = requestvalidation.NewProviderRequestValidator(&providerValidationEnvironment{p})
 	transportConfigurer := dtutils.TransportConfigurer(network.ID(), &providerStoreGetter{p})
 
@@ -181,6 +284,12 @@ func NewProvider(minerAddress address.Address,
 
 // Stop stops handling incoming requests.
 func (p *Provider) Stop() error {
+	if p.settlement != nil {
+		p.settlement.Stop()
+	}
+	if p.retention != nil {
+		p.retention.Stop()
+	}
 	return p.network.StopHandlingRequests()
 }
 
@@ -192,14 +301,90 @@ func (p *Provider) Start(ctx context.Context) error {
 		if err != nil {
 			log.Errorf("Migrating retrieval provider state machines: %s", err.Error())
 		}
+		if err == nil && p.retention != nil {
+			p.retention.Start()
+		}
+		if err == nil {
+			p.publishAsk(ctx)
+		}
 		err = p.readyMgr.FireReady(err)
 		if err != nil {
 			log.Warnf("Publish retrieval provider ready event: %s", err.Error())
 		}
 	}()
+	if p.settlement != nil {
+		p.settlement.Start()
+	}
 	return p.network.SetDelegate(p)
 }
 
+// Pause stops the provider accepting new retrieval deals, so that it can be
+// drained for maintenance. Deals in progress carry on, and new deals are
+// rejected with drain.MaintenanceMessage as the reason. The provider stays
+// paused if it is restarted, until Resume is called.
+func (p *Provider) Pause() error {
+	return p.drainer.Pause()
+}
+
+// Resume lets the provider accept new retrieval deals again after Pause or
+// Drain
+func (p *Provider) Resume() error {
+	return p.drainer.Resume()
+}
+
+// Paused returns true if the provider is not accepting new retrieval deals
+func (p *Provider) Paused() bool {
+	return p.drainer.Paused()
+}
+
+// DrainProgress returns the number of retrieval deals in flight in each state
+func (p *Provider) DrainProgress(ctx context.Context) (drain.Progress, error) {
+	return p.drainer.Progress(ctx)
+}
+
+// Drain pauses the provider and waits until it has no retrieval deals in
+// flight, so that it can be stopped without breaking any data transfers.
+// onProgress, if not nil, is called with the deals in flight each time they
+// are counted. If deals are still in flight when the context is done or after
+// the timeout, they are returned with an error. The provider stays paused
+// until Resume is called.
+func (p *Provider) Drain(ctx context.Context, timeout time.Duration, onProgress func(drain.Progress)) ([]drain.Deal, error) {
+	return p.drainer.Drain(ctx, timeout, onProgress)
+}
+
+func (p *Provider) dealsInFlight(ctx context.Context) ([]drain.Deal, error) {
+	var deals []retrievalmarket.ProviderDealState
+	if err := p.stateMachines.List(&deals); err != nil {
+		return nil, xerrors.Errorf("listing deals: %w", err)
+	}
+	var inFlight []drain.Deal
+	for _, deal := range deals {
+		if p.stateMachines.IsTerminated(deal) {
+			continue
+		}
+		inFlight = append(inFlight, drain.Deal{ID: deal.Identifier().String(), State: retrievalmarket.DealStatuses[deal.Status]})
+	}
+	return inFlight, nil
+}
+
+// retentionDeals lists the deals in the live deal store for the retention
+// manager
+func (p *Provider) retentionDeals() ([]retention.Deal, error) {
+	var deals []retrievalmarket.ProviderDealState
+	if err := p.stateMachines.List(&deals); err != nil {
+		return nil, err
+	}
+	out := make([]retention.Deal, 0, len(deals))
+	for i := range deals {
+		out = append(out, retention.Deal{
+			ID:       deals[i].Identifier(),
+			Terminal: p.stateMachines.IsTerminated(deals[i]),
+			State:    &deals[i],
+		})
+	}
+	return out, nil
+}
+
 // OnReady registers a listener for when the provider has finished starting up
 func (p *Provider) OnReady(ready shared.ReadyFunc) {
 	p.readyMgr.OnReady(ready)
@@ -222,6 +407,20 @@ func (p *Provider) SubscribeToValidationEvents(subscriber retrievalmarket.Provid
 	return p.requestValidator.Subscribe(subscriber)
 }
 
+// SubscribeToDenylistHits subscribes to the queries and deal proposals that
+// the provider refuses because their payload is on its denylist
+func (p *Provider) SubscribeToDenylistHits(subscriber denylist.Subscriber) retrievalmarket.Unsubscribe {
+	if p.denylist == nil {
+		return func() {}
+	}
+	// the denylist may be shared with a storage provider
+	return retrievalmarket.Unsubscribe(p.denylist.Subscribe(func(hit denylist.Hit) {
+		if hit.Source == denylist.SourceRetrievalQuery || hit.Source == denylist.SourceRetrievalProposal {
+			subscriber(hit)
+		}
+	}))
+}
+
 // GetAsk returns the current deal parameters this provider accepts
 func (p *Provider) GetAsk() *retrievalmarket.Ask {
 	return p.askStore.GetAsk()
@@ -234,6 +433,23 @@ func (p *Provider) SetAsk(ask *retrievalmarket.Ask) {
 
 	if err != nil {
 		log.Warnf("Error setting retrieval ask: %w", err)
+		return
+	}
+	p.publishAsk(context.TODO())
+}
+
+// publishAsk gossips the current retrieval ask, if the provider has an ask
+// publisher
+func (p *Provider) publishAsk(ctx context.Context) {
+	if p.askPublisher == nil {
+		return
+	}
+	ask := p.askStore.GetAsk()
+	if ask == nil {
+		return
+	}
+	if err := p.askPublisher.SetRetrievalAsk(ctx, ask); err != nil {
+		log.Warnf("publishing retrieval ask: %s", err)
 	}
 }
 
@@ -311,6 +527,28 @@ func (p *Provider) HandleQueryStream(stream rmnet.RetrievalQueryStream) {
 		UnsealPrice:     big.Zero(),
 	}
 
+	if p.drainer.Paused() {
+		answer.Message = drain.MaintenanceMessage
+		sendResp(answer)
+		return
+	}
+
+	if p.accessControl != nil {
+		if err := p.accessControl.CheckPeer(stream.RemotePeer()); err != nil {
+			answer.Message = err.Error()
+			sendResp(answer)
+			return
+		}
+	}
+
+	if p.denylist != nil {
+		if err := p.denylist.Check(query.PayloadCID, denylist.SourceRetrievalQuery, stream.RemotePeer()); err != nil {
+			answer.Message = err.Error()
+			sendResp(answer)
+			return
+		}
+	}
+
 	// get chain head to query actor states.
 	tok, _, err := p.node.GetChainHead(ctx)
 	if err != nil {
@@ -359,6 +597,15 @@ func (p *Provider) HandleQueryStream(stream rmnet.RetrievalQueryStream) {
 		return
 	}
 
+	if p.accessControl != nil {
+		err := p.accessControl.Check(ctx, stream.RemotePeer(), query.PayloadCID, pieceInfo.PieceCID, query.AccessToken)
+		if err != nil {
+			answer.Message = err.Error()
+			sendResp(answer)
+			return
+		}
+	}
+
 	answer.Status = retrievalmarket.QueryResponseAvailable
 	answer.Size = uint64(pieceInfo.Deals[0].Length.Unpadded()) // TODO: verify on intermediate
 	answer.PieceCIDFound = retrievalmarket.QueryItemAvailable
@@ -377,6 +624,25 @@ func (p *Provider) HandleQueryStream(stream rmnet.RetrievalQueryStream) {
 		return
 	}
 
+	// the size of a path or range can only be measured without unsealing the
+	// piece
+	if (query.Path != "" || query.Range != nil) && isUnsealed {
+		size, found, err := p.selectionSize(ctx, pieceInfo.PieceCID, query.PayloadCID, query.QueryParams)
+		switch {
+		case err != nil:
+			// the client is quoted for the whole piece
+			log.Warnf("Retrieval query: measuring path %q under %s: %s", query.Path, query.PayloadCID, err)
+		case !found:
+			answer.Status = retrievalmarket.QueryResponseUnavailable
+			answer.Message = fmt.Sprintf("path %q not found under %s", query.Path, query.PayloadCID)
+			sendResp(answer)
+			return
+		default:
+			answer.Size = size
+			answer.PathFound = true
+		}
+	}
+
 	input := retrievalmarket.PricingInput{
 		// piece from which the payload will be retrieved
 		// If user hasn't given a PieceCID, we try to choose an unsealed piece in the call to `getPieceInfoFromCid` above.
@@ -20,7 +20,9 @@ import (
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/dtutils"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/providerstates"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/requestvalidation"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/unsealqueue"
 	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/shared/denylist"
 )
 
 var _ requestvalidation.ValidationEnvironment = new(providerValidationEnvironment)
@@ -99,6 +101,24 @@ func (pve *providerValidationEnvironment) RunDealDecisioningLogic(ctx context.Co
 	return pve.p.dealDecider(ctx, state)
 }
 
+func (pve *providerValidationEnvironment) Paused() bool {
+	return pve.p.drainer.Paused()
+}
+
+func (pve *providerValidationEnvironment) CheckAccess(ctx context.Context, client peer.ID, payloadCid cid.Cid, pieceCid cid.Cid, token *retrievalmarket.AccessToken) error {
+	if pve.p.accessControl == nil {
+		return nil
+	}
+	return pve.p.accessControl.Check(ctx, client, payloadCid, pieceCid, token)
+}
+
+func (pve *providerValidationEnvironment) CheckDenylist(client peer.ID, payloadCid cid.Cid) error {
+	if pve.p.denylist == nil {
+		return nil
+	}
+	return pve.p.denylist.Check(payloadCid, denylist.SourceRetrievalProposal, client)
+}
+
 // StateMachines returns the FSM Group to begin tracking with
 func (pve *providerValidationEnvironment) BeginTracking(pds retrievalmarket.ProviderDealState) error {
 	err := pve.p.stateMachines.Begin(pds.Identifier(), &pds)
@@ -130,11 +150,29 @@ func (pde *providerDealEnvironment) Node() retrievalmarket.RetrievalProviderNode
 	return pde.p.node
 }
 
+// ScheduleUnseal waits for a free slot in the unseal queue. Paid deals are
+// unsealed before free deals, and smaller pieces before larger pieces.
+func (pde *providerDealEnvironment) ScheduleUnseal(ctx context.Context, deal retrievalmarket.ProviderDealState, onPosition unsealqueue.PositionFunc) (unsealqueue.ReleaseFunc, error) {
+	// cached pieces don't need to be unsealed, so they skip the queue
+	if pde.p.pieceCache != nil && pde.p.pieceCache.Has(deal.PieceInfo.PieceCID) {
+		return func() {}, nil
+	}
+	req := unsealqueue.Request{
+		PieceCID: deal.PieceInfo.PieceCID,
+		Paid:     deal.UnsealPrice.GreaterThan(big.Zero()) || deal.PricePerByte.GreaterThan(big.Zero()),
+	}
+	if len(deal.PieceInfo.Deals) > 0 {
+		req.Size = uint64(deal.PieceInfo.Deals[0].Length)
+	}
+	return pde.p.unsealQueue.Acquire(ctx, req, onPosition)
+}
+
 // PrepareBlockstore is called when the deal data has been unsealed and we need
 // to add all blocks to a blockstore that is used to serve retrieval
 func (pde *providerDealEnvironment) PrepareBlockstore(ctx context.Context, dealID retrievalmarket.DealID, pieceCid cid.Cid) error {
-	// Load the blockstore that has the deal data
-	bs, err := pde.p.dagStore.LoadShard(ctx, pieceCid)
+	// Load the blockstore that has the deal data, sharing it with any other
+	// deals that are retrieving from the same piece
+	bs, err := pde.p.pieceBlockstores.acquire(ctx, pieceCid, pde.p.loadPieceBlockstore)
 	if err != nil {
 		return xerrors.Errorf("failed to load blockstore for piece %s: %w", pieceCid, err)
 	}
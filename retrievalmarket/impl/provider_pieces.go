@@ -1,18 +1,34 @@
 package retrievalimpl
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 
+	bstore "github.com/ipfs/boxo/blockstore"
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync/storeutil"
+	"github.com/ipfs/go-unixfsnode"
+	dagpb "github.com/ipld/go-codec-dagpb"
 	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
 	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
 	"github.com/multiformats/go-multihash"
+	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-state-types/abi"
 
 	"github.com/filecoin-project/go-fil-markets/piecestore"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/piececache"
+	"github.com/filecoin-project/go-fil-markets/stores"
 )
 
 // getAllPieceInfoForPayload returns all of the pieces containing the requested Payload CID.
@@ -156,7 +172,17 @@ func linksFromIdentityCid(identityCid cid.Cid) ([]cid.Cid, error) {
 	return resultCids, err
 }
 
+// pieceInUnsealedSector returns true if the piece can be retrieved without
+// unsealing, either because it is in an unsealed sector or because an
+// unsealed copy is in the piece cache
 func (p *Provider) pieceInUnsealedSector(ctx context.Context, pieceInfo piecestore.PieceInfo) bool {
+	if p.pieceCache != nil && p.pieceCache.Has(pieceInfo.PieceCID) {
+		return true
+	}
+	return p.hasUnsealedSector(ctx, pieceInfo)
+}
+
+func (p *Provider) hasUnsealedSector(ctx context.Context, pieceInfo piecestore.PieceInfo) bool {
 	for _, di := range pieceInfo.Deals {
 		isUnsealed, err := p.sa.IsUnsealed(ctx, di.SectorID, di.Offset.Unpadded(), di.Length.Unpadded())
 		if err != nil {
@@ -171,6 +197,54 @@ func (p *Provider) pieceInUnsealedSector(ctx context.Context, pieceInfo piecesto
 	return false
 }
 
+// loadPieceBlockstore returns a blockstore over the data in a piece.
+// If a piece cache is configured, the piece is served from the cache,
+// and pieces that are only in sealed sectors are unsealed into the cache.
+// Otherwise the piece is loaded from the DAG store.
+func (p *Provider) loadPieceBlockstore(ctx context.Context, pieceCid cid.Cid) (stores.ClosableBlockstore, error) {
+	if p.pieceCache == nil {
+		return p.dagStore.LoadShard(ctx, pieceCid)
+	}
+
+	bs, err := p.pieceCache.Get(pieceCid)
+	if err == nil {
+		log.Debugf("serving piece %s from unsealed piece cache", pieceCid)
+		return bs, nil
+	}
+	if !errors.Is(err, piececache.ErrNotFound) {
+		log.Warnf("reading piece %s from unsealed piece cache: %s", pieceCid, err)
+	}
+
+	pieceInfo, err := p.pieceStore.GetPieceInfo(pieceCid)
+	if err != nil || len(pieceInfo.Deals) == 0 || p.hasUnsealedSector(ctx, pieceInfo) {
+		return p.dagStore.LoadShard(ctx, pieceCid)
+	}
+
+	sizeHint := uint64(pieceInfo.Deals[0].Length.Unpadded())
+	bs, err = p.pieceCache.GetOrFetch(ctx, pieceCid, sizeHint, func(ctx context.Context) (io.ReadCloser, error) {
+		return p.unsealPiece(ctx, pieceInfo)
+	})
+	if err != nil {
+		log.Warnf("caching unsealed piece %s, falling back to DAG store: %s", pieceCid, err)
+		return p.dagStore.LoadShard(ctx, pieceCid)
+	}
+	return bs, nil
+}
+
+// unsealPiece unseals the piece from the first sector that can be unsealed
+func (p *Provider) unsealPiece(ctx context.Context, pieceInfo piecestore.PieceInfo) (io.ReadCloser, error) {
+	var lastErr error
+	for _, di := range pieceInfo.Deals {
+		rdr, err := p.sa.UnsealSector(ctx, di.SectorID, di.Offset.Unpadded(), di.Length.Unpadded())
+		if err == nil {
+			return rdr, nil
+		}
+		log.Warnf("failed to unseal piece %s from sector %d: %s", pieceInfo.PieceCID, di.SectorID, err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("unsealing piece %s: %w", pieceInfo.PieceCID, lastErr)
+}
+
 func (p *Provider) getStorageDealsForPiece(clientSpecificPiece bool, pieces []piecestore.PieceInfo, pieceInfo piecestore.PieceInfo) []abi.DealID {
 	var storageDeals []abi.DealID
 	if clientSpecificPiece {
@@ -235,3 +309,88 @@ func (p *Provider) getBestPieceInfoMatch(ctx context.Context, pieces []piecestor
 
 	return piecestore.PieceInfoUndefined, false
 }
+
+// selectionSize walks the UnixFS path and byte range of a query under the
+// payload in an unsealed piece, and returns the size of the blocks that
+// retrieving them transfers, and whether they exist
+func (p *Provider) selectionSize(ctx context.Context, pieceCid cid.Cid, payloadCid cid.Cid, params retrievalmarket.QueryParams) (uint64, bool, error) {
+	bs, err := p.loadPieceBlockstore(ctx, pieceCid)
+	if err != nil {
+		return 0, false, xerrors.Errorf("loading piece %s: %w", pieceCid, err)
+	}
+	defer bs.Close() //nolint:errcheck
+
+	// the entity at the end of the path is matched, so that the walk tells
+	// whether the path exists
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	target := ssb.ExploreUnion(ssb.Matcher(), unixfsnode.ExploreAllRecursivelySelector)
+	if params.Range != nil {
+		target = params.Range.Selector(ssb)
+	}
+	sel, err := selector.CompileSelector(unixfsnode.UnixFSPathSelectorBuilder(params.Path, target, false))
+	if err != nil {
+		return 0, false, xerrors.Errorf("compiling selector for path %s: %w", params.Path, err)
+	}
+
+	var size uint64
+	seen := cid.NewSet()
+	lsys := storeutil.LinkSystemForBlockstore(bstore.NewIdStore(bs))
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	readOpener := lsys.StorageReadOpener
+	lsys.StorageReadOpener = func(lctx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+		r, err := readOpener(lctx, lnk)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		c := lnk.(cidlink.Link).Cid
+		if c.Prefix().MhType != multihash.IDENTITY && seen.Visit(c) {
+			size += uint64(len(data))
+		}
+		return bytes.NewReader(data), nil
+	}
+	chooser := dagpb.AddSupportToChooser(basicnode.Chooser)
+
+	rootLnk := cidlink.Link{Cid: payloadCid}
+	lctx := linking.LinkContext{Ctx: ctx}
+	np, err := chooser(rootLnk, lctx)
+	if err != nil {
+		return 0, false, err
+	}
+	root, err := lsys.Load(lctx, rootLnk, np)
+	if err != nil {
+		return 0, false, xerrors.Errorf("loading payload root %s: %w", payloadCid, err)
+	}
+
+	found := false
+	err = traversal.Progress{
+		Cfg: &traversal.Config{
+			Ctx:                            ctx,
+			LinkSystem:                     lsys,
+			LinkTargetNodePrototypeChooser: chooser,
+		},
+	}.WalkAdv(root, sel, func(_ traversal.Progress, n datamodel.Node, reason traversal.VisitReason) error {
+		if reason != traversal.VisitReason_SelectionMatch {
+			return nil
+		}
+		found = true
+		// the blocks holding a byte range are only loaded when the range is
+		// read, as graphsync does when it sends it
+		if lbn, ok := n.(datamodel.LargeBytesNode); ok {
+			r, err := lbn.AsLargeBytes()
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(io.Discard, r)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, xerrors.Errorf("walking path %s under %s: %w", params.Path, payloadCid, err)
+	}
+	return size, found, nil
+}
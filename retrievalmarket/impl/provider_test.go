@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -30,6 +32,7 @@ import (
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/testnodes"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/migrations/maptypes"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/network"
+	"github.com/filecoin-project/go-fil-markets/shared/denylist"
 	tut "github.com/filecoin-project/go-fil-markets/shared_testutil"
 )
 
@@ -815,6 +818,40 @@ func TestHandleQueryStream(t *testing.T) {
 			expectedUnsealPrice:             expectedUnsealPrice,
 		},
 
+		{name: "When a range is queried from a sealed piece, the whole piece is priced",
+			expFunc: func(t *testing.T, pieceStore *tut.TestPieceStore, dagStore *tut.MockDagStoreWrapper) {
+				pieceStore.ExpectPiece(expectedPieceCID, expectedPiece)
+				dagStore.AddBlockToPieceIndex(payloadCID, expectedPieceCID)
+			},
+			query: retrievalmarket.NewQueryForRange(payloadCID, "dir/file", retrievalmarket.ByteRange{Offset: 10, Length: 100}, nil),
+			expResp: retrievalmarket.QueryResponse{
+				Status:        retrievalmarket.QueryResponseAvailable,
+				PieceCIDFound: retrievalmarket.QueryItemAvailable,
+				Size:          expectedSize,
+			},
+			expectedPricePerByte:            expectedPricePerByte,
+			expectedPaymentInterval:         expectedPaymentInterval,
+			expectedPaymentIntervalIncrease: expectedPaymentIntervalIncrease,
+			expectedUnsealPrice:             expectedUnsealPrice,
+		},
+
+		{name: "When a path is queried from a sealed piece, the whole piece is priced",
+			expFunc: func(t *testing.T, pieceStore *tut.TestPieceStore, dagStore *tut.MockDagStoreWrapper) {
+				pieceStore.ExpectPiece(expectedPieceCID, expectedPiece)
+				dagStore.AddBlockToPieceIndex(payloadCID, expectedPieceCID)
+			},
+			query: retrievalmarket.NewQueryForPath(payloadCID, "dir/file", nil),
+			expResp: retrievalmarket.QueryResponse{
+				Status:        retrievalmarket.QueryResponseAvailable,
+				PieceCIDFound: retrievalmarket.QueryItemAvailable,
+				Size:          expectedSize,
+			},
+			expectedPricePerByte:            expectedPricePerByte,
+			expectedPaymentInterval:         expectedPaymentInterval,
+			expectedPaymentIntervalIncrease: expectedPaymentIntervalIncrease,
+			expectedUnsealPrice:             expectedUnsealPrice,
+		},
+
 		{name: "When QueryParams has PieceCID and is missing",
 			expFunc: func(t *testing.T, ps *tut.TestPieceStore, dagStore *tut.MockDagStoreWrapper) {
 				loadPieceCIDS(t, ps, payloadCID, cid.Undef)
@@ -1047,6 +1084,44 @@ func TestHandleQueryStream(t *testing.T) {
 		pieceStore.VerifyExpectations(t)
 	})
 
+	t.Run("denylisted payload", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "denylist")
+		require.NoError(t, os.WriteFile(path, []byte(payloadCID.String()+"\n"), 0644))
+		dl, err := denylist.New([]string{path}, 0)
+		require.NoError(t, err)
+
+		node := testnodes.NewTestRetrievalProviderNode()
+		sa := testnodes.NewTestSectorAccessor()
+		pieceStore := tut.NewTestPieceStore()
+		dagStore := tut.NewMockDagStoreWrapper(pieceStore, sa)
+		net := tut.NewTestRetrievalMarketNetwork(tut.TestNetworkParams{})
+		priceFunc := func(ctx context.Context, dealPricingParams retrievalmarket.PricingInput) (retrievalmarket.Ask, error) {
+			return retrievalmarket.Ask{}, nil
+		}
+		p, err := retrievalimpl.NewProvider(expectedAddress, node, sa, net, pieceStore, dagStore, tut.NewTestDataTransfer(),
+			dss.MutexWrap(datastore.NewMapDatastore()), priceFunc, retrievalimpl.DenylistOpt(dl))
+		require.NoError(t, err)
+		tut.StartAndWaitForReady(ctx, t, p)
+
+		var hits []denylist.Hit
+		unsub := p.SubscribeToDenylistHits(func(hit denylist.Hit) {
+			hits = append(hits, hit)
+		})
+		defer unsub()
+
+		qs := readWriteQueryStream()
+		require.NoError(t, qs.WriteQuery(retrievalmarket.Query{PayloadCID: payloadCID}))
+		net.ReceiveQueryStream(qs)
+		response, err := qs.ReadQueryResponse()
+		require.NoError(t, err)
+		require.Equal(t, retrievalmarket.QueryResponseUnavailable, response.Status)
+		require.Contains(t, response.Message, denylist.ErrDenied.Error())
+		require.Equal(t, []denylist.Hit{{Cid: payloadCID, Source: denylist.SourceRetrievalQuery, Peer: expectedPeer}}, hits)
+
+		// hits from a storage provider sharing the denylist are left out
+		require.Error(t, dl.Check(payloadCID, denylist.SourceStorageProposal, expectedPeer))
+		require.Len(t, hits, 1)
+	})
 }
 
 func TestProvider_Construct(t *testing.T) {
@@ -3,6 +3,7 @@ package providerstates
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
@@ -14,6 +15,7 @@ import (
 	"github.com/filecoin-project/go-statemachine/fsm"
 
 	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/unsealqueue"
 )
 
 var log = logging.Logger("retrieval-fsm")
@@ -23,6 +25,9 @@ var log = logging.Logger("retrieval-fsm")
 type ProviderDealEnvironment interface {
 	// Node returns the node interface for this deal
 	Node() rm.RetrievalProviderNode
+	// ScheduleUnseal waits until the deal is allowed to start unsealing, calling
+	// onPosition with the deal's position in the unseal queue while it waits
+	ScheduleUnseal(ctx context.Context, deal rm.ProviderDealState, onPosition unsealqueue.PositionFunc) (unsealqueue.ReleaseFunc, error)
 	PrepareBlockstore(ctx context.Context, dealID rm.DealID, pieceCid cid.Cid) error
 	DeleteStore(dealID rm.DealID) error
 	ResumeDataTransfer(context.Context, datatransfer.ChannelID) error
@@ -34,6 +39,17 @@ type ProviderDealEnvironment interface {
 // UnsealData fetches the piece containing data needed for the retrieval,
 // unsealing it if necessary
 func UnsealData(ctx fsm.Context, environment ProviderDealEnvironment, deal rm.ProviderDealState) error {
+	release, err := environment.ScheduleUnseal(ctx.Context(), deal, func(position int, queueLength int) {
+		sendQueuePosition(ctx, environment, deal, position, queueLength)
+	})
+	if err != nil {
+		return ctx.Trigger(rm.ProviderEventUnsealError, err)
+	}
+	// the deal gives up its place in the queue once the blockstore is loaded,
+	// which doesn't cover unsealing that the DAG store does lazily as blocks
+	// are read (see retrievalimpl.MaxConcurrentUnsealsOpt)
+	defer release()
+
 	if err := environment.PrepareBlockstore(ctx.Context(), deal.ID, deal.PieceInfo.PieceCID); err != nil {
 		return ctx.Trigger(rm.ProviderEventUnsealError, err)
 	}
@@ -41,6 +57,32 @@ func UnsealData(ctx fsm.Context, environment ProviderDealEnvironment, deal rm.Pr
 	return ctx.Trigger(rm.ProviderEventUnsealComplete)
 }
 
+// sendQueuePosition tells the client where its deal is in the unseal queue
+func sendQueuePosition(ctx fsm.Context, environment ProviderDealEnvironment, deal rm.ProviderDealState, position int, queueLength int) {
+	if deal.ChannelID == nil {
+		return
+	}
+	log.Debugf("deal %d is waiting to unseal: position %d of %d", deal.ID, position, queueLength)
+
+	dr := rm.DealResponse{
+		ID:      deal.ID,
+		Status:  rm.DealStatusUnsealQueued,
+		Message: fmt.Sprintf("queued for unsealing: position %d of %d", position, queueLength),
+	}
+	node := rm.BindnodeRegistry.TypeToNode(&dr)
+	vr := datatransfer.ValidationResult{
+		Accepted:             true,
+		ForcePause:           true,
+		RequiresFinalization: true,
+		DataLimit:            deal.Params.NextInterval(deal.FundsReceived),
+		VoucherResult:        &datatransfer.TypedVoucher{Voucher: node, Type: rm.DealResponseType},
+	}
+	err := environment.UpdateValidationStatus(ctx.Context(), *deal.ChannelID, vr)
+	if err != nil {
+		log.Warnf("sending unseal queue position for deal %d: %s", deal.ID, err)
+	}
+}
+
 // UnpauseDeal resumes a deal so we can start sending data after its unsealed
 func UnpauseDeal(ctx fsm.Context, environment ProviderDealEnvironment, deal rm.ProviderDealState) error {
 	log.Debugf("unpausing data transfer for deal %d", deal.ID)
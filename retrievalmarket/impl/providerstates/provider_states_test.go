@@ -106,6 +106,43 @@ func TestUnsealData(t *testing.T) {
 		require.Equal(t, dealState.Status, rm.DealStatusFailing)
 		require.Equal(t, dealState.Message, "Something went wrong")
 	})
+
+	t.Run("ScheduleUnseal error", func(t *testing.T) {
+		node := testnodes.NewTestRetrievalProviderNode()
+		dealState := makeDeals()
+		setupEnv := func(fe *rmtesting.TestProviderDealEnvironment) {
+			fe.ScheduleUnsealError = errors.New("context cancelled")
+		}
+		runUnsealData(t, node, setupEnv, dealState)
+		require.Equal(t, dealState.Status, rm.DealStatusFailing)
+		require.Equal(t, dealState.Message, "context cancelled")
+	})
+
+	t.Run("sends queue position while waiting to unseal", func(t *testing.T) {
+		node := testnodes.NewTestRetrievalProviderNode()
+		dealState := makeDeals()
+		dealState.ChannelID = &datatransfer.ChannelID{
+			Initiator: "initiator",
+			Responder: dealState.Receiver,
+			ID:        1,
+		}
+		var environment *rmtesting.TestProviderDealEnvironment
+		setupEnv := func(fe *rmtesting.TestProviderDealEnvironment) {
+			fe.UnsealQueuePositions = []int{2, 1}
+			environment = fe
+		}
+		runUnsealData(t, node, setupEnv, dealState)
+		require.Equal(t, dealState.Status, rm.DealStatusUnsealed)
+
+		// the last position sent should be the front of the queue
+		vr := environment.NewValidationStatus
+		require.True(t, vr.Accepted)
+		require.True(t, vr.ForcePause)
+		resp, err := rm.DealResponseFromNode(vr.VoucherResult.Voucher)
+		require.NoError(t, err)
+		require.Equal(t, rm.DealStatusUnsealQueued, resp.Status)
+		require.Equal(t, "queued for unsealing: position 1 of 2", resp.Message)
+	})
 }
 
 func TestUnpauseDeal(t *testing.T) {
@@ -19,6 +19,7 @@ import (
 	"github.com/filecoin-project/go-fil-markets/piecestore"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/shared/drain"
 )
 
 var allSelector = selectorparse.CommonSelector_ExploreAllRecursively
@@ -36,6 +37,15 @@ type ValidationEnvironment interface {
 	RunDealDecisioningLogic(ctx context.Context, state rm.ProviderDealState) (bool, string, error)
 	// StateMachines returns the FSM Group to begin tracking with
 	BeginTracking(pds rm.ProviderDealState) error
+	// Paused returns true if the provider is in maintenance mode and is not
+	// accepting new deals
+	Paused() bool
+	// CheckAccess returns an error if the client may not retrieve the payload
+	// from the piece
+	CheckAccess(ctx context.Context, client peer.ID, payloadCid cid.Cid, pieceCid cid.Cid, token *rm.AccessToken) error
+	// CheckDenylist returns an error if the payload is on the provider's
+	// content denylist
+	CheckDenylist(client peer.ID, payloadCid cid.Cid) error
 	Get(dealID rm.ProviderDealIdentifier) (rm.ProviderDealState, error)
 }
 
@@ -123,6 +133,14 @@ func (rv *ProviderRequestValidator) validatePull(receiver peer.ID, proposal *rm.
 		return rejectProposal(proposal, rm.DealStatusRejected, "incorrect selector specified for this proposal")
 	}
 
+	if rv.env.Paused() {
+		return rejectProposal(proposal, rm.DealStatusRejected, drain.MaintenanceMessage)
+	}
+
+	if err := rv.env.CheckDenylist(receiver, proposal.PayloadCID); err != nil {
+		return rejectProposal(proposal, rm.DealStatusRejected, err.Error())
+	}
+
 	// This is a new graphsync request (not a restart)
 	deal := rm.ProviderDealState{
 		DealProposal: *proposal,
@@ -140,6 +158,10 @@ func (rv *ProviderRequestValidator) validatePull(receiver peer.ID, proposal *rm.
 	ctx, cancel := context.WithTimeout(context.TODO(), askTimeout)
 	defer cancel()
 
+	if err := rv.env.CheckAccess(ctx, receiver, deal.PayloadCID, pieceInfo.PieceCID, deal.AccessToken); err != nil {
+		return rejectProposal(proposal, rm.DealStatusRejected, err.Error())
+	}
+
 	ask, err := rv.env.GetAsk(ctx, deal.PayloadCID, deal.PieceCID, pieceInfo, isUnsealed, deal.Receiver)
 	if err != nil {
 		return rejectProposal(proposal, rm.DealStatusErrored, err.Error())
@@ -20,6 +20,7 @@ import (
 	"github.com/filecoin-project/go-fil-markets/piecestore"
 	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/requestvalidation"
+	"github.com/filecoin-project/go-fil-markets/shared/drain"
 	"github.com/filecoin-project/go-fil-markets/shared_testutil"
 )
 
@@ -137,6 +138,36 @@ func TestValidatePull(t *testing.T) {
 			voucher:       proposalVoucher,
 			expectedError: errors.New("everything is awful"),
 		},
+		"provider is paused": {
+			fve: fakeValidationEnvironment{
+				RunDealDecisioningLogicAccepted: true,
+				IsPaused:                        true,
+			},
+			baseCid:               proposal.PayloadCID,
+			selector:              selectorparse.CommonSelector_ExploreAllRecursively,
+			voucher:               proposalVoucher,
+			expectedVoucherResult: dealResponseToVoucher(t, rm.DealStatusRejected, proposal.ID, drain.MaintenanceMessage, nil),
+		},
+		"content is denylisted": {
+			fve: fakeValidationEnvironment{
+				RunDealDecisioningLogicAccepted: true,
+				CheckDenylistError:              errors.New("content is denylisted"),
+			},
+			baseCid:               proposal.PayloadCID,
+			selector:              selectorparse.CommonSelector_ExploreAllRecursively,
+			voucher:               proposalVoucher,
+			expectedVoucherResult: dealResponseToVoucher(t, rm.DealStatusRejected, proposal.ID, "content is denylisted", nil),
+		},
+		"access denied": {
+			fve: fakeValidationEnvironment{
+				RunDealDecisioningLogicAccepted: true,
+				CheckAccessError:                errors.New("access denied"),
+			},
+			baseCid:               proposal.PayloadCID,
+			selector:              selectorparse.CommonSelector_ExploreAllRecursively,
+			voucher:               proposalVoucher,
+			expectedVoucherResult: dealResponseToVoucher(t, rm.DealStatusRejected, proposal.ID, "access denied", nil),
+		},
 		"success": {
 			fve: fakeValidationEnvironment{
 				RunDealDecisioningLogicAccepted: true,
@@ -310,6 +341,9 @@ type fakeValidationEnvironment struct {
 	RunDealDecisioningLogicFailReason string
 	RunDealDecisioningLogicError      error
 	BeginTrackingError                error
+	IsPaused                          bool
+	CheckAccessError                  error
+	CheckDenylistError                error
 
 	Ask      rm.Ask
 	GetDeal  rm.ProviderDealState
@@ -340,6 +374,18 @@ func (fve *fakeValidationEnvironment) BeginTracking(pds rm.ProviderDealState) er
 	return fve.BeginTrackingError
 }
 
+func (fve *fakeValidationEnvironment) Paused() bool {
+	return fve.IsPaused
+}
+
+func (fve *fakeValidationEnvironment) CheckAccess(ctx context.Context, client peer.ID, payloadCid cid.Cid, pieceCid cid.Cid, token *rm.AccessToken) error {
+	return fve.CheckAccessError
+}
+
+func (fve *fakeValidationEnvironment) CheckDenylist(client peer.ID, payloadCid cid.Cid) error {
+	return fve.CheckDenylistError
+}
+
 func (fve *fakeValidationEnvironment) Get(dealID rm.ProviderDealIdentifier) (rm.ProviderDealState, error) {
 	return fve.GetDeal, fve.GetError
 }
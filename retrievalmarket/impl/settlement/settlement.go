@@ -0,0 +1,535 @@
+// Package settlement makes sure a retrieval provider is paid for the vouchers
+// it receives.
+//
+// Vouchers are only worth something once they are redeemed on-chain. A
+// payment channel can be settled by either party, after which the provider
+// has a limited time to submit its best voucher for each lane before the
+// channel is collected. The Manager records the best voucher it has received
+// for each lane of each payment channel, watches the channels for settlement,
+// submits any vouchers that have not been redeemed while a channel is
+// settling, and collects the channel's funds once settlement has finished,
+// collecting it again if the collect message fails.
+package settlement
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	paychtypes "github.com/filecoin-project/go-state-types/builtin/v8/paych"
+
+	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/shared"
+)
+
+var log = logging.Logger("retrieval-settlement")
+
+// DefaultPollInterval is how often the Manager checks the state of payment
+// channels by default
+const DefaultPollInterval = 10 * time.Minute
+
+// DefaultMinCollectBackoff and DefaultMaxCollectBackoff are the bounds of the
+// delay before retrying a payment channel collect that failed, by default
+const (
+	DefaultMinCollectBackoff = time.Minute
+	DefaultMaxCollectBackoff = time.Hour
+)
+
+// vouchersPrefix is the namespace of the Manager's keys in its datastore
+var vouchersPrefix = datastore.NewKey("/vouchers")
+
+// Option configures a Manager
+type Option func(m *Manager)
+
+// PollInterval sets how often the Manager checks the state of payment
+// channels
+func PollInterval(interval time.Duration) Option {
+	return func(m *Manager) {
+		m.interval = interval
+	}
+}
+
+// CollectBackoff sets the bounds of the delay before retrying a payment
+// channel collect that failed. The delay starts at min and doubles with each
+// failure, up to max.
+func CollectBackoff(min, max time.Duration) Option {
+	return func(m *Manager) {
+		m.minBackoff = min
+		m.maxBackoff = max
+	}
+}
+
+// ChannelRevenue is the revenue from a single payment channel
+type ChannelRevenue struct {
+	PaymentChannel address.Address
+	// Lanes is the number of lanes with a voucher
+	Lanes int
+	// Vouchered is the total amount of the best voucher in each lane
+	Vouchered abi.TokenAmount
+	// Redeemed is the amount redeemed on-chain, as of the last check
+	Redeemed abi.TokenAmount
+	// SettlingAt is the epoch at which the channel finishes settling, or
+	// zero if it is not settling
+	SettlingAt abi.ChainEpoch
+}
+
+type laneKey struct {
+	paych address.Address
+	lane  uint64
+}
+
+// collectRetry is when a failed collect is next attempted
+type collectRetry struct {
+	failures int
+	at       time.Time
+}
+
+// Manager records the best voucher received for each payment channel lane,
+// and redeems and collects them when the payment channel settles
+type Manager struct {
+	ds         datastore.Batching
+	node       rm.RetrievalProviderSettlementNode
+	interval   time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	lk         sync.Mutex
+	states     map[address.Address]rm.PaymentChannelState
+	submitted  map[laneKey]abi.TokenAmount
+	collecting map[address.Address]cid.Cid
+	retries    map[address.Address]collectRetry
+
+	runLk  sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewManager returns a new Manager that stores vouchers in the given
+// datastore, under the /vouchers namespace
+func NewManager(ds datastore.Batching, node rm.RetrievalProviderSettlementNode, opts ...Option) *Manager {
+	m := &Manager{
+		ds:         ds,
+		node:       node,
+		interval:   DefaultPollInterval,
+		minBackoff: DefaultMinCollectBackoff,
+		maxBackoff: DefaultMaxCollectBackoff,
+		states:     make(map[address.Address]rm.PaymentChannelState),
+		submitted:  make(map[laneKey]abi.TokenAmount),
+		collecting: make(map[address.Address]cid.Cid),
+		retries:    make(map[address.Address]collectRetry),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Start begins checking payment channels periodically. A Manager that has
+// been stopped can be started again. Starting a Manager that is running has
+// no effect.
+func (m *Manager) Start() {
+	m.runLk.Lock()
+	defer m.runLk.Unlock()
+	if m.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.wg.Add(1)
+	go m.run(ctx)
+}
+
+// Stop stops checking payment channels
+func (m *Manager) Stop() {
+	m.runLk.Lock()
+	defer m.runLk.Unlock()
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	m.cancel = nil
+	m.wg.Wait()
+}
+
+func (m *Manager) run(ctx context.Context) {
+	defer m.wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		if err := m.Check(ctx); err != nil && ctx.Err() == nil {
+			log.Errorf("checking payment channels: %s", err)
+		}
+		timer.Reset(m.nextCheck())
+	}
+}
+
+// nextCheck returns how long to wait before the next check: the poll
+// interval, or less if a failed collect is due to be retried sooner
+func (m *Manager) nextCheck() time.Duration {
+	wait := m.interval
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	for _, retry := range m.retries {
+		if until := time.Until(retry.at); until < wait {
+			wait = until
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// RecordVoucher records a voucher received for a payment channel, if it is
+// the best voucher seen so far for its lane
+func (m *Manager) RecordVoucher(paymentChannel address.Address, voucher *paychtypes.SignedVoucher) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	key := voucherKey(paymentChannel, voucher.Lane)
+	best, err := m.getVoucher(key)
+	if err != nil && !xerrors.Is(err, datastore.ErrNotFound) {
+		return err
+	}
+	if best != nil && best.Amount.GreaterThanEqual(voucher.Amount) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := voucher.MarshalCBOR(&buf); err != nil {
+		return xerrors.Errorf("serializing voucher: %w", err)
+	}
+	return m.ds.Put(context.TODO(), key, buf.Bytes())
+}
+
+// WrapNode returns a RetrievalProviderNode that records every voucher that
+// is successfully saved through the given node
+func (m *Manager) WrapNode(node rm.RetrievalProviderNode) rm.RetrievalProviderNode {
+	return &recordingNode{RetrievalProviderNode: node, m: m}
+}
+
+// Check does a single pass over all payment channels with vouchers: it
+// submits unredeemed vouchers for channels that are settling, and collects
+// channels that have finished settling
+func (m *Manager) Check(ctx context.Context) error {
+	vouchers, err := m.listVouchers()
+	if err != nil {
+		return err
+	}
+
+	tok, epoch, err := m.node.GetChainHead(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting chain head: %w", err)
+	}
+
+	for paych, lanes := range vouchers {
+		if err := m.checkChannel(ctx, tok, epoch, paych, lanes); err != nil {
+			log.Errorf("checking payment channel %s: %s", paych, err)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) checkChannel(ctx context.Context, tok shared.TipSetToken, epoch abi.ChainEpoch, paych address.Address, lanes []*paychtypes.SignedVoucher) error {
+	state, err := m.node.GetPaymentChannelState(ctx, paych, tok)
+	if err != nil {
+		return xerrors.Errorf("getting payment channel state: %w", err)
+	}
+
+	m.lk.Lock()
+	m.states[paych] = state
+	m.lk.Unlock()
+
+	if state.Collected {
+		log.Infow("payment channel collected", "paych", paych)
+		return m.removeChannel(paych)
+	}
+
+	// nothing to do until someone starts settling the channel
+	if state.SettlingAt == 0 {
+		return nil
+	}
+
+	if epoch < state.SettlingAt {
+		for _, voucher := range lanes {
+			if err := m.submitVoucher(ctx, paych, state, voucher); err != nil {
+				log.Errorf("submitting voucher for payment channel %s lane %d: %s", paych, voucher.Lane, err)
+			}
+		}
+		return nil
+	}
+
+	if epoch < state.MinSettleHeight {
+		return nil
+	}
+	return m.collect(ctx, paych)
+}
+
+func (m *Manager) submitVoucher(ctx context.Context, paych address.Address, state rm.PaymentChannelState, voucher *paychtypes.SignedVoucher) error {
+	if redeemed, ok := state.LaneRedeemed[voucher.Lane]; ok && redeemed.GreaterThanEqual(voucher.Amount) {
+		return nil
+	}
+
+	key := laneKey{paych: paych, lane: voucher.Lane}
+	m.lk.Lock()
+	submitted, ok := m.submitted[key]
+	m.lk.Unlock()
+	if ok && submitted.GreaterThanEqual(voucher.Amount) {
+		// already submitted, waiting for the message to land on chain
+		return nil
+	}
+
+	msgCID, err := m.node.SubmitPaymentVoucher(ctx, paych, voucher)
+	if err != nil {
+		return err
+	}
+	log.Infow("submitted payment voucher", "paych", paych, "lane", voucher.Lane, "amount", voucher.Amount, "msg", msgCID)
+
+	m.lk.Lock()
+	m.submitted[key] = voucher.Amount
+	m.lk.Unlock()
+	return nil
+}
+
+// collect collects the payment channel, or checks on the collect message if
+// it has already been sent. If sending the message fails, or the message
+// fails on chain, the collect is retried with exponential backoff.
+func (m *Manager) collect(ctx context.Context, paych address.Address) error {
+	m.lk.Lock()
+	pending, ok := m.collecting[paych]
+	retry, retrying := m.retries[paych]
+	m.lk.Unlock()
+	if ok {
+		return m.checkCollect(ctx, paych, pending)
+	}
+	if retrying && time.Now().Before(retry.at) {
+		return nil
+	}
+
+	msgCID, err := m.node.CollectPaymentChannel(ctx, paych)
+	if err != nil {
+		return m.collectFailed(paych, err)
+	}
+	log.Infow("collecting payment channel", "paych", paych, "msg", msgCID)
+
+	m.lk.Lock()
+	m.collecting[paych] = msgCID
+	delete(m.retries, paych)
+	m.lk.Unlock()
+	return nil
+}
+
+// checkCollect looks up a collect message that has been sent. Once it has
+// succeeded, the channel is forgotten when its state shows it was collected.
+func (m *Manager) checkCollect(ctx context.Context, paych address.Address, msgCID cid.Cid) error {
+	code, found, err := m.node.LookupMessage(ctx, msgCID)
+	if err != nil {
+		return xerrors.Errorf("looking up collect message %s: %w", msgCID, err)
+	}
+	if !found || code.IsSuccess() {
+		return nil
+	}
+
+	m.lk.Lock()
+	delete(m.collecting, paych)
+	m.lk.Unlock()
+	return m.collectFailed(paych, xerrors.Errorf("collect message %s failed with exit code %s", msgCID, code))
+}
+
+// collectFailed schedules the next attempt to collect the payment channel
+func (m *Manager) collectFailed(paych address.Address, err error) error {
+	m.lk.Lock()
+	retry := m.retries[paych]
+	retry.failures++
+	retry.at = time.Now().Add(m.backoff(retry.failures))
+	m.retries[paych] = retry
+	m.lk.Unlock()
+	return xerrors.Errorf("collecting (attempt %d, retrying at %s): %w", retry.failures, retry.at.Format(time.RFC3339), err)
+}
+
+// backoff returns the delay before retrying a collect that has failed the
+// given number of times
+func (m *Manager) backoff(failures int) time.Duration {
+	backoff := m.minBackoff
+	for i := 1; i < failures && backoff < m.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > m.maxBackoff {
+		backoff = m.maxBackoff
+	}
+	return backoff
+}
+
+// removeChannel forgets about a payment channel once it has been collected
+func (m *Manager) removeChannel(paych address.Address) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	res, err := m.ds.Query(context.TODO(), query.Query{Prefix: channelKey(paych).String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := m.ds.Delete(context.TODO(), datastore.NewKey(entry.Key)); err != nil {
+			return err
+		}
+	}
+
+	delete(m.states, paych)
+	delete(m.collecting, paych)
+	delete(m.retries, paych)
+	for key := range m.submitted {
+		if key.paych == paych {
+			delete(m.submitted, key)
+		}
+	}
+	return nil
+}
+
+// Revenue returns the revenue from each payment channel that has not yet
+// been collected
+func (m *Manager) Revenue() ([]ChannelRevenue, error) {
+	vouchers, err := m.listVouchers()
+	if err != nil {
+		return nil, err
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	revenue := make([]ChannelRevenue, 0, len(vouchers))
+	for paych, lanes := range vouchers {
+		state := m.states[paych]
+		rev := ChannelRevenue{
+			PaymentChannel: paych,
+			Lanes:          len(lanes),
+			Vouchered:      big.Zero(),
+			Redeemed:       big.Zero(),
+			SettlingAt:     state.SettlingAt,
+		}
+		for _, voucher := range lanes {
+			rev.Vouchered = big.Add(rev.Vouchered, voucher.Amount)
+		}
+		for _, redeemed := range state.LaneRedeemed {
+			rev.Redeemed = big.Add(rev.Redeemed, redeemed)
+		}
+		revenue = append(revenue, rev)
+	}
+	return revenue, nil
+}
+
+// UncollectedRevenue returns the total amount of the best vouchers for all
+// payment channels that have not yet been collected, less the amount already
+// redeemed in each lane as of the last check
+func (m *Manager) UncollectedRevenue() (abi.TokenAmount, error) {
+	vouchers, err := m.listVouchers()
+	if err != nil {
+		return big.Zero(), err
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	total := big.Zero()
+	for paych, lanes := range vouchers {
+		state := m.states[paych]
+		for _, voucher := range lanes {
+			unredeemed := voucher.Amount
+			if redeemed, ok := state.LaneRedeemed[voucher.Lane]; ok {
+				unredeemed = big.Sub(unredeemed, redeemed)
+			}
+			if unredeemed.GreaterThan(big.Zero()) {
+				total = big.Add(total, unredeemed)
+			}
+		}
+	}
+	return total, nil
+}
+
+func (m *Manager) getVoucher(key datastore.Key) (*paychtypes.SignedVoucher, error) {
+	data, err := m.ds.Get(context.TODO(), key)
+	if err != nil {
+		return nil, err
+	}
+	var voucher paychtypes.SignedVoucher
+	if err := voucher.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+		return nil, xerrors.Errorf("deserializing voucher %s: %w", key, err)
+	}
+	return &voucher, nil
+}
+
+// listVouchers returns the best voucher for each lane, grouped by payment
+// channel
+func (m *Manager) listVouchers() (map[address.Address][]*paychtypes.SignedVoucher, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	res, err := m.ds.Query(context.TODO(), query.Query{Prefix: vouchersPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	vouchers := make(map[address.Address][]*paychtypes.SignedVoucher)
+	for _, entry := range entries {
+		key := datastore.NewKey(entry.Key)
+		paych, err := address.NewFromString(key.Parent().BaseNamespace())
+		if err != nil {
+			return nil, xerrors.Errorf("parsing payment channel from key %s: %w", key, err)
+		}
+		var voucher paychtypes.SignedVoucher
+		if err := voucher.UnmarshalCBOR(bytes.NewReader(entry.Value)); err != nil {
+			return nil, xerrors.Errorf("deserializing voucher %s: %w", key, err)
+		}
+		vouchers[paych] = append(vouchers[paych], &voucher)
+	}
+	return vouchers, nil
+}
+
+func channelKey(paych address.Address) datastore.Key {
+	return vouchersPrefix.ChildString(paych.String())
+}
+
+func voucherKey(paych address.Address, lane uint64) datastore.Key {
+	return channelKey(paych).ChildString(strconv.FormatUint(lane, 10))
+}
+
+type recordingNode struct {
+	rm.RetrievalProviderNode
+	m *Manager
+}
+
+func (n *recordingNode) SavePaymentVoucher(ctx context.Context, paymentChannel address.Address, voucher *paychtypes.SignedVoucher, proof []byte, expectedAmount abi.TokenAmount, tok shared.TipSetToken) (abi.TokenAmount, error) {
+	received, err := n.RetrievalProviderNode.SavePaymentVoucher(ctx, paymentChannel, voucher, proof, expectedAmount, tok)
+	if err != nil {
+		return received, err
+	}
+	if err := n.m.RecordVoucher(paymentChannel, voucher); err != nil {
+		log.Errorf("recording voucher for payment channel %s: %s", paymentChannel, err)
+	}
+	return received, nil
+}
@@ -0,0 +1,269 @@
+package settlement_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	paychtypes "github.com/filecoin-project/go-state-types/builtin/v8/paych"
+	"github.com/filecoin-project/go-state-types/exitcode"
+
+	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/settlement"
+	"github.com/filecoin-project/go-fil-markets/shared"
+	tut "github.com/filecoin-project/go-fil-markets/shared_testutil"
+)
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	paych, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+
+	voucher := func(lane uint64, amount int64) *paychtypes.SignedVoucher {
+		return &paychtypes.SignedVoucher{ChannelAddr: paych, Lane: lane, Amount: abi.NewTokenAmount(amount)}
+	}
+
+	t.Run("keeps the best voucher per lane", func(t *testing.T) {
+		m := settlement.NewManager(dss.MutexWrap(datastore.NewMapDatastore()), newFakeNode())
+		require.NoError(t, m.RecordVoucher(paych, voucher(0, 100)))
+		require.NoError(t, m.RecordVoucher(paych, voucher(0, 50)))
+		require.NoError(t, m.RecordVoucher(paych, voucher(1, 30)))
+
+		uncollected, err := m.UncollectedRevenue()
+		require.NoError(t, err)
+		require.Equal(t, abi.NewTokenAmount(130), uncollected)
+
+		revenue, err := m.Revenue()
+		require.NoError(t, err)
+		require.Len(t, revenue, 1)
+		require.Equal(t, paych, revenue[0].PaymentChannel)
+		require.Equal(t, 2, revenue[0].Lanes)
+	})
+
+	t.Run("does nothing while the channel is not settling", func(t *testing.T) {
+		node := newFakeNode()
+		m := settlement.NewManager(dss.MutexWrap(datastore.NewMapDatastore()), node)
+		require.NoError(t, m.RecordVoucher(paych, voucher(0, 100)))
+
+		require.NoError(t, m.Check(ctx))
+		require.Empty(t, node.submitted)
+		require.Empty(t, node.collected)
+	})
+
+	t.Run("submits unredeemed vouchers while settling, then collects", func(t *testing.T) {
+		node := newFakeNode()
+		m := settlement.NewManager(dss.MutexWrap(datastore.NewMapDatastore()), node)
+		require.NoError(t, m.RecordVoucher(paych, voucher(0, 100)))
+		require.NoError(t, m.RecordVoucher(paych, voucher(1, 30)))
+
+		node.epoch = 10
+		node.state = rm.PaymentChannelState{
+			SettlingAt:   20,
+			LaneRedeemed: map[uint64]abi.TokenAmount{1: abi.NewTokenAmount(30)},
+		}
+		require.NoError(t, m.Check(ctx))
+		require.Equal(t, []uint64{0}, node.submitted)
+
+		// the voucher that has been redeemed is no longer uncollected revenue
+		uncollected, err := m.UncollectedRevenue()
+		require.NoError(t, err)
+		require.Equal(t, abi.NewTokenAmount(100), uncollected)
+
+		// the voucher is not submitted again while the message is pending
+		require.NoError(t, m.Check(ctx))
+		require.Equal(t, []uint64{0}, node.submitted)
+
+		// once settlement has finished the channel is collected
+		node.epoch = 20
+		require.NoError(t, m.Check(ctx))
+		require.Equal(t, []address.Address{paych}, node.collected)
+
+		// the channel is not collected again while the message is pending
+		require.NoError(t, m.Check(ctx))
+		require.Len(t, node.collectAttempts(), 1)
+
+		// once the channel has been collected it is forgotten
+		node.state = rm.PaymentChannelState{Collected: true}
+		require.NoError(t, m.Check(ctx))
+		uncollected, err = m.UncollectedRevenue()
+		require.NoError(t, err)
+		require.True(t, uncollected.IsZero())
+	})
+
+	t.Run("retries a failed collect with backoff", func(t *testing.T) {
+		node := newFakeNode()
+		m := settlement.NewManager(dss.MutexWrap(datastore.NewMapDatastore()), node, settlement.CollectBackoff(100*time.Millisecond, time.Second))
+		require.NoError(t, m.RecordVoucher(paych, voucher(0, 100)))
+
+		node.epoch = 20
+		node.state = rm.PaymentChannelState{SettlingAt: 20}
+		node.collectErr = errors.New("out of gas")
+		require.NoError(t, m.Check(ctx))
+		require.Len(t, node.collectAttempts(), 1)
+
+		// the collect is not attempted again until the backoff has passed
+		require.NoError(t, m.Check(ctx))
+		require.Len(t, node.collectAttempts(), 1)
+
+		node.setCollectErr(nil)
+		require.Eventually(t, func() bool {
+			require.NoError(t, m.Check(ctx))
+			return len(node.collectAttempts()) == 2
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, []address.Address{paych}, node.collected)
+	})
+
+	t.Run("retries a collect that fails on chain", func(t *testing.T) {
+		node := newFakeNode()
+		m := settlement.NewManager(dss.MutexWrap(datastore.NewMapDatastore()), node, settlement.CollectBackoff(100*time.Millisecond, time.Second))
+		require.NoError(t, m.RecordVoucher(paych, voucher(0, 100)))
+
+		node.epoch = 20
+		node.state = rm.PaymentChannelState{SettlingAt: 20}
+		require.NoError(t, m.Check(ctx))
+		require.Len(t, node.collectAttempts(), 1)
+
+		// the message lands on chain but fails
+		node.setMessageResult(node.lastCollect(), exitcode.ErrInsufficientFunds)
+		require.NoError(t, m.Check(ctx))
+		require.Len(t, node.collectAttempts(), 1)
+
+		// the collect is sent again once the backoff has passed
+		require.Eventually(t, func() bool {
+			require.NoError(t, m.Check(ctx))
+			return len(node.collectAttempts()) == 2
+		}, time.Second, 10*time.Millisecond)
+		node.setMessageResult(node.lastCollect(), exitcode.Ok)
+		require.NoError(t, m.Check(ctx))
+		require.Len(t, node.collectAttempts(), 2)
+	})
+
+	t.Run("only reads its own namespace", func(t *testing.T) {
+		ds := dss.MutexWrap(datastore.NewMapDatastore())
+		require.NoError(t, ds.Put(ctx, datastore.NewKey("/other/key"), []byte("not a voucher")))
+		m := settlement.NewManager(ds, newFakeNode())
+		require.NoError(t, m.RecordVoucher(paych, voucher(0, 100)))
+
+		uncollected, err := m.UncollectedRevenue()
+		require.NoError(t, err)
+		require.Equal(t, abi.NewTokenAmount(100), uncollected)
+	})
+
+	t.Run("can be restarted after stopping", func(t *testing.T) {
+		node := newFakeNode()
+		m := settlement.NewManager(dss.MutexWrap(datastore.NewMapDatastore()), node, settlement.PollInterval(time.Hour))
+		m.Start()
+		m.Stop()
+
+		require.NoError(t, m.RecordVoucher(paych, voucher(0, 100)))
+		node.epoch = 20
+		node.state = rm.PaymentChannelState{SettlingAt: 20}
+		m.Start()
+		defer m.Stop()
+		require.Eventually(t, func() bool {
+			return len(node.collectAttempts()) == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("records vouchers saved through the node", func(t *testing.T) {
+		m := settlement.NewManager(dss.MutexWrap(datastore.NewMapDatastore()), newFakeNode())
+		node := m.WrapNode(&savingNode{})
+		_, err := node.SavePaymentVoucher(ctx, paych, voucher(0, 100), nil, abi.NewTokenAmount(0), nil)
+		require.NoError(t, err)
+
+		uncollected, err := m.UncollectedRevenue()
+		require.NoError(t, err)
+		require.Equal(t, abi.NewTokenAmount(100), uncollected)
+	})
+}
+
+type fakeNode struct {
+	lk         sync.Mutex
+	epoch      abi.ChainEpoch
+	state      rm.PaymentChannelState
+	submitted  []uint64
+	collected  []address.Address
+	attempts   []address.Address
+	collectErr error
+	collectMsg cid.Cid
+	messages   map[cid.Cid]exitcode.ExitCode
+}
+
+func newFakeNode() *fakeNode {
+	return &fakeNode{messages: make(map[cid.Cid]exitcode.ExitCode)}
+}
+
+func (n *fakeNode) GetChainHead(ctx context.Context) (shared.TipSetToken, abi.ChainEpoch, error) {
+	return []byte{1, 2, 3}, n.epoch, nil
+}
+
+func (n *fakeNode) GetPaymentChannelState(ctx context.Context, paymentChannel address.Address, tok shared.TipSetToken) (rm.PaymentChannelState, error) {
+	return n.state, nil
+}
+
+func (n *fakeNode) SubmitPaymentVoucher(ctx context.Context, paymentChannel address.Address, voucher *paychtypes.SignedVoucher) (cid.Cid, error) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	n.submitted = append(n.submitted, voucher.Lane)
+	return tut.GenerateCids(1)[0], nil
+}
+
+func (n *fakeNode) setCollectErr(err error) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	n.collectErr = err
+}
+
+func (n *fakeNode) collectAttempts() []address.Address {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	return append([]address.Address{}, n.attempts...)
+}
+
+func (n *fakeNode) CollectPaymentChannel(ctx context.Context, paymentChannel address.Address) (cid.Cid, error) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	n.attempts = append(n.attempts, paymentChannel)
+	if n.collectErr != nil {
+		return cid.Undef, n.collectErr
+	}
+	n.collected = append(n.collected, paymentChannel)
+	n.collectMsg = tut.GenerateCids(1)[0]
+	return n.collectMsg, nil
+}
+
+func (n *fakeNode) lastCollect() cid.Cid {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	return n.collectMsg
+}
+
+func (n *fakeNode) setMessageResult(mcid cid.Cid, code exitcode.ExitCode) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	n.messages[mcid] = code
+}
+
+func (n *fakeNode) LookupMessage(ctx context.Context, mcid cid.Cid) (exitcode.ExitCode, bool, error) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	code, ok := n.messages[mcid]
+	return code, ok, nil
+}
+
+type savingNode struct {
+	rm.RetrievalProviderNode
+}
+
+func (n *savingNode) SavePaymentVoucher(ctx context.Context, paymentChannel address.Address, voucher *paychtypes.SignedVoucher, proof []byte, expectedAmount abi.TokenAmount, tok shared.TipSetToken) (abi.TokenAmount, error) {
+	return voucher.Amount, nil
+}
@@ -0,0 +1,115 @@
+package retrievalimpl
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-fil-markets/stores"
+)
+
+// sharedBlockstores lets concurrent deals for the same piece share a single
+// blockstore, so that the piece is only unsealed and loaded once however many
+// deals are retrieving from it
+type sharedBlockstores struct {
+	lk     sync.Mutex
+	pieces map[cid.Cid]*sharedBlockstore
+}
+
+type sharedBlockstore struct {
+	ready  chan struct{}
+	loaded bool
+	bs     stores.ClosableBlockstore
+	err    error
+	refs   int
+}
+
+func newSharedBlockstores() *sharedBlockstores {
+	return &sharedBlockstores{pieces: make(map[cid.Cid]*sharedBlockstore)}
+}
+
+// acquire returns a handle on the blockstore for the piece. The first deal for
+// a piece starts loading the blockstore; deals that arrive while it is loading
+// or open share it. The load isn't tied to any one deal, so that a deal that
+// is cancelled doesn't fail the others waiting for the same piece: each deal
+// only stops waiting when its own context is done. The underlying blockstore
+// is closed when every handle has been closed.
+func (s *sharedBlockstores) acquire(ctx context.Context, pieceCid cid.Cid, load func(context.Context, cid.Cid) (stores.ClosableBlockstore, error)) (stores.ClosableBlockstore, error) {
+	s.lk.Lock()
+	sb, ok := s.pieces[pieceCid]
+	if !ok {
+		sb = &sharedBlockstore{ready: make(chan struct{})}
+		s.pieces[pieceCid] = sb
+		go s.load(pieceCid, sb, load)
+	}
+	sb.refs++
+	s.lk.Unlock()
+
+	select {
+	case <-sb.ready:
+	case <-ctx.Done():
+		s.release(pieceCid, sb)
+		return nil, ctx.Err()
+	}
+
+	if sb.err != nil {
+		s.release(pieceCid, sb)
+		return nil, sb.err
+	}
+	return &sharedBlockstoreHandle{ClosableBlockstore: sb.bs, release: func() error {
+		return s.release(pieceCid, sb)
+	}}, nil
+}
+
+func (s *sharedBlockstores) load(pieceCid cid.Cid, sb *sharedBlockstore, load func(context.Context, cid.Cid) (stores.ClosableBlockstore, error)) {
+	bs, err := load(context.Background(), pieceCid)
+
+	s.lk.Lock()
+	sb.bs, sb.err, sb.loaded = bs, err, true
+	// let later deals try to load the piece again if it failed, and close it
+	// if every deal waiting for it gave up
+	unused := sb.refs == 0
+	if (err != nil || unused) && s.pieces[pieceCid] == sb {
+		delete(s.pieces, pieceCid)
+	}
+	s.lk.Unlock()
+	close(sb.ready)
+
+	if err == nil && unused {
+		if err := bs.Close(); err != nil {
+			log.Warnf("closing unused blockstore for piece %s: %s", pieceCid, err)
+		}
+	}
+}
+
+func (s *sharedBlockstores) release(pieceCid cid.Cid, sb *sharedBlockstore) error {
+	s.lk.Lock()
+	sb.refs--
+	// a piece that is still loading is closed once it has loaded
+	last := sb.refs == 0 && sb.loaded
+	if last && s.pieces[pieceCid] == sb {
+		delete(s.pieces, pieceCid)
+	}
+	s.lk.Unlock()
+
+	if last && sb.bs != nil {
+		return sb.bs.Close()
+	}
+	return nil
+}
+
+// sharedBlockstoreHandle is one deal's reference to a shared blockstore
+type sharedBlockstoreHandle struct {
+	stores.ClosableBlockstore
+	once    sync.Once
+	release func() error
+}
+
+func (h *sharedBlockstoreHandle) Close() error {
+	var err error
+	h.once.Do(func() {
+		err = h.release()
+	})
+	return err
+}
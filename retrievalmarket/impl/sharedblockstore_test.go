@@ -0,0 +1,185 @@
+package retrievalimpl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bstore "github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/shared_testutil"
+	"github.com/filecoin-project/go-fil-markets/stores"
+)
+
+type countingBlockstore struct {
+	bstore.Blockstore
+	closes int32
+}
+
+func (c *countingBlockstore) Close() error {
+	atomic.AddInt32(&c.closes, 1)
+	return nil
+}
+
+func (c *countingBlockstore) closed() int {
+	return int(atomic.LoadInt32(&c.closes))
+}
+
+func TestSharedBlockstores(t *testing.T) {
+	ctx := context.Background()
+	pieceCid := shared_testutil.GenerateCids(1)[0]
+	b := shared_testutil.GenerateBlocksOfSize(1, 1024)[0]
+	underlying := &countingBlockstore{Blockstore: bstore.NewBlockstore(ds.NewMapDatastore())}
+	require.NoError(t, underlying.Put(ctx, b))
+
+	// the load is held open until every deal has asked for the piece
+	loads := 0
+	unblock := make(chan struct{})
+	load := func(context.Context, cid.Cid) (stores.ClosableBlockstore, error) {
+		loads++
+		<-unblock
+		return underlying, nil
+	}
+
+	s := newSharedBlockstores()
+	const deals = 3
+	handles := make([]stores.ClosableBlockstore, deals)
+	var wg sync.WaitGroup
+	for i := 0; i < deals; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bs, err := s.acquire(ctx, pieceCid, load)
+			require.NoError(t, err)
+			handles[i] = bs
+		}()
+	}
+	require.Eventually(t, func() bool {
+		s.lk.Lock()
+		defer s.lk.Unlock()
+		return s.pieces[pieceCid] != nil && s.pieces[pieceCid].refs == deals
+	}, time.Second, time.Millisecond)
+	close(unblock)
+	wg.Wait()
+	require.Equal(t, 1, loads)
+
+	for _, h := range handles {
+		blk, err := h.Get(ctx, b.Cid())
+		require.NoError(t, err)
+		require.Equal(t, b, blk)
+	}
+
+	// the piece is only closed once the last deal is done with it
+	require.NoError(t, handles[0].Close())
+	require.NoError(t, handles[0].Close())
+	require.NoError(t, handles[1].Close())
+	require.Equal(t, 0, underlying.closed())
+	require.NoError(t, handles[2].Close())
+	require.Equal(t, 1, underlying.closed())
+
+	// once it has been closed, the next deal loads it again
+	_, err := s.acquire(ctx, pieceCid, func(context.Context, cid.Cid) (stores.ClosableBlockstore, error) {
+		loads++
+		return underlying, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, loads)
+}
+
+func TestSharedBlockstoresLoadError(t *testing.T) {
+	ctx := context.Background()
+	pieceCid := shared_testutil.GenerateCids(1)[0]
+	s := newSharedBlockstores()
+
+	_, err := s.acquire(ctx, pieceCid, func(context.Context, cid.Cid) (stores.ClosableBlockstore, error) {
+		return nil, errors.New("unseal failed")
+	})
+	require.EqualError(t, err, "unseal failed")
+
+	// a failed load is not cached
+	underlying := &countingBlockstore{Blockstore: bstore.NewBlockstore(ds.NewMapDatastore())}
+	bs, err := s.acquire(ctx, pieceCid, func(context.Context, cid.Cid) (stores.ClosableBlockstore, error) {
+		return underlying, nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, bs.Close())
+	require.Equal(t, 1, underlying.closed())
+}
+
+func TestSharedBlockstoresCancelledDeal(t *testing.T) {
+	pieceCid := shared_testutil.GenerateCids(1)[0]
+	underlying := &countingBlockstore{Blockstore: bstore.NewBlockstore(ds.NewMapDatastore())}
+	unblock := make(chan struct{})
+	load := func(ctx context.Context, _ cid.Cid) (stores.ClosableBlockstore, error) {
+		select {
+		case <-unblock:
+			return underlying, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	s := newSharedBlockstores()
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := s.acquire(firstCtx, pieceCid, load)
+		firstErr <- err
+	}()
+	type result struct {
+		bs  stores.ClosableBlockstore
+		err error
+	}
+	second := make(chan result, 1)
+	go func() {
+		bs, err := s.acquire(context.Background(), pieceCid, load)
+		second <- result{bs, err}
+	}()
+	require.Eventually(t, func() bool {
+		s.lk.Lock()
+		defer s.lk.Unlock()
+		return s.pieces[pieceCid] != nil && s.pieces[pieceCid].refs == 2
+	}, time.Second, time.Millisecond)
+
+	// cancelling the deal that started the load only stops that deal waiting
+	cancelFirst()
+	require.ErrorIs(t, <-firstErr, context.Canceled)
+	close(unblock)
+	res := <-second
+	require.NoError(t, res.err)
+	require.NoError(t, res.bs.Close())
+	require.Equal(t, 1, underlying.closed())
+}
+
+func TestSharedBlockstoresAllDealsCancelled(t *testing.T) {
+	pieceCid := shared_testutil.GenerateCids(1)[0]
+	underlying := &countingBlockstore{Blockstore: bstore.NewBlockstore(ds.NewMapDatastore())}
+	unblock := make(chan struct{})
+	loaded := make(chan struct{})
+	s := newSharedBlockstores()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.acquire(ctx, pieceCid, func(context.Context, cid.Cid) (stores.ClosableBlockstore, error) {
+		defer close(loaded)
+		<-unblock
+		return underlying, nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	// a piece that loads after every deal has given up on it is closed
+	close(unblock)
+	<-loaded
+	require.Eventually(t, func() bool {
+		s.lk.Lock()
+		defer s.lk.Unlock()
+		return s.pieces[pieceCid] == nil
+	}, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool { return underlying.closed() == 1 }, time.Second, time.Millisecond)
+}
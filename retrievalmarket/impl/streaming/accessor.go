@@ -0,0 +1,108 @@
+package streaming
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	bstore "github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"golang.org/x/xerrors"
+
+	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+)
+
+// Accessor is a retrievalmarket.BlockstoreAccessor that streams the blocks
+// of a deal to a writer as they are stored in the blockstore provided by the
+// wrapped accessor
+type Accessor struct {
+	inner rm.BlockstoreAccessor
+
+	lk      sync.Mutex
+	streams map[rm.DealID]*Stream
+}
+
+var _ rm.BlockstoreAccessor = (*Accessor)(nil)
+
+// NewAccessor returns an Accessor that wraps the given BlockstoreAccessor
+func NewAccessor(inner rm.BlockstoreAccessor) *Accessor {
+	return &Accessor{
+		inner:   inner,
+		streams: make(map[rm.DealID]*Stream),
+	}
+}
+
+// Stream registers a writer for a deal's data. It must be called before the
+// retrieval starts, using an ID reserved with RetrievalClient.NextID.
+// The stream is finished when the deal completes.
+func (a *Accessor) Stream(id rm.DealID, format Format, w io.Writer) (*Stream, error) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	if _, ok := a.streams[id]; ok {
+		return nil, xerrors.Errorf("deal %d already has a stream", id)
+	}
+	s := newStream(format, w)
+	a.streams[id] = s
+	return s, nil
+}
+
+// Get returns the blockstore for a deal. If the deal has a stream, blocks put
+// to the blockstore are also written to the stream.
+func (a *Accessor) Get(id rm.DealID, payloadCid rm.PayloadCID) (bstore.Blockstore, error) {
+	bs, err := a.inner.Get(id, payloadCid)
+	if err != nil {
+		return nil, err
+	}
+
+	a.lk.Lock()
+	s, ok := a.streams[id]
+	a.lk.Unlock()
+	if !ok {
+		return bs, nil
+	}
+
+	s.start(payloadCid)
+	return &streamingBlockstore{Blockstore: bs, s: s}, nil
+}
+
+// Done finishes the deal's stream, if it has one, and then calls Done on the
+// wrapped accessor
+func (a *Accessor) Done(id rm.DealID) error {
+	a.lk.Lock()
+	s, ok := a.streams[id]
+	delete(a.streams, id)
+	a.lk.Unlock()
+
+	if ok {
+		if err := s.finish(); err != nil {
+			log.Warnf("stream for retrieval deal %d finished with error: %s", id, err)
+		}
+	}
+	return a.inner.Done(id)
+}
+
+// streamingBlockstore writes blocks to a stream after they have been stored
+type streamingBlockstore struct {
+	bstore.Blockstore
+	s *Stream
+}
+
+func (sb *streamingBlockstore) Put(ctx context.Context, blk blocks.Block) error {
+	if err := sb.Blockstore.Put(ctx, blk); err != nil {
+		return err
+	}
+	return sb.s.received(ctx, blk, sb.Blockstore.Get)
+}
+
+func (sb *streamingBlockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	if err := sb.Blockstore.PutMany(ctx, blks); err != nil {
+		return err
+	}
+	for _, blk := range blks {
+		if err := sb.s.received(ctx, blk, sb.Blockstore.Get); err != nil {
+			return err
+		}
+	}
+	return nil
+}
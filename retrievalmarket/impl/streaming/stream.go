@@ -0,0 +1,298 @@
+// Package streaming lets a retrieval client consume the data for a deal while
+// it is being retrieved, instead of waiting for the deal to complete.
+//
+// An Accessor wraps the client's BlockstoreAccessor. For each deal that has
+// a Stream registered, blocks are written to the stream's writer as they are
+// received and validated, either as a CARv1 stream in traversal order, or as
+// the contents of a UnixFS file.
+//
+// Writes happen synchronously while the block is being stored, so a consumer
+// that reads slowly from the writer (eg one end of an io.Pipe) slows down the
+// retrieval. The stream's state is not locked while writing, so a slow
+// consumer does not block calls to Err or BytesWritten.
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipld/unixfs"
+	unixfspb "github.com/ipfs/boxo/ipld/unixfs/pb"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/stores"
+)
+
+var log = logging.Logger("retrieval-streaming")
+
+// Format is the format of the data written to a stream
+type Format int
+
+const (
+	// FormatCARv1 writes a CARv1 with the payload CID as its root, followed
+	// by each block in the order it is received
+	FormatCARv1 Format = iota
+	// FormatUnixFSFile writes the contents of the UnixFS file with the
+	// payload CID as its root
+	FormatUnixFSFile
+)
+
+// ErrIncomplete is the error of a UnixFS stream whose deal finished before
+// the whole file was received
+var ErrIncomplete = xerrors.New("retrieval finished before the whole file was received")
+
+// getBlockFunc returns a block that has already been received
+type getBlockFunc func(ctx context.Context, c cid.Cid) (blocks.Block, error)
+
+// Stream writes the blocks of a single retrieval to a writer
+type Stream struct {
+	format Format
+	w      io.Writer
+	// writeLk is held while writing to w, so that data is written in the
+	// order it was queued
+	writeLk sync.Mutex
+
+	lk      sync.Mutex
+	root    cid.Cid
+	started bool
+	written uint64
+	err     error
+	done    chan struct{}
+
+	// whether the header has been written and which blocks have been written
+	// to a CAR stream
+	headerWritten bool
+	seen          *cid.Set
+	// the blocks of a UnixFS file still to be written, in order
+	pending []cid.Cid
+	// data that is ready to be written to w, in order
+	queued [][]byte
+}
+
+func newStream(format Format, w io.Writer) *Stream {
+	return &Stream{
+		format: format,
+		w:      w,
+		done:   make(chan struct{}),
+		seen:   cid.NewSet(),
+	}
+}
+
+// Done returns a channel that is closed once the stream is finished
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that stopped the stream, if any
+func (s *Stream) Err() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.err
+}
+
+// BytesWritten returns the number of bytes written to the writer so far
+func (s *Stream) BytesWritten() uint64 {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.written
+}
+
+// start sets the root of the stream, the first time it is called
+func (s *Stream) start(root cid.Cid) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	s.root = root
+	s.pending = []cid.Cid{root}
+}
+
+// received is called with each block as it is stored. get is used to
+// look up blocks that were received earlier. It returns once the data that
+// the block makes ready has been written.
+func (s *Stream) received(ctx context.Context, blk blocks.Block, get getBlockFunc) error {
+	if err := s.queueBlock(ctx, blk, get); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// queueBlock queues the data that can be written now that the block has
+// been received
+func (s *Stream) queueBlock(ctx context.Context, blk blocks.Block, get getBlockFunc) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	var err error
+	switch s.format {
+	case FormatCARv1:
+		err = s.writeCARBlock(blk)
+	case FormatUnixFSFile:
+		err = s.writeFileBlocks(ctx, blk, get)
+	default:
+		err = xerrors.Errorf("unknown stream format %d", s.format)
+	}
+	if err != nil {
+		s.err = err
+	}
+	return err
+}
+
+// flush writes the queued data to the writer, without holding the stream's
+// lock while writing
+func (s *Stream) flush() error {
+	s.writeLk.Lock()
+	defer s.writeLk.Unlock()
+
+	for {
+		s.lk.Lock()
+		if s.err != nil || len(s.queued) == 0 {
+			err := s.err
+			s.lk.Unlock()
+			return err
+		}
+		data := s.queued[0]
+		s.queued = s.queued[1:]
+		s.lk.Unlock()
+
+		n, err := s.w.Write(data)
+
+		s.lk.Lock()
+		s.written += uint64(n)
+		if err != nil && s.err == nil {
+			s.err = xerrors.Errorf("writing to stream: %w", err)
+		}
+		s.lk.Unlock()
+	}
+}
+
+// queue adds data to be written to the writer. It must be called with the
+// stream's lock held.
+func (s *Stream) queue(data []byte) {
+	s.queued = append(s.queued, data)
+}
+
+// finish is called when the deal is done
+func (s *Stream) finish() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	select {
+	case <-s.done:
+		return s.err
+	default:
+	}
+
+	if s.err == nil && s.format == FormatUnixFSFile && len(s.pending) > 0 {
+		s.err = ErrIncomplete
+	}
+	close(s.done)
+	return s.err
+}
+
+func (s *Stream) writeCARBlock(blk blocks.Block) error {
+	if !s.headerWritten {
+		var buf bytes.Buffer
+		if err := stores.WriteHeader(&stores.CarHeader{Roots: []cid.Cid{s.root}, Version: 1}, &buf); err != nil {
+			return xerrors.Errorf("writing CAR header: %w", err)
+		}
+		s.queue(buf.Bytes())
+		s.headerWritten = true
+	}
+	if s.seen.Has(blk.Cid()) {
+		return nil
+	}
+	s.seen.Add(blk.Cid())
+	var buf bytes.Buffer
+	if err := stores.LdWrite(&buf, blk.Cid().Bytes(), blk.RawData()); err != nil {
+		return xerrors.Errorf("writing block %s: %w", blk.Cid(), err)
+	}
+	s.queue(buf.Bytes())
+	return nil
+}
+
+// writeFileBlocks writes the file data in all blocks that can be written,
+// in file order. Blocks of a UnixFS file are received in depth-first order,
+// but a block that appears more than once in the file is only received the
+// first time, so the blocks to write are tracked separately.
+func (s *Stream) writeFileBlocks(ctx context.Context, blk blocks.Block, get getBlockFunc) error {
+	for len(s.pending) > 0 {
+		next := s.pending[0]
+		var nextBlk blocks.Block
+		if next.Equals(blk.Cid()) {
+			nextBlk = blk
+		} else {
+			var err error
+			nextBlk, err = getBlock(ctx, next, get)
+			if err != nil {
+				// not received yet
+				return nil
+			}
+		}
+
+		data, links, err := decodeFileNode(nextBlk)
+		if err != nil {
+			return err
+		}
+		s.queue(data)
+		s.pending = append(links, s.pending[1:]...)
+	}
+	return nil
+}
+
+func getBlock(ctx context.Context, c cid.Cid, get getBlockFunc) (blocks.Block, error) {
+	if c.Prefix().MhType == multihash.IDENTITY {
+		dmh, err := multihash.Decode(c.Hash())
+		if err != nil {
+			return nil, err
+		}
+		return blocks.NewBlockWithCid(dmh.Digest, c)
+	}
+	return get(ctx, c)
+}
+
+// decodeFileNode returns the file data held in a block, and the links to
+// the blocks that hold the rest of the data
+func decodeFileNode(blk blocks.Block) ([]byte, []cid.Cid, error) {
+	switch multicodec.Code(blk.Cid().Prefix().Codec) {
+	case multicodec.Raw:
+		return blk.RawData(), nil, nil
+	case multicodec.DagPb:
+	default:
+		return nil, nil, xerrors.Errorf("block %s is not a UnixFS file node: unsupported codec %d", blk.Cid(), blk.Cid().Prefix().Codec)
+	}
+
+	nd, err := merkledag.DecodeProtobuf(blk.RawData())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("decoding block %s: %w", blk.Cid(), err)
+	}
+	fsn, err := unixfs.FSNodeFromBytes(nd.Data())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("decoding UnixFS data of block %s: %w", blk.Cid(), err)
+	}
+	switch fsn.Type() {
+	case unixfspb.Data_File, unixfspb.Data_Raw:
+	default:
+		return nil, nil, xerrors.Errorf("block %s is not a UnixFS file node: type %s", blk.Cid(), fsn.Type())
+	}
+
+	links := make([]cid.Cid, 0, len(nd.Links()))
+	for _, l := range nd.Links() {
+		links = append(links, l.Cid)
+	}
+	return fsn.Data(), links, nil
+}
@@ -0,0 +1,228 @@
+package streaming_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/blockservice"
+	bstore "github.com/ipfs/boxo/blockstore"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/stretchr/testify/require"
+
+	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/streaming"
+	"github.com/filecoin-project/go-fil-markets/shared_testutil/unixfs"
+)
+
+func TestStream(t *testing.T) {
+	t.Run("CARv1 stream", func(t *testing.T) {
+		root, src := createFile(t, randomData(3<<20))
+		blks := dfsBlocks(t, src, root)
+
+		var out bytes.Buffer
+		a := streaming.NewAccessor(newTestAccessor())
+		s, err := a.Stream(1, streaming.FormatCARv1, &out)
+		require.NoError(t, err)
+		putAll(t, a, 1, root, blks)
+		require.NoError(t, a.Done(1))
+		<-s.Done()
+		require.NoError(t, s.Err())
+		require.EqualValues(t, out.Len(), s.BytesWritten())
+
+		br, err := carv2.NewBlockReader(&out)
+		require.NoError(t, err)
+		require.Equal(t, []cid.Cid{root}, br.Roots)
+		for _, blk := range blks {
+			got, err := br.Next()
+			require.NoError(t, err)
+			require.Equal(t, blk.Cid(), got.Cid())
+		}
+		_, err = br.Next()
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("UnixFS file stream", func(t *testing.T) {
+		// a file with repeated chunks has leaves that are linked more than
+		// once, but only received once
+		data := append(randomData(1<<20), make([]byte, 2<<20)...)
+		root, src := createFile(t, data)
+		blks := dfsBlocks(t, src, root)
+
+		var out bytes.Buffer
+		a := streaming.NewAccessor(newTestAccessor())
+		s, err := a.Stream(1, streaming.FormatUnixFSFile, &out)
+		require.NoError(t, err)
+		putAll(t, a, 1, root, blks)
+		require.NoError(t, a.Done(1))
+		<-s.Done()
+		require.NoError(t, s.Err())
+		require.Equal(t, data, out.Bytes())
+	})
+
+	t.Run("UnixFS file stream with backpressure", func(t *testing.T) {
+		data := randomData(2 << 20)
+		root, src := createFile(t, data)
+		blks := dfsBlocks(t, src, root)
+
+		pr, pw := io.Pipe()
+		a := streaming.NewAccessor(newTestAccessor())
+		s, err := a.Stream(1, streaming.FormatUnixFSFile, pw)
+		require.NoError(t, err)
+
+		go func() {
+			putAll(t, a, 1, root, blks)
+			_ = a.Done(1)
+			_ = pw.Close()
+		}()
+		out, err := io.ReadAll(pr)
+		require.NoError(t, err)
+		require.Equal(t, data, out)
+		<-s.Done()
+		require.NoError(t, s.Err())
+	})
+
+	t.Run("a blocked writer does not block the stream's state", func(t *testing.T) {
+		root, src := createFile(t, randomData(1<<20))
+		blks := dfsBlocks(t, src, root)
+
+		pr, pw := io.Pipe()
+		a := streaming.NewAccessor(newTestAccessor())
+		s, err := a.Stream(1, streaming.FormatCARv1, pw)
+		require.NoError(t, err)
+
+		bs, err := a.Get(1, root)
+		require.NoError(t, err)
+		put := make(chan error)
+		go func() {
+			put <- bs.Put(context.Background(), blks[0])
+		}()
+
+		// nothing reads from the pipe, so the put is stuck writing
+		state := make(chan uint64)
+		go func() {
+			require.NoError(t, s.Err())
+			state <- s.BytesWritten()
+		}()
+		select {
+		case written := <-state:
+			require.Zero(t, written)
+		case <-time.After(time.Second):
+			require.FailNow(t, "stream state is blocked by the writer")
+		}
+
+		_ = pr.Close()
+		require.Error(t, <-put)
+		require.Error(t, s.Err())
+	})
+
+	t.Run("incomplete UnixFS file", func(t *testing.T) {
+		root, src := createFile(t, randomData(2<<20))
+		blks := dfsBlocks(t, src, root)
+
+		a := streaming.NewAccessor(newTestAccessor())
+		s, err := a.Stream(1, streaming.FormatUnixFSFile, io.Discard)
+		require.NoError(t, err)
+		putAll(t, a, 1, root, blks[:len(blks)/2])
+		require.NoError(t, a.Done(1))
+		<-s.Done()
+		require.ErrorIs(t, s.Err(), streaming.ErrIncomplete)
+	})
+
+	t.Run("deals without a stream are not affected", func(t *testing.T) {
+		inner := newTestAccessor()
+		a := streaming.NewAccessor(inner)
+		bs, err := a.Get(1, cid.Undef)
+		require.NoError(t, err)
+		require.Equal(t, inner.bs, bs)
+		require.NoError(t, a.Done(1))
+	})
+
+	t.Run("only one stream per deal", func(t *testing.T) {
+		a := streaming.NewAccessor(newTestAccessor())
+		_, err := a.Stream(1, streaming.FormatCARv1, io.Discard)
+		require.NoError(t, err)
+		_, err = a.Stream(1, streaming.FormatCARv1, io.Discard)
+		require.Error(t, err)
+	})
+
+}
+
+type testAccessor struct {
+	bs bstore.Blockstore
+}
+
+func newTestAccessor() *testAccessor {
+	return &testAccessor{bs: bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))}
+}
+
+func (ta *testAccessor) Get(rm.DealID, rm.PayloadCID) (bstore.Blockstore, error) {
+	return ta.bs, nil
+}
+
+func (ta *testAccessor) Done(rm.DealID) error {
+	return nil
+}
+
+func putAll(t *testing.T, a *streaming.Accessor, id rm.DealID, root cid.Cid, blks []blocks.Block) {
+	bs, err := a.Get(id, root)
+	require.NoError(t, err)
+	for _, blk := range blks {
+		require.NoError(t, bs.Put(context.Background(), blk))
+	}
+}
+
+func randomData(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+// createFile imports data as a UnixFS file and returns the root and the
+// blockstore holding the file's blocks
+func createFile(t *testing.T, data []byte) (cid.Cid, bstore.Blockstore) {
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	bs := bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+	dagSvc := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	root := unixfs.WriteUnixfsDAGTo(t, path, dagSvc)
+	return root, bs
+}
+
+// dfsBlocks returns the blocks of a DAG in depth-first order, without
+// duplicates, which is the order in which they are received in a retrieval
+func dfsBlocks(t *testing.T, bs bstore.Blockstore, root cid.Cid) []blocks.Block {
+	var out []blocks.Block
+	seen := cid.NewSet()
+	var visit func(c cid.Cid)
+	visit = func(c cid.Cid) {
+		if !seen.Visit(c) {
+			return
+		}
+		blk, err := bs.Get(context.Background(), c)
+		require.NoError(t, err)
+		out = append(out, blk)
+		if c.Prefix().Codec != cid.DagProtobuf {
+			return
+		}
+		nd, err := merkledag.DecodeProtobuf(blk.RawData())
+		require.NoError(t, err)
+		for _, l := range nd.Links() {
+			visit(l.Cid)
+		}
+	}
+	visit(root)
+	return out
+}
@@ -0,0 +1,234 @@
+// Package unsealqueue provides a bounded, prioritized scheduler for unsealing
+// pieces on a retrieval provider.
+//
+// Unsealing a sector is expensive, so the provider limits how many unseals run
+// at once. Requests waiting for a slot are ordered so that paid retrievals go
+// before free ones, and smaller pieces go before larger ones. Concurrent
+// requests for the same piece are de-duplicated: they share a single slot and
+// are all released to proceed at the same time.
+package unsealqueue
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Request describes a single request to unseal a piece
+type Request struct {
+	// PieceCID identifies the piece (and therefore the sector range) to unseal.
+	// Concurrent requests for the same piece share a single slot.
+	PieceCID cid.Cid
+	// Paid is true if the client is paying for the retrieval
+	Paid bool
+	// Size is the size of the piece in bytes
+	Size uint64
+}
+
+// PositionFunc is called with the (1-based) position of a request in the
+// queue each time that position changes while the request is waiting
+type PositionFunc func(position int, queueLength int)
+
+// ReleaseFunc releases an acquired slot. It is safe to call more than once.
+type ReleaseFunc func()
+
+type waiter struct {
+	onPosition   PositionFunc
+	lastPosition int
+}
+
+type job struct {
+	pieceCid cid.Cid
+	paid     bool
+	size     uint64
+	seq      uint64
+	refs     int
+	running  bool
+	ready    chan struct{}
+	waiters  map[*waiter]struct{}
+}
+
+type notification struct {
+	w        *waiter
+	position int
+	length   int
+}
+
+// Queue schedules unseal requests so that no more than a fixed number run
+// concurrently
+type Queue struct {
+	lk            sync.Mutex
+	maxConcurrent int
+	running       int
+	seq           uint64
+	jobs          map[cid.Cid]*job
+	waiting       []*job
+}
+
+// NewQueue returns a new Queue that allows at most maxConcurrent unseals
+// to run at once. If maxConcurrent is zero or less, the number of concurrent
+// unseals is unlimited.
+func NewQueue(maxConcurrent int) *Queue {
+	return &Queue{
+		maxConcurrent: maxConcurrent,
+		jobs:          make(map[cid.Cid]*job),
+	}
+}
+
+// Acquire blocks until the request can proceed, or the context is cancelled.
+// While the request is waiting, onPosition (if not nil) is called whenever the
+// request's position in the queue changes.
+// The caller must call the returned ReleaseFunc once unsealing has finished.
+func (q *Queue) Acquire(ctx context.Context, req Request, onPosition PositionFunc) (ReleaseFunc, error) {
+	w := &waiter{onPosition: onPosition}
+
+	q.lk.Lock()
+	j, ok := q.jobs[req.PieceCID]
+	if ok {
+		j.refs++
+		// a paid request for the same piece promotes the whole job
+		if req.Paid && !j.paid {
+			j.paid = true
+		}
+	} else {
+		q.seq++
+		j = &job{
+			pieceCid: req.PieceCID,
+			paid:     req.Paid,
+			size:     req.Size,
+			seq:      q.seq,
+			refs:     1,
+			ready:    make(chan struct{}),
+			waiters:  make(map[*waiter]struct{}),
+		}
+		q.jobs[req.PieceCID] = j
+		q.waiting = append(q.waiting, j)
+	}
+	if !j.running {
+		j.waiters[w] = struct{}{}
+	}
+	notifications := q.schedule()
+	q.lk.Unlock()
+
+	notify(notifications)
+
+	select {
+	case <-j.ready:
+		return q.releaseFunc(j), nil
+	case <-ctx.Done():
+	}
+
+	q.lk.Lock()
+	delete(j.waiters, w)
+	if j.running {
+		// the job started at the same time as the context was cancelled, so
+		// give back the slot that was acquired on our behalf
+		q.lk.Unlock()
+		q.releaseFunc(j)()
+		return nil, ctx.Err()
+	}
+	j.refs--
+	if j.refs == 0 {
+		delete(q.jobs, j.pieceCid)
+		q.removeWaiting(j)
+	}
+	notifications = q.schedule()
+	q.lk.Unlock()
+
+	notify(notifications)
+	return nil, ctx.Err()
+}
+
+// Len returns the number of unseal jobs that are waiting for a slot
+func (q *Queue) Len() int {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	return len(q.waiting)
+}
+
+// Running returns the number of unseal jobs that currently hold a slot
+func (q *Queue) Running() int {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	return q.running
+}
+
+func (q *Queue) releaseFunc(j *job) ReleaseFunc {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.lk.Lock()
+			j.refs--
+			if j.refs > 0 {
+				q.lk.Unlock()
+				return
+			}
+			delete(q.jobs, j.pieceCid)
+			q.running--
+			notifications := q.schedule()
+			q.lk.Unlock()
+
+			notify(notifications)
+		})
+	}
+}
+
+// schedule starts as many waiting jobs as there are free slots, and returns
+// the position updates for the jobs that are still waiting.
+// It must be called with the lock held.
+func (q *Queue) schedule() []notification {
+	sort.SliceStable(q.waiting, func(i, k int) bool {
+		return less(q.waiting[i], q.waiting[k])
+	})
+
+	for len(q.waiting) > 0 && (q.maxConcurrent <= 0 || q.running < q.maxConcurrent) {
+		j := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		j.running = true
+		j.waiters = nil
+		q.running++
+		close(j.ready)
+	}
+
+	var notifications []notification
+	for i, j := range q.waiting {
+		position := i + 1
+		for w := range j.waiters {
+			if w.onPosition == nil || w.lastPosition == position {
+				continue
+			}
+			w.lastPosition = position
+			notifications = append(notifications, notification{w: w, position: position, length: len(q.waiting)})
+		}
+	}
+	return notifications
+}
+
+func (q *Queue) removeWaiting(j *job) {
+	for i, other := range q.waiting {
+		if other == j {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// less orders paid jobs before free jobs, then smaller jobs before larger
+// jobs, then older jobs before newer jobs
+func less(a, b *job) bool {
+	if a.paid != b.paid {
+		return a.paid
+	}
+	if a.size != b.size {
+		return a.size < b.size
+	}
+	return a.seq < b.seq
+}
+
+func notify(notifications []notification) {
+	for _, n := range notifications {
+		n.w.onPosition(n.position, n.length)
+	}
+}
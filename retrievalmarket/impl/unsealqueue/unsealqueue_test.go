@@ -0,0 +1,164 @@
+package unsealqueue_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/unsealqueue"
+)
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("limits concurrency", func(t *testing.T) {
+		q := unsealqueue.NewQueue(1)
+		release, err := q.Acquire(ctx, unsealqueue.Request{PieceCID: testCid(t, "a")}, nil)
+		require.NoError(t, err)
+
+		acquired := make(chan unsealqueue.ReleaseFunc)
+		go func() {
+			r, err := q.Acquire(ctx, unsealqueue.Request{PieceCID: testCid(t, "b")}, nil)
+			require.NoError(t, err)
+			acquired <- r
+		}()
+
+		require.Eventually(t, func() bool { return q.Len() == 1 }, time.Second, time.Millisecond)
+		require.Equal(t, 1, q.Running())
+
+		release()
+		select {
+		case r := <-acquired:
+			r()
+		case <-time.After(time.Second):
+			t.Fatal("second request did not acquire a slot")
+		}
+		require.Equal(t, 0, q.Running())
+		require.Equal(t, 0, q.Len())
+	})
+
+	t.Run("prioritizes paid then smaller requests", func(t *testing.T) {
+		q := unsealqueue.NewQueue(1)
+		release, err := q.Acquire(ctx, unsealqueue.Request{PieceCID: testCid(t, "blocker")}, nil)
+		require.NoError(t, err)
+
+		reqs := []unsealqueue.Request{
+			{PieceCID: testCid(t, "free-small"), Size: 10},
+			{PieceCID: testCid(t, "paid-large"), Paid: true, Size: 1000},
+			{PieceCID: testCid(t, "paid-small"), Paid: true, Size: 10},
+		}
+
+		var lk sync.Mutex
+		var order []cid.Cid
+		var wg sync.WaitGroup
+		for i, req := range reqs {
+			req := req
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r, err := q.Acquire(ctx, req, nil)
+				require.NoError(t, err)
+				lk.Lock()
+				order = append(order, req.PieceCID)
+				lk.Unlock()
+				r()
+			}()
+			expected := i + 1
+			require.Eventually(t, func() bool { return q.Len() == expected }, time.Second, time.Millisecond)
+		}
+
+		release()
+		wg.Wait()
+		require.Equal(t, []cid.Cid{reqs[2].PieceCID, reqs[1].PieceCID, reqs[0].PieceCID}, order)
+	})
+
+	t.Run("de-duplicates requests for the same piece", func(t *testing.T) {
+		q := unsealqueue.NewQueue(1)
+		release, err := q.Acquire(ctx, unsealqueue.Request{PieceCID: testCid(t, "a")}, nil)
+		require.NoError(t, err)
+
+		// a second request for the same piece proceeds straight away
+		releaseDup, err := q.Acquire(ctx, unsealqueue.Request{PieceCID: testCid(t, "a")}, nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, q.Running())
+
+		// the slot is only freed once every request has been released
+		release()
+		require.Equal(t, 1, q.Running())
+		releaseDup()
+		require.Equal(t, 0, q.Running())
+	})
+
+	t.Run("reports queue position", func(t *testing.T) {
+		q := unsealqueue.NewQueue(1)
+		release, err := q.Acquire(ctx, unsealqueue.Request{PieceCID: testCid(t, "blocker")}, nil)
+		require.NoError(t, err)
+
+		positions := make(chan int, 10)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			r, err := q.Acquire(ctx, unsealqueue.Request{PieceCID: testCid(t, "free"), Size: 10}, func(position int, _ int) {
+				positions <- position
+			})
+			require.NoError(t, err)
+			r()
+		}()
+		require.Equal(t, 1, <-positions)
+
+		// a paid request jumps ahead in the queue
+		paidDone := make(chan struct{})
+		go func() {
+			defer close(paidDone)
+			r, err := q.Acquire(ctx, unsealqueue.Request{PieceCID: testCid(t, "paid"), Paid: true}, nil)
+			require.NoError(t, err)
+			r()
+		}()
+		require.Equal(t, 2, <-positions)
+
+		release()
+		<-paidDone
+		<-done
+	})
+
+	t.Run("cancelled requests leave the queue", func(t *testing.T) {
+		q := unsealqueue.NewQueue(1)
+		release, err := q.Acquire(ctx, unsealqueue.Request{PieceCID: testCid(t, "a")}, nil)
+		require.NoError(t, err)
+
+		cctx, cancel := context.WithCancel(ctx)
+		errs := make(chan error)
+		go func() {
+			_, err := q.Acquire(cctx, unsealqueue.Request{PieceCID: testCid(t, "b")}, nil)
+			errs <- err
+		}()
+		require.Eventually(t, func() bool { return q.Len() == 1 }, time.Second, time.Millisecond)
+
+		cancel()
+		require.ErrorIs(t, <-errs, context.Canceled)
+		require.Equal(t, 0, q.Len())
+
+		release()
+		require.Equal(t, 0, q.Running())
+	})
+
+	t.Run("unlimited concurrency", func(t *testing.T) {
+		q := unsealqueue.NewQueue(0)
+		for _, name := range []string{"a", "b", "c"} {
+			_, err := q.Acquire(ctx, unsealqueue.Request{PieceCID: testCid(t, name)}, nil)
+			require.NoError(t, err)
+		}
+		require.Equal(t, 3, q.Running())
+	})
+}
+
+func testCid(t *testing.T, name string) cid.Cid {
+	mh, err := multihash.Sum([]byte(name), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	return cid.NewCidV1(cid.Raw, mh)
+}
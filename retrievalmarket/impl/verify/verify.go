@@ -0,0 +1,187 @@
+// Package verify checks that the blockstore of a finished retrieval holds the
+// whole DAG selected by the deal.
+//
+// Data transfer reports that all blocks were received based on what the
+// provider sent, which does not catch blocks that were lost or corrupted
+// while being written to the client's blockstore. Blockstore walks the deal's
+// selector over the blockstore, re-hashing every block it loads.
+package verify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	bstore "github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/go-cid"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-unixfsnode"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/xerrors"
+)
+
+// maxReported is the maximum number of missing or corrupt CIDs listed in the
+// error for an incomplete result
+const maxReported = 5
+
+// Result is the result of verifying a blockstore
+type Result struct {
+	// Blocks is the number of distinct blocks that were verified
+	Blocks int
+	// Bytes is the total size of the distinct blocks that were verified
+	Bytes uint64
+	// Missing are the blocks that the blockstore does not have
+	Missing []cid.Cid
+	// Corrupt are the blocks whose data does not match their CID
+	Corrupt []cid.Cid
+}
+
+// Complete returns true if no blocks are missing or corrupt
+func (r Result) Complete() bool {
+	return len(r.Missing) == 0 && len(r.Corrupt) == 0
+}
+
+// Err returns an error describing the missing and corrupt blocks, or nil if
+// the result is complete
+func (r Result) Err() error {
+	if r.Complete() {
+		return nil
+	}
+	return xerrors.Errorf("blockstore is incomplete: %d blocks verified, %d missing %s, %d corrupt %s",
+		r.Blocks, len(r.Missing), listCids(r.Missing), len(r.Corrupt), listCids(r.Corrupt))
+}
+
+func listCids(cids []cid.Cid) string {
+	if len(cids) == 0 {
+		return "[]"
+	}
+	strs := make([]string, 0, maxReported)
+	for i, c := range cids {
+		if i == maxReported {
+			strs = append(strs, "...")
+			break
+		}
+		strs = append(strs, c.String())
+	}
+	return "[" + strings.Join(strs, " ") + "]"
+}
+
+// Blockstore walks the selector over the blockstore starting at root, and
+// checks that every block it reaches is present and matches its CID. Parts of
+// the DAG below a missing or corrupt block cannot be walked, so they are not
+// included in the result.
+func Blockstore(ctx context.Context, bs bstore.Blockstore, root cid.Cid, sel ipld.Node) (Result, error) {
+	compiled, err := selector.CompileSelector(sel)
+	if err != nil {
+		return Result{}, xerrors.Errorf("compiling selector: %w", err)
+	}
+
+	var res Result
+	seen := cid.NewSet()
+	missing := cid.NewSet()
+	corrupt := cid.NewSet()
+
+	lsys := cidlink.DefaultLinkSystem()
+	// hashes are checked by the read opener, so that a corrupt block doesn't
+	// stop the walk
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.StorageReadOpener = func(lctx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+		c := lnk.(cidlink.Link).Cid
+		if c.Prefix().MhType == multihash.IDENTITY {
+			dmh, err := multihash.Decode(c.Hash())
+			if err != nil {
+				return nil, err
+			}
+			return bytes.NewReader(dmh.Digest), nil
+		}
+		blk, err := bs.Get(lctx.Ctx, c)
+		if err != nil {
+			if ipldformat.IsNotFound(err) {
+				if missing.Visit(c) {
+					res.Missing = append(res.Missing, c)
+				}
+				return nil, traversal.SkipMe{}
+			}
+			return nil, err
+		}
+		if !verifyHash(c, blk.RawData()) {
+			if corrupt.Visit(c) {
+				res.Corrupt = append(res.Corrupt, c)
+			}
+			return nil, traversal.SkipMe{}
+		}
+		if seen.Visit(c) {
+			res.Blocks++
+			res.Bytes += uint64(len(blk.RawData()))
+		}
+		return bytes.NewReader(blk.RawData()), nil
+	}
+	chooser := dagpb.AddSupportToChooser(func(datamodel.Link, linking.LinkContext) (datamodel.NodePrototype, error) {
+		return basicnode.Prototype.Any, nil
+	})
+
+	rootLnk := cidlink.Link{Cid: root}
+	lctx := linking.LinkContext{Ctx: ctx}
+	np, err := chooser(rootLnk, lctx)
+	if err != nil {
+		return Result{}, err
+	}
+	rootNode, err := lsys.Load(lctx, rootLnk, np)
+	if err != nil {
+		if _, ok := err.(traversal.SkipMe); ok {
+			return res, nil
+		}
+		return Result{}, xerrors.Errorf("loading root %s: %w", root, err)
+	}
+
+	err = traversal.Progress{
+		Cfg: &traversal.Config{
+			Ctx:                            ctx,
+			LinkSystem:                     lsys,
+			LinkTargetNodePrototypeChooser: chooser,
+		},
+	}.WalkAdv(rootNode, compiled, func(_ traversal.Progress, n datamodel.Node, reason traversal.VisitReason) error {
+		return readMatched(n, reason)
+	})
+	if err != nil {
+		return Result{}, xerrors.Errorf("walking blocks of %s: %w", root, err)
+	}
+	return res, nil
+}
+
+// readMatched reads a matched node with large bytes, such as a range of a
+// UnixFS file, as graphsync does when it sends it, so that the blocks holding
+// the bytes are loaded
+func readMatched(n datamodel.Node, reason traversal.VisitReason) error {
+	lbn, ok := n.(datamodel.LargeBytesNode)
+	if !ok || reason != traversal.VisitReason_SelectionMatch {
+		return nil
+	}
+	r, err := lbn.AsLargeBytes()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil && !errors.Is(err, traversal.SkipMe{}) {
+		return err
+	}
+	return nil
+}
+
+func verifyHash(c cid.Cid, data []byte) bool {
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return false
+	}
+	return sum.Equals(c)
+}
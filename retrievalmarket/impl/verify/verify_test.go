@@ -0,0 +1,169 @@
+package verify_test
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/boxo/blockservice"
+	bstore "github.com/ipfs/boxo/blockstore"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ufs "github.com/ipfs/boxo/ipld/unixfs"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/verify"
+	"github.com/filecoin-project/go-fil-markets/shared_testutil/unixfs"
+)
+
+func TestBlockstore(t *testing.T) {
+	ctx := context.Background()
+	sel := selectorparse.CommonSelector_ExploreAllRecursively
+
+	t.Run("complete", func(t *testing.T) {
+		root, bs, _ := createFile(t)
+		res, err := verify.Blockstore(ctx, bs, root, sel)
+		require.NoError(t, err)
+		require.True(t, res.Complete())
+		require.NoError(t, res.Err())
+		// the root is small enough to be inlined in an identity CID, so it
+		// isn't loaded from the blockstore
+		require.Equal(t, uint64(multihash.IDENTITY), root.Prefix().MhType)
+		require.Equal(t, countBlocks(t, bs)-1, res.Blocks)
+	})
+
+	t.Run("empty blockstore", func(t *testing.T) {
+		root, _, children := createFile(t)
+		res, err := verify.Blockstore(ctx, newBlockstore(), root, sel)
+		require.NoError(t, err)
+		require.Equal(t, children, res.Missing)
+		require.Zero(t, res.Blocks)
+		require.Error(t, res.Err())
+
+		res, err = verify.Blockstore(ctx, newBlockstore(), children[0], sel)
+		require.NoError(t, err)
+		require.Equal(t, []cid.Cid{children[0]}, res.Missing)
+	})
+
+	t.Run("missing leaf", func(t *testing.T) {
+		root, bs, leaves := createFile(t)
+		require.NoError(t, bs.DeleteBlock(ctx, leaves[1]))
+		res, err := verify.Blockstore(ctx, bs, root, sel)
+		require.NoError(t, err)
+		require.Equal(t, []cid.Cid{leaves[1]}, res.Missing)
+		require.Empty(t, res.Corrupt)
+		require.Contains(t, res.Err().Error(), leaves[1].String())
+	})
+
+	t.Run("byte range", func(t *testing.T) {
+		root, bs, children := createFile(t)
+		require.NoError(t, bs.DeleteBlock(ctx, children[0]))
+		ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+
+		// only the blocks holding the range are walked: the second child and
+		// one of its leaves
+		rangeSel := retrievalmarket.ByteRange{Offset: 3 << 19, Length: 100}.Selector(ssb).Node()
+		res, err := verify.Blockstore(ctx, bs, root, rangeSel)
+		require.NoError(t, err)
+		require.NoError(t, res.Err())
+		require.Equal(t, 2, res.Blocks)
+
+		rangeSel = retrievalmarket.ByteRange{Offset: 100, Length: 100}.Selector(ssb).Node()
+		res, err = verify.Blockstore(ctx, bs, root, rangeSel)
+		require.NoError(t, err)
+		require.Equal(t, []cid.Cid{children[0]}, res.Missing)
+	})
+
+	t.Run("corrupt leaf", func(t *testing.T) {
+		root, bs, leaves := createFile(t)
+		require.NoError(t, bs.DeleteBlock(ctx, leaves[0]))
+		blk, err := blocks.NewBlockWithCid([]byte("not the leaf data"), leaves[0])
+		require.NoError(t, err)
+		require.NoError(t, bs.Put(ctx, blk))
+
+		res, err := verify.Blockstore(ctx, bs, root, sel)
+		require.NoError(t, err)
+		require.Empty(t, res.Missing)
+		require.Equal(t, []cid.Cid{leaves[0]}, res.Corrupt)
+		require.Error(t, res.Err())
+	})
+}
+
+func TestBlockstorePath(t *testing.T) {
+	ctx := context.Background()
+	bs := newBlockstore()
+	dagSvc := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	file := func(name string) ipldformat.Node {
+		data := make([]byte, 1<<20)
+		rand.New(rand.NewSource(int64(len(name)))).Read(data)
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		nd, err := dagSvc.Get(ctx, unixfs.WriteUnixfsDAGTo(t, path, dagSvc))
+		require.NoError(t, err)
+		return nd
+	}
+	wanted, other := file("wanted"), file("other file")
+
+	dir := ufs.EmptyDirNode()
+	require.NoError(t, dir.AddNodeLink("wanted", wanted))
+	require.NoError(t, dir.AddNodeLink("other", other))
+	require.NoError(t, dagSvc.Add(ctx, dir))
+
+	// only the directory and the blocks of the file at the path are walked
+	res, err := verify.Blockstore(ctx, bs, dir.Cid(), retrievalmarket.UnixFSPathSelector("wanted"))
+	require.NoError(t, err)
+	require.NoError(t, res.Err())
+	all, err := verify.Blockstore(ctx, bs, wanted.Cid(), selectorparse.CommonSelector_ExploreAllRecursively)
+	require.NoError(t, err)
+	require.Equal(t, all.Blocks+1, res.Blocks)
+	require.Equal(t, all.Bytes+uint64(len(dir.RawData())), res.Bytes)
+}
+
+func newBlockstore() bstore.Blockstore {
+	return bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+}
+
+func countBlocks(t *testing.T, bs bstore.Blockstore) int {
+	keys, err := bs.AllKeysChan(context.Background())
+	require.NoError(t, err)
+	n := 0
+	for range keys {
+		n++
+	}
+	return n
+}
+
+// createFile imports a file with random data and returns the root, the
+// blockstore with the file's blocks and the CIDs of the root's children
+func createFile(t *testing.T) (cid.Cid, bstore.Blockstore, []cid.Cid) {
+	data := make([]byte, 2<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	bs := newBlockstore()
+	dagSvc := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	root := unixfs.WriteUnixfsDAGTo(t, path, dagSvc)
+
+	rootBlk, err := bs.Get(context.Background(), root)
+	require.NoError(t, err)
+	nd, err := merkledag.DecodeProtobuf(rootBlk.RawData())
+	require.NoError(t, err)
+	var children []cid.Cid
+	for _, l := range nd.Links() {
+		children = append(children, l.Cid)
+	}
+	return root, bs, children
+}
@@ -3,6 +3,7 @@ package migrations
 import (
 	datatransfer "github.com/filecoin-project/go-data-transfer/v2"
 	"github.com/filecoin-project/go-ds-versioning/pkg/versioned"
+	"github.com/filecoin-project/go-state-types/big"
 
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/migrations/maptypes"
@@ -44,6 +45,7 @@ func MigrateClientDealState1To2(oldDs *maptypes.ClientDealState1) (*retrievalmar
 		WaitMsgCID:           oldDs.WaitMsgCID,
 		VoucherShortfall:     oldDs.VoucherShortfall,
 		LegacyProtocol:       true,
+		AutoTopUpAdded:       big.Zero(),
 	}, nil
 }
 
@@ -22,6 +22,7 @@ import (
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/clientstates"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/providerstates"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/unsealqueue"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/migrations/maptypes"
 )
 
@@ -273,6 +274,18 @@ func (e *mockClientEnv) FinalizeBlockstore(ctx context.Context, id retrievalmark
 	return nil
 }
 
+func (e *mockClientEnv) VerifyBlockstore(_ context.Context, _ retrievalmarket.ClientDealState) error {
+	return nil
+}
+
+func (e *mockClientEnv) AuthorizePayment(_ context.Context, _ retrievalmarket.ClientDealState, _ abi.TokenAmount) error {
+	return nil
+}
+
+func (e *mockClientEnv) AutoTopUpAmount(_ retrievalmarket.ClientDealState, _ abi.TokenAmount) (abi.TokenAmount, error) {
+	return big.Zero(), nil
+}
+
 var _ clientstates.ClientDealEnvironment = &mockClientEnv{}
 
 type mockProviderEnv struct {
@@ -305,4 +318,8 @@ func (te *mockProviderEnv) UpdateValidationStatus(_ context.Context, _ datatrans
 	return nil
 }
 
+func (te *mockProviderEnv) ScheduleUnseal(_ context.Context, _ retrievalmarket.ProviderDealState, _ unsealqueue.PositionFunc) (unsealqueue.ReleaseFunc, error) {
+	return func() {}, nil
+}
+
 var _ providerstates.ProviderDealEnvironment = &mockProviderEnv{}
@@ -9,6 +9,7 @@ import (
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
 	paychtypes "github.com/filecoin-project/go-state-types/builtin/v8/paych"
+	"github.com/filecoin-project/go-state-types/exitcode"
 
 	"github.com/filecoin-project/go-fil-markets/shared"
 )
@@ -53,3 +54,23 @@ type RetrievalProviderNode interface {
 
 	GetRetrievalPricingInput(ctx context.Context, pieceCID cid.Cid, storageDeals []abi.DealID) (PricingInput, error)
 }
+
+// RetrievalProviderSettlementNode are the node dependencies for redeeming the
+// payment vouchers a RetrievalProvider receives
+type RetrievalProviderSettlementNode interface {
+	GetChainHead(ctx context.Context) (shared.TipSetToken, abi.ChainEpoch, error)
+
+	// GetPaymentChannelState returns the on-chain state of a payment channel
+	GetPaymentChannelState(ctx context.Context, paymentChannel address.Address, tok shared.TipSetToken) (PaymentChannelState, error)
+
+	// SubmitPaymentVoucher redeems a voucher on-chain
+	SubmitPaymentVoucher(ctx context.Context, paymentChannel address.Address, voucher *paychtypes.SignedVoucher) (cid.Cid, error)
+
+	// CollectPaymentChannel collects the redeemed funds from a payment channel
+	// that has finished settling
+	CollectPaymentChannel(ctx context.Context, paymentChannel address.Address) (cid.Cid, error)
+
+	// LookupMessage returns the exit code of a message once it is on chain.
+	// found is false while the message is still pending.
+	LookupMessage(ctx context.Context, mcid cid.Cid) (code exitcode.ExitCode, found bool, err error)
+}
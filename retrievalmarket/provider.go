@@ -2,10 +2,13 @@ package retrievalmarket
 
 import (
 	"context"
+	"time"
 
 	"github.com/filecoin-project/go-state-types/abi"
 
 	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/shared/denylist"
+	"github.com/filecoin-project/go-fil-markets/shared/drain"
 )
 
 // ProviderSubscriber is a callback that is registered to listen for retrieval events on a provider
@@ -50,7 +53,28 @@ type RetrievalProvider interface {
 	// provider validates a request for data
 	SubscribeToValidationEvents(subscriber ProviderValidationSubscriber) Unsubscribe
 
+	// SubscribeToDenylistHits subscribes to the queries and deal proposals
+	// that the provider refuses because their payload is on its denylist
+	SubscribeToDenylistHits(subscriber denylist.Subscriber) Unsubscribe
+
 	ListDeals() map[ProviderDealIdentifier]ProviderDealState
+
+	// Pause stops the provider accepting new deals, while deals in progress carry on.
+	// The provider stays paused across restarts until it is resumed.
+	Pause() error
+
+	// Resume lets the provider accept new deals again
+	Resume() error
+
+	// Paused returns true if the provider is not accepting new deals
+	Paused() bool
+
+	// DrainProgress returns the number of deals in flight in each state
+	DrainProgress(ctx context.Context) (drain.Progress, error)
+
+	// Drain pauses the provider and waits until it has no deals in flight, or returns
+	// the deals still in flight when the context is done or the timeout elapses
+	Drain(ctx context.Context, timeout time.Duration, onProgress func(drain.Progress)) ([]drain.Deal, error)
 }
 
 // AskStore is an interface which provides access to a persisted retrieval Ask
@@ -11,6 +11,7 @@ import (
 	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	retrievalimpl "github.com/filecoin-project/go-fil-markets/retrievalmarket/impl"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/providerstates"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/impl/unsealqueue"
 )
 
 // TestProviderDealEnvironment is a test implementation of ProviderDealEnvironment used
@@ -18,6 +19,8 @@ import (
 type TestProviderDealEnvironment struct {
 	node                        rm.RetrievalProviderNode
 	ResumeDataTransferError     error
+	ScheduleUnsealError         error
+	UnsealQueuePositions        []int
 	PrepareBlockstoreError      error
 	CloseDataTransferError      error
 	DeleteStoreError            error
@@ -43,6 +46,16 @@ func (te *TestProviderDealEnvironment) DeleteStore(dealID rm.DealID) error {
 	return te.DeleteStoreError
 }
 
+func (te *TestProviderDealEnvironment) ScheduleUnseal(ctx context.Context, deal rm.ProviderDealState, onPosition unsealqueue.PositionFunc) (unsealqueue.ReleaseFunc, error) {
+	if te.ScheduleUnsealError != nil {
+		return nil, te.ScheduleUnsealError
+	}
+	for _, position := range te.UnsealQueuePositions {
+		onPosition(position, len(te.UnsealQueuePositions))
+	}
+	return func() {}, nil
+}
+
 func (te *TestProviderDealEnvironment) PrepareBlockstore(ctx context.Context, dealID rm.DealID, pieceCid cid.Cid) error {
 	return te.PrepareBlockstoreError
 }
@@ -1,15 +1,21 @@
 package retrievalmarket
 
 import (
+	"bytes"
 	_ "embed"
 	"errors"
 	"fmt"
+	"math"
 
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
 	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/ipld/go-ipld-prime/node/bindnode"
 	bindnoderegistry "github.com/ipld/go-ipld-prime/node/bindnode/registry"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"golang.org/x/xerrors"
@@ -19,11 +25,12 @@ import (
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
 	paychtypes "github.com/filecoin-project/go-state-types/builtin/v8/paych"
+	"github.com/filecoin-project/go-state-types/crypto"
 
 	"github.com/filecoin-project/go-fil-markets/piecestore"
 )
 
-//go:generate cbor-gen-for --map-encoding Query QueryResponse DealProposal DealResponse Params QueryParams DealPayment ClientDealState ProviderDealState PaymentInfo RetrievalPeer Ask
+//go:generate cbor-gen-for --map-encoding Query QueryResponse DealProposal DealResponse Params QueryParams DealPayment ClientDealState ProviderDealState PaymentInfo RetrievalPeer Ask ByteRange AccessToken
 
 //go:embed types.ipldsch
 var embedSchema []byte
@@ -67,6 +74,9 @@ type ClientDealState struct {
 	WaitMsgCID           *cid.Cid // the CID of any message the client deal is waiting for
 	VoucherShortfall     abi.TokenAmount
 	LegacyProtocol       bool
+	// AutoTopUpAdded is the total added to the payment channel automatically
+	// for this deal
+	AutoTopUpAdded abi.TokenAmount
 }
 
 func (deal *ClientDealState) NextInterval() uint64 {
@@ -165,6 +175,16 @@ const (
 // for the retrieval deal
 type QueryParams struct {
 	PieceCID *cid.Cid // optional, query if miner has this cid in this piece. some miners may not be able to respond.
+	// Path is optional. If set, the query is for the UnixFS file or directory
+	// at this path under the payload, and the provider responds with the size
+	// of the blocks that retrieving the path transfers.
+	Path string
+	// Range is optional. If set, the query is for these bytes of the UnixFS
+	// file at Path, or of the payload if Path is empty.
+	Range *ByteRange
+	// AccessToken is optional. It authorises the client to query a provider
+	// that only serves the data to authorised clients.
+	AccessToken *AccessToken
 	//Selector                   ipld.Node // optional, query if miner has this cid in this piece. some miners may not be able to respond.
 	//MaxPricePerByte            abi.TokenAmount    // optional, tell miner uninterested if more expensive than this
 	//MinPaymentInterval         uint64    // optional, tell miner uninterested unless payment interval is greater than this
@@ -196,6 +216,31 @@ func NewQueryV1(payloadCID cid.Cid, pieceCID *cid.Cid) Query {
 	}
 }
 
+// NewQueryForPath creates a V1 query for the UnixFS file or directory at the
+// given path under the payload
+func NewQueryForPath(payloadCID cid.Cid, path string, pieceCID *cid.Cid) Query {
+	return Query{
+		PayloadCID: payloadCID,
+		QueryParams: QueryParams{
+			PieceCID: pieceCID,
+			Path:     path,
+		},
+	}
+}
+
+// NewQueryForRange creates a V1 query for a range of bytes of the UnixFS file
+// at the given path under the payload
+func NewQueryForRange(payloadCID cid.Cid, path string, byteRange ByteRange, pieceCID *cid.Cid) Query {
+	return Query{
+		PayloadCID: payloadCID,
+		QueryParams: QueryParams{
+			PieceCID: pieceCID,
+			Path:     path,
+			Range:    &byteRange,
+		},
+	}
+}
+
 // QueryResponse is a miners response to a given retrieval query
 type QueryResponse struct {
 	Status        QueryResponseStatus
@@ -211,6 +256,12 @@ type QueryResponse struct {
 	MaxPaymentIntervalIncrease uint64
 	Message                    string
 	UnsealPrice                abi.TokenAmount
+
+	// PathFound is true if the query was for a path or a range and the
+	// provider found it, in which case Size is the size of the blocks that
+	// retrieving the path or range transfers. Otherwise Size is the size of
+	// the piece.
+	PathFound bool
 }
 
 // QueryResponseUndefined is an empty QueryResponse
@@ -232,7 +283,8 @@ func (qr QueryResponse) PieceRetrievalPrice() abi.TokenAmount {
 func IsTerminalError(status DealStatus) bool {
 	return status == DealStatusDealNotFound ||
 		status == DealStatusFailing ||
-		status == DealStatusRejected
+		status == DealStatusRejected ||
+		status == DealStatusIncomplete
 }
 
 // IsTerminalSuccess returns true if this status indicates processing of this deal
@@ -255,6 +307,12 @@ type Params struct {
 	PaymentInterval         uint64 // when to request payment
 	PaymentIntervalIncrease uint64
 	UnsealPrice             abi.TokenAmount
+	// AccessToken is optional. It authorises the client to retrieve data
+	// that the provider only serves to authorised clients. Providers that
+	// don't support access tokens reject proposals that carry one. It is sent
+	// in the deal proposal voucher, as data transfer has no other way to send
+	// data with a request, and left out of the voucher when it is nil.
+	AccessToken *AccessToken `cborgen:"omitempty"`
 }
 
 // paramsBindnodeOptions is the bindnode options required to convert custom
@@ -262,12 +320,85 @@ type Params struct {
 var paramsBindnodeOptions = []bindnode.Option{
 	CborGenCompatibleNodeBindnodeOption,
 	TokenAmountBindnodeOption,
+	AddressBindnodeOption,
+	SignatureBindnodeOption,
+}
+
+// AccessToken is a bearer token, signed by the owner of some data, that
+// authorises retrieving the data from providers that accept tokens from the
+// owner
+type AccessToken struct {
+	// PayloadCID and PieceCID are the data that the token authorises
+	// retrieving. At least one of them must be set, and a retrieval must match
+	// each one that is set.
+	PayloadCID *cid.Cid
+	PieceCID   *cid.Cid
+	// Client is the only peer that may use the token. If it is empty, any
+	// peer holding the token may use it.
+	Client peer.ID
+	// Expiration is the unix time in seconds at which the token expires
+	Expiration int64
+	// Signer is the address of the owner that signed the token
+	Signer    address.Address
+	Signature *crypto.Signature
+}
+
+// SigningBytes returns the bytes of the token that its signature is over
+func (t AccessToken) SigningBytes() ([]byte, error) {
+	t.Signature = nil
+	buf := new(bytes.Buffer)
+	if err := t.MarshalCBOR(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 func (p Params) SelectorSpecified() bool {
 	return !p.Selector.IsNull()
 }
 
+// SelectsUnixFS returns true if the selector interprets nodes as UnixFS, as
+// the selectors for a path or a range of bytes do. Traversing such a selector
+// requires UnixFS reification on the link system.
+func (p Params) SelectsUnixFS() bool {
+	return p.SelectorSpecified() && interpretsAsUnixFS(p.Selector.Node)
+}
+
+func interpretsAsUnixFS(n datamodel.Node) bool {
+	switch n.Kind() {
+	case datamodel.Kind_Map:
+		if interpretAs, err := n.LookupByString(selector.SelectorKey_ExploreInterpretAs); err == nil {
+			if as, err := interpretAs.LookupByString(selector.SelectorKey_As); err == nil {
+				if adl, err := as.AsString(); err == nil && adl == "unixfs" {
+					return true
+				}
+			}
+		}
+		it := n.MapIterator()
+		for !it.Done() {
+			_, v, err := it.Next()
+			if err != nil {
+				return false
+			}
+			if interpretsAsUnixFS(v) {
+				return true
+			}
+		}
+	case datamodel.Kind_List:
+		it := n.ListIterator()
+		for !it.Done() {
+			_, v, err := it.Next()
+			if err != nil {
+				return false
+			}
+			if interpretsAsUnixFS(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (p Params) IntervalLowerBound(currentInterval uint64) uint64 {
 	intervalSize := p.PaymentInterval
 	var lowerBound uint64
@@ -281,6 +412,8 @@ func (p Params) IntervalLowerBound(currentInterval uint64) uint64 {
 }
 
 // OutstandingBalance produces the amount owed based on the deal params
+// and the bytes sent so far. For a deal for a byte range, only the blocks that
+// hold bytes in the range are sent, so only they are paid for.
 // for the given transfer state and funds received
 func (p Params) OutstandingBalance(fundsReceived abi.TokenAmount, sent uint64, inFinalization bool) big.Int {
 	// Check if the payment covers unsealing
@@ -370,6 +503,66 @@ func NewParamsV1(pricePerByte abi.TokenAmount, paymentInterval uint64, paymentIn
 	}, nil
 }
 
+// NewParamsForPath generates parameters for a retrieval deal for the UnixFS
+// file or directory at the given path under the payload
+func NewParamsForPath(pricePerByte abi.TokenAmount, paymentInterval uint64, paymentIntervalIncrease uint64, path string, pieceCid *cid.Cid, unsealPrice abi.TokenAmount) (Params, error) {
+	return NewParamsV1(pricePerByte, paymentInterval, paymentIntervalIncrease, UnixFSPathSelector(path), pieceCid, unsealPrice)
+}
+
+// UnixFSPathSelector returns a selector for the UnixFS file or directory at
+// the given slash-separated path under a root. It selects the blocks of the
+// directories along the path, including only the HAMT shards that the path
+// goes through, and every block of the file or directory at the path.
+//
+// Traversing the selector requires UnixFS reification on the link system,
+// see unixfsnode.AddUnixFSReificationToLinkSystem.
+func UnixFSPathSelector(path string) datamodel.Node {
+	return unixfsnode.UnixFSPathSelectorBuilder(path, unixfsnode.ExploreAllRecursivelySelector, false)
+}
+
+// ByteRange is a range of bytes of a UnixFS file
+type ByteRange struct {
+	Offset uint64
+	// Length is the number of bytes in the range. If it is zero, the range
+	// runs to the end of the file.
+	Length uint64
+}
+
+// Selector returns a selector for the UnixFS file at the node it is applied
+// to, that matches the bytes in the range. Only the blocks of the file that
+// hold bytes in the range, and the blocks above them, are loaded when the
+// matched bytes are read.
+func (r ByteRange) Selector(ssb builder.SelectorSpecBuilder) builder.SelectorSpec {
+	from, to := int64(math.MaxInt64), int64(math.MaxInt64)
+	if r.Offset < math.MaxInt64 {
+		from = int64(r.Offset)
+	}
+	if r.Length != 0 && r.Length <= uint64(to-from) {
+		to = from + int64(r.Length)
+	}
+	return ssb.ExploreInterpretAs("unixfs", ssb.MatcherSubset(from, to))
+}
+
+// NewParamsForRange generates parameters for a retrieval deal for a range of
+// bytes of the UnixFS file at the given path under the payload. The provider
+// charges for the blocks that hold bytes in the range, not for the whole file.
+//
+// The deal's blockstore receives whole blocks, so it may hold bytes on either
+// side of the range. To get exactly the bytes in the range, extract the deal
+// with the same path and range, using the Path and Range options of the
+// retrievalmarket/impl/extract package.
+func NewParamsForRange(pricePerByte abi.TokenAmount, paymentInterval uint64, paymentIntervalIncrease uint64, path string, byteRange ByteRange, pieceCid *cid.Cid, unsealPrice abi.TokenAmount) (Params, error) {
+	return NewParamsV1(pricePerByte, paymentInterval, paymentIntervalIncrease, UnixFSRangeSelector(path, byteRange), pieceCid, unsealPrice)
+}
+
+// UnixFSRangeSelector returns a selector for a range of bytes of the UnixFS
+// file at the given slash-separated path under a root. Like
+// UnixFSPathSelector, it requires UnixFS reification on the link system.
+func UnixFSRangeSelector(path string, byteRange ByteRange) datamodel.Node {
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	return unixfsnode.UnixFSPathSelectorBuilder(path, byteRange.Selector(ssb), false)
+}
+
 // DealID is an identifier for a retrieval deal (unique to a client)
 type DealID uint64
 
@@ -524,6 +717,22 @@ type ChannelAvailableFunds struct {
 	VoucherReedeemedAmt abi.TokenAmount
 }
 
+// PaymentChannelState is the on-chain state of a payment channel, as seen by
+// the recipient of the channel's vouchers
+type PaymentChannelState struct {
+	// SettlingAt is the epoch at which the channel finishes settling, or zero
+	// if settling has not started
+	SettlingAt abi.ChainEpoch
+	// MinSettleHeight is the earliest epoch at which the channel can be
+	// collected
+	MinSettleHeight abi.ChainEpoch
+	// LaneRedeemed is the amount that has been redeemed on-chain in each lane
+	LaneRedeemed map[uint64]abi.TokenAmount
+	// Collected is true if the channel has been collected and no longer
+	// exists on-chain
+	Collected bool
+}
+
 // PricingInput provides input parameters required to price a retrieval deal.
 type PricingInput struct {
 	// PayloadCID is the cid of the payload to retrieve.
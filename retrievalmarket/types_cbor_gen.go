@@ -11,6 +11,7 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer/v2"
 	piecestore "github.com/filecoin-project/go-fil-markets/piecestore"
 	paych "github.com/filecoin-project/go-state-types/builtin/v8/paych"
+	crypto "github.com/filecoin-project/go-state-types/crypto"
 	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p/core/peer"
 	cbg "github.com/whyrusleeping/cbor-gen"
@@ -146,7 +147,7 @@ func (t *QueryResponse) MarshalCBOR(w io.Writer) error {
 
 	cw := cbg.NewCborWriter(w)
 
-	if _, err := cw.Write([]byte{169}); err != nil {
+	if _, err := cw.Write([]byte{170}); err != nil {
 		return err
 	}
 
@@ -205,6 +206,22 @@ func (t *QueryResponse) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
+	// t.PathFound (bool) (bool)
+	if len("PathFound") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"PathFound\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("PathFound"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("PathFound")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteBool(w, t.PathFound); err != nil {
+		return err
+	}
+
 	// t.UnsealPrice (big.Int) (struct)
 	if len("UnsealPrice") > cbg.MaxLength {
 		return xerrors.Errorf("Value in field \"UnsealPrice\" was too long")
@@ -383,6 +400,24 @@ func (t *QueryResponse) UnmarshalCBOR(r io.Reader) (err error) {
 
 				t.Message = string(sval)
 			}
+			// t.PathFound (bool) (bool)
+		case "PathFound":
+
+			maj, extra, err = cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+			if maj != cbg.MajOther {
+				return fmt.Errorf("booleans must be major type 7")
+			}
+			switch extra {
+			case 20:
+				t.PathFound = false
+			case 21:
+				t.PathFound = true
+			default:
+				return fmt.Errorf("booleans are either major type 7, value 20 or 21 (got %d)", extra)
+			}
 			// t.UnsealPrice (big.Int) (struct)
 		case "UnsealPrice":
 
@@ -805,8 +840,13 @@ func (t *Params) MarshalCBOR(w io.Writer) error {
 	}
 
 	cw := cbg.NewCborWriter(w)
+	fieldCount := 7
 
-	if _, err := cw.Write([]byte{166}); err != nil {
+	if t.AccessToken == nil {
+		fieldCount--
+	}
+
+	if _, err := cw.Write(cbg.CborEncodeMajorType(cbg.MajMap, uint64(fieldCount))); err != nil {
 		return err
 	}
 
@@ -848,6 +888,25 @@ func (t *Params) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
+	// t.AccessToken (retrievalmarket.AccessToken) (struct)
+	if t.AccessToken != nil {
+
+		if len("AccessToken") > cbg.MaxLength {
+			return xerrors.Errorf("Value in field \"AccessToken\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("AccessToken"))); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, string("AccessToken")); err != nil {
+			return err
+		}
+
+		if err := t.AccessToken.MarshalCBOR(cw); err != nil {
+			return err
+		}
+	}
+
 	// t.UnsealPrice (big.Int) (struct)
 	if len("UnsealPrice") > cbg.MaxLength {
 		return xerrors.Errorf("Value in field \"UnsealPrice\" was too long")
@@ -985,6 +1044,26 @@ func (t *Params) UnmarshalCBOR(r io.Reader) (err error) {
 					return xerrors.Errorf("unmarshaling t.Selector: %w", err)
 				}
 
+			}
+			// t.AccessToken (retrievalmarket.AccessToken) (struct)
+		case "AccessToken":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+					t.AccessToken = new(AccessToken)
+					if err := t.AccessToken.UnmarshalCBOR(cr); err != nil {
+						return xerrors.Errorf("unmarshaling t.AccessToken pointer: %w", err)
+					}
+				}
+
 			}
 			// t.UnsealPrice (big.Int) (struct)
 		case "UnsealPrice":
@@ -1053,7 +1132,46 @@ func (t *QueryParams) MarshalCBOR(w io.Writer) error {
 
 	cw := cbg.NewCborWriter(w)
 
-	if _, err := cw.Write([]byte{161}); err != nil {
+	if _, err := cw.Write([]byte{164}); err != nil {
+		return err
+	}
+
+	// t.Path (string) (string)
+	if len("Path") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Path\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Path"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Path")); err != nil {
+		return err
+	}
+
+	if len(t.Path) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.Path was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.Path))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.Path)); err != nil {
+		return err
+	}
+
+	// t.Range (retrievalmarket.ByteRange) (struct)
+	if len("Range") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Range\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Range"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Range")); err != nil {
+		return err
+	}
+
+	if err := t.Range.MarshalCBOR(cw); err != nil {
 		return err
 	}
 
@@ -1079,6 +1197,21 @@ func (t *QueryParams) MarshalCBOR(w io.Writer) error {
 		}
 	}
 
+	// t.AccessToken (retrievalmarket.AccessToken) (struct)
+	if len("AccessToken") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"AccessToken\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("AccessToken"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("AccessToken")); err != nil {
+		return err
+	}
+
+	if err := t.AccessToken.MarshalCBOR(cw); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1120,7 +1253,38 @@ func (t *QueryParams) UnmarshalCBOR(r io.Reader) (err error) {
 		}
 
 		switch name {
-		// t.PieceCID (cid.Cid) (struct)
+		// t.Path (string) (string)
+		case "Path":
+
+			{
+				sval, err := cbg.ReadString(cr)
+				if err != nil {
+					return err
+				}
+
+				t.Path = string(sval)
+			}
+			// t.Range (retrievalmarket.ByteRange) (struct)
+		case "Range":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+					t.Range = new(ByteRange)
+					if err := t.Range.UnmarshalCBOR(cr); err != nil {
+						return xerrors.Errorf("unmarshaling t.Range pointer: %w", err)
+					}
+				}
+
+			}
+			// t.PieceCID (cid.Cid) (struct)
 		case "PieceCID":
 
 			{
@@ -1143,6 +1307,26 @@ func (t *QueryParams) UnmarshalCBOR(r io.Reader) (err error) {
 				}
 
 			}
+			// t.AccessToken (retrievalmarket.AccessToken) (struct)
+		case "AccessToken":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+					t.AccessToken = new(AccessToken)
+					if err := t.AccessToken.UnmarshalCBOR(cr); err != nil {
+						return xerrors.Errorf("unmarshaling t.AccessToken pointer: %w", err)
+					}
+				}
+
+			}
 
 		default:
 			// Field doesn't exist on this type, so ignore it
@@ -1314,7 +1498,7 @@ func (t *ClientDealState) MarshalCBOR(w io.Writer) error {
 
 	cw := cbg.NewCborWriter(w)
 
-	if _, err := cw.Write([]byte{181}); err != nil {
+	if _, err := cw.Write([]byte{182}); err != nil {
 		return err
 	}
 
@@ -1568,6 +1752,22 @@ func (t *ClientDealState) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
+	// t.AutoTopUpAdded (big.Int) (struct)
+	if len("AutoTopUpAdded") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"AutoTopUpAdded\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("AutoTopUpAdded"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("AutoTopUpAdded")); err != nil {
+		return err
+	}
+
+	if err := t.AutoTopUpAdded.MarshalCBOR(cw); err != nil {
+		return err
+	}
+
 	// t.LegacyProtocol (bool) (bool)
 	if len("LegacyProtocol") > cbg.MaxLength {
 		return xerrors.Errorf("Value in field \"LegacyProtocol\" was too long")
@@ -1924,6 +2124,16 @@ func (t *ClientDealState) UnmarshalCBOR(r io.Reader) (err error) {
 				}
 				t.TotalReceived = uint64(extra)
 
+			}
+			// t.AutoTopUpAdded (big.Int) (struct)
+		case "AutoTopUpAdded":
+
+			{
+
+				if err := t.AutoTopUpAdded.UnmarshalCBOR(cr); err != nil {
+					return xerrors.Errorf("unmarshaling t.AutoTopUpAdded: %w", err)
+				}
+
 			}
 			// t.LegacyProtocol (bool) (bool)
 		case "LegacyProtocol":
@@ -2809,3 +3019,423 @@ func (t *Ask) UnmarshalCBOR(r io.Reader) (err error) {
 
 	return nil
 }
+func (t *ByteRange) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+
+	cw := cbg.NewCborWriter(w)
+
+	if _, err := cw.Write([]byte{162}); err != nil {
+		return err
+	}
+
+	// t.Length (uint64) (uint64)
+	if len("Length") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Length\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Length"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Length")); err != nil {
+		return err
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.Length)); err != nil {
+		return err
+	}
+
+	// t.Offset (uint64) (uint64)
+	if len("Offset") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Offset\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Offset"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Offset")); err != nil {
+		return err
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.Offset)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (t *ByteRange) UnmarshalCBOR(r io.Reader) (err error) {
+	*t = ByteRange{}
+
+	cr := cbg.NewCborReader(r)
+
+	maj, extra, err := cr.ReadHeader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("ByteRange: map struct too large (%d)", extra)
+	}
+
+	var name string
+	n := extra
+
+	for i := uint64(0); i < n; i++ {
+
+		{
+			sval, err := cbg.ReadString(cr)
+			if err != nil {
+				return err
+			}
+
+			name = string(sval)
+		}
+
+		switch name {
+		// t.Length (uint64) (uint64)
+		case "Length":
+
+			{
+
+				maj, extra, err = cr.ReadHeader()
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.Length = uint64(extra)
+
+			}
+			// t.Offset (uint64) (uint64)
+		case "Offset":
+
+			{
+
+				maj, extra, err = cr.ReadHeader()
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.Offset = uint64(extra)
+
+			}
+
+		default:
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
+		}
+	}
+
+	return nil
+}
+func (t *AccessToken) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+
+	cw := cbg.NewCborWriter(w)
+
+	if _, err := cw.Write([]byte{166}); err != nil {
+		return err
+	}
+
+	// t.Client (peer.ID) (string)
+	if len("Client") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Client\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Client"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Client")); err != nil {
+		return err
+	}
+
+	if len(t.Client) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.Client was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.Client))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.Client)); err != nil {
+		return err
+	}
+
+	// t.Signer (address.Address) (struct)
+	if len("Signer") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Signer\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Signer"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Signer")); err != nil {
+		return err
+	}
+
+	if err := t.Signer.MarshalCBOR(cw); err != nil {
+		return err
+	}
+
+	// t.PieceCID (cid.Cid) (struct)
+	if len("PieceCID") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"PieceCID\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("PieceCID"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("PieceCID")); err != nil {
+		return err
+	}
+
+	if t.PieceCID == nil {
+		if _, err := cw.Write(cbg.CborNull); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteCid(cw, *t.PieceCID); err != nil {
+			return xerrors.Errorf("failed to write cid field t.PieceCID: %w", err)
+		}
+	}
+
+	// t.Signature (crypto.Signature) (struct)
+	if len("Signature") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Signature\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Signature"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Signature")); err != nil {
+		return err
+	}
+
+	if err := t.Signature.MarshalCBOR(cw); err != nil {
+		return err
+	}
+
+	// t.Expiration (int64) (int64)
+	if len("Expiration") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Expiration\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Expiration"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Expiration")); err != nil {
+		return err
+	}
+
+	if t.Expiration >= 0 {
+		if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.Expiration)); err != nil {
+			return err
+		}
+	} else {
+		if err := cw.WriteMajorTypeHeader(cbg.MajNegativeInt, uint64(-t.Expiration-1)); err != nil {
+			return err
+		}
+	}
+
+	// t.PayloadCID (cid.Cid) (struct)
+	if len("PayloadCID") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"PayloadCID\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("PayloadCID"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("PayloadCID")); err != nil {
+		return err
+	}
+
+	if t.PayloadCID == nil {
+		if _, err := cw.Write(cbg.CborNull); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteCid(cw, *t.PayloadCID); err != nil {
+			return xerrors.Errorf("failed to write cid field t.PayloadCID: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (t *AccessToken) UnmarshalCBOR(r io.Reader) (err error) {
+	*t = AccessToken{}
+
+	cr := cbg.NewCborReader(r)
+
+	maj, extra, err := cr.ReadHeader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("AccessToken: map struct too large (%d)", extra)
+	}
+
+	var name string
+	n := extra
+
+	for i := uint64(0); i < n; i++ {
+
+		{
+			sval, err := cbg.ReadString(cr)
+			if err != nil {
+				return err
+			}
+
+			name = string(sval)
+		}
+
+		switch name {
+		// t.Client (peer.ID) (string)
+		case "Client":
+
+			{
+				sval, err := cbg.ReadString(cr)
+				if err != nil {
+					return err
+				}
+
+				t.Client = peer.ID(sval)
+			}
+			// t.Signer (address.Address) (struct)
+		case "Signer":
+
+			{
+
+				if err := t.Signer.UnmarshalCBOR(cr); err != nil {
+					return xerrors.Errorf("unmarshaling t.Signer: %w", err)
+				}
+
+			}
+			// t.PieceCID (cid.Cid) (struct)
+		case "PieceCID":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+
+					c, err := cbg.ReadCid(cr)
+					if err != nil {
+						return xerrors.Errorf("failed to read cid field t.PieceCID: %w", err)
+					}
+
+					t.PieceCID = &c
+				}
+
+			}
+			// t.Signature (crypto.Signature) (struct)
+		case "Signature":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+					t.Signature = new(crypto.Signature)
+					if err := t.Signature.UnmarshalCBOR(cr); err != nil {
+						return xerrors.Errorf("unmarshaling t.Signature pointer: %w", err)
+					}
+				}
+
+			}
+			// t.Expiration (int64) (int64)
+		case "Expiration":
+			{
+				maj, extra, err := cr.ReadHeader()
+				var extraI int64
+				if err != nil {
+					return err
+				}
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative overflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.Expiration = int64(extraI)
+			}
+			// t.PayloadCID (cid.Cid) (struct)
+		case "PayloadCID":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+
+					c, err := cbg.ReadCid(cr)
+					if err != nil {
+						return xerrors.Errorf("failed to read cid field t.PayloadCID: %w", err)
+					}
+
+					t.PayloadCID = &c
+				}
+
+			}
+
+		default:
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
+		}
+	}
+
+	return nil
+}
@@ -115,3 +115,19 @@ func TestParamsIntervalBounds(t *testing.T) {
 		})
 	}
 }
+
+func TestParamsSelectsUnixFS(t *testing.T) {
+	allSelector := selectorparse.CommonSelector_ExploreAllRecursively
+	params, err := retrievalmarket.NewParamsV1(abi.NewTokenAmount(1), 10, 5, allSelector, nil, big.Zero())
+	require.NoError(t, err)
+	require.False(t, params.SelectsUnixFS())
+	require.False(t, retrievalmarket.NewParamsV0(abi.NewTokenAmount(1), 10, 5).SelectsUnixFS())
+
+	params, err = retrievalmarket.NewParamsForPath(abi.NewTokenAmount(1), 10, 5, "dir/file", nil, big.Zero())
+	require.NoError(t, err)
+	require.True(t, params.SelectsUnixFS())
+
+	params, err = retrievalmarket.NewParamsForRange(abi.NewTokenAmount(1), 10, 5, "", retrievalmarket.ByteRange{Offset: 10, Length: 100}, nil, big.Zero())
+	require.NoError(t, err)
+	require.True(t, params.SelectsUnixFS())
+}
@@ -0,0 +1,65 @@
+// Package askgossip spreads provider asks over a libp2p pubsub topic.
+//
+// Without gossip, a client learns a provider's storage ask by dialing the
+// provider on the ask protocol, which makes price discovery across many
+// providers slow. A provider's Publisher publishes its signed storage ask and
+// its retrieval ask to a topic whenever they change, and periodically after
+// that, and a client's Cache subscribes to the topic and keeps the latest
+// verified storage ask of each provider.
+//
+// The package does not depend on a pubsub implementation: the node wraps a
+// go-libp2p-pubsub topic in the Topic interface.
+package askgossip
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+)
+
+//go:generate cbor-gen-for --map-encoding AskMessage
+
+// TopicName is the name of the pubsub topic that asks are gossiped on
+const TopicName = "/fil/markets/asks/1.0.0"
+
+// Topic is a pubsub topic. Messages received by a subscription must have had
+// their signature verified, so that From is the peer that published them, as
+// go-libp2p-pubsub does when strict message signing is enabled (the
+// default).
+type Topic interface {
+	// Publish publishes data to the topic
+	Publish(ctx context.Context, data []byte) error
+	// Subscribe returns a subscription to the messages published to the topic
+	Subscribe() (Subscription, error)
+}
+
+// Subscription is a subscription to a pubsub topic
+type Subscription interface {
+	// Next returns the next message published to the topic
+	Next(ctx context.Context) (Message, error)
+	// Cancel ends the subscription
+	Cancel()
+}
+
+// Message is a message received from a pubsub topic
+type Message struct {
+	// From is the peer that published the message
+	From peer.ID
+	// Data is the content of the message
+	Data []byte
+}
+
+// AskMessage is the message that providers publish to the topic. The
+// storage ask is signed by the miner's worker key. The retrieval ask is not
+// signed, so it should only be trusted if the message was published by the
+// miner's peer.
+type AskMessage struct {
+	Miner        address.Address
+	StorageAsk   *storagemarket.SignedStorageAsk
+	RetrievalAsk *retrievalmarket.Ask
+}
@@ -0,0 +1,271 @@
+package askgossip
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+)
+
+func TestPublishAndCache(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	worker, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+	minerPeer := peer.ID("miner")
+	node := &fakeNode{
+		epoch: 100,
+		miners: map[address.Address]*storagemarket.StorageProviderInfo{
+			miner: {Address: miner, Worker: worker, PeerID: minerPeer},
+		},
+	}
+
+	topic := newFakeTopic()
+	cache := NewCache(topic, node, time.Hour)
+	var clockLk sync.Mutex
+	now := time.Now()
+	cache.now = func() time.Time {
+		clockLk.Lock()
+		defer clockLk.Unlock()
+		return now
+	}
+	require.NoError(t, cache.Start())
+	defer cache.Stop()
+
+	pub := NewPublisher(topic.from(minerPeer), miner, 0)
+
+	// nothing is published until an ask is set
+	require.NoError(t, pub.Publish(ctx))
+	require.Zero(t, topic.published())
+
+	storageAsk := signedAsk(t, miner, worker, 1)
+	require.NoError(t, pub.SetStorageAsk(ctx, storageAsk))
+	require.Eventually(t, func() bool {
+		_, ok := cache.StorageAsk(miner)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	ask, _ := cache.StorageAsk(miner)
+	require.Equal(t, storageAsk.Ask, ask)
+
+	// both asks are published together
+	retrievalAsk := &retrievalmarket.Ask{
+		PricePerByte:    abi.NewTokenAmount(2),
+		UnsealPrice:     abi.NewTokenAmount(3),
+		PaymentInterval: 1 << 20,
+	}
+	require.NoError(t, pub.SetRetrievalAsk(ctx, retrievalAsk))
+	require.Eventually(t, func() bool { return topic.published() == 2 }, time.Second, 10*time.Millisecond)
+	var am AskMessage
+	require.NoError(t, am.UnmarshalCBOR(bytes.NewReader(topic.last())))
+	require.Equal(t, retrievalAsk, am.RetrievalAsk)
+	require.Equal(t, storageAsk.Ask, am.StorageAsk.Ask)
+
+	// asks expire from the cache, and are then evicted
+	clockLk.Lock()
+	now = now.Add(time.Hour)
+	clockLk.Unlock()
+	_, ok := cache.StorageAsk(miner)
+	require.False(t, ok)
+	cache.evictExpired()
+	cache.lk.RLock()
+	require.Empty(t, cache.asks)
+	cache.lk.RUnlock()
+}
+
+func TestCacheRejectsInvalidAsks(t *testing.T) {
+	ctx := context.Background()
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	worker, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+	other, err := address.NewIDAddress(1002)
+	require.NoError(t, err)
+	minerPeer := peer.ID("miner")
+	node := &fakeNode{
+		epoch: 100,
+		miners: map[address.Address]*storagemarket.StorageProviderInfo{
+			miner: {Address: miner, Worker: worker, PeerID: minerPeer},
+		},
+	}
+
+	receive := func(from peer.ID, msg AskMessage) (*Cache, error) {
+		var buf bytes.Buffer
+		require.NoError(t, msg.MarshalCBOR(&buf))
+		cache := NewCache(newFakeTopic(), node, 0)
+		return cache, cache.receive(ctx, Message{From: from, Data: buf.Bytes()})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		cache, err := receive(minerPeer, AskMessage{Miner: miner, StorageAsk: signedAsk(t, miner, worker, 1)})
+		require.NoError(t, err)
+		_, ok := cache.StorageAsk(miner)
+		require.True(t, ok)
+	})
+
+	t.Run("published by another peer", func(t *testing.T) {
+		_, err := receive(peer.ID("other"), AskMessage{Miner: miner, StorageAsk: signedAsk(t, miner, worker, 1)})
+		require.Error(t, err)
+	})
+
+	t.Run("without a storage ask", func(t *testing.T) {
+		_, err := receive(minerPeer, AskMessage{Miner: miner, RetrievalAsk: &retrievalmarket.Ask{}})
+		require.Error(t, err)
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		_, err := receive(minerPeer, AskMessage{Miner: miner, StorageAsk: signedAsk(t, miner, other, 1)})
+		require.Error(t, err)
+	})
+
+	t.Run("for another miner", func(t *testing.T) {
+		_, err := receive(minerPeer, AskMessage{Miner: miner, StorageAsk: signedAsk(t, other, worker, 1)})
+		require.Error(t, err)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		ask := signedAsk(t, miner, worker, 1)
+		ask.Ask.Expiry = node.epoch
+		ask = sign(t, ask.Ask, worker)
+		_, err := receive(minerPeer, AskMessage{Miner: miner, StorageAsk: ask})
+		require.Error(t, err)
+	})
+
+	t.Run("out of order", func(t *testing.T) {
+		cache := NewCache(newFakeTopic(), node, 0)
+		for _, seqNo := range []uint64{2, 1} {
+			var buf bytes.Buffer
+			require.NoError(t, (&AskMessage{Miner: miner, StorageAsk: signedAsk(t, miner, worker, seqNo)}).MarshalCBOR(&buf))
+			require.NoError(t, cache.receive(ctx, Message{From: minerPeer, Data: buf.Bytes()}))
+		}
+		ask, ok := cache.StorageAsk(miner)
+		require.True(t, ok)
+		require.EqualValues(t, 2, ask.SeqNo)
+	})
+}
+
+func signedAsk(t *testing.T, miner address.Address, signer address.Address, seqNo uint64) *storagemarket.SignedStorageAsk {
+	return sign(t, &storagemarket.StorageAsk{
+		Price:         abi.NewTokenAmount(10),
+		VerifiedPrice: abi.NewTokenAmount(5),
+		MinPieceSize:  256,
+		MaxPieceSize:  1 << 30,
+		Miner:         miner,
+		Timestamp:     90,
+		Expiry:        1000,
+		SeqNo:         seqNo,
+	}, signer)
+}
+
+// sign makes a fake signature, which is the signer's address followed by the
+// signed bytes
+func sign(t *testing.T, ask *storagemarket.StorageAsk, signer address.Address) *storagemarket.SignedStorageAsk {
+	data, err := cborutil.Dump(ask)
+	require.NoError(t, err)
+	return &storagemarket.SignedStorageAsk{
+		Ask:       ask,
+		Signature: &crypto.Signature{Type: crypto.SigTypeBLS, Data: append(signer.Bytes(), data...)},
+	}
+}
+
+type fakeNode struct {
+	epoch  abi.ChainEpoch
+	miners map[address.Address]*storagemarket.StorageProviderInfo
+}
+
+func (n *fakeNode) GetChainHead(ctx context.Context) (shared.TipSetToken, abi.ChainEpoch, error) {
+	return shared.TipSetToken{}, n.epoch, nil
+}
+
+func (n *fakeNode) GetMinerInfo(ctx context.Context, maddr address.Address, tok shared.TipSetToken) (*storagemarket.StorageProviderInfo, error) {
+	info, ok := n.miners[maddr]
+	if !ok {
+		return nil, address.ErrUnknownNetwork
+	}
+	return info, nil
+}
+
+func (n *fakeNode) VerifySignature(ctx context.Context, signature crypto.Signature, signer address.Address, plaintext []byte, tok shared.TipSetToken) (bool, error) {
+	return bytes.Equal(signature.Data, append(signer.Bytes(), plaintext...)), nil
+}
+
+// fakeTopic delivers published messages to its subscriptions
+type fakeTopic struct {
+	lk    sync.Mutex
+	subs  []chan Message
+	count int
+	data  []byte
+	self  peer.ID
+	root  *fakeTopic
+}
+
+func newFakeTopic() *fakeTopic {
+	ft := &fakeTopic{}
+	ft.root = ft
+	return ft
+}
+
+// from returns a view of the topic that publishes messages from the peer
+func (ft *fakeTopic) from(p peer.ID) *fakeTopic {
+	return &fakeTopic{self: p, root: ft.root}
+}
+
+func (ft *fakeTopic) published() int {
+	ft.root.lk.Lock()
+	defer ft.root.lk.Unlock()
+	return ft.root.count
+}
+
+// last returns the last message published to the topic
+func (ft *fakeTopic) last() []byte {
+	ft.root.lk.Lock()
+	defer ft.root.lk.Unlock()
+	return ft.root.data
+}
+
+func (ft *fakeTopic) Publish(ctx context.Context, data []byte) error {
+	ft.root.lk.Lock()
+	defer ft.root.lk.Unlock()
+	ft.root.count++
+	ft.root.data = data
+	for _, sub := range ft.root.subs {
+		sub <- Message{From: ft.self, Data: data}
+	}
+	return nil
+}
+
+func (ft *fakeTopic) Subscribe() (Subscription, error) {
+	ft.root.lk.Lock()
+	defer ft.root.lk.Unlock()
+	sub := make(chan Message, 16)
+	ft.root.subs = append(ft.root.subs, sub)
+	return fakeSubscription(sub), nil
+}
+
+type fakeSubscription chan Message
+
+func (fs fakeSubscription) Next(ctx context.Context) (Message, error) {
+	select {
+	case msg := <-fs:
+		return msg, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+func (fs fakeSubscription) Cancel() {}
@@ -0,0 +1,219 @@
+package askgossip
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+
+	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+)
+
+// DefaultMaxAge is how long a Cache keeps a provider's asks after it last
+// received them by default
+const DefaultMaxAge = 2 * DefaultRepublishInterval
+
+// Node is the chain access a Cache needs to verify asks. It is implemented
+// by storagemarket.StorageClientNode.
+type Node interface {
+	GetChainHead(ctx context.Context) (shared.TipSetToken, abi.ChainEpoch, error)
+	GetMinerInfo(ctx context.Context, maddr address.Address, tok shared.TipSetToken) (*storagemarket.StorageProviderInfo, error)
+	VerifySignature(ctx context.Context, signature crypto.Signature, signer address.Address, plaintext []byte, tok shared.TipSetToken) (bool, error)
+}
+
+type cachedAsk struct {
+	ask      *storagemarket.StorageAsk
+	received time.Time
+}
+
+// Cache keeps the latest verified storage ask of each provider that
+// publishes to the topic. Asks are only accepted from miners on chain, and
+// are evicted once they are older than the cache's max age, which bounds the
+// size of the cache.
+//
+// Retrieval asks in the messages are not cached: the price and availability
+// of a retrieval depend on the payload, so retrieval clients still query the
+// provider.
+type Cache struct {
+	topic  Topic
+	node   Node
+	maxAge time.Duration
+	now    func() time.Time
+
+	lk   sync.RWMutex
+	asks map[address.Address]cachedAsk
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewCache returns a Cache of the asks published to the topic, which keeps
+// the asks of a provider for maxAge after they were last received. If maxAge
+// is zero, DefaultMaxAge is used.
+func NewCache(topic Topic, node Node, maxAge time.Duration) *Cache {
+	if maxAge == 0 {
+		maxAge = DefaultMaxAge
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Cache{
+		topic:  topic,
+		node:   node,
+		maxAge: maxAge,
+		now:    time.Now,
+		asks:   make(map[address.Address]cachedAsk),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start subscribes to the topic and begins evicting old asks
+func (c *Cache) Start() error {
+	sub, err := c.topic.Subscribe()
+	if err != nil {
+		return xerrors.Errorf("subscribing to asks: %w", err)
+	}
+	c.wg.Add(2)
+	go c.run(sub)
+	go c.evict()
+	return nil
+}
+
+// Stop unsubscribes from the topic
+func (c *Cache) Stop() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *Cache) run(sub Subscription) {
+	defer c.wg.Done()
+	defer sub.Cancel()
+
+	for {
+		msg, err := sub.Next(c.ctx)
+		if err != nil {
+			if c.ctx.Err() == nil {
+				log.Errorf("reading asks: %s", err)
+			}
+			return
+		}
+		if err := c.receive(c.ctx, msg); err != nil {
+			log.Debugf("ignoring asks from %s: %s", msg.From, err)
+		}
+	}
+}
+
+// evict periodically removes the asks that are older than the max age
+func (c *Cache) evict() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.maxAge)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.evictExpired()
+		}
+	}
+}
+
+func (c *Cache) evictExpired() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	for miner, cached := range c.asks {
+		if c.now().Sub(cached.received) >= c.maxAge {
+			delete(c.asks, miner)
+		}
+	}
+}
+
+// receive verifies the storage ask in a message, and caches it if it is
+// valid
+func (c *Cache) receive(ctx context.Context, msg Message) error {
+	var am AskMessage
+	if err := am.UnmarshalCBOR(bytes.NewReader(msg.Data)); err != nil {
+		return xerrors.Errorf("decoding asks: %w", err)
+	}
+	if am.Miner == address.Undef {
+		return xerrors.New("no miner address")
+	}
+	if am.StorageAsk == nil {
+		return xerrors.New("no storage ask")
+	}
+
+	tok, epoch, err := c.node.GetChainHead(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting chain head: %w", err)
+	}
+	info, err := c.node.GetMinerInfo(ctx, am.Miner, tok)
+	if err != nil {
+		return xerrors.Errorf("getting info of miner %s: %w", am.Miner, err)
+	}
+	// asks are only accepted from the miner's own peer
+	if msg.From != info.PeerID {
+		return xerrors.Errorf("asks for miner %s published by %s, not the miner's peer %s", am.Miner, msg.From, info.PeerID)
+	}
+
+	if err := c.verifyStorageAsk(ctx, am.Miner, info.Worker, am.StorageAsk, tok, epoch); err != nil {
+		return err
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	ask := am.StorageAsk.Ask
+	// keep the previous ask if it is newer, in case messages arrive out of
+	// order
+	if prev, ok := c.asks[am.Miner]; ok && prev.ask.SeqNo > ask.SeqNo {
+		ask = prev.ask
+	}
+	c.asks[am.Miner] = cachedAsk{ask: ask, received: c.now()}
+	return nil
+}
+
+func (c *Cache) verifyStorageAsk(ctx context.Context, miner address.Address, worker address.Address, ask *storagemarket.SignedStorageAsk, tok shared.TipSetToken, epoch abi.ChainEpoch) error {
+	if ask.Ask == nil || ask.Signature == nil {
+		return xerrors.New("storage ask is not signed")
+	}
+	if ask.Ask.Miner != miner {
+		return xerrors.Errorf("storage ask is for miner %s, not %s", ask.Ask.Miner, miner)
+	}
+	if ask.Ask.Expiry <= epoch {
+		return xerrors.Errorf("storage ask expired at epoch %d", ask.Ask.Expiry)
+	}
+	askBytes, err := cborutil.Dump(ask.Ask)
+	if err != nil {
+		return err
+	}
+	valid, err := c.node.VerifySignature(ctx, *ask.Signature, worker, askBytes, tok)
+	if err != nil {
+		return xerrors.Errorf("verifying storage ask signature: %w", err)
+	}
+	if !valid {
+		return xerrors.New("storage ask was not properly signed")
+	}
+	return nil
+}
+
+// StorageAsk returns the latest storage ask of the miner, if one has been
+// received within the cache's max age. The caller should check that the ask
+// has not expired.
+func (c *Cache) StorageAsk(miner address.Address) (*storagemarket.StorageAsk, bool) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	cached, ok := c.asks[miner]
+	if !ok || c.now().Sub(cached.received) >= c.maxAge {
+		return nil, false
+	}
+	return cached.ask, true
+}
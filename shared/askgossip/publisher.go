@@ -0,0 +1,127 @@
+package askgossip
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+)
+
+var log = logging.Logger("askgossip")
+
+// DefaultRepublishInterval is how often a Publisher republishes its asks by
+// default, so that clients that join the topic later learn them
+const DefaultRepublishInterval = 30 * time.Minute
+
+// Publisher publishes a provider's asks to the topic
+type Publisher struct {
+	topic    Topic
+	miner    address.Address
+	interval time.Duration
+
+	lk           sync.Mutex
+	storageAsk   *storagemarket.SignedStorageAsk
+	retrievalAsk *retrievalmarket.Ask
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPublisher returns a Publisher for the asks of the given miner, which
+// republishes them at the given interval. If the interval is zero,
+// DefaultRepublishInterval is used.
+//
+// A single Publisher can be shared by a miner's storage and retrieval
+// providers, so that both asks are published in the same message. The
+// Publisher is started and stopped by its owner, not by the providers.
+func NewPublisher(topic Topic, miner address.Address, interval time.Duration) *Publisher {
+	if interval == 0 {
+		interval = DefaultRepublishInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Publisher{
+		topic:    topic,
+		miner:    miner,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start begins republishing the asks periodically
+func (p *Publisher) Start() {
+	p.wg.Add(1)
+	go p.run()
+}
+
+// Stop stops republishing the asks
+func (p *Publisher) Stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+func (p *Publisher) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Publish(p.ctx); err != nil && p.ctx.Err() == nil {
+				log.Errorf("republishing asks: %s", err)
+			}
+		}
+	}
+}
+
+// SetStorageAsk sets the storage ask and publishes the asks
+func (p *Publisher) SetStorageAsk(ctx context.Context, ask *storagemarket.SignedStorageAsk) error {
+	p.lk.Lock()
+	p.storageAsk = ask
+	p.lk.Unlock()
+	return p.Publish(ctx)
+}
+
+// SetRetrievalAsk sets the retrieval ask and publishes the asks
+func (p *Publisher) SetRetrievalAsk(ctx context.Context, ask *retrievalmarket.Ask) error {
+	p.lk.Lock()
+	p.retrievalAsk = ask
+	p.lk.Unlock()
+	return p.Publish(ctx)
+}
+
+// Publish publishes the current asks. Nothing is published until at least
+// one ask has been set.
+func (p *Publisher) Publish(ctx context.Context) error {
+	p.lk.Lock()
+	msg := AskMessage{
+		Miner:        p.miner,
+		StorageAsk:   p.storageAsk,
+		RetrievalAsk: p.retrievalAsk,
+	}
+	p.lk.Unlock()
+
+	if msg.StorageAsk == nil && msg.RetrievalAsk == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := msg.MarshalCBOR(&buf); err != nil {
+		return xerrors.Errorf("encoding asks: %w", err)
+	}
+	if err := p.topic.Publish(ctx, buf.Bytes()); err != nil {
+		return xerrors.Errorf("publishing asks: %w", err)
+	}
+	return nil
+}
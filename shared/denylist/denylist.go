@@ -0,0 +1,325 @@
+// Package denylist refuses content that is on takedown lists.
+//
+// A Denylist is loaded from local files with one entry per line. An entry is
+// either a CID, optionally prefixed with /ipfs/, or a hashed CID in the "bad
+// bits" double-hash format: // followed by the hex SHA-256 of the CIDv1 in
+// base32 and a trailing slash, so that a list does not itself reveal the
+// content it denies. Blank lines and lines starting with # are ignored.
+//
+// CID entries are matched by multihash, so they deny the content whatever the
+// version or codec of the CID it is asked for by. Hashed entries match CIDs
+// with the same codec and multihash, whatever their version. Bad bits entries
+// for paths under a CID never match, as only whole CIDs are checked.
+//
+// While it is running, a Denylist reloads its files when they change,
+// including when they are replaced by renaming another file over them. If a
+// file goes missing, as it may while it is rotated, its entries are kept until
+// it is back. Storage and retrieval providers check content against it, and
+// report each match to its subscribers.
+package denylist
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hannahhoward/go-pubsub"
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/shared"
+)
+
+var log = logging.Logger("denylist")
+
+// DefaultReloadInterval is how often a Denylist checks whether its files
+// have changed by default
+const DefaultReloadInterval = time.Minute
+
+// ErrDenied is returned for content that is on the denylist
+var ErrDenied = errors.New("content is denylisted")
+
+// Source is where denylisted content was seen
+type Source string
+
+const (
+	// SourceStorageProposal is a storage deal proposal, whose payload root or
+	// piece CID is denylisted
+	SourceStorageProposal = Source("storage deal proposal")
+	// SourceRetrievalQuery is a retrieval query for a denylisted payload
+	SourceRetrievalQuery = Source("retrieval query")
+	// SourceRetrievalProposal is a retrieval deal proposal for a denylisted
+	// payload
+	SourceRetrievalProposal = Source("retrieval deal proposal")
+)
+
+// Hit is a match of content against the denylist
+type Hit struct {
+	Cid    cid.Cid
+	Source Source
+	// Peer is the peer that asked for the content
+	Peer peer.ID
+}
+
+// Subscriber is called with each hit
+type Subscriber func(Hit)
+
+// fileVersion identifies the contents of a file that were loaded. It is empty
+// for a file that is missing.
+type fileVersion struct {
+	info os.FileInfo
+}
+
+func (v fileVersion) same(other fileVersion) bool {
+	if v.info == nil || other.info == nil {
+		return v.info == nil && other.info == nil
+	}
+	// a file that was replaced is a different file, even if its size and
+	// modification time are the same
+	return os.SameFile(v.info, other.info) &&
+		v.info.Size() == other.info.Size() &&
+		v.info.ModTime().Equal(other.info.ModTime())
+}
+
+// fileEntries are the entries loaded from one file
+type fileEntries struct {
+	version fileVersion
+	cids    map[string]struct{}
+	hashes  map[string]struct{}
+}
+
+// Denylist is a set of denied CIDs, loaded from files
+type Denylist struct {
+	paths    []string
+	interval time.Duration
+	psub     *pubsub.PubSub
+
+	lk     sync.RWMutex
+	cids   map[string]struct{}
+	hashes map[string]struct{}
+	files  map[string]fileEntries
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a Denylist loaded from the files at the given paths, which
+// checks the files for changes every reloadInterval while it is running. If
+// reloadInterval is zero, DefaultReloadInterval is used.
+func New(paths []string, reloadInterval time.Duration) (*Denylist, error) {
+	if reloadInterval == 0 {
+		reloadInterval = DefaultReloadInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Denylist{
+		paths:    paths,
+		interval: reloadInterval,
+		psub:     pubsub.New(hitDispatcher),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	if err := d.Reload(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Start begins reloading the files when they change
+func (d *Denylist) Start() {
+	d.wg.Add(1)
+	go d.run()
+}
+
+// Stop stops reloading the files
+func (d *Denylist) Stop() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+func (d *Denylist) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !d.changed() {
+			continue
+		}
+		// the previous entries are kept if the files can't be loaded
+		if err := d.Reload(); err != nil {
+			log.Errorf("reloading denylist: %s", err)
+		}
+	}
+}
+
+// changed returns true if any of the files has changed, been replaced, gone
+// missing or come back since it was loaded
+func (d *Denylist) changed() bool {
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+	for _, path := range d.paths {
+		var v fileVersion
+		// a file that can't be read is reloaded, and kept if it is missing
+		if info, err := os.Stat(path); err == nil {
+			v.info = info
+		}
+		if !v.same(d.files[path].version) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload loads the files again, replacing the entries of the denylist. The
+// entries of a file that is missing are kept if it was loaded before. If a
+// file can't be loaded, the denylist is left as it was.
+func (d *Denylist) Reload() error {
+	d.lk.RLock()
+	previous := d.files
+	d.lk.RUnlock()
+
+	files := make(map[string]fileEntries, len(d.paths))
+	for _, path := range d.paths {
+		entries, err := loadFile(path)
+		if err != nil {
+			prev, ok := previous[path]
+			if !ok || !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			log.Warnf("denylist %s is missing, keeping its %d entries", path, len(prev.cids)+len(prev.hashes))
+			entries = fileEntries{cids: prev.cids, hashes: prev.hashes}
+		}
+		files[path] = entries
+	}
+
+	cids := make(map[string]struct{})
+	hashes := make(map[string]struct{})
+	for _, entries := range files {
+		for c := range entries.cids {
+			cids[c] = struct{}{}
+		}
+		for h := range entries.hashes {
+			hashes[h] = struct{}{}
+		}
+	}
+
+	d.lk.Lock()
+	d.cids = cids
+	d.hashes = hashes
+	d.files = files
+	d.lk.Unlock()
+	log.Infow("loaded denylist", "cids", len(cids), "hashes", len(hashes))
+	return nil
+}
+
+func loadFile(path string) (fileEntries, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileEntries{}, xerrors.Errorf("reading denylist %s: %w", path, err)
+	}
+	defer f.Close() //nolint:errcheck
+	// the version is of the file that is read, even if the path is replaced
+	// while it is read
+	info, err := f.Stat()
+	if err != nil {
+		return fileEntries{}, xerrors.Errorf("reading denylist %s: %w", path, err)
+	}
+	entries := fileEntries{
+		version: fileVersion{info: info},
+		cids:    make(map[string]struct{}),
+		hashes:  make(map[string]struct{}),
+	}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "//") {
+			hash := strings.ToLower(strings.TrimPrefix(line, "//"))
+			if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+				return fileEntries{}, xerrors.Errorf("denylist %s line %d: invalid hashed CID %q", path, n, line)
+			}
+			entries.hashes[hash] = struct{}{}
+			continue
+		}
+		c, err := cid.Decode(strings.TrimPrefix(line, "/ipfs/"))
+		if err != nil {
+			return fileEntries{}, xerrors.Errorf("denylist %s line %d: %w", path, n, err)
+		}
+		entries.cids[string(c.Hash())] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fileEntries{}, xerrors.Errorf("reading denylist %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// HashCid returns the bad bits double-hash of a CID
+func HashCid(c cid.Cid) string {
+	v1 := cid.NewCidV1(c.Type(), c.Hash())
+	sum := sha256.Sum256([]byte(v1.String() + "/"))
+	return hex.EncodeToString(sum[:])
+}
+
+// Denied returns true if the CID is on the denylist
+func (d *Denylist) Denied(c cid.Cid) bool {
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+	if _, ok := d.cids[string(c.Hash())]; ok {
+		return true
+	}
+	if len(d.hashes) == 0 {
+		return false
+	}
+	_, ok := d.hashes[HashCid(c)]
+	return ok
+}
+
+// Check returns an error wrapping ErrDenied if the CID is on the denylist,
+// and reports the hit to the subscribers
+func (d *Denylist) Check(c cid.Cid, source Source, p peer.ID) error {
+	if !d.Denied(c) {
+		return nil
+	}
+	log.Infow("denylist hit", "cid", c, "source", source, "peer", p)
+	if err := d.psub.Publish(Hit{Cid: c, Source: source, Peer: p}); err != nil {
+		log.Errorf("publishing denylist hit: %s", err)
+	}
+	return xerrors.Errorf("%s: %w", c, ErrDenied)
+}
+
+// Subscribe calls the subscriber with each hit
+func (d *Denylist) Subscribe(subscriber Subscriber) shared.Unsubscribe {
+	return shared.Unsubscribe(d.psub.Subscribe(subscriber))
+}
+
+func hitDispatcher(evt pubsub.Event, subscriberFn pubsub.SubscriberFn) error {
+	hit, ok := evt.(Hit)
+	if !ok {
+		return errors.New("wrong type of event")
+	}
+	cb, ok := subscriberFn.(Subscriber)
+	if !ok {
+		return errors.New("wrong type of callback")
+	}
+	cb(hit)
+	return nil
+}
@@ -0,0 +1,134 @@
+package denylist_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/shared/denylist"
+)
+
+func TestDenylist(t *testing.T) {
+	bad, hashed, good := testCid(t, "bad"), testCid(t, "hashed"), testCid(t, "good")
+	badV0 := cid.NewCidV0(bad.Hash())
+	hashedV0 := cid.NewCidV0(testCid(t, "hashed v0").Hash())
+
+	path := filepath.Join(t.TempDir(), "denylist")
+	writeList(t, path, "# a comment\n\n/ipfs/"+badV0.String()+"\n//"+denylist.HashCid(hashed)+"\n"+
+		"//"+denylist.HashCid(cid.NewCidV1(cid.DagProtobuf, hashedV0.Hash()))+"\n")
+
+	dl, err := denylist.New([]string{path}, 0)
+	require.NoError(t, err)
+
+	// CID entries match by multihash, whatever the version and codec
+	require.True(t, dl.Denied(bad))
+	require.True(t, dl.Denied(badV0))
+	// hashed entries match by codec and multihash, whatever the version
+	require.True(t, dl.Denied(hashed))
+	require.True(t, dl.Denied(hashedV0))
+	require.False(t, dl.Denied(cid.NewCidV1(cid.DagProtobuf, hashed.Hash())))
+	require.False(t, dl.Denied(good))
+
+	t.Run("hits", func(t *testing.T) {
+		var hits []denylist.Hit
+		unsub := dl.Subscribe(func(hit denylist.Hit) {
+			hits = append(hits, hit)
+		})
+		require.NoError(t, dl.Check(good, denylist.SourceRetrievalQuery, peer.ID("alice")))
+		require.ErrorIs(t, dl.Check(bad, denylist.SourceRetrievalQuery, peer.ID("alice")), denylist.ErrDenied)
+		require.Equal(t, []denylist.Hit{{Cid: bad, Source: denylist.SourceRetrievalQuery, Peer: peer.ID("alice")}}, hits)
+
+		unsub()
+		require.Error(t, dl.Check(bad, denylist.SourceStorageProposal, peer.ID("bob")))
+		require.Len(t, hits, 1)
+	})
+
+	t.Run("invalid files", func(t *testing.T) {
+		invalid := filepath.Join(t.TempDir(), "invalid")
+		writeList(t, invalid, "not a cid\n")
+		_, err := denylist.New([]string{invalid}, 0)
+		require.Error(t, err)
+
+		writeList(t, invalid, "//abcd\n")
+		_, err = denylist.New([]string{invalid}, 0)
+		require.Error(t, err)
+
+		_, err = denylist.New([]string{filepath.Join(t.TempDir(), "missing")}, 0)
+		require.Error(t, err)
+	})
+}
+
+func TestDenylistReload(t *testing.T) {
+	bad, good := testCid(t, "bad"), testCid(t, "good")
+	path := filepath.Join(t.TempDir(), "denylist")
+	writeList(t, path, bad.String()+"\n")
+
+	dl, err := denylist.New([]string{path}, 10*time.Millisecond)
+	require.NoError(t, err)
+	dl.Start()
+	defer dl.Stop()
+
+	writeList(t, path, good.String()+"\n"+bad.String()+"\n")
+	require.Eventually(t, func() bool { return dl.Denied(good) }, 5*time.Second, 10*time.Millisecond)
+
+	// a list that can't be loaded leaves the previous entries in place
+	writeList(t, path, "not a cid\n")
+	require.Error(t, dl.Reload())
+	require.True(t, dl.Denied(good))
+	require.True(t, dl.Denied(bad))
+
+	writeList(t, path, "")
+	require.NoError(t, dl.Reload())
+	require.False(t, dl.Denied(bad))
+}
+
+func TestDenylistReplaced(t *testing.T) {
+	bad, good, other := testCid(t, "bad"), testCid(t, "good"), testCid(t, "other")
+	dir := t.TempDir()
+	path, otherPath := filepath.Join(dir, "denylist"), filepath.Join(dir, "other")
+	writeList(t, path, bad.String()+"\n")
+	writeList(t, otherPath, "")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	dl, err := denylist.New([]string{path, otherPath}, 10*time.Millisecond)
+	require.NoError(t, err)
+	dl.Start()
+	defer dl.Stop()
+
+	// while a file is missing, its entries are kept and the other files are
+	// still reloaded
+	require.NoError(t, os.Remove(path))
+	writeList(t, otherPath, other.String()+"\n")
+	require.Eventually(t, func() bool { return dl.Denied(other) }, 5*time.Second, 10*time.Millisecond)
+	require.True(t, dl.Denied(bad))
+
+	// a file renamed over the path is loaded, even with the same size and
+	// modification time as the one it replaces
+	tmp := filepath.Join(dir, "denylist.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte(good.String()+"\n"), 0644))
+	require.NoError(t, os.Chtimes(tmp, info.ModTime(), info.ModTime()))
+	require.NoError(t, os.Rename(tmp, path))
+	require.Eventually(t, func() bool { return dl.Denied(good) }, 5*time.Second, 10*time.Millisecond)
+	require.False(t, dl.Denied(bad))
+	require.True(t, dl.Denied(other))
+}
+
+func writeList(t *testing.T, path string, contents string) {
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+	// make sure the change is seen even if the mtime has a coarse resolution
+	later := time.Now().Add(time.Duration(len(contents)) * time.Second)
+	require.NoError(t, os.Chtimes(path, later, later))
+}
+
+func testCid(t *testing.T, data string) cid.Cid {
+	c, err := cid.V1Builder{Codec: cid.Raw, MhType: multihash.SHA2_256}.Sum([]byte(data))
+	require.NoError(t, err)
+	return c
+}
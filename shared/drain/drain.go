@@ -0,0 +1,172 @@
+// Package drain lets a provider stop taking new deals while the deals it is
+// already working on finish, so that it can be restarted for maintenance
+// without breaking in-flight deals.
+//
+// A paused provider rejects new deals with MaintenanceMessage as the reason.
+// Whether a provider is paused is saved in its datastore, so a provider that
+// is restarted while paused stays paused until it is resumed. Drain pauses
+// the provider and waits until it has no deals in flight, or gives up and
+// returns the deals that are still in flight.
+package drain
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"golang.org/x/xerrors"
+)
+
+// MaintenanceMessage is the reason given to clients for rejecting their
+// deals while a provider is paused
+const MaintenanceMessage = "provider is in maintenance mode and is not accepting new deals"
+
+// DefaultPollInterval is how often Drain checks the deals in flight by
+// default
+const DefaultPollInterval = 5 * time.Second
+
+// DefaultTimeout is how long Drain waits for the deals in flight to finish by
+// default
+const DefaultTimeout = 6 * time.Hour
+
+// ErrTimeout is returned by Drain when deals are still in flight after the
+// timeout
+var ErrTimeout = errors.New("timed out waiting for deals in flight")
+
+var pausedKey = datastore.NewKey("paused")
+
+// Deal is a deal that a provider has in flight
+type Deal struct {
+	// ID identifies the deal, such as its proposal CID
+	ID string
+	// State is the name of the deal's state
+	State string
+}
+
+// Progress maps the name of each deal state to the number of deals in
+// flight in that state
+type Progress map[string]int
+
+// NewProgress counts the deals in flight in each state
+func NewProgress(deals []Deal) Progress {
+	progress := make(Progress)
+	for _, deal := range deals {
+		progress[deal.State]++
+	}
+	return progress
+}
+
+// Total returns the number of deals in flight
+func (p Progress) Total() int {
+	total := 0
+	for _, n := range p {
+		total += n
+	}
+	return total
+}
+
+// ListFunc returns the deals that a provider has in flight
+type ListFunc func(ctx context.Context) ([]Deal, error)
+
+// Drainer keeps track of whether a provider is paused, and waits for its
+// deals in flight to finish
+type Drainer struct {
+	ds       datastore.Datastore
+	list     ListFunc
+	interval time.Duration
+	paused   atomic.Bool
+}
+
+// NewDrainer returns a Drainer that saves whether the provider is paused in
+// ds, and lists the deals in flight with list every interval while draining.
+// If the interval is zero, DefaultPollInterval is used.
+func NewDrainer(ds datastore.Datastore, list ListFunc, interval time.Duration) (*Drainer, error) {
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+	d := &Drainer{
+		ds:       ds,
+		list:     list,
+		interval: interval,
+	}
+	paused, err := ds.Has(context.TODO(), pausedKey)
+	if err != nil {
+		return nil, xerrors.Errorf("loading paused state: %w", err)
+	}
+	d.paused.Store(paused)
+	return d, nil
+}
+
+// Pause stops the provider accepting new deals, until Resume is called
+func (d *Drainer) Pause() error {
+	if err := d.ds.Put(context.TODO(), pausedKey, []byte{}); err != nil {
+		return xerrors.Errorf("saving paused state: %w", err)
+	}
+	d.paused.Store(true)
+	return nil
+}
+
+// Resume lets the provider accept new deals again
+func (d *Drainer) Resume() error {
+	if err := d.ds.Delete(context.TODO(), pausedKey); err != nil {
+		return xerrors.Errorf("saving paused state: %w", err)
+	}
+	d.paused.Store(false)
+	return nil
+}
+
+// Paused returns true if the provider is not accepting new deals
+func (d *Drainer) Paused() bool {
+	return d.paused.Load()
+}
+
+// Progress returns the number of deals in flight in each state
+func (d *Drainer) Progress(ctx context.Context) (Progress, error) {
+	deals, err := d.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewProgress(deals), nil
+}
+
+// Drain pauses the provider, and waits until it has no deals in flight. If
+// onProgress is not nil, it is called with the deals in flight each time
+// they are counted. If deals are still in flight when the context is done or
+// after the timeout, Drain returns them with the context's error or
+// ErrTimeout. If the timeout is zero, DefaultTimeout is used. The provider
+// stays paused after Drain returns, until Resume is called.
+func (d *Drainer) Drain(ctx context.Context, timeout time.Duration, onProgress func(Progress)) ([]Deal, error) {
+	if err := d.Pause(); err != nil {
+		return nil, err
+	}
+
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		deals, err := d.list(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if onProgress != nil {
+			onProgress(NewProgress(deals))
+		}
+		if len(deals) == 0 {
+			return nil, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return deals, ctx.Err()
+		case <-deadline.C:
+			return deals, ErrTimeout
+		case <-ticker.C:
+		}
+	}
+}
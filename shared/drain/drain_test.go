@@ -0,0 +1,112 @@
+package drain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrain(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var lk sync.Mutex
+	remaining := []Deal{{ID: "a", State: "Ongoing"}, {ID: "b", State: "Ongoing"}, {ID: "c", State: "Unsealing"}}
+	d, err := NewDrainer(datastore.NewMapDatastore(), func(context.Context) ([]Deal, error) {
+		lk.Lock()
+		defer lk.Unlock()
+		out := append([]Deal{}, remaining...)
+		// a deal finishes every time the deals are listed
+		if len(remaining) > 0 {
+			remaining = remaining[1:]
+		}
+		return out, nil
+	}, time.Millisecond)
+	require.NoError(t, err)
+
+	require.False(t, d.Paused())
+	var totals []int
+	deals, err := d.Drain(ctx, 0, func(p Progress) {
+		totals = append(totals, p.Total())
+	})
+	require.NoError(t, err)
+	require.Empty(t, deals)
+	require.Equal(t, []int{3, 2, 1, 0}, totals)
+
+	// the provider stays paused until it is resumed
+	require.True(t, d.Paused())
+	require.NoError(t, d.Resume())
+	require.False(t, d.Paused())
+}
+
+func TestDrainPausedIsSaved(t *testing.T) {
+	ds := datastore.NewMapDatastore()
+	none := func(context.Context) ([]Deal, error) { return nil, nil }
+	d, err := NewDrainer(ds, none, 0)
+	require.NoError(t, err)
+	require.NoError(t, d.Pause())
+
+	// a restarted provider is still paused
+	d, err = NewDrainer(ds, none, 0)
+	require.NoError(t, err)
+	require.True(t, d.Paused())
+
+	require.NoError(t, d.Resume())
+	d, err = NewDrainer(ds, none, 0)
+	require.NoError(t, err)
+	require.False(t, d.Paused())
+}
+
+func TestDrainErrors(t *testing.T) {
+	inFlight := []Deal{{ID: "a", State: "Ongoing"}}
+	stuck := func(context.Context) ([]Deal, error) {
+		return inFlight, nil
+	}
+
+	t.Run("list fails", func(t *testing.T) {
+		listErr := errors.New("something went wrong")
+		d, err := NewDrainer(datastore.NewMapDatastore(), func(context.Context) ([]Deal, error) {
+			return nil, listErr
+		}, time.Millisecond)
+		require.NoError(t, err)
+		_, err = d.Drain(context.Background(), 0, nil)
+		require.ErrorIs(t, err, listErr)
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		d, err := NewDrainer(datastore.NewMapDatastore(), stuck, time.Millisecond)
+		require.NoError(t, err)
+		deals, err := d.Drain(ctx, 0, nil)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, inFlight, deals)
+		require.True(t, d.Paused())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		d, err := NewDrainer(datastore.NewMapDatastore(), stuck, time.Millisecond)
+		require.NoError(t, err)
+		deals, err := d.Drain(context.Background(), 10*time.Millisecond, nil)
+		require.ErrorIs(t, err, ErrTimeout)
+		require.Equal(t, inFlight, deals)
+		require.True(t, d.Paused())
+	})
+}
+
+func TestNewProgress(t *testing.T) {
+	var deals []Deal
+	for i := 0; i < 3; i++ {
+		deals = append(deals, Deal{ID: fmt.Sprint(i), State: "Ongoing"})
+	}
+	deals = append(deals, Deal{ID: "3", State: "Unsealing"})
+	progress := NewProgress(deals)
+	require.Equal(t, Progress{"Ongoing": 3, "Unsealing": 1}, progress)
+	require.Equal(t, 4, progress.Total())
+}
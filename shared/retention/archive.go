@@ -0,0 +1,243 @@
+// Package retention moves the records of finished deals out of a market's
+// live deal store.
+//
+// Deal state machine groups keep every deal in the datastore forever, so
+// listing deals and restarting them on startup gets slower over time. A
+// Manager periodically looks for deals in a terminal state, and once a deal
+// has been in a terminal state for longer than the retention policy allows,
+// moves its record to an Archive and removes it from the live store.
+//
+// The group returned by Archive.Group reads archived deals by ID, so lookups
+// of individual deals keep working after they have been archived, while
+// listing only returns the live deals.
+package retention
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-statemachine/fsm"
+	"github.com/filecoin-project/go-statestore"
+)
+
+var (
+	dealsPrefix    = datastore.NewKey("/deals")
+	terminalPrefix = datastore.NewKey("/terminal")
+)
+
+// ErrArchived is returned when an event is sent to a deal that has been
+// archived
+var ErrArchived = xerrors.New("deal has been archived")
+
+// ArchivedDeal is the record of a deal in the archive
+type ArchivedDeal struct {
+	// Key is the key of the deal in the live store
+	Key string
+	// ArchivedAt is the time the deal was archived
+	ArchivedAt time.Time
+	// State is the CBOR encoded state of the deal when it was archived
+	State []byte
+}
+
+// Archive stores the final state of deals that have been removed from a
+// state machine group, keyed in the same way as the group.
+type Archive struct {
+	deals    datastore.Batching
+	terminal datastore.Batching
+}
+
+// NewArchive returns an archive that stores deals in the given datastore.
+// Each state machine group needs its own archive.
+func NewArchive(ds datastore.Batching) *Archive {
+	return &Archive{
+		deals:    namespace.Wrap(ds, dealsPrefix),
+		terminal: namespace.Wrap(ds, terminalPrefix),
+	}
+}
+
+// Put archives the state of the deal with the given ID
+func (a *Archive) Put(ctx context.Context, id interface{}, state cbg.CBORMarshaler, archivedAt time.Time) error {
+	var buf bytes.Buffer
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(archivedAt.UnixNano()))
+	buf.Write(ts[:])
+	if err := state.MarshalCBOR(&buf); err != nil {
+		return xerrors.Errorf("encoding deal %v: %w", id, err)
+	}
+	return a.deals.Put(ctx, statestore.ToKey(id), buf.Bytes())
+}
+
+// Get reads the archived state of the deal with the given ID into out. It
+// returns datastore.ErrNotFound if the deal is not in the archive.
+func (a *Archive) Get(ctx context.Context, id interface{}, out cbg.CBORUnmarshaler) error {
+	data, err := a.deals.Get(ctx, statestore.ToKey(id))
+	if err != nil {
+		return err
+	}
+	deal, err := decodeDeal(statestore.ToKey(id).String(), data)
+	if err != nil {
+		return err
+	}
+	return out.UnmarshalCBOR(bytes.NewReader(deal.State))
+}
+
+// Has returns true if the deal with the given ID is in the archive
+func (a *Archive) Has(ctx context.Context, id interface{}) (bool, error) {
+	return a.deals.Has(ctx, statestore.ToKey(id))
+}
+
+// Delete removes a deal from the archive
+func (a *Archive) Delete(ctx context.Context, id interface{}) error {
+	return a.deals.Delete(ctx, statestore.ToKey(id))
+}
+
+// ForEach calls cb with each archived deal, eg to export the archive to a
+// file. It stops at the first error returned by cb.
+func (a *Archive) ForEach(ctx context.Context, cb func(ArchivedDeal) error) error {
+	res, err := a.deals.Query(ctx, query.Query{})
+	if err != nil {
+		return err
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		deal, err := decodeDeal(r.Key, r.Value)
+		if err != nil {
+			return err
+		}
+		if err := cb(deal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeDeal(key string, data []byte) (ArchivedDeal, error) {
+	if len(data) < 8 {
+		return ArchivedDeal{}, xerrors.Errorf("archived deal %s is too short: %d bytes", key, len(data))
+	}
+	return ArchivedDeal{
+		Key:        key,
+		ArchivedAt: time.Unix(0, int64(binary.BigEndian.Uint64(data[:8]))),
+		State:      data[8:],
+	}, nil
+}
+
+// terminalSince returns the time the deal was first seen in a terminal
+// state, recording now as that time if it has not been seen before
+func (a *Archive) terminalSince(ctx context.Context, id interface{}, now time.Time) (time.Time, error) {
+	key := statestore.ToKey(id)
+	data, err := a.terminal.Get(ctx, key)
+	if err == nil && len(data) == 8 {
+		return time.Unix(0, int64(binary.BigEndian.Uint64(data))), nil
+	}
+	if err != nil && err != datastore.ErrNotFound {
+		return time.Time{}, err
+	}
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(now.UnixNano()))
+	if err := a.terminal.Put(ctx, key, ts[:]); err != nil {
+		return time.Time{}, err
+	}
+	return now, nil
+}
+
+func (a *Archive) clearTerminalSince(ctx context.Context, id interface{}) error {
+	return a.terminal.Delete(ctx, statestore.ToKey(id))
+}
+
+// Group wraps a state machine group so that archived deals can be read with
+// Get and are reported by Has. Sending an event to an archived deal returns
+// ErrArchived, rather than creating a new deal with the same ID. List only
+// returns live deals.
+func (a *Archive) Group(g fsm.Group) fsm.Group {
+	return &archivedGroup{Group: g, archive: a}
+}
+
+type archivedGroup struct {
+	fsm.Group
+	archive *Archive
+}
+
+func (ag *archivedGroup) archived(id interface{}) (bool, error) {
+	live, err := ag.Group.Has(id)
+	if err != nil || live {
+		return false, err
+	}
+	return ag.archive.Has(context.TODO(), id)
+}
+
+func (ag *archivedGroup) Send(id interface{}, name fsm.EventName, args ...interface{}) error {
+	archived, err := ag.archived(id)
+	if err != nil {
+		return err
+	}
+	if archived {
+		return xerrors.Errorf("sending event %v to deal %v: %w", name, id, ErrArchived)
+	}
+	return ag.Group.Send(id, name, args...)
+}
+
+func (ag *archivedGroup) SendSync(ctx context.Context, id interface{}, name fsm.EventName, args ...interface{}) error {
+	archived, err := ag.archived(id)
+	if err != nil {
+		return err
+	}
+	if archived {
+		return xerrors.Errorf("sending event %v to deal %v: %w", name, id, ErrArchived)
+	}
+	return ag.Group.SendSync(ctx, id, name, args...)
+}
+
+func (ag *archivedGroup) Get(id interface{}) fsm.StoredState {
+	archived, err := ag.archived(id)
+	if err != nil || !archived {
+		return ag.Group.Get(id)
+	}
+	return &archivedState{archive: ag.archive, id: id}
+}
+
+func (ag *archivedGroup) GetSync(ctx context.Context, id interface{}, out cbg.CBORUnmarshaler) error {
+	archived, err := ag.archived(id)
+	if err != nil || !archived {
+		return ag.Group.GetSync(ctx, id, out)
+	}
+	return ag.archive.Get(ctx, id, out)
+}
+
+func (ag *archivedGroup) Has(id interface{}) (bool, error) {
+	live, err := ag.Group.Has(id)
+	if err != nil || live {
+		return live, err
+	}
+	return ag.archive.Has(context.TODO(), id)
+}
+
+// archivedState is the StoredState of an archived deal
+type archivedState struct {
+	archive *Archive
+	id      interface{}
+}
+
+func (as *archivedState) End() error {
+	return as.archive.Delete(context.TODO(), as.id)
+}
+
+func (as *archivedState) Get(out cbg.CBORUnmarshaler) error {
+	return as.archive.Get(context.TODO(), as.id, out)
+}
+
+func (as *archivedState) Mutate(mutator interface{}) error {
+	return xerrors.Errorf("mutating deal %v: %w", as.id, ErrArchived)
+}
@@ -0,0 +1,167 @@
+package retention
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-statemachine/fsm"
+)
+
+var log = logging.Logger("retention")
+
+// DefaultInterval is how often a Manager looks for deals to archive by
+// default
+const DefaultInterval = time.Hour
+
+// Policy configures which deals are archived
+type Policy struct {
+	// MaxAge is how long a deal stays in the live store after it is first
+	// seen in a terminal state. The time a deal reached its terminal state is
+	// not recorded by the state machine, so the clock starts the first time
+	// the Manager sees the deal in a terminal state.
+	MaxAge time.Duration
+	// Interval is how often the Manager looks for deals to archive. If zero,
+	// DefaultInterval is used.
+	Interval time.Duration
+}
+
+// Deal is a deal in the live store
+type Deal struct {
+	// ID is the deal's identifier in the state machine group
+	ID interface{}
+	// Terminal is true if the deal is in a terminal state
+	Terminal bool
+	// State is the deal's state, which is archived
+	State cbg.CBORMarshaler
+}
+
+// ListDealsFunc lists all the deals in the live store
+type ListDealsFunc func() ([]Deal, error)
+
+// Manager archives deals that have been in a terminal state for longer than
+// the policy allows
+type Manager struct {
+	archive *Archive
+	group   fsm.Group
+	list    ListDealsFunc
+	policy  Policy
+	now     func() time.Time
+
+	runLk  sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewManager returns a Manager that moves deals from the live state machine
+// group to the archive
+func NewManager(archive *Archive, group fsm.Group, list ListDealsFunc, policy Policy) *Manager {
+	if policy.Interval == 0 {
+		policy.Interval = DefaultInterval
+	}
+	return &Manager{
+		archive: archive,
+		group:   group,
+		list:    list,
+		policy:  policy,
+		now:     time.Now,
+	}
+}
+
+// Start begins archiving deals periodically. A Manager that has been stopped
+// can be started again. Starting a Manager that is running has no effect.
+func (m *Manager) Start() {
+	m.runLk.Lock()
+	defer m.runLk.Unlock()
+	if m.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.wg.Add(1)
+	go m.run(ctx)
+}
+
+// Stop stops archiving deals
+func (m *Manager) Stop() {
+	m.runLk.Lock()
+	defer m.runLk.Unlock()
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	m.cancel = nil
+	m.wg.Wait()
+}
+
+func (m *Manager) run(ctx context.Context) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.policy.Interval)
+	defer ticker.Stop()
+	for {
+		archived, err := m.Sweep(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Errorf("archiving deals: %s", err)
+		}
+		if archived > 0 {
+			log.Infow("archived deals", "count", archived)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep archives the deals that have been in a terminal state for longer
+// than the policy's maximum age, and returns the number of deals archived
+func (m *Manager) Sweep(ctx context.Context) (int, error) {
+	deals, err := m.list()
+	if err != nil {
+		return 0, xerrors.Errorf("listing deals: %w", err)
+	}
+
+	now := m.now()
+	archived := 0
+	for _, deal := range deals {
+		if ctx.Err() != nil {
+			return archived, ctx.Err()
+		}
+		if !deal.Terminal {
+			continue
+		}
+		since, err := m.archive.terminalSince(ctx, deal.ID, now)
+		if err != nil {
+			return archived, xerrors.Errorf("reading terminal time of deal %v: %w", deal.ID, err)
+		}
+		if now.Sub(since) < m.policy.MaxAge {
+			continue
+		}
+		if err := m.archiveDeal(ctx, deal, now); err != nil {
+			return archived, err
+		}
+		archived++
+	}
+	return archived, nil
+}
+
+func (m *Manager) archiveDeal(ctx context.Context, deal Deal, now time.Time) error {
+	// write the archive record before removing the live record, so that a
+	// failure in between leaves the deal in both rather than neither
+	if err := m.archive.Put(ctx, deal.ID, deal.State, now); err != nil {
+		return xerrors.Errorf("archiving deal %v: %w", deal.ID, err)
+	}
+	if err := m.group.Get(deal.ID).End(); err != nil {
+		return xerrors.Errorf("removing archived deal %v from live store: %w", deal.ID, err)
+	}
+	if err := m.archive.clearTerminalSince(ctx, deal.ID); err != nil {
+		return xerrors.Errorf("clearing terminal time of deal %v: %w", deal.ID, err)
+	}
+	return nil
+}
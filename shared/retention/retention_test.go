@@ -0,0 +1,158 @@
+package retention
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/go-statemachine/fsm"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+)
+
+type testEnv struct{}
+
+const evtFail = "fail"
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	group, err := fsm.New(dss.MutexWrap(datastore.NewMapDatastore()), fsm.Parameters{
+		Environment:   testEnv{},
+		StateType:     storagemarket.ClientDeal{},
+		StateKeyField: "State",
+		Events: fsm.Events{
+			fsm.Event(evtFail).FromAny().To(storagemarket.StorageDealError),
+		},
+		StateEntryFuncs: fsm.StateEntryFuncs{},
+		FinalityStates:  []fsm.StateKey{storagemarket.StorageDealError},
+	})
+	require.NoError(t, err)
+
+	addr, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	cids := testCids(t, 3)
+	for i, c := range cids {
+		// the first two deals are finished
+		state := storagemarket.StorageDealError
+		if i == 2 {
+			state = storagemarket.StorageDealUnknown
+		}
+		deal := &storagemarket.ClientDeal{ProposalCid: c, MinerWorker: addr, State: state}
+		deal.Proposal.PieceCID = c
+		deal.Proposal.Client = addr
+		deal.Proposal.Provider = addr
+		deal.ClientSignature = crypto.Signature{Type: crypto.SigTypeBLS}
+		require.NoError(t, group.Begin(c, deal))
+	}
+
+	list := func() ([]Deal, error) {
+		var deals []storagemarket.ClientDeal
+		if err := group.List(&deals); err != nil {
+			return nil, err
+		}
+		out := make([]Deal, 0, len(deals))
+		for i := range deals {
+			out = append(out, Deal{
+				ID:       deals[i].ProposalCid,
+				Terminal: group.IsTerminated(deals[i]),
+				State:    &deals[i],
+			})
+		}
+		return out, nil
+	}
+
+	archive := NewArchive(dss.MutexWrap(datastore.NewMapDatastore()))
+	m := NewManager(archive, group, list, Policy{MaxAge: time.Hour})
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	// the first sweep starts the clock for terminal deals
+	archived, err := m.Sweep(ctx)
+	require.NoError(t, err)
+	require.Zero(t, archived)
+
+	now = now.Add(time.Hour)
+	archived, err = m.Sweep(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, archived)
+
+	// only the live deal is listed
+	var live []storagemarket.ClientDeal
+	require.NoError(t, group.List(&live))
+	require.Len(t, live, 1)
+	require.Equal(t, cids[2], live[0].ProposalCid)
+
+	// archived deals can be read through the wrapped group
+	wrapped := archive.Group(group)
+	var deal storagemarket.ClientDeal
+	require.NoError(t, wrapped.Get(cids[0]).Get(&deal))
+	require.Equal(t, cids[0], deal.ProposalCid)
+	require.Equal(t, storagemarket.StorageDealError, deal.State)
+	has, err := wrapped.Has(cids[1])
+	require.NoError(t, err)
+	require.True(t, has)
+	require.NoError(t, wrapped.Get(cids[2]).Get(&deal))
+	require.Equal(t, cids[2], deal.ProposalCid)
+
+	// events for archived deals are rejected rather than creating a new deal
+	require.ErrorIs(t, wrapped.Send(cids[0], evtFail), ErrArchived)
+	has, err = group.Has(cids[0])
+	require.NoError(t, err)
+	require.False(t, has)
+
+	// the archive can be exported
+	var exported []ArchivedDeal
+	require.NoError(t, archive.ForEach(ctx, func(d ArchivedDeal) error {
+		exported = append(exported, d)
+		return nil
+	}))
+	require.Len(t, exported, 2)
+	for _, d := range exported {
+		var deal storagemarket.ClientDeal
+		require.NoError(t, deal.UnmarshalCBOR(bytes.NewReader(d.State)))
+		require.Equal(t, storagemarket.StorageDealError, deal.State)
+		require.Equal(t, now.UnixNano(), d.ArchivedAt.UnixNano())
+	}
+}
+
+func TestManagerRestart(t *testing.T) {
+	var sweeps int32
+	list := func() ([]Deal, error) {
+		atomic.AddInt32(&sweeps, 1)
+		return nil, nil
+	}
+	archive := NewArchive(dss.MutexWrap(datastore.NewMapDatastore()))
+	m := NewManager(archive, nil, list, Policy{MaxAge: time.Hour, Interval: time.Hour})
+
+	// each run sweeps once straight away, and starting twice runs once
+	m.Start()
+	m.Start()
+	m.Stop()
+	require.EqualValues(t, 1, atomic.LoadInt32(&sweeps))
+
+	// a stopped manager can be started again
+	m.Stop()
+	m.Start()
+	m.Stop()
+	require.EqualValues(t, 2, atomic.LoadInt32(&sweeps))
+}
+
+func testCids(t *testing.T, n int) []cid.Cid {
+	out := make([]cid.Cid, 0, n)
+	for i := 0; i < n; i++ {
+		mh, err := multihash.Sum([]byte{byte(i)}, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		out = append(out, cid.NewCidV1(cid.Raw, mh))
+	}
+	return out
+}
@@ -88,8 +88,9 @@ func MakeTestDealProposal() *retrievalmarket.DealProposal {
 	cid := GenerateCids(1)[0]
 	return &retrievalmarket.DealProposal{
 		PayloadCID: cid,
-		ID:         retrievalmarket.DealID(rand.Uint64()),
-		Params:     retrievalmarket.NewParamsV0(MakeTestTokenAmount(), rand.Uint64(), rand.Uint64()),
+		// IPLD integers are signed, so the values must fit in an int64
+		ID:     retrievalmarket.DealID(rand.Int63()),
+		Params: retrievalmarket.NewParamsV0(MakeTestTokenAmount(), uint64(rand.Int63()), uint64(rand.Int63())),
 	}
 }
 
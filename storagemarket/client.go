@@ -60,6 +60,16 @@ type StorageClient interface {
 	// ProposeStorageDeal initiates deal negotiation with a Storage Provider
 	ProposeStorageDeal(ctx context.Context, params ProposeStorageDealParams) (*ProposeStorageDealResult, error)
 
+	// ValidateStorageDeal checks locally whether a Storage Provider would accept a deal, before it is proposed
+	ValidateStorageDeal(ctx context.Context, params ProposeStorageDealParams) error
+
+	// QueryStorageDeal asks a Storage Provider whether it would accept a deal, without proposing it.
+	// It fails if the provider doesn't answer deal checks.
+	QueryStorageDeal(ctx context.Context, params ProposeStorageDealParams) error
+
+	// CancelDeal cancels a deal with a Storage Provider before it is published
+	CancelDeal(ctx context.Context, proposalCid cid.Cid) error
+
 	// GetPaymentEscrow returns the current funds available for deal payment
 	GetPaymentEscrow(ctx context.Context, addr address.Address) (Balance, error)
 
@@ -111,6 +111,13 @@ const (
 	// ClientEventDataTransferQueued happens when we queue the provider's request to transfer data to it
 	// in response to the push request we send to the provider.
 	ClientEventDataTransferQueued
+
+	// ClientEventReproposed happens when a deal that the provider rejected because of its price or
+	// collateral is re-proposed as a new deal
+	ClientEventReproposed
+
+	// ClientEventCancelled happens when the client cancels a deal before it is published
+	ClientEventCancelled
 )
 
 // ClientEvents maps client event codes to string names
@@ -148,6 +155,8 @@ var ClientEvents = map[ClientEvent]string{
 	ClientEventDataTransferStalled:        "ClientEventDataTransferStalled",
 	ClientEventDataTransferCancelled:      "ClientEventDataTransferCancelled",
 	ClientEventDataTransferQueued:         "ClientEventDataTransferQueued",
+	ClientEventReproposed:                 "ClientEventReproposed",
+	ClientEventCancelled:                  "ClientEventCancelled",
 }
 
 func (e ClientEvent) String() string {
@@ -292,6 +301,9 @@ const (
 	// ProviderEventAwaitTransferRestartTimeout is dispatched after a certain amount of time a provider has been
 	// waiting for a data transfer to restart. If transfer hasn't restarted, the provider will fail the deal
 	ProviderEventAwaitTransferRestartTimeout
+
+	// ProviderEventClientCancelled happens when the client cancels a deal before it is published
+	ProviderEventClientCancelled
 )
 
 // ProviderEvents maps provider event codes to string names
@@ -339,6 +351,7 @@ var ProviderEvents = map[ProviderEvent]string{
 	ProviderEventDealPrecommitFailed:         "ProviderEventDealPrecommitFailed",
 	ProviderEventDealPrecommitted:            "ProviderEventDealPrecommitted",
 	ProviderEventAwaitTransferRestartTimeout: "ProviderEventAwaitTransferRestartTimeout",
+	ProviderEventClientCancelled:             "ProviderEventClientCancelled",
 }
 
 func (e ProviderEvent) String() string {
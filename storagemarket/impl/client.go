@@ -26,9 +26,12 @@ import (
 	discoveryimpl "github.com/filecoin-project/go-fil-markets/discovery/impl"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/shared/askgossip"
+	"github.com/filecoin-project/go-fil-markets/shared/retention"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/clientstates"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/clientutils"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/dealvalidation"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/dtutils"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/requestvalidation"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/migrations"
@@ -63,6 +66,14 @@ type Client struct {
 	unsubDataTransfer datatransfer.Unsubscribe
 
 	bstores storagemarket.BlockstoreAccessor
+
+	archive         *retention.Archive
+	retentionPolicy retention.Policy
+	retention       *retention.Manager
+
+	askCache *askgossip.Cache
+
+	dealStatus *dealStatusPoller
 }
 
 // StorageClientOption allows custom configuration of a storage client
@@ -84,6 +95,26 @@ func MaxTraversalLinks(m uint64) StorageClientOption {
 	}
 }
 
+// ClientDealRetention moves deals that have been in a terminal state for longer
+// than the policy's maximum age from the client's deal store to the archive.
+// Archived deals are no longer returned by ListLocalDeals, but can still be
+// looked up with GetLocalDeal.
+func ClientDealRetention(archive *retention.Archive, policy retention.Policy) StorageClientOption {
+	return func(c *Client) {
+		c.archive = archive
+		c.retentionPolicy = policy
+	}
+}
+
+// AskCache makes GetAsk return a provider's ask from the given cache of
+// gossiped asks when it has one that hasn't expired, rather than querying the
+// provider. The cache is started and stopped by its owner.
+func AskCache(cache *askgossip.Cache) StorageClientOption {
+	return func(c *Client) {
+		c.askCache = cache
+	}
+}
+
 // NewClient creates a new storage client
 func NewClient(
 	net network.StorageMarketNetwork,
@@ -104,6 +135,7 @@ func NewClient(
 		pollingInterval:   DefaultPollingInterval,
 		maxTraversalLinks: DefaultMaxTraversalLinks,
 		bstores:           bstores,
+		dealStatus:        newDealStatusPoller(),
 	}
 	storageMigrations, err := migrations.ClientMigrations.Build()
 	if err != nil {
@@ -121,6 +153,10 @@ func NewClient(
 	}
 
 	c.Configure(options...)
+	if c.archive != nil {
+		c.retention = retention.NewManager(c.archive, c.statemachines, c.retentionDeals, c.retentionPolicy)
+		c.statemachines = c.archive.Group(c.statemachines)
+	}
 
 	// register a data transfer event handler -- this will send events to the state machines based on DT events
 	c.unsubDataTransfer = dataTransfer.SubscribeToEvents(dtutils.ClientDataTransferSubscriber(c.statemachines))
@@ -158,6 +194,9 @@ func (c *Client) OnReady(ready shared.ReadyFunc) {
 // Stop ends deal processing on a StorageClient
 func (c *Client) Stop() error {
 	c.unsubDataTransfer()
+	if c.retention != nil {
+		c.retention.Stop()
+	}
 	return c.statemachines.Stop(context.TODO())
 }
 
@@ -214,6 +253,10 @@ func (c *Client) GetLocalDeal(ctx context.Context, cid cid.Cid) (storagemarket.C
 // When it receives a response, it verifies the signature and returns the validated
 // StorageAsk if successful
 func (c *Client) GetAsk(ctx context.Context, info storagemarket.StorageProviderInfo) (*storagemarket.StorageAsk, error) {
+	if ask, ok := c.cachedAsk(ctx, info.Address); ok {
+		return ask, nil
+	}
+
 	if len(info.Addrs) > 0 {
 		c.net.AddAddrs(info.PeerID, info.Addrs)
 	}
@@ -258,49 +301,37 @@ func (c *Client) GetAsk(ctx context.Context, info storagemarket.StorageProviderI
 	return out.Ask.Ask, nil
 }
 
-// GetProviderDealState queries a provider for the current state of a client's deal
-func (c *Client) GetProviderDealState(ctx context.Context, proposalCid cid.Cid) (*storagemarket.ProviderDealState, error) {
-	var deal storagemarket.ClientDeal
-	err := c.statemachines.Get(proposalCid).Get(&deal)
-	if err != nil {
-		return nil, xerrors.Errorf("could not get client deal state: %w", err)
-	}
-
-	s, err := c.net.NewDealStatusStream(ctx, deal.Miner)
-	if err != nil {
-		return nil, xerrors.Errorf("failed to open stream to miner: %w", err)
-	}
-	defer s.Close() //nolint
-
-	buf, err := cborutil.Dump(&deal.ProposalCid)
-	if err != nil {
-		return nil, xerrors.Errorf("failed serialize deal status request: %w", err)
+// cachedAsk returns the provider's ask from the ask cache, if it has one
+// that hasn't expired
+func (c *Client) cachedAsk(ctx context.Context, miner address.Address) (*storagemarket.StorageAsk, bool) {
+	if c.askCache == nil {
+		return nil, false
 	}
-
-	signature, err := c.node.SignBytes(ctx, deal.Proposal.Client, buf)
-	if err != nil {
-		return nil, xerrors.Errorf("failed to sign deal status request: %w", err)
-	}
-
-	if err := s.WriteDealStatusRequest(network.DealStatusRequest{Proposal: proposalCid, Signature: *signature}); err != nil {
-		return nil, xerrors.Errorf("failed to send deal status request: %w", err)
+	ask, ok := c.askCache.StorageAsk(miner)
+	if !ok {
+		return nil, false
 	}
-
-	resp, origBytes, err := s.ReadDealStatusResponse()
-	if err != nil {
-		return nil, xerrors.Errorf("failed to read deal status response: %w", err)
+	_, epoch, err := c.node.GetChainHead(ctx)
+	if err != nil || ask.Expiry <= epoch {
+		return nil, false
 	}
+	return ask, true
+}
 
-	valid, err := c.verifyStatusResponseSignature(ctx, deal.MinerWorker, resp, origBytes)
+// GetProviderDealState queries a provider for the current state of a client's deal.
+//
+// If the provider supports batch deal status queries, the states of the client's
+// other deals with the provider that are being polled are fetched in the same
+// request, and returned by the next GetProviderDealState for each of them if
+// they are less than a quarter of the polling interval old.
+func (c *Client) GetProviderDealState(ctx context.Context, proposalCid cid.Cid) (*storagemarket.ProviderDealState, error) {
+	var deal storagemarket.ClientDeal
+	err := c.statemachines.Get(proposalCid).Get(&deal)
 	if err != nil {
-		return nil, err
-	}
-
-	if !valid {
-		return nil, xerrors.Errorf("invalid deal status response signature")
+		return nil, xerrors.Errorf("could not get client deal state: %w", err)
 	}
 
-	return &resp.DealState, nil
+	return c.dealStatus.get(ctx, c, &deal)
 }
 
 // ProposeStorageDeal initiates the retrieval deal flow, which involves multiple requests and responses.
@@ -339,34 +370,84 @@ func (c *Client) ProposeStorageDeal(ctx context.Context, params storagemarket.Pr
 		return nil, xerrors.Errorf("looking up addresses: %w", err)
 	}
 
+	dealProposal, err := c.dealProposal(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	commP := dealProposal.PieceCID
+
+	clientDealProposal, err := c.node.SignProposal(ctx, params.Addr, dealProposal)
+	if err != nil {
+		return nil, xerrors.Errorf("signing deal proposal failed: %w", err)
+	}
+
+	proposalNd, err := cborutil.AsIpld(clientDealProposal)
+	if err != nil {
+		return nil, xerrors.Errorf("getting proposal node failed: %w", err)
+	}
+
+	deal := &storagemarket.ClientDeal{
+		ProposalCid:        proposalNd.Cid(),
+		ClientDealProposal: *clientDealProposal,
+		State:              storagemarket.StorageDealUnknown,
+		Miner:              params.Info.PeerID,
+		MinerWorker:        params.Info.Worker,
+		DataRef:            params.Data,
+		FastRetrieval:      params.FastRetrieval,
+		DealStages:         storagemarket.NewDealStages(),
+		CreationTime:       curTime(),
+		Negotiation:        params.Negotiation,
+	}
+
+	err = c.statemachines.Begin(proposalNd.Cid(), deal)
+	if err != nil {
+		return nil, xerrors.Errorf("setting up deal tracking: %w", err)
+	}
+
+	err = c.statemachines.Send(deal.ProposalCid, storagemarket.ClientEventOpen)
+	if err != nil {
+		return nil, xerrors.Errorf("initializing state machine: %w", err)
+	}
+
+	return &storagemarket.ProposeStorageDealResult{
+			ProposalCid: deal.ProposalCid,
+		}, c.discovery.AddPeer(ctx, params.Data.Root, retrievalmarket.RetrievalPeer{
+			Address:  dealProposal.Provider,
+			ID:       deal.Miner,
+			PieceCID: &commP,
+		})
+}
+
+// dealProposal builds the unsigned proposal for a deal
+func (c *Client) dealProposal(ctx context.Context, params storagemarket.ProposeStorageDealParams) (market.DealProposal, error) {
 	bs, err := c.bstores.Get(params.Data.Root)
 	if err != nil {
-		return nil, xerrors.Errorf("failed to get blockstore for imported root %s: %w", params.Data.Root, err)
+		return market.DealProposal{}, xerrors.Errorf("failed to get blockstore for imported root %s: %w", params.Data.Root, err)
 	}
 
 	commP, pieceSize, err := clientutils.CommP(ctx, bs, params.Data, c.maxTraversalLinks)
 	if err != nil {
-		return nil, xerrors.Errorf("computing commP failed: %w", err)
+		return market.DealProposal{}, xerrors.Errorf("computing commP failed: %w", err)
 	}
 
 	if uint64(pieceSize.Padded()) > params.Info.SectorSize {
-		return nil, fmt.Errorf("cannot propose a deal whose piece size (%d) is greater than sector size (%d)", pieceSize.Padded(), params.Info.SectorSize)
+		return market.DealProposal{}, fmt.Errorf("cannot propose a deal whose piece size (%d) is greater than sector size (%d)", pieceSize.Padded(), params.Info.SectorSize)
 	}
 
 	pcMin := params.Collateral
 	if pcMin.Int == nil || pcMin.IsZero() {
 		pcMin, _, err = c.node.DealProviderCollateralBounds(ctx, pieceSize.Padded(), params.VerifiedDeal)
 		if err != nil {
-			return nil, xerrors.Errorf("computing deal provider collateral bound failed: %w", err)
+			return market.DealProposal{}, xerrors.Errorf("computing deal provider collateral bound failed: %w", err)
 		}
 	}
 
 	label, err := clientutils.LabelField(params.Data.Root)
 	if err != nil {
-		return nil, xerrors.Errorf("creating label field in proposal: %w", err)
+		return market.DealProposal{}, xerrors.Errorf("creating label field in proposal: %w", err)
 	}
 
-	dealProposal := market.DealProposal{
+	return market.DealProposal{
 		PieceCID:             commP,
 		PieceSize:            pieceSize.Padded(),
 		Client:               params.Addr,
@@ -378,47 +459,88 @@ func (c *Client) ProposeStorageDeal(ctx context.Context, params storagemarket.Pr
 		ProviderCollateral:   pcMin,
 		ClientCollateral:     big.Zero(),
 		VerifiedDeal:         params.VerifiedDeal,
+	}, nil
+}
+
+// ValidateStorageDeal checks a deal before it is proposed, against the
+// provider's current ask and the chain, the same way the provider checks it
+// when it is proposed. The client's DataCap is not checked for verified deals.
+// If the provider would reject the deal, the error is a
+// *storagemarket.RejectionError with the reason.
+func (c *Client) ValidateStorageDeal(ctx context.Context, params storagemarket.ProposeStorageDealParams) error {
+	proposal, err := c.dealProposal(ctx, params)
+	if err != nil {
+		return err
 	}
 
-	clientDealProposal, err := c.node.SignProposal(ctx, params.Addr, dealProposal)
+	ask, err := c.GetAsk(ctx, *params.Info)
 	if err != nil {
-		return nil, xerrors.Errorf("signing deal proposal failed: %w", err)
+		return xerrors.Errorf("getting ask of provider %s: %w", params.Info.Address, err)
 	}
 
-	proposalNd, err := cborutil.AsIpld(clientDealProposal)
+	tok, epoch, err := c.node.GetChainHead(ctx)
 	if err != nil {
-		return nil, xerrors.Errorf("getting proposal node failed: %w", err)
+		return xerrors.Errorf("getting chain head: %w", err)
 	}
 
-	deal := &storagemarket.ClientDeal{
-		ProposalCid:        proposalNd.Cid(),
-		ClientDealProposal: *clientDealProposal,
-		State:              storagemarket.StorageDealUnknown,
-		Miner:              params.Info.PeerID,
-		MinerWorker:        params.Info.Worker,
-		DataRef:            params.Data,
-		FastRetrieval:      params.FastRetrieval,
-		DealStages:         storagemarket.NewDealStages(),
-		CreationTime:       curTime(),
+	validationParams := dealvalidation.Params{
+		Provider:    params.Info.Address,
+		Ask:         *ask,
+		TipSetToken: tok,
+		Epoch:       epoch,
+		// the funds for the deal are added when it is proposed
+		IgnoreClientBalance: true,
+	}
+	if rerr := dealvalidation.ValidateProposal(ctx, c.node, validationParams, proposal); rerr != nil {
+		return rerr
 	}
+	return nil
+}
 
-	err = c.statemachines.Begin(proposalNd.Cid(), deal)
+// QueryStorageDeal asks the provider whether it would accept a deal, without
+// signing or proposing it. The provider runs the same checks as for a
+// proposed deal, including its own deal decision logic. If the provider would
+// reject the deal, the error is a *storagemarket.RejectionError with the
+// reason.
+func (c *Client) QueryStorageDeal(ctx context.Context, params storagemarket.ProposeStorageDealParams) error {
+	proposal, err := c.dealProposal(ctx, params)
 	if err != nil {
-		return nil, xerrors.Errorf("setting up deal tracking: %w", err)
+		return err
 	}
 
-	err = c.statemachines.Send(deal.ProposalCid, storagemarket.ClientEventOpen)
+	err = c.addMultiaddrs(ctx, params.Info.Address)
 	if err != nil {
-		return nil, xerrors.Errorf("initializing state machine: %w", err)
+		return xerrors.Errorf("looking up addresses: %w", err)
 	}
 
-	return &storagemarket.ProposeStorageDealResult{
-			ProposalCid: deal.ProposalCid,
-		}, c.discovery.AddPeer(ctx, params.Data.Root, retrievalmarket.RetrievalPeer{
-			Address:  dealProposal.Provider,
-			ID:       deal.Miner,
-			PieceCID: &commP,
-		})
+	s, err := c.net.NewDealCheckStream(ctx, params.Info.PeerID)
+	if err != nil {
+		return xerrors.Errorf("failed to open stream to miner: %w", err)
+	}
+	defer s.Close() //nolint
+
+	request := network.DealCheckRequest{
+		Proposal:      proposal,
+		Piece:         params.Data,
+		FastRetrieval: params.FastRetrieval,
+	}
+	if err := s.WriteDealCheckRequest(request); err != nil {
+		return xerrors.Errorf("failed to send deal check request: %w", err)
+	}
+
+	resp, err := s.ReadDealCheckResponse()
+	if err != nil {
+		return xerrors.Errorf("failed to read deal check response: %w", err)
+	}
+
+	if resp.Accepted {
+		return nil
+	}
+	rerr := storagemarket.NewRejectionError(storagemarket.RejectionOther, "provider would reject deal: %s", resp.Message)
+	if resp.Rejection != nil {
+		rerr.Rejection = *resp.Rejection
+	}
+	return rerr
 }
 
 func curTime() cbg.CborTime {
@@ -494,9 +616,30 @@ func (c *Client) start(ctx context.Context) error {
 	if err := c.restartDeals(ctx); err != nil {
 		return fmt.Errorf("Failed to restart deals: %w", err)
 	}
+	if c.retention != nil {
+		c.retention.Start()
+	}
 	return nil
 }
 
+// retentionDeals lists the deals in the live deal store for the retention
+// manager
+func (c *Client) retentionDeals() ([]retention.Deal, error) {
+	var deals []storagemarket.ClientDeal
+	if err := c.statemachines.List(&deals); err != nil {
+		return nil, err
+	}
+	out := make([]retention.Deal, 0, len(deals))
+	for i := range deals {
+		out = append(out, retention.Deal{
+			ID:       deals[i].ProposalCid,
+			Terminal: c.statemachines.IsTerminated(deals[i]),
+			State:    &deals[i],
+		})
+	}
+	return out, nil
+}
+
 func (c *Client) restartDeals(ctx context.Context) error {
 	var deals []storagemarket.ClientDeal
 	err := c.statemachines.List(&deals)
@@ -0,0 +1,101 @@
+package storageimpl
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/clientstates"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/network"
+)
+
+// CancelDeal cancels a storage deal that has not been published. The provider
+// is asked to cancel the deal with a signed request, so that it cleans up the
+// deal's staging files, and the deal is only cancelled if the provider agrees,
+// as it may already be publishing it. Then the data transfer is stopped and
+// the deal fails, which releases the funds reserved for it.
+//
+// A deal that has not been sent to the provider yet is cancelled without
+// asking the provider. Otherwise, if the provider can't be reached or doesn't
+// have the deal yet, the cancel fails and can be tried again, as the provider
+// may still accept the deal.
+func (c *Client) CancelDeal(ctx context.Context, proposalCid cid.Cid) error {
+	var deal storagemarket.ClientDeal
+	if err := c.statemachines.Get(proposalCid).Get(&deal); err != nil {
+		return xerrors.Errorf("getting deal %s: %w", proposalCid, err)
+	}
+
+	if !clientCanCancel(deal.State) {
+		return xerrors.Errorf("deal in state %s can not be cancelled", storagemarket.DealStates[deal.State])
+	}
+
+	// a deal that has not been sent to the provider is only cancelled locally
+	if deal.State != storagemarket.StorageDealClientFunding {
+		if err := c.cancelWithProvider(ctx, deal); err != nil {
+			return xerrors.Errorf("cancelling deal %s with provider: %w", proposalCid, err)
+		}
+	}
+
+	if err := c.statemachines.SendSync(ctx, proposalCid, storagemarket.ClientEventCancelled); err != nil {
+		return xerrors.Errorf("cancelling deal %s: %w", proposalCid, err)
+	}
+
+	if deal.TransferChannelID != nil {
+		if err := c.dataTransfer.CloseDataTransferChannel(ctx, *deal.TransferChannelID); err != nil {
+			log.Warnf("closing data transfer channel %s for cancelled deal %s: %s", deal.TransferChannelID, proposalCid, err)
+		}
+	}
+	return nil
+}
+
+// cancelWithProvider asks the provider to cancel the deal, and returns an
+// error if it doesn't
+func (c *Client) cancelWithProvider(ctx context.Context, deal storagemarket.ClientDeal) error {
+	err := c.addMultiaddrs(ctx, deal.Proposal.Provider)
+	if err != nil {
+		return xerrors.Errorf("looking up addresses: %w", err)
+	}
+
+	request := network.DealCancelRequest{Proposal: deal.ProposalCid}
+	buf, err := request.SigningBytes()
+	if err != nil {
+		return xerrors.Errorf("failed serialize deal cancel request: %w", err)
+	}
+
+	signature, err := c.node.SignBytes(ctx, deal.Proposal.Client, buf)
+	if err != nil {
+		return xerrors.Errorf("failed to sign deal cancel request: %w", err)
+	}
+	request.Signature = *signature
+
+	s, err := c.net.NewDealCancelStream(ctx, deal.Miner)
+	if err != nil {
+		return xerrors.Errorf("failed to open stream to miner: %w", err)
+	}
+	defer s.Close() //nolint
+
+	if err := s.WriteDealCancelRequest(request); err != nil {
+		return xerrors.Errorf("failed to send deal cancel request: %w", err)
+	}
+
+	resp, err := s.ReadDealCancelResponse()
+	if err != nil {
+		return xerrors.Errorf("failed to read deal cancel response: %w", err)
+	}
+
+	if !resp.Cancelled {
+		return xerrors.Errorf("provider refused to cancel deal in state %s: %s", storagemarket.DealStates[resp.State], resp.Message)
+	}
+	return nil
+}
+
+func clientCanCancel(state storagemarket.StorageDealStatus) bool {
+	for _, s := range clientstates.ClientCancellableStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package storageimpl
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	cborutil "github.com/filecoin-project/go-cbor-util"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/network"
+)
+
+// maxDealStatusBatch is the most deals whose status is queried in one batch request
+const maxDealStatusBatch = 500
+
+// dealStatusMaxAgeDivisor sets how old a deal state fetched by a batch
+// request for another deal can be when it is returned, as a fraction of the
+// polling interval
+const dealStatusMaxAgeDivisor = 4
+
+// dealStatusKey identifies the deals whose status can be queried in the same
+// batch request: they are with the same provider, signed by the same client
+// address, and the responses are signed by the same worker
+type dealStatusKey struct {
+	miner  peer.ID
+	client address.Address
+	worker address.Address
+}
+
+type fetchedDealState struct {
+	state   *storagemarket.ProviderDealState
+	fetched time.Time
+}
+
+// dealStatusBatch tracks the deals that are being polled with the same key,
+// and the states of them that were fetched by a batch request for another deal
+type dealStatusBatch struct {
+	// lk serializes requests, so that concurrent polls share a batch request
+	lk      sync.Mutex
+	polled  map[cid.Cid]time.Time
+	fetched map[cid.Cid]fetchedDealState
+
+	// lastPolled is guarded by the poller's lock
+	lastPolled time.Time
+}
+
+// dealStatusPoller batches the deal status queries that a client makes to a
+// provider. When a deal is polled, the deals that have been polled with the
+// same key within the last two polling intervals are included in the request.
+// A state fetched for another deal is returned when that deal is next polled,
+// if it is less than a quarter of the polling interval old. So once every
+// deal has been polled, a provider is queried about four times per polling
+// interval however many deals the client has with it, and a state is never
+// more than a quarter of the polling interval older than a direct query
+// would return.
+type dealStatusPoller struct {
+	lk      sync.Mutex
+	batches map[dealStatusKey]*dealStatusBatch
+}
+
+func newDealStatusPoller() *dealStatusPoller {
+	return &dealStatusPoller{batches: make(map[dealStatusKey]*dealStatusBatch)}
+}
+
+// batch returns the batch for the key, and forgets the batches of other keys
+// that haven't been polled since the cutoff
+func (dp *dealStatusPoller) batch(key dealStatusKey, now time.Time, cutoff time.Time) *dealStatusBatch {
+	dp.lk.Lock()
+	defer dp.lk.Unlock()
+
+	for other, b := range dp.batches {
+		if other != key && b.lastPolled.Before(cutoff) {
+			delete(dp.batches, other)
+		}
+	}
+
+	b, ok := dp.batches[key]
+	if !ok {
+		b = &dealStatusBatch{
+			polled:  make(map[cid.Cid]time.Time),
+			fetched: make(map[cid.Cid]fetchedDealState),
+		}
+		dp.batches[key] = b
+	}
+	b.lastPolled = now
+	return b
+}
+
+// get returns the provider's state of the deal, from an earlier batch
+// request if it was fetched recently enough, or else by querying the provider
+func (dp *dealStatusPoller) get(ctx context.Context, c *Client, deal *storagemarket.ClientDeal) (*storagemarket.ProviderDealState, error) {
+	now := time.Now()
+	cutoff := now.Add(-2 * c.pollingInterval)
+	b := dp.batch(dealStatusKey{miner: deal.Miner, client: deal.Proposal.Client, worker: deal.MinerWorker}, now, cutoff)
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	// the time may have moved on while waiting for another poll's request
+	now = time.Now()
+	b.polled[deal.ProposalCid] = now
+	if f, ok := b.fetched[deal.ProposalCid]; ok {
+		delete(b.fetched, deal.ProposalCid)
+		if now.Sub(f.fetched) < c.pollingInterval/dealStatusMaxAgeDivisor {
+			return f.state, nil
+		}
+	}
+
+	s, err := c.net.NewDealStatusStream(ctx, deal.Miner)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open stream to miner: %w", err)
+	}
+	defer s.Close() //nolint
+
+	bs, ok := s.(network.BatchDealStatusStream)
+	if !ok {
+		return c.queryDealStatus(ctx, s, deal)
+	}
+
+	proposals := b.proposals(deal.ProposalCid, cutoff)
+	dealStates, err := c.queryBatchDealStatus(ctx, bs, deal, proposals)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(proposals); i++ {
+		b.fetched[proposals[i]] = fetchedDealState{state: dealStates[i], fetched: now}
+	}
+	return dealStates[0], nil
+}
+
+// proposals returns the deal's proposal followed by the other deals that have
+// been polled since the cutoff, and forgets the deals that haven't
+func (b *dealStatusBatch) proposals(proposalCid cid.Cid, cutoff time.Time) []cid.Cid {
+	proposals := []cid.Cid{proposalCid}
+	for other, polled := range b.polled {
+		if polled.Before(cutoff) {
+			delete(b.polled, other)
+			delete(b.fetched, other)
+			continue
+		}
+		if other != proposalCid && len(proposals) < maxDealStatusBatch {
+			proposals = append(proposals, other)
+		}
+	}
+	return proposals
+}
+
+// queryDealStatus queries the provider for the state of a single deal
+func (c *Client) queryDealStatus(ctx context.Context, s network.DealStatusStream, deal *storagemarket.ClientDeal) (*storagemarket.ProviderDealState, error) {
+	buf, err := cborutil.Dump(&deal.ProposalCid)
+	if err != nil {
+		return nil, xerrors.Errorf("failed serialize deal status request: %w", err)
+	}
+
+	signature, err := c.node.SignBytes(ctx, deal.Proposal.Client, buf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to sign deal status request: %w", err)
+	}
+
+	if err := s.WriteDealStatusRequest(network.DealStatusRequest{Proposal: deal.ProposalCid, Signature: *signature}); err != nil {
+		return nil, xerrors.Errorf("failed to send deal status request: %w", err)
+	}
+
+	resp, origBytes, err := s.ReadDealStatusResponse()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read deal status response: %w", err)
+	}
+
+	valid, err := c.verifyStatusResponseSignature(ctx, deal.MinerWorker, resp, origBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if !valid {
+		return nil, xerrors.Errorf("invalid deal status response signature")
+	}
+
+	return &resp.DealState, nil
+}
+
+// queryBatchDealStatus queries the provider for the states of the deals with
+// the given proposals, which all have the same client and worker as the deal
+func (c *Client) queryBatchDealStatus(ctx context.Context, s network.BatchDealStatusStream, deal *storagemarket.ClientDeal, proposals []cid.Cid) ([]*storagemarket.ProviderDealState, error) {
+	request := network.BatchDealStatusRequest{Proposals: proposals}
+	buf, err := request.SigningBytes()
+	if err != nil {
+		return nil, xerrors.Errorf("failed serialize deal status request: %w", err)
+	}
+
+	signature, err := c.node.SignBytes(ctx, deal.Proposal.Client, buf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to sign deal status request: %w", err)
+	}
+	request.Signature = *signature
+
+	if err := s.WriteBatchDealStatusRequest(request); err != nil {
+		return nil, xerrors.Errorf("failed to send deal status request: %w", err)
+	}
+
+	resp, origBytes, err := s.ReadBatchDealStatusResponse()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read deal status response: %w", err)
+	}
+	if len(resp.DealStates) != len(proposals) {
+		return nil, xerrors.Errorf("deal status response has %d deals, expected %d", len(resp.DealStates), len(proposals))
+	}
+
+	dealStates := make([]*storagemarket.ProviderDealState, 0, len(proposals))
+	for i := range resp.DealStates {
+		valid, err := c.verifyStatusResponseSignature(ctx, deal.MinerWorker, resp.DealStates[i], origBytes[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if !valid {
+			return nil, xerrors.Errorf("invalid deal status response signature")
+		}
+
+		dealState := &resp.DealStates[i].DealState
+		if dealState.ProposalCid != nil && !dealState.ProposalCid.Equals(proposals[i]) {
+			return nil, xerrors.Errorf("deal status response has proposal %s, expected %s", dealState.ProposalCid, proposals[i])
+		}
+		dealStates = append(dealStates, dealState)
+	}
+	return dealStates, nil
+}
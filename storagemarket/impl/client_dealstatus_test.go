@@ -0,0 +1,50 @@
+package storageimpl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/shared_testutil"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+)
+
+func TestDealStatusBatchProposals(t *testing.T) {
+	cids := shared_testutil.GenerateCids(4)
+	now := time.Now()
+	cutoff := now.Add(-time.Minute)
+
+	b := newDealStatusPoller().batch(dealStatusKey{}, now, cutoff)
+	b.polled[cids[0]] = now
+	b.polled[cids[1]] = now
+	b.polled[cids[2]] = cutoff.Add(-time.Second)
+	b.fetched[cids[2]] = fetchedDealState{state: &storagemarket.ProviderDealState{}, fetched: cutoff}
+
+	proposals := b.proposals(cids[0], cutoff)
+	require.Equal(t, cids[0], proposals[0])
+	require.ElementsMatch(t, cids[:2], proposals)
+
+	// deals that haven't been polled since the cutoff are forgotten
+	require.NotContains(t, b.polled, cids[2])
+	require.NotContains(t, b.fetched, cids[2])
+
+	// a deal that hasn't been polled before is queried first
+	proposals = b.proposals(cids[3], cutoff)
+	require.Equal(t, cids[3], proposals[0])
+	require.ElementsMatch(t, []cid.Cid{cids[0], cids[1], cids[3]}, proposals)
+}
+
+func TestDealStatusPollerForgetsOldBatches(t *testing.T) {
+	now := time.Now()
+	cutoff := now.Add(-time.Minute)
+	dp := newDealStatusPoller()
+	peers := shared_testutil.GeneratePeers(2)
+
+	old := dp.batch(dealStatusKey{miner: peers[0]}, cutoff.Add(-time.Second), cutoff.Add(-time.Hour))
+	old.polled[shared_testutil.GenerateCids(1)[0]] = cutoff.Add(-time.Second)
+	dp.batch(dealStatusKey{miner: peers[1]}, now, cutoff)
+	require.Len(t, dp.batches, 1)
+	require.Contains(t, dp.batches, dealStatusKey{miner: peers[1]})
+}
@@ -54,6 +54,10 @@ func (c *clientDealEnvironment) PollingInterval() time.Duration {
 	return c.c.pollingInterval
 }
 
+func (c *clientDealEnvironment) ReproposeDeal(ctx context.Context, deal storagemarket.ClientDeal) (cid.Cid, error) {
+	return c.c.reproposeDeal(ctx, deal)
+}
+
 type clientStoreGetter struct {
 	c *Client
 }
@@ -0,0 +1,131 @@
+package storageimpl
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin/v9/market"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/dealvalidation"
+)
+
+// reproposeDeal proposes a new deal in place of a deal that the provider
+// rejected because of its price or collateral. The price is taken from the
+// provider's current ask and the collateral from the bounds that the provider
+// sent with the rejection, as long as they are within the limits of the
+// deal's negotiation.
+func (c *Client) reproposeDeal(ctx context.Context, deal storagemarket.ClientDeal) (cid.Cid, error) {
+	if deal.Negotiation == nil || deal.Negotiation.MaxReproposals == 0 {
+		return cid.Undef, xerrors.New("deal has no re-proposals left")
+	}
+	if deal.Rejection == nil {
+		return cid.Undef, xerrors.New("provider gave no reason for rejecting the deal")
+	}
+
+	proposal := deal.Proposal
+	switch deal.Rejection.Code {
+	case storagemarket.RejectionPriceTooLow:
+		price, err := c.askPrice(ctx, proposal)
+		if err != nil {
+			return cid.Undef, err
+		}
+		if !deal.Rejection.Min.Nil() && price.LessThan(deal.Rejection.Min) {
+			price = deal.Rejection.Min
+		}
+		max := deal.Negotiation.MaxStoragePricePerEpoch
+		if max.Nil() || price.GreaterThan(max) {
+			return cid.Undef, xerrors.Errorf("provider's price per epoch %s is above the limit %s", price, max)
+		}
+		proposal.StoragePricePerEpoch = price
+	case storagemarket.RejectionCollateralTooLow:
+		collateral := deal.Rejection.Min
+		if collateral.Nil() || collateral.IsZero() {
+			pcMin, _, err := c.node.DealProviderCollateralBounds(ctx, proposal.PieceSize, proposal.VerifiedDeal)
+			if err != nil {
+				return cid.Undef, xerrors.Errorf("computing deal provider collateral bound failed: %w", err)
+			}
+			collateral = pcMin
+		}
+		max := deal.Negotiation.MaxProviderCollateral
+		if max.Nil() || collateral.GreaterThan(max) {
+			return cid.Undef, xerrors.Errorf("provider's minimum collateral %s is above the limit %s", collateral, max)
+		}
+		proposal.ProviderCollateral = collateral
+	case storagemarket.RejectionCollateralTooHigh:
+		collateral := deal.Rejection.Max
+		if collateral.Nil() || collateral.IsZero() {
+			_, pcMax, err := c.node.DealProviderCollateralBounds(ctx, proposal.PieceSize, proposal.VerifiedDeal)
+			if err != nil {
+				return cid.Undef, xerrors.Errorf("computing deal provider collateral bound failed: %w", err)
+			}
+			collateral = pcMax
+		}
+		proposal.ProviderCollateral = collateral
+	default:
+		return cid.Undef, xerrors.Errorf("deal was rejected for reason %s, which is not price or collateral",
+			storagemarket.RejectionCodes[deal.Rejection.Code])
+	}
+
+	clientDealProposal, err := c.node.SignProposal(ctx, proposal.Client, proposal)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("signing deal proposal failed: %w", err)
+	}
+
+	proposalNd, err := cborutil.AsIpld(clientDealProposal)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("getting proposal node failed: %w", err)
+	}
+
+	negotiation := *deal.Negotiation
+	negotiation.MaxReproposals--
+	reproposalOf := deal.ProposalCid
+	newDeal := &storagemarket.ClientDeal{
+		ProposalCid:        proposalNd.Cid(),
+		ClientDealProposal: *clientDealProposal,
+		State:              storagemarket.StorageDealUnknown,
+		Miner:              deal.Miner,
+		MinerWorker:        deal.MinerWorker,
+		DataRef:            deal.DataRef,
+		FastRetrieval:      deal.FastRetrieval,
+		DealStages:         storagemarket.NewDealStages(),
+		CreationTime:       curTime(),
+		Negotiation:        &negotiation,
+		ReproposalOf:       &reproposalOf,
+	}
+
+	err = c.statemachines.Begin(newDeal.ProposalCid, newDeal)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("setting up deal tracking: %w", err)
+	}
+
+	err = c.statemachines.Send(newDeal.ProposalCid, storagemarket.ClientEventOpen)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("initializing state machine: %w", err)
+	}
+
+	return newDeal.ProposalCid, nil
+}
+
+// askPrice returns the storage price per epoch for the proposal at the
+// provider's current ask
+func (c *Client) askPrice(ctx context.Context, proposal market.DealProposal) (abi.TokenAmount, error) {
+	tok, _, err := c.node.GetChainHead(ctx)
+	if err != nil {
+		return abi.TokenAmount{}, xerrors.Errorf("getting chain head: %w", err)
+	}
+	info, err := c.node.GetMinerInfo(ctx, proposal.Provider, tok)
+	if err != nil {
+		return abi.TokenAmount{}, xerrors.Errorf("getting info of provider %s: %w", proposal.Provider, err)
+	}
+	ask, err := c.GetAsk(ctx, *info)
+	if err != nil {
+		return abi.TokenAmount{}, xerrors.Errorf("getting ask of provider %s: %w", proposal.Provider, err)
+	}
+
+	return dealvalidation.MinPrice(*ask, proposal), nil
+}
@@ -3,6 +3,7 @@ package storageimpl_test
 import (
 	"bytes"
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -162,3 +163,111 @@ func TestClient_Migrations(t *testing.T) {
 		require.Equal(t, expectedDeal, deal)
 	}
 }
+
+// batchStatusReceiver answers batch deal status requests, counting them
+type batchStatusReceiver struct {
+	network.StorageReceiver
+	lk       sync.Mutex
+	requests []network.BatchDealStatusRequest
+}
+
+func (r *batchStatusReceiver) HandleDealStatusStream(s network.DealStatusStream) {
+	defer s.Close() //nolint:errcheck
+	bs, ok := s.(network.BatchDealStatusStream)
+	if !ok {
+		return
+	}
+	request, err := bs.ReadBatchDealStatusRequest()
+	if err != nil {
+		return
+	}
+	r.lk.Lock()
+	r.requests = append(r.requests, request)
+	r.lk.Unlock()
+
+	var resp network.BatchDealStatusResponse
+	for i := range request.Proposals {
+		proposal := request.Proposals[i]
+		resp.DealStates = append(resp.DealStates, network.DealStatusResponse{
+			DealState: storagemarket.ProviderDealState{State: storagemarket.StorageDealActive, ProposalCid: &proposal},
+			Signature: *shared_testutil.MakeTestSignature(),
+		})
+	}
+	_ = bs.WriteBatchDealStatusResponse(resp, nil)
+}
+
+func (r *batchStatusReceiver) batches() []network.BatchDealStatusRequest {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return append([]network.BatchDealStatusRequest{}, r.requests...)
+}
+
+func TestClient_GetProviderDealStateBatches(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	deps := dependencies.NewDependenciesWithTestData(t, ctx, shared_testutil.NewLibp2pTestData(ctx, t), testnodes.NewStorageMarketState(), "", noOpDelay,
+		noOpDelay)
+
+	receiver := &batchStatusReceiver{}
+	providerNet := network.NewFromLibp2pHost(deps.TestData.Host2)
+	require.NoError(t, providerNet.SetDelegate(receiver))
+	defer providerNet.StopHandlingRequests() //nolint:errcheck
+
+	clientDs := namespace.Wrap(deps.TestData.Ds1, datastore.NewKey("/deals/client"))
+	numDeals := 5
+	proposalCids := make([]cid.Cid, numDeals)
+	for i := 0; i < numDeals; i++ {
+		proposal := shared_testutil.MakeTestClientDealProposal()
+		proposalNd, err := cborutil.AsIpld(proposal)
+		require.NoError(t, err)
+		proposalCids[i] = proposalNd.Cid()
+		deal := migrations.ClientDeal0{
+			ClientDealProposal: *proposal,
+			ProposalCid:        proposalCids[i],
+			State:              storagemarket.StorageDealExpired,
+			Miner:              deps.TestData.Host2.ID(),
+			MinerWorker:        address.TestAddress2,
+			DataRef: &migrations.DataRef0{
+				TransferType: storagemarket.TTGraphsync,
+				Root:         shared_testutil.GenerateCids(1)[0],
+			},
+			FundsReserved: big.Zero(),
+		}
+		buf := new(bytes.Buffer)
+		require.NoError(t, deal.MarshalCBOR(buf))
+		require.NoError(t, clientDs.Put(ctx, datastore.NewKey(deal.ProposalCid.String()), buf.Bytes()))
+	}
+
+	client, err := storageimpl.NewClient(
+		network.NewFromLibp2pHost(deps.TestData.Host1, network.RetryParameters(0, 0, 0, 0)),
+		deps.DTClient,
+		deps.PeerResolver,
+		clientDs,
+		deps.ClientNode,
+		shared_testutil.NewTestStorageBlockstoreAccessor(),
+		storageimpl.DealPollingInterval(time.Hour),
+	)
+	require.NoError(t, err)
+	shared_testutil.StartAndWaitForReady(ctx, t, client)
+
+	// the first time each deal is polled, the provider is queried for it and
+	// the deals polled before it
+	for i, proposalCid := range proposalCids {
+		state, err := client.GetProviderDealState(ctx, proposalCid)
+		require.NoError(t, err)
+		require.Equal(t, proposalCid, *state.ProposalCid)
+		require.Len(t, receiver.batches(), i+1)
+		require.Len(t, receiver.batches()[i].Proposals, i+1)
+	}
+
+	// after that, the states of every deal are fetched in a single request
+	for _, proposalCid := range proposalCids {
+		state, err := client.GetProviderDealState(ctx, proposalCid)
+		require.NoError(t, err)
+		require.Equal(t, proposalCid, *state.ProposalCid)
+		require.Equal(t, storagemarket.StorageDealActive, state.State)
+	}
+	batches := receiver.batches()
+	require.Len(t, batches, numDeals+1)
+	require.ElementsMatch(t, proposalCids, batches[numDeals].Proposals)
+}
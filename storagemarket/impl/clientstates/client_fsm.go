@@ -82,8 +82,9 @@ var ClientEvents = fsm.Events{
 		}),
 	fsm.Event(storagemarket.ClientEventUnexpectedDealState).
 		From(storagemarket.StorageDealFundsReserved).To(storagemarket.StorageDealFailing).
-		Action(func(deal *storagemarket.ClientDeal, status storagemarket.StorageDealStatus, providerMessage string) error {
+		Action(func(deal *storagemarket.ClientDeal, status storagemarket.StorageDealStatus, providerMessage string, rejection *storagemarket.Rejection) error {
 			deal.Message = xerrors.Errorf("unexpected deal status while waiting for data request: %d (%s). Provider message: %s", status, storagemarket.DealStates[status], providerMessage).Error()
+			deal.Rejection = rejection
 			deal.AddLog(deal.Message)
 			return nil
 		}),
@@ -266,6 +267,20 @@ var ClientEvents = fsm.Events{
 			deal.AddLog(deal.Message)
 			return nil
 		}),
+	fsm.Event(storagemarket.ClientEventReproposed).
+		From(storagemarket.StorageDealFailing).ToJustRecord().
+		Action(func(deal *storagemarket.ClientDeal, reproposedAs cid.Cid) error {
+			deal.ReproposedAs = &reproposedAs
+			deal.AddLog("re-proposed as deal %s", reproposedAs)
+			return nil
+		}),
+	fsm.Event(storagemarket.ClientEventCancelled).
+		FromMany(ClientCancellableStates...).To(storagemarket.StorageDealFailing).
+		Action(func(deal *storagemarket.ClientDeal) error {
+			deal.Message = "deal cancelled by client"
+			deal.AddLog(deal.Message)
+			return nil
+		}),
 	fsm.Event(storagemarket.ClientEventFailed).
 		From(storagemarket.StorageDealFailing).To(storagemarket.StorageDealError).
 		Action(func(deal *storagemarket.ClientDeal) error {
@@ -298,3 +313,17 @@ var ClientFinalityStates = []fsm.StateKey{
 	storagemarket.StorageDealExpired,
 	storagemarket.StorageDealError,
 }
+
+// ClientCancellableStates are the states in which the client can cancel a deal.
+// Once the provider accepts the deal it publishes it, so the deal can no longer
+// be cancelled. The states in which funds are being reserved are left out, so
+// that the funds are released when the deal fails.
+var ClientCancellableStates = []fsm.StateKey{
+	storagemarket.StorageDealClientFunding,
+	storagemarket.StorageDealFundsReserved,
+	storagemarket.StorageDealStartDataTransfer,
+	storagemarket.StorageDealTransferQueued,
+	storagemarket.StorageDealTransferring,
+	storagemarket.StorageDealClientTransferRestart,
+	storagemarket.StorageDealCheckForAcceptance,
+}
@@ -39,6 +39,10 @@ type ClientDealEnvironment interface {
 	RestartDataTransfer(ctx context.Context, chid datatransfer.ChannelID) error
 	GetProviderDealState(ctx context.Context, proposalCid cid.Cid) (*storagemarket.ProviderDealState, error)
 	PollingInterval() time.Duration
+	// ReproposeDeal proposes a new deal in place of a deal that the provider
+	// rejected because of its price or collateral, within the limits of the
+	// deal's negotiation, and returns the new proposal's CID
+	ReproposeDeal(ctx context.Context, deal storagemarket.ClientDeal) (cid.Cid, error)
 	network.PeerTagger
 }
 
@@ -125,7 +129,7 @@ func ProposeDeal(ctx fsm.Context, environment ClientDealEnvironment, deal storag
 	}
 
 	if resp.Response.State != storagemarket.StorageDealWaitingForData {
-		return ctx.Trigger(storagemarket.ClientEventUnexpectedDealState, resp.Response.State, resp.Response.Message)
+		return ctx.Trigger(storagemarket.ClientEventUnexpectedDealState, resp.Response.State, resp.Response.Message, resp.Response.Rejection)
 	}
 
 	return ctx.Trigger(storagemarket.ClientEventInitiateDataTransfer)
@@ -329,13 +333,45 @@ func FailDeal(ctx fsm.Context, environment ClientDealEnvironment, deal storagema
 
 	environment.UntagPeer(deal.Miner, deal.ProposalCid.String())
 
-	if err := environment.CleanBlockstore(deal.DataRef.Root); err != nil {
-		log.Errorf("failed to cleanup read-only blockstore, proposalCid=%s: %s", deal.ProposalCid, err)
+	// a re-proposal transfers the same data, so the blockstore is left for it
+	reproposed := deal.ReproposedAs != nil
+	if shouldRepropose(deal) {
+		reproposedAs, err := environment.ReproposeDeal(ctx.Context(), deal)
+		if err != nil {
+			log.Warnf("not re-proposing deal %s: %s", deal.ProposalCid, err)
+		} else {
+			reproposed = true
+			_ = ctx.Trigger(storagemarket.ClientEventReproposed, reproposedAs)
+		}
+	}
+
+	if !reproposed {
+		if err := environment.CleanBlockstore(deal.DataRef.Root); err != nil {
+			log.Errorf("failed to cleanup read-only blockstore, proposalCid=%s: %s", deal.ProposalCid, err)
+		}
 	}
 
 	return ctx.Trigger(storagemarket.ClientEventFailed)
 }
 
+// shouldRepropose returns true if the deal has re-proposals left, the
+// provider rejected it because of its price or collateral, and it hasn't
+// already been re-proposed before the client restarted
+func shouldRepropose(deal storagemarket.ClientDeal) bool {
+	if deal.ReproposedAs != nil {
+		return false
+	}
+	if deal.Negotiation == nil || deal.Negotiation.MaxReproposals == 0 || deal.Rejection == nil {
+		return false
+	}
+	switch deal.Rejection.Code {
+	case storagemarket.RejectionPriceTooLow, storagemarket.RejectionCollateralTooLow, storagemarket.RejectionCollateralTooHigh:
+		return true
+	default:
+		return false
+	}
+}
+
 func releaseReservedFunds(ctx fsm.Context, environment ClientDealEnvironment, deal storagemarket.ClientDeal) {
 	if !deal.FundsReserved.Nil() && !deal.FundsReserved.IsZero() {
 		err := environment.Node().ReleaseFunds(ctx.Context(), deal.Proposal.Client, deal.FundsReserved)
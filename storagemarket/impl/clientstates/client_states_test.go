@@ -16,6 +16,7 @@ import (
 	cborutil "github.com/filecoin-project/go-cbor-util"
 	datatransfer "github.com/filecoin-project/go-data-transfer/v2"
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/go-state-types/builtin/v9/market"
 	"github.com/filecoin-project/go-state-types/exitcode"
 	"github.com/filecoin-project/go-statemachine/fsm"
@@ -205,6 +206,31 @@ func TestProposeDeal(t *testing.T) {
 			},
 		})
 	})
+	t.Run("response is a rejection", func(t *testing.T) {
+		rejection := &storagemarket.Rejection{
+			Code:     storagemarket.RejectionPriceTooLow,
+			Min:      abi.NewTokenAmount(100),
+			Max:      big.Zero(),
+			Proposed: abi.NewTokenAmount(10),
+		}
+		ds := tut.NewTestStorageDealStream(tut.TestStorageDealStreamParams{
+			ResponseReader: testResponseReader(t, responseParams{
+				proposal:  clientDealProposal,
+				state:     storagemarket.StorageDealFailing,
+				message:   "deal rejected: storage price per epoch less than asking price: 10 < 100",
+				rejection: rejection,
+			}),
+		})
+		runAndInspect(t, storagemarket.StorageDealFundsReserved, clientstates.ProposeDeal, testCase{
+			envParams: envParams{
+				dealStream: ds,
+			},
+			inspector: func(deal storagemarket.ClientDeal, env *fakeEnvironment) {
+				tut.AssertDealState(t, storagemarket.StorageDealFailing, deal.State)
+				assert.Equal(t, rejection, deal.Rejection)
+			},
+		})
+	})
 }
 
 func TestInitiateDataTransfer(t *testing.T) {
@@ -557,6 +583,81 @@ func TestFailDeal(t *testing.T) {
 				tut.AssertDealState(t, storagemarket.StorageDealError, deal.State)
 				assert.Len(t, env.node.DealFunds.ReleaseCalls, 0)
 				assert.True(t, deal.FundsReserved.Nil() || deal.FundsReserved.IsZero())
+				assert.Len(t, env.reproposeCalls, 0)
+				assert.Equal(t, []cid.Cid{deal.DataRef.Root}, env.cleaned)
+			},
+		})
+	})
+	t.Run("re-proposes deal rejected for price", func(t *testing.T) {
+		reproposedAs := tut.GenerateCids(1)[0]
+		runAndInspect(t, storagemarket.StorageDealFailing, clientstates.FailDeal, testCase{
+			stateParams: dealStateParams{
+				negotiation: &storagemarket.DealNegotiation{MaxReproposals: 1},
+				rejection:   &storagemarket.Rejection{Code: storagemarket.RejectionPriceTooLow},
+			},
+			envParams: envParams{reproposedAs: reproposedAs},
+			inspector: func(deal storagemarket.ClientDeal, env *fakeEnvironment) {
+				tut.AssertDealState(t, storagemarket.StorageDealError, deal.State)
+				assert.Len(t, env.reproposeCalls, 1)
+				assert.Equal(t, &reproposedAs, deal.ReproposedAs)
+				// the re-proposal still needs the data
+				assert.Empty(t, env.cleaned)
+			},
+		})
+	})
+	t.Run("does not re-propose again after a restart", func(t *testing.T) {
+		reproposedAs := tut.GenerateCids(1)[0]
+		runAndInspect(t, storagemarket.StorageDealFailing, clientstates.FailDeal, testCase{
+			stateParams: dealStateParams{
+				negotiation:  &storagemarket.DealNegotiation{MaxReproposals: 1},
+				rejection:    &storagemarket.Rejection{Code: storagemarket.RejectionPriceTooLow},
+				reproposedAs: &reproposedAs,
+			},
+			envParams: envParams{reproposedAs: tut.GenerateCids(1)[0]},
+			inspector: func(deal storagemarket.ClientDeal, env *fakeEnvironment) {
+				tut.AssertDealState(t, storagemarket.StorageDealError, deal.State)
+				assert.Len(t, env.reproposeCalls, 0)
+				assert.Equal(t, &reproposedAs, deal.ReproposedAs)
+				assert.Empty(t, env.cleaned)
+			},
+		})
+	})
+	t.Run("re-proposal fails", func(t *testing.T) {
+		runAndInspect(t, storagemarket.StorageDealFailing, clientstates.FailDeal, testCase{
+			stateParams: dealStateParams{
+				negotiation: &storagemarket.DealNegotiation{MaxReproposals: 1},
+				rejection:   &storagemarket.Rejection{Code: storagemarket.RejectionCollateralTooLow},
+			},
+			envParams: envParams{reproposeErr: errors.New("above the limit")},
+			inspector: func(deal storagemarket.ClientDeal, env *fakeEnvironment) {
+				tut.AssertDealState(t, storagemarket.StorageDealError, deal.State)
+				assert.Len(t, env.reproposeCalls, 1)
+				assert.Nil(t, deal.ReproposedAs)
+				assert.Equal(t, []cid.Cid{deal.DataRef.Root}, env.cleaned)
+			},
+		})
+	})
+	t.Run("does not re-propose deal rejected for other reasons", func(t *testing.T) {
+		runAndInspect(t, storagemarket.StorageDealFailing, clientstates.FailDeal, testCase{
+			stateParams: dealStateParams{
+				negotiation: &storagemarket.DealNegotiation{MaxReproposals: 1},
+				rejection:   &storagemarket.Rejection{Code: storagemarket.RejectionPieceTooLarge},
+			},
+			inspector: func(deal storagemarket.ClientDeal, env *fakeEnvironment) {
+				tut.AssertDealState(t, storagemarket.StorageDealError, deal.State)
+				assert.Len(t, env.reproposeCalls, 0)
+			},
+		})
+	})
+	t.Run("does not re-propose deal with no re-proposals left", func(t *testing.T) {
+		runAndInspect(t, storagemarket.StorageDealFailing, clientstates.FailDeal, testCase{
+			stateParams: dealStateParams{
+				negotiation: &storagemarket.DealNegotiation{},
+				rejection:   &storagemarket.Rejection{Code: storagemarket.RejectionPriceTooLow},
+			},
+			inspector: func(deal storagemarket.ClientDeal, env *fakeEnvironment) {
+				tut.AssertDealState(t, storagemarket.StorageDealError, deal.State)
+				assert.Len(t, env.reproposeCalls, 0)
 			},
 		})
 	})
@@ -571,6 +672,8 @@ type envParams struct {
 	providerDealState        *storagemarket.ProviderDealState
 	getDealStatusErr         error
 	pollingInterval          time.Duration
+	reproposedAs             cid.Cid
+	reproposeErr             error
 }
 
 type dealStateParams struct {
@@ -578,6 +681,9 @@ type dealStateParams struct {
 	reserveFunds  bool
 	fastRetrieval bool
 	startEpoch    abi.ChainEpoch
+	negotiation   *storagemarket.DealNegotiation
+	rejection     *storagemarket.Rejection
+	reproposedAs  *cid.Cid
 }
 
 type executor func(t *testing.T,
@@ -611,6 +717,9 @@ func makeExecutor(ctx context.Context,
 		if dealParams.startEpoch != 0 {
 			dealState.Proposal.StartEpoch = dealParams.startEpoch
 		}
+		dealState.Negotiation = dealParams.negotiation
+		dealState.Rejection = dealParams.rejection
+		dealState.ReproposedAs = dealParams.reproposedAs
 
 		environment := &fakeEnvironment{
 			node:                       node,
@@ -622,6 +731,8 @@ func makeExecutor(ctx context.Context,
 			getDealStatusErr:           envParams.getDealStatusErr,
 			pollingInterval:            envParams.pollingInterval,
 			peerTagger:                 tut.NewTestPeerTagger(),
+			reproposedAs:               envParams.reproposedAs,
+			reproposeErr:               envParams.reproposeErr,
 		}
 
 		if environment.pollingInterval == 0 {
@@ -714,6 +825,11 @@ type fakeEnvironment struct {
 	getDealStatusErr  error
 	pollingInterval   time.Duration
 	peerTagger        *tut.TestPeerTagger
+
+	reproposedAs   cid.Cid
+	reproposeErr   error
+	reproposeCalls []storagemarket.ClientDeal
+	cleaned        []cid.Cid
 }
 
 type dataTransferParams struct {
@@ -766,6 +882,11 @@ func (fe *fakeEnvironment) PollingInterval() time.Duration {
 	return fe.pollingInterval
 }
 
+func (fe *fakeEnvironment) ReproposeDeal(_ context.Context, deal storagemarket.ClientDeal) (cid.Cid, error) {
+	fe.reproposeCalls = append(fe.reproposeCalls, deal)
+	return fe.reproposedAs, fe.reproposeErr
+}
+
 func (fe *fakeEnvironment) TagPeer(id peer.ID, ident string) {
 	fe.peerTagger.TagPeer(id, ident)
 }
@@ -775,6 +896,7 @@ func (fe *fakeEnvironment) UntagPeer(id peer.ID, ident string) {
 }
 
 func (fe *fakeEnvironment) CleanBlockstore(proposalCid cid.Cid) error {
+	fe.cleaned = append(fe.cleaned, proposalCid)
 	return nil
 }
 
@@ -786,6 +908,7 @@ type responseParams struct {
 	message        string
 	publishMessage *cid.Cid
 	proposalCid    cid.Cid
+	rejection      *storagemarket.Rejection
 }
 
 func testResponseReader(t *testing.T, params responseParams) tut.StorageDealResponseReader {
@@ -794,6 +917,7 @@ func testResponseReader(t *testing.T, params responseParams) tut.StorageDealResp
 		Proposal:       params.proposalCid,
 		Message:        params.message,
 		PublishMessage: params.publishMessage,
+		Rejection:      params.rejection,
 	}
 
 	if response.Proposal == cid.Undef {
@@ -0,0 +1,175 @@
+// Package dealvalidation checks a storage deal proposal against a provider's
+// criteria. The provider runs it on every proposal it receives, and a client
+// can run it on its own proposal before sending it, so that it doesn't sign
+// and stage a deal that the provider will reject.
+package dealvalidation
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	minertypes "github.com/filecoin-project/go-state-types/builtin/v8/miner"
+	"github.com/filecoin-project/go-state-types/builtin/v8/verifreg"
+	"github.com/filecoin-project/go-state-types/builtin/v9/market"
+
+	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+)
+
+// TODO: These are copied from spec-actors master, use spec-actors exports when we update
+const DealMaxLabelSize = 256
+
+// Node is the chain access needed to validate a proposal. It is implemented
+// by storagemarket.StorageProviderNode and storagemarket.StorageClientNode.
+type Node interface {
+	DealProviderCollateralBounds(ctx context.Context, size abi.PaddedPieceSize, isVerified bool) (abi.TokenAmount, abi.TokenAmount, error)
+	GetBalance(ctx context.Context, addr address.Address, tok shared.TipSetToken) (storagemarket.Balance, error)
+}
+
+// DataCapFunc returns the DataCap of a verified client
+type DataCapFunc func(ctx context.Context, addr address.Address, tok shared.TipSetToken) (*verifreg.DataCap, error)
+
+// Params are the provider's criteria that a proposal is validated against
+type Params struct {
+	// Provider is the address of the provider that the proposal must be for
+	Provider address.Address
+	// Ask is the provider's current storage ask
+	Ask storagemarket.StorageAsk
+	// TipSetToken and Epoch are the chain head to validate the proposal at
+	TipSetToken shared.TipSetToken
+	Epoch       abi.ChainEpoch
+	// GetDataCap looks up the DataCap of the client of a verified deal. If it
+	// is nil the DataCap is not checked, as a client node can't look it up.
+	GetDataCap DataCapFunc
+	// IgnoreClientBalance skips the check of the client's market balance, for
+	// proposals checked before the client has added the funds for them
+	IgnoreClientBalance bool
+}
+
+// ValidateProposal checks an unsigned proposal against the provider's
+// criteria. It returns nil if the proposal meets them, or the reason that the
+// provider would reject it. The client's signature is not checked.
+func ValidateProposal(ctx context.Context, node Node, params Params, proposal market.DealProposal) *storagemarket.RejectionError {
+	if proposal.Provider != params.Provider {
+		return storagemarket.NewRejectionError(storagemarket.RejectionWrongProvider, "incorrect provider for deal")
+	}
+
+	if proposal.Label.Length() > DealMaxLabelSize {
+		return storagemarket.NewRejectionError(storagemarket.RejectionLabelTooLong, "deal label can be at most %d bytes, is %d", DealMaxLabelSize, proposal.Label.Length()).
+			WithMax(big.NewInt(DealMaxLabelSize)).WithProposed(big.NewInt(int64(proposal.Label.Length())))
+	}
+
+	if err := proposal.PieceSize.Validate(); err != nil {
+		return storagemarket.NewRejectionError(storagemarket.RejectionInvalidProposal, "proposal piece size is invalid: %w", err)
+	}
+
+	if !proposal.PieceCID.Defined() {
+		return storagemarket.NewRejectionError(storagemarket.RejectionInvalidProposal, "proposal PieceCID undefined")
+	}
+
+	if proposal.PieceCID.Prefix() != market.PieceCIDPrefix {
+		return storagemarket.NewRejectionError(storagemarket.RejectionInvalidProposal, "proposal PieceCID had wrong prefix")
+	}
+
+	if proposal.EndEpoch <= proposal.StartEpoch {
+		return storagemarket.NewRejectionError(storagemarket.RejectionInvalidProposal, "proposal end before proposal start")
+	}
+
+	curEpoch := params.Epoch
+	if curEpoch > proposal.StartEpoch {
+		return storagemarket.NewRejectionError(storagemarket.RejectionStartEpochElapsed, "deal start epoch has already elapsed").
+			WithMin(big.NewInt(int64(curEpoch))).WithProposed(big.NewInt(int64(proposal.StartEpoch)))
+	}
+
+	// Check that the delta between the start and end epochs (the deal
+	// duration) is within acceptable bounds
+	minDuration, maxDuration := market.DealDurationBounds(proposal.PieceSize)
+	if proposal.Duration() < minDuration || proposal.Duration() > maxDuration {
+		return storagemarket.NewRejectionError(storagemarket.RejectionDurationOutOfBounds, "deal duration out of bounds (min, max, provided): %d, %d, %d", minDuration, maxDuration, proposal.Duration()).
+			WithMin(big.NewInt(int64(minDuration))).WithMax(big.NewInt(int64(maxDuration))).WithProposed(big.NewInt(int64(proposal.Duration())))
+	}
+
+	// Check that the proposed end epoch isn't too far beyond the current epoch
+	maxEndEpoch := curEpoch + minertypes.MaxSectorExpirationExtension
+	if proposal.EndEpoch > maxEndEpoch {
+		return storagemarket.NewRejectionError(storagemarket.RejectionEndEpochTooLate, "invalid deal end epoch %d: cannot be more than %d past current epoch %d", proposal.EndEpoch, minertypes.MaxSectorExpirationExtension, curEpoch).
+			WithMax(big.NewInt(int64(maxEndEpoch))).WithProposed(big.NewInt(int64(proposal.EndEpoch)))
+	}
+
+	pcMin, pcMax, err := node.DealProviderCollateralBounds(ctx, proposal.PieceSize, proposal.VerifiedDeal)
+	if err != nil {
+		return storagemarket.NewRejectionError(storagemarket.RejectionProviderError, "node error getting collateral bounds: %w", err)
+	}
+
+	if proposal.ProviderCollateral.LessThan(pcMin) {
+		return storagemarket.NewRejectionError(storagemarket.RejectionCollateralTooLow, "proposed provider collateral below minimum: %s < %s", proposal.ProviderCollateral, pcMin).
+			WithMin(pcMin).WithMax(pcMax).WithProposed(proposal.ProviderCollateral)
+	}
+
+	if proposal.ProviderCollateral.GreaterThan(pcMax) {
+		return storagemarket.NewRejectionError(storagemarket.RejectionCollateralTooHigh, "proposed provider collateral above maximum: %s > %s", proposal.ProviderCollateral, pcMax).
+			WithMin(pcMin).WithMax(pcMax).WithProposed(proposal.ProviderCollateral)
+	}
+
+	minPrice := MinPrice(params.Ask, proposal)
+	if proposal.StoragePricePerEpoch.LessThan(minPrice) {
+		return storagemarket.NewRejectionError(storagemarket.RejectionPriceTooLow, "storage price per epoch less than asking price: %s < %s", proposal.StoragePricePerEpoch, minPrice).
+			WithMin(minPrice).WithProposed(proposal.StoragePricePerEpoch)
+	}
+
+	if proposal.PieceSize < params.Ask.MinPieceSize {
+		return storagemarket.NewRejectionError(storagemarket.RejectionPieceTooSmall, "piece size less than minimum required size: %d < %d", proposal.PieceSize, params.Ask.MinPieceSize).
+			WithMin(big.NewIntUnsigned(uint64(params.Ask.MinPieceSize))).WithProposed(big.NewIntUnsigned(uint64(proposal.PieceSize)))
+	}
+
+	if proposal.PieceSize > params.Ask.MaxPieceSize {
+		return storagemarket.NewRejectionError(storagemarket.RejectionPieceTooLarge, "piece size more than maximum allowed size: %d > %d", proposal.PieceSize, params.Ask.MaxPieceSize).
+			WithMax(big.NewIntUnsigned(uint64(params.Ask.MaxPieceSize))).WithProposed(big.NewIntUnsigned(uint64(proposal.PieceSize)))
+	}
+
+	// check market funds
+	if !params.IgnoreClientBalance {
+		clientMarketBalance, err := node.GetBalance(ctx, proposal.Client, params.TipSetToken)
+		if err != nil {
+			return storagemarket.NewRejectionError(storagemarket.RejectionProviderError, "node error getting client market balance failed: %w", err)
+		}
+
+		// This doesn't guarantee that the client won't withdraw / lock those funds
+		// but it's a decent first filter
+		if clientMarketBalance.Available.LessThan(proposal.ClientBalanceRequirement()) {
+			return storagemarket.NewRejectionError(storagemarket.RejectionInsufficientClientBalance, "clientMarketBalance.Available too small: %d < %d", clientMarketBalance.Available, proposal.ClientBalanceRequirement()).
+				WithMin(proposal.ClientBalanceRequirement()).WithProposed(clientMarketBalance.Available)
+		}
+	}
+
+	// Verified deal checks
+	if proposal.VerifiedDeal && params.GetDataCap != nil {
+		dataCap, err := params.GetDataCap(ctx, proposal.Client, params.TipSetToken)
+		if err != nil {
+			return storagemarket.NewRejectionError(storagemarket.RejectionProviderError, "node error fetching verified data cap: %w", err)
+		}
+		if dataCap == nil {
+			return storagemarket.NewRejectionError(storagemarket.RejectionNoDataCap, "node error fetching verified data cap: data cap missing -- client not verified").
+				WithMin(big.NewIntUnsigned(uint64(proposal.PieceSize)))
+		}
+		pieceSize := big.NewIntUnsigned(uint64(proposal.PieceSize))
+		if dataCap.LessThan(pieceSize) {
+			return storagemarket.NewRejectionError(storagemarket.RejectionNoDataCap, "verified deal DataCap too small for proposed piece size").
+				WithMin(pieceSize).WithProposed(*dataCap)
+		}
+	}
+
+	return nil
+}
+
+// MinPrice returns the lowest storage price per epoch for the proposal at
+// the given ask
+func MinPrice(ask storagemarket.StorageAsk, proposal market.DealProposal) abi.TokenAmount {
+	askPrice := ask.Price
+	if proposal.VerifiedDeal {
+		askPrice = ask.VerifiedPrice
+	}
+	return big.Div(big.Mul(askPrice, abi.NewTokenAmount(int64(proposal.PieceSize))), abi.NewTokenAmount(1<<30))
+}
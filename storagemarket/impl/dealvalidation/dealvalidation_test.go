@@ -0,0 +1,152 @@
+package dealvalidation_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin/v8/verifreg"
+	"github.com/filecoin-project/go-state-types/builtin/v9/market"
+
+	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/dealvalidation"
+)
+
+func TestValidateProposal(t *testing.T) {
+	ctx := context.Background()
+	pieceCid, err := commcid.DataCommitmentV1ToCID(make([]byte, 32))
+	require.NoError(t, err)
+	label, err := market.NewLabelFromString("label")
+	require.NoError(t, err)
+
+	validProposal := func() market.DealProposal {
+		return market.DealProposal{
+			PieceCID:             pieceCid,
+			PieceSize:            1 << 20,
+			Client:               address.TestAddress,
+			Provider:             address.TestAddress2,
+			Label:                label,
+			StartEpoch:           200,
+			EndEpoch:             200 + 200*2880,
+			StoragePricePerEpoch: abi.NewTokenAmount(10),
+			ProviderCollateral:   abi.NewTokenAmount(100),
+			ClientCollateral:     big.Zero(),
+		}
+	}
+	validParams := func() dealvalidation.Params {
+		return dealvalidation.Params{
+			Provider: address.TestAddress2,
+			Ask: storagemarket.StorageAsk{
+				Price:         abi.NewTokenAmount(1 << 10),
+				VerifiedPrice: abi.NewTokenAmount(0),
+				MinPieceSize:  256,
+				MaxPieceSize:  1 << 30,
+			},
+			Epoch: 100,
+		}
+	}
+
+	tests := map[string]struct {
+		proposal func(*market.DealProposal)
+		params   func(*dealvalidation.Params)
+		node     fakeNode
+		code     storagemarket.RejectionCode
+		ok       bool
+	}{
+		"valid": {
+			ok: true,
+		},
+		"wrong provider": {
+			proposal: func(p *market.DealProposal) { p.Provider = address.TestAddress },
+			code:     storagemarket.RejectionWrongProvider,
+		},
+		"start epoch elapsed": {
+			params: func(p *dealvalidation.Params) { p.Epoch = 300 },
+			code:   storagemarket.RejectionStartEpochElapsed,
+		},
+		"collateral too low": {
+			node: fakeNode{minCollateral: abi.NewTokenAmount(1000)},
+			code: storagemarket.RejectionCollateralTooLow,
+		},
+		"price too low": {
+			proposal: func(p *market.DealProposal) { p.StoragePricePerEpoch = abi.NewTokenAmount(0) },
+			code:     storagemarket.RejectionPriceTooLow,
+		},
+		"piece too large": {
+			params: func(p *dealvalidation.Params) { p.Ask.MaxPieceSize = 1 << 10 },
+			code:   storagemarket.RejectionPieceTooLarge,
+		},
+		"insufficient balance": {
+			node: fakeNode{balance: abi.NewTokenAmount(1)},
+			code: storagemarket.RejectionInsufficientClientBalance,
+		},
+		"provider error": {
+			node: fakeNode{err: errors.New("something went wrong")},
+			code: storagemarket.RejectionProviderError,
+		},
+		"verified deal without DataCap check": {
+			proposal: func(p *market.DealProposal) { p.VerifiedDeal = true },
+			ok:       true,
+		},
+		"verified deal without DataCap": {
+			proposal: func(p *market.DealProposal) { p.VerifiedDeal = true },
+			params: func(p *dealvalidation.Params) {
+				p.GetDataCap = func(context.Context, address.Address, shared.TipSetToken) (*verifreg.DataCap, error) {
+					return nil, nil
+				}
+			},
+			code: storagemarket.RejectionNoDataCap,
+		},
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			proposal := validProposal()
+			if data.proposal != nil {
+				data.proposal(&proposal)
+			}
+			params := validParams()
+			if data.params != nil {
+				data.params(&params)
+			}
+			rerr := dealvalidation.ValidateProposal(ctx, &data.node, params, proposal)
+			if data.ok {
+				require.Nil(t, rerr)
+				return
+			}
+			require.NotNil(t, rerr)
+			require.Equal(t, storagemarket.RejectionCodes[data.code], storagemarket.RejectionCodes[rerr.Rejection.Code])
+		})
+	}
+}
+
+type fakeNode struct {
+	minCollateral abi.TokenAmount
+	balance       abi.TokenAmount
+	err           error
+}
+
+func (n *fakeNode) DealProviderCollateralBounds(ctx context.Context, size abi.PaddedPieceSize, isVerified bool) (abi.TokenAmount, abi.TokenAmount, error) {
+	if n.err != nil {
+		return abi.TokenAmount{}, abi.TokenAmount{}, n.err
+	}
+	min := n.minCollateral
+	if min.Nil() {
+		min = big.Zero()
+	}
+	return min, abi.NewTokenAmount(1 << 20), nil
+}
+
+func (n *fakeNode) GetBalance(ctx context.Context, addr address.Address, tok shared.TipSetToken) (storagemarket.Balance, error) {
+	available := n.balance
+	if available.Nil() {
+		available = abi.NewTokenAmount(1 << 40)
+	}
+	return storagemarket.Balance{Locked: big.Zero(), Available: available}, nil
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
 	"github.com/ipni/go-libipni/metadata"
 	provider "github.com/ipni/index-provider"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -35,6 +36,10 @@ import (
 	"github.com/filecoin-project/go-fil-markets/filestore"
 	"github.com/filecoin-project/go-fil-markets/piecestore"
 	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/shared/askgossip"
+	"github.com/filecoin-project/go-fil-markets/shared/denylist"
+	"github.com/filecoin-project/go-fil-markets/shared/drain"
+	"github.com/filecoin-project/go-fil-markets/shared/retention"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/connmanager"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/dtutils"
@@ -48,6 +53,7 @@ import (
 
 var _ storagemarket.StorageProvider = &Provider{}
 var _ network.StorageReceiver = &Provider{}
+var _ network.DealCancelReceiver = &Provider{}
 
 const defaultAwaitRestartTimeout = 1 * time.Hour
 
@@ -96,6 +102,17 @@ type Provider struct {
 	indexProvider   provider.Interface
 	metadataForDeal MetadataFunc
 	stores          *stores.ReadWriteBlockstores
+
+	archive         *retention.Archive
+	retentionPolicy retention.Policy
+	retention       *retention.Manager
+
+	askPublisher *askgossip.Publisher
+
+	drainer  *drain.Drainer
+	denylist *denylist.Denylist
+
+	dealChecks *peerRateLimiter
 }
 
 // StorageProviderOption allows custom configuration of a storage provider
@@ -132,6 +149,34 @@ func CustomMetadataGenerator(metadataFunc MetadataFunc) StorageProviderOption {
 	}
 }
 
+// ProviderDealRetention moves deals that have been in a terminal state for longer
+// than the policy's maximum age from the provider's deal store to the
+// archive. Archived deals are no longer returned by ListLocalDeals, but can
+// still be looked up by proposal CID.
+func ProviderDealRetention(archive *retention.Archive, policy retention.Policy) StorageProviderOption {
+	return func(p *Provider) {
+		p.archive = archive
+		p.retentionPolicy = policy
+	}
+}
+
+// AskPublisher publishes the provider's storage ask with the given
+// publisher when the provider starts and whenever the ask is set
+func AskPublisher(publisher *askgossip.Publisher) StorageProviderOption {
+	return func(p *Provider) {
+		p.askPublisher = publisher
+	}
+}
+
+// Denylist rejects deal proposals whose payload root or piece CID is on the
+// denylist. The caller starts and stops the denylist, so that it can be
+// shared with a retrieval provider.
+func Denylist(dl *denylist.Denylist) StorageProviderOption {
+	return func(p *Provider) {
+		p.denylist = dl
+	}
+}
+
 // NewProvider returns a new storage provider
 func NewProvider(net network.StorageMarketNetwork,
 	ds datastore.Batching,
@@ -164,6 +209,11 @@ func NewProvider(net network.StorageMarketNetwork,
 		indexProvider:               indexer,
 		metadataForDeal:             defaultMetadataFunc,
 	}
+	var err error
+	h.drainer, err = drain.NewDrainer(namespace.Wrap(ds, datastore.NewKey("drain")), h.dealsInFlight, 0)
+	if err != nil {
+		return nil, err
+	}
 	storageMigrations, err := migrations.ProviderMigrations.Build()
 	if err != nil {
 		return nil, err
@@ -179,6 +229,10 @@ func NewProvider(net network.StorageMarketNetwork,
 		return nil, err
 	}
 	h.Configure(options...)
+	if h.archive != nil {
+		h.retention = retention.NewManager(h.archive, h.deals, h.retentionDeals, h.retentionPolicy)
+		h.deals = h.archive.Group(h.deals)
+	}
 
 	// register a data transfer event handler -- this will send events to the state machines based on DT events
 	h.unsubDataTransfer = dataTransfer.SubscribeToEvents(dtutils.ProviderDataTransferSubscriber(h.deals))
@@ -201,7 +255,11 @@ func NewProvider(net network.StorageMarketNetwork,
 // It also registers the provider with a StorageMarketNetwork so it can receive incoming
 // messages on the storage market's libp2p protocols
 func (p *Provider) Start(ctx context.Context) error {
-	err := p.net.SetDelegate(p)
+	var receiver network.StorageReceiver = p
+	if p.dealChecks != nil {
+		receiver = &dealCheckReceiver{p}
+	}
+	err := p.net.SetDelegate(receiver)
 	if err != nil {
 		return err
 	}
@@ -343,6 +401,9 @@ func (p *Provider) receiveDeal(s network.StorageDealStream) error {
 func (p *Provider) Stop() error {
 	p.readyMgr.Stop()
 	p.unsubDataTransfer()
+	if p.retention != nil {
+		p.retention.Stop()
+	}
 	err := p.deals.Stop(context.TODO())
 	if err != nil {
 		return err
@@ -550,7 +611,26 @@ func (p *Provider) ListLocalDealsPage(startPropCid *cid.Cid, offset int, limit i
 // SetAsk configures the storage miner's ask with the provided price,
 // duration, and options. Any previously-existing ask is replaced.
 func (p *Provider) SetAsk(price abi.TokenAmount, verifiedPrice abi.TokenAmount, duration abi.ChainEpoch, options ...storagemarket.StorageAskOption) error {
-	return p.storedAsk.SetAsk(price, verifiedPrice, duration, options...)
+	if err := p.storedAsk.SetAsk(price, verifiedPrice, duration, options...); err != nil {
+		return err
+	}
+	p.publishAsk(context.TODO())
+	return nil
+}
+
+// publishAsk gossips the current storage ask, if the provider has an ask
+// publisher
+func (p *Provider) publishAsk(ctx context.Context) {
+	if p.askPublisher == nil {
+		return
+	}
+	ask := p.storedAsk.GetAsk()
+	if ask == nil {
+		return
+	}
+	if err := p.askPublisher.SetStorageAsk(ctx, ask); err != nil {
+		log.Warnf("publishing storage ask: %s", err)
+	}
 }
 
 // AnnounceDealToIndexer informs indexer nodes that a new deal was received,
@@ -676,6 +756,11 @@ The connection is kept open only as long as the request-response exchange.
 func (p *Provider) HandleDealStatusStream(s network.DealStatusStream) {
 	ctx := context.TODO()
 	defer s.Close()
+	if bs, ok := s.(network.BatchDealStatusStream); ok {
+		p.handleBatchDealStatusStream(ctx, bs)
+		return
+	}
+
 	request, err := s.ReadDealStatusRequest()
 	if err != nil {
 		log.Errorf("failed to read DealStatusRequest from incoming stream: %s", err)
@@ -708,15 +793,117 @@ func (p *Provider) HandleDealStatusStream(s network.DealStatusStream) {
 	}
 }
 
-func (p *Provider) processDealStatusRequest(ctx context.Context, request *network.DealStatusRequest) (*storagemarket.ProviderDealState, error) {
-	// fetch deal state
-	var md = storagemarket.MinerDeal{}
+// handleBatchDealStatusStream responds to a request for the status of many
+// deals, with a signed deal state for each of them
+func (p *Provider) handleBatchDealStatusStream(ctx context.Context, s network.BatchDealStatusStream) {
+	request, err := s.ReadBatchDealStatusRequest()
+	if err != nil {
+		log.Errorf("failed to read BatchDealStatusRequest from incoming stream: %s", err)
+		return
+	}
+
+	dealStates := p.processBatchDealStatusRequest(ctx, &request)
+	response := network.BatchDealStatusResponse{
+		DealStates: make([]network.DealStatusResponse, 0, len(dealStates)),
+	}
+	for _, dealState := range dealStates {
+		signature, err := p.sign(ctx, dealState)
+		if err != nil {
+			log.Errorf("failed to sign deal status response: %s", err)
+			return
+		}
+		response.DealStates = append(response.DealStates, network.DealStatusResponse{
+			DealState: *dealState,
+			Signature: *signature,
+		})
+	}
+
+	if err := s.WriteBatchDealStatusResponse(response, p.sign); err != nil {
+		log.Warnf("failed to write batch deal status response: %s", err)
+		return
+	}
+}
+
+/*
+HandleDealCancelStream is called by the network implementation whenever a client asks to cancel
+a deal.
+
+The Provider verifies that the request is signed by the deal's client, and cancels the deal if
+it has not started to publish it. The deal then fails, which cleans up its staging files and
+releases the funds reserved for it.
+*/
+func (p *Provider) HandleDealCancelStream(s network.DealCancelStream) {
+	ctx := context.TODO()
+	defer s.Close()
+	request, err := s.ReadDealCancelRequest()
+	if err != nil {
+		log.Errorf("failed to read DealCancelRequest from incoming stream: %s", err)
+		return
+	}
+
+	response := network.DealCancelResponse{Cancelled: true}
+	state, err := p.processDealCancelRequest(ctx, &request)
+	response.State = state
+	if err != nil {
+		log.Errorf("failed to process deal cancel request: %s", err)
+		response.Cancelled = false
+		response.Message = err.Error()
+	}
+
+	if err := s.WriteDealCancelResponse(response); err != nil {
+		log.Warnf("failed to write deal cancel response: %s", err)
+		return
+	}
+}
+
+// processDealCancelRequest cancels the deal in the request, and returns the
+// state of the deal
+func (p *Provider) processDealCancelRequest(ctx context.Context, request *network.DealCancelRequest) (storagemarket.StorageDealStatus, error) {
+	buf, err := request.SigningBytes()
+	if err != nil {
+		log.Errorf("failed to serialize cancel request: %s", err)
+		return storagemarket.StorageDealUnknown, xerrors.Errorf("internal error")
+	}
+
+	tok, _, err := p.spn.GetChainHead(ctx)
+	if err != nil {
+		log.Errorf("failed to get chain head: %s", err)
+		return storagemarket.StorageDealUnknown, xerrors.Errorf("internal error")
+	}
+
+	var md storagemarket.MinerDeal
 	if err := p.deals.Get(request.Proposal).Get(&md); err != nil {
 		log.Errorf("proposal doesn't exist in state store: %s", err)
-		return nil, xerrors.Errorf("no such proposal")
+		return storagemarket.StorageDealUnknown, xerrors.Errorf("no such proposal")
 	}
 
-	// verify query signature
+	if err := providerutils.VerifySignature(ctx, request.Signature, md.Proposal.Client, buf, tok, p.spn.VerifySignature); err != nil {
+		log.Errorf("invalid deal cancel request signature: %s", err)
+		return md.State, xerrors.Errorf("invalid signature")
+	}
+
+	if !providerCanCancel(md.State) {
+		return md.State, xerrors.Errorf("deal in state %s can no longer be cancelled", storagemarket.DealStates[md.State])
+	}
+
+	// the deal may have moved on since it was read, in which case the state
+	// machine refuses the event
+	if err := p.deals.SendSync(ctx, request.Proposal, storagemarket.ProviderEventClientCancelled); err != nil {
+		return md.State, xerrors.Errorf("cancelling deal: %w", err)
+	}
+	return storagemarket.StorageDealFailing, nil
+}
+
+func providerCanCancel(state storagemarket.StorageDealStatus) bool {
+	for _, s := range providerstates.ProviderCancellableStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Provider) processDealStatusRequest(ctx context.Context, request *network.DealStatusRequest) (*storagemarket.ProviderDealState, error) {
 	buf, err := cborutil.Dump(&request.Proposal)
 	if err != nil {
 		log.Errorf("failed to serialize status request: %s", err)
@@ -729,8 +916,81 @@ func (p *Provider) processDealStatusRequest(ctx context.Context, request *networ
 		return nil, xerrors.Errorf("internal error")
 	}
 
-	err = providerutils.VerifySignature(ctx, request.Signature, md.ClientDealProposal.Proposal.Client, buf, tok, p.spn.VerifySignature)
+	return p.dealStatus(request.Proposal, func(client address.Address) error {
+		return providerutils.VerifySignature(ctx, request.Signature, client, buf, tok, p.spn.VerifySignature)
+	})
+}
+
+// processBatchDealStatusRequest returns the state of each deal in the
+// request, or an error state for the deals that could not be queried
+func (p *Provider) processBatchDealStatusRequest(ctx context.Context, request *network.BatchDealStatusRequest) []*storagemarket.ProviderDealState {
+	buf, err := request.SigningBytes()
 	if err != nil {
+		log.Errorf("failed to serialize status request: %s", err)
+		return batchDealStatusErrors(request.Proposals, xerrors.Errorf("internal error"))
+	}
+
+	tok, _, err := p.spn.GetChainHead(ctx)
+	if err != nil {
+		log.Errorf("failed to get chain head: %s", err)
+		return batchDealStatusErrors(request.Proposals, xerrors.Errorf("internal error"))
+	}
+
+	// the deals in a batch normally all have the same client, so the
+	// signature is only verified once for each client
+	verified := make(map[address.Address]error)
+	verify := func(client address.Address) error {
+		verr, ok := verified[client]
+		if !ok {
+			verr = providerutils.VerifySignature(ctx, request.Signature, client, buf, tok, p.spn.VerifySignature)
+			verified[client] = verr
+		}
+		return verr
+	}
+
+	dealStates := make([]*storagemarket.ProviderDealState, 0, len(request.Proposals))
+	for _, proposal := range request.Proposals {
+		dealState, err := p.dealStatus(proposal, verify)
+		if err != nil {
+			log.Errorf("failed to process deal status request for %s: %s", proposal, err)
+			dealState = batchDealStatusError(proposal, err)
+		}
+		dealStates = append(dealStates, dealState)
+	}
+	return dealStates
+}
+
+// batchDealStatusError is the state returned for a deal in a batch that could
+// not be queried. It has the proposal CID so that the client can match it
+// with the deal.
+func batchDealStatusError(proposal cid.Cid, err error) *storagemarket.ProviderDealState {
+	return &storagemarket.ProviderDealState{
+		State:       storagemarket.StorageDealError,
+		Message:     err.Error(),
+		ProposalCid: &proposal,
+	}
+}
+
+func batchDealStatusErrors(proposals []cid.Cid, err error) []*storagemarket.ProviderDealState {
+	dealStates := make([]*storagemarket.ProviderDealState, 0, len(proposals))
+	for _, proposal := range proposals {
+		dealStates = append(dealStates, batchDealStatusError(proposal, err))
+	}
+	return dealStates
+}
+
+// dealStatus returns the state of a deal, if verify accepts the signature of
+// the request for the deal's client
+func (p *Provider) dealStatus(proposal cid.Cid, verify func(client address.Address) error) (*storagemarket.ProviderDealState, error) {
+	// fetch deal state
+	var md = storagemarket.MinerDeal{}
+	if err := p.deals.Get(proposal).Get(&md); err != nil {
+		log.Errorf("proposal doesn't exist in state store: %s", err)
+		return nil, xerrors.Errorf("no such proposal")
+	}
+
+	// verify query signature
+	if err := verify(md.ClientDealProposal.Proposal.Client); err != nil {
 		log.Errorf("invalid deal status request signature: %s", err)
 		return nil, xerrors.Errorf("internal error")
 	}
@@ -761,6 +1021,20 @@ func (p *Provider) SubscribeToEvents(subscriber storagemarket.ProviderSubscriber
 	return shared.Unsubscribe(p.pubSub.Subscribe(subscriber))
 }
 
+// SubscribeToDenylistHits subscribes to the deal proposals that the provider
+// refuses because their payload or piece is on its denylist
+func (p *Provider) SubscribeToDenylistHits(subscriber denylist.Subscriber) shared.Unsubscribe {
+	if p.denylist == nil {
+		return func() {}
+	}
+	// the denylist may be shared with a retrieval provider
+	return p.denylist.Subscribe(func(hit denylist.Hit) {
+		if hit.Source == denylist.SourceStorageProposal {
+			subscriber(hit)
+		}
+	})
+}
+
 // dispatch puts the fsm event into a form that pubSub can consume,
 // then publishes the event
 func (p *Provider) dispatch(eventName fsm.EventName, deal fsm.StateType) {
@@ -803,6 +1077,12 @@ func (p *Provider) start(ctx context.Context) (err error) {
 		return fmt.Errorf("failed to restart deals: %w", err)
 	}
 
+	if p.retention != nil {
+		p.retention.Start()
+	}
+
+	p.publishAsk(ctx)
+
 	// register indexer provider callback now that everything has booted up.
 	p.indexProvider.RegisterMultihashLister(func(ctx context.Context, pid peer.ID, contextID []byte) (provider.MultihashIterator, error) {
 		proposalCid, err := cid.Cast(contextID)
@@ -830,6 +1110,87 @@ func (p *Provider) start(ctx context.Context) (err error) {
 	return nil
 }
 
+// Pause stops the provider accepting new deals, so that it can be drained for
+// maintenance. Deals in progress carry on, and new proposals are rejected with
+// storagemarket.RejectionMaintenance. The provider stays paused if it is
+// restarted, until Resume is called.
+func (p *Provider) Pause() error {
+	return p.drainer.Pause()
+}
+
+// Resume lets the provider accept new deals again after Pause or Drain
+func (p *Provider) Resume() error {
+	return p.drainer.Resume()
+}
+
+// Paused returns true if the provider is not accepting new deals
+func (p *Provider) Paused() bool {
+	return p.drainer.Paused()
+}
+
+// DrainProgress returns the number of deals in flight in each state. A deal
+// is in flight until it has been handed off to the sealing subsystem or has
+// failed. Offline deals that are waiting for their data to be imported are not
+// counted, as they don't depend on a connection to the client.
+func (p *Provider) DrainProgress(ctx context.Context) (drain.Progress, error) {
+	return p.drainer.Progress(ctx)
+}
+
+// Drain pauses the provider and waits until it has no deals in flight, so
+// that it can be stopped without breaking any data transfers. onProgress, if
+// not nil, is called with the deals in flight each time they are counted.
+// If deals are still in flight when the context is done or after the timeout,
+// they are returned with an error. The provider stays paused until Resume is
+// called.
+func (p *Provider) Drain(ctx context.Context, timeout time.Duration, onProgress func(drain.Progress)) ([]drain.Deal, error) {
+	return p.drainer.Drain(ctx, timeout, onProgress)
+}
+
+func (p *Provider) dealsInFlight(ctx context.Context) ([]drain.Deal, error) {
+	var deals []storagemarket.MinerDeal
+	if err := p.deals.List(&deals); err != nil {
+		return nil, xerrors.Errorf("listing deals: %w", err)
+	}
+	var inFlight []drain.Deal
+	for _, deal := range deals {
+		if p.deals.IsTerminated(deal) || isHandedOff(deal.State) {
+			continue
+		}
+		if deal.State == storagemarket.StorageDealWaitingForData && deal.Ref != nil && deal.Ref.TransferType == storagemarket.TTManual {
+			continue
+		}
+		inFlight = append(inFlight, drain.Deal{ID: deal.ProposalCid.String(), State: storagemarket.DealStates[deal.State]})
+	}
+	return inFlight, nil
+}
+
+func isHandedOff(state storagemarket.StorageDealStatus) bool {
+	for _, s := range providerstates.StatesKnownBySealingSubsystem {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// retentionDeals lists the deals in the live deal store for the retention
+// manager
+func (p *Provider) retentionDeals() ([]retention.Deal, error) {
+	var deals []storagemarket.MinerDeal
+	if err := p.deals.List(&deals); err != nil {
+		return nil, err
+	}
+	out := make([]retention.Deal, 0, len(deals))
+	for i := range deals {
+		out = append(out, retention.Deal{
+			ID:       deals[i].ProposalCid,
+			Terminal: p.deals.IsTerminated(deals[i]),
+			State:    &deals[i],
+		})
+	}
+	return out, nil
+}
+
 func (p *Provider) runMigrations(ctx context.Context) ([]storagemarket.MinerDeal, error) {
 	// Perform datastore migration
 	err := p.migrateDeals(ctx)
@@ -0,0 +1,171 @@
+package storageimpl
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/filecoin-project/go-state-types/builtin/v9/market"
+
+	"github.com/filecoin-project/go-fil-markets/shared/drain"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/dealvalidation"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/network"
+)
+
+// DealChecks makes the provider answer clients that ask whether it would
+// accept a deal proposal, allowing each peer at most limit checks per
+// interval. Checks are not answered without this option, as each one costs
+// the provider chain queries and a run of its deal decision logic.
+func DealChecks(limit int, interval time.Duration) StorageProviderOption {
+	return func(p *Provider) {
+		p.dealChecks = newPeerRateLimiter(limit, interval)
+	}
+}
+
+// dealCheckReceiver is the receiver that the provider registers with the
+// network when deal checks are enabled
+type dealCheckReceiver struct {
+	*Provider
+}
+
+var _ network.DealCheckReceiver = (*dealCheckReceiver)(nil)
+
+/*
+HandleDealCheckStream is called by the network implementation whenever a client asks whether
+the provider would accept a deal proposal.
+
+The Provider validates the unsigned proposal the same way as a proposed deal, against its
+current ask, and runs its custom deal decision logic on it. No state is kept for the proposal,
+so a client can check a proposal before it signs it and prepares the deal data. A client that
+checks too many proposals is rejected until its rate limit allows it again.
+*/
+func (r *dealCheckReceiver) HandleDealCheckStream(s network.DealCheckStream) {
+	ctx := context.TODO()
+	defer s.Close()
+	request, err := s.ReadDealCheckRequest()
+	if err != nil {
+		log.Errorf("failed to read DealCheckRequest from incoming stream: %s", err)
+		return
+	}
+
+	var rerr *storagemarket.RejectionError
+	if !r.dealChecks.allow(s.RemotePeer(), time.Now()) {
+		rerr = storagemarket.NewRejectionError(storagemarket.RejectionRateLimited, "too many deal checks, try again later")
+	} else {
+		rerr = r.checkProposal(ctx, s.RemotePeer(), request)
+	}
+
+	response := network.DealCheckResponse{Accepted: true}
+	if rerr != nil {
+		response = network.DealCheckResponse{
+			Message:   rerr.Error(),
+			Rejection: &rerr.Rejection,
+		}
+	}
+
+	if err := s.WriteDealCheckResponse(response); err != nil {
+		log.Warnf("failed to write deal check response: %s", err)
+		return
+	}
+}
+
+// checkProposal returns the reason the provider would reject the proposal,
+// or nil if it would accept it
+func (p *Provider) checkProposal(ctx context.Context, client peer.ID, request network.DealCheckRequest) *storagemarket.RejectionError {
+	tok, curEpoch, err := p.spn.GetChainHead(ctx)
+	if err != nil {
+		return storagemarket.NewRejectionError(storagemarket.RejectionProviderError, "node error getting most recent state id: %w", err)
+	}
+
+	if p.drainer.Paused() {
+		return storagemarket.NewRejectionError(storagemarket.RejectionMaintenance, drain.MaintenanceMessage)
+	}
+
+	env := &providerDealEnvironment{p}
+	params := dealvalidation.Params{
+		Provider:    p.actor,
+		Ask:         env.Ask(),
+		TipSetToken: tok,
+		Epoch:       curEpoch,
+		GetDataCap:  p.spn.GetDataCap,
+		// the client adds funds for a deal after checking it
+		IgnoreClientBalance: true,
+	}
+	if rerr := dealvalidation.ValidateProposal(ctx, p.spn, params, request.Proposal); rerr != nil {
+		return rerr
+	}
+
+	deal := storagemarket.MinerDeal{
+		ClientDealProposal: market.ClientDealProposal{Proposal: request.Proposal},
+		Miner:              p.net.ID(),
+		Client:             client,
+		State:              storagemarket.StorageDealValidating,
+		FastRetrieval:      request.FastRetrieval,
+		Ref:                request.Piece,
+	}
+	if err := env.CheckDenylist(deal); err != nil {
+		return storagemarket.NewRejectionError(storagemarket.RejectionDenylisted, "content denied: %w", err)
+	}
+	accept, reason, err := env.RunCustomDecisionLogic(ctx, deal)
+	if err != nil {
+		return storagemarket.NewRejectionError(storagemarket.RejectionProviderError, "custom deal decision logic failed: %w", err)
+	}
+	if !accept {
+		return storagemarket.NewRejectionError(storagemarket.RejectionPolicyDenied, "%s", reason)
+	}
+	return nil
+}
+
+// peerRateLimiter allows each peer a number of requests in each interval
+type peerRateLimiter struct {
+	limit    int
+	interval time.Duration
+
+	lk        sync.Mutex
+	windows   map[peer.ID]*rateWindow
+	lastPrune time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newPeerRateLimiter(limit int, interval time.Duration) *peerRateLimiter {
+	return &peerRateLimiter{
+		limit:    limit,
+		interval: interval,
+		windows:  make(map[peer.ID]*rateWindow),
+	}
+}
+
+// allow returns true if the peer has made fewer than limit requests in the
+// current interval, and counts the request
+func (l *peerRateLimiter) allow(p peer.ID, now time.Time) bool {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	// forget the peers whose intervals are over
+	if now.Sub(l.lastPrune) >= l.interval {
+		for other, w := range l.windows {
+			if now.Sub(w.start) >= l.interval {
+				delete(l.windows, other)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	w, ok := l.windows[p]
+	if !ok || now.Sub(w.start) >= l.interval {
+		w = &rateWindow{start: now}
+		l.windows[p] = w
+	}
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	return true
+}
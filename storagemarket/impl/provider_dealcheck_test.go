@@ -0,0 +1,44 @@
+package storageimpl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/shared_testutil"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/network"
+)
+
+func TestPeerRateLimiter(t *testing.T) {
+	peers := shared_testutil.GeneratePeers(2)
+	l := newPeerRateLimiter(2, time.Minute)
+	now := time.Now()
+
+	require.True(t, l.allow(peers[0], now))
+	require.True(t, l.allow(peers[0], now.Add(time.Second)))
+	require.False(t, l.allow(peers[0], now.Add(2*time.Second)))
+	// each peer has its own limit
+	require.True(t, l.allow(peers[1], now.Add(2*time.Second)))
+
+	// the limit is reset once the interval is over, and peers that have
+	// stopped asking are forgotten
+	require.True(t, l.allow(peers[0], now.Add(time.Minute)))
+	require.Len(t, l.windows, 2)
+	require.True(t, l.allow(peers[0], now.Add(3*time.Minute)))
+	require.Len(t, l.windows, 1)
+}
+
+func TestDealChecksOption(t *testing.T) {
+	// without the option, the provider doesn't answer deal checks
+	var receiver network.StorageReceiver = &Provider{}
+	_, ok := receiver.(network.DealCheckReceiver)
+	require.False(t, ok)
+
+	p := &Provider{}
+	DealChecks(10, time.Minute)(p)
+	require.NotNil(t, p.dealChecks)
+	receiver = &dealCheckReceiver{p}
+	_, ok = receiver.(network.DealCheckReceiver)
+	require.True(t, ok)
+}
@@ -13,11 +13,13 @@ import (
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-address"
+	datatransfer "github.com/filecoin-project/go-data-transfer/v2"
 	"github.com/filecoin-project/go-state-types/abi"
 
 	"github.com/filecoin-project/go-fil-markets/commp"
 	"github.com/filecoin-project/go-fil-markets/filestore"
 	"github.com/filecoin-project/go-fil-markets/piecestore"
+	"github.com/filecoin-project/go-fil-markets/shared/denylist"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/providerstates"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/network"
@@ -91,6 +93,17 @@ func (p *providerDealEnvironment) TerminateBlockstore(proposalCid cid.Cid, path
 	return nil
 }
 
+func (p *providerDealEnvironment) CloseDataTransfer(ctx context.Context, chid datatransfer.ChannelID) error {
+	st, err := p.p.dataTransfer.ChannelState(ctx, chid)
+	if err != nil {
+		return xerrors.Errorf("getting state of data transfer channel: %w", err)
+	}
+	if st.Status().TransferComplete() {
+		return nil
+	}
+	return p.p.dataTransfer.CloseDataTransferChannel(ctx, chid)
+}
+
 func (p *providerDealEnvironment) Address() address.Address {
 	return p.p.actor
 }
@@ -174,6 +187,25 @@ func (p *providerDealEnvironment) Disconnect(proposalCid cid.Cid) error {
 	return p.p.conns.Disconnect(proposalCid)
 }
 
+func (p *providerDealEnvironment) Paused() bool {
+	return p.p.drainer.Paused()
+}
+
+func (p *providerDealEnvironment) CheckDenylist(deal storagemarket.MinerDeal) error {
+	if p.p.denylist == nil {
+		return nil
+	}
+	if deal.Ref != nil {
+		if err := p.p.denylist.Check(deal.Ref.Root, denylist.SourceStorageProposal, deal.Client); err != nil {
+			return xerrors.Errorf("payload: %w", err)
+		}
+	}
+	if err := p.p.denylist.Check(deal.Proposal.PieceCID, denylist.SourceStorageProposal, deal.Client); err != nil {
+		return xerrors.Errorf("piece: %w", err)
+	}
+	return nil
+}
+
 func (p *providerDealEnvironment) RunCustomDecisionLogic(ctx context.Context, deal storagemarket.MinerDeal) (bool, string, error) {
 	if p.p.customDealDeciderFunc == nil {
 		return true, "", nil
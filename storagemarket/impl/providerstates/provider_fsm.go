@@ -27,6 +27,11 @@ var ProviderEvents = fsm.Events{
 		FromMany(storagemarket.StorageDealValidating, storagemarket.StorageDealVerifyData, storagemarket.StorageDealAcceptWait).To(storagemarket.StorageDealRejecting).
 		Action(func(deal *storagemarket.MinerDeal, err error) error {
 			deal.Message = xerrors.Errorf("deal rejected: %w", err).Error()
+			deal.Rejection = &storagemarket.Rejection{Code: storagemarket.RejectionOther, Min: big.Zero(), Max: big.Zero(), Proposed: big.Zero()}
+			var rerr *storagemarket.RejectionError
+			if xerrors.As(err, &rerr) {
+				deal.Rejection = &rerr.Rejection
+			}
 			return nil
 		}),
 	fsm.Event(storagemarket.ProviderEventRejectionSent).
@@ -205,6 +210,13 @@ var ProviderEvents = fsm.Events{
 			return nil
 		}),
 
+	fsm.Event(storagemarket.ProviderEventClientCancelled).
+		FromMany(ProviderCancellableStates...).To(storagemarket.StorageDealFailing).
+		Action(func(deal *storagemarket.MinerDeal) error {
+			deal.Message = "deal cancelled by client"
+			return nil
+		}),
+
 	fsm.Event(storagemarket.ProviderEventFailed).From(storagemarket.StorageDealFailing).To(storagemarket.StorageDealError),
 
 	fsm.Event(storagemarket.ProviderEventRestart).
@@ -282,3 +294,16 @@ var StatesKnownBySealingSubsystem = []fsm.StateKey{
 	storagemarket.StorageDealFinalizing,
 	storagemarket.StorageDealActive,
 }
+
+// ProviderCancellableStates are the states in which a client can cancel a deal.
+// A deal can't be cancelled once the provider has started to publish it. Reserving
+// funds is left out, so that the funds are released when the deal fails.
+var ProviderCancellableStates = []fsm.StateKey{
+	storagemarket.StorageDealValidating,
+	storagemarket.StorageDealAcceptWait,
+	storagemarket.StorageDealWaitingForData,
+	storagemarket.StorageDealTransferring,
+	storagemarket.StorageDealProviderTransferAwaitRestart,
+	storagemarket.StorageDealVerifyData,
+	storagemarket.StorageDealProviderFunding,
+}
@@ -13,25 +13,25 @@ import (
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-address"
+	datatransfer "github.com/filecoin-project/go-data-transfer/v2"
 	"github.com/filecoin-project/go-state-types/abi"
-	"github.com/filecoin-project/go-state-types/big"
-	minertypes "github.com/filecoin-project/go-state-types/builtin/v8/miner"
-	"github.com/filecoin-project/go-state-types/builtin/v9/market"
 	"github.com/filecoin-project/go-state-types/exitcode"
 	"github.com/filecoin-project/go-statemachine/fsm"
 
 	"github.com/filecoin-project/go-fil-markets/filestore"
 	"github.com/filecoin-project/go-fil-markets/piecestore"
 	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/shared/drain"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/dealvalidation"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/providerutils"
 	"github.com/filecoin-project/go-fil-markets/storagemarket/network"
 )
 
 var log = logging.Logger("providerstates")
 
-// TODO: These are copied from spec-actors master, use spec-actors exports when we update
-const DealMaxLabelSize = 256
+// DealMaxLabelSize is the longest deal label a provider accepts, in bytes
+const DealMaxLabelSize = dealvalidation.DealMaxLabelSize
 
 // ProviderDealEnvironment are the dependencies needed for processing deals
 // with a ProviderStateEntryFunc
@@ -44,6 +44,9 @@ type ProviderDealEnvironment interface {
 
 	FinalizeBlockstore(proposalCid cid.Cid) error
 	TerminateBlockstore(proposalCid cid.Cid, path string) error
+	// CloseDataTransfer closes a data transfer channel, unless the transfer
+	// has already finished
+	CloseDataTransfer(ctx context.Context, chid datatransfer.ChannelID) error
 
 	GeneratePieceCommitment(proposalCid cid.Cid, path string, dealSize abi.PaddedPieceSize) (cid.Cid, filestore.Path, error)
 
@@ -55,6 +58,12 @@ type ProviderDealEnvironment interface {
 	FileStore() filestore.FileStore
 	PieceStore() piecestore.PieceStore
 	RunCustomDecisionLogic(context.Context, storagemarket.MinerDeal) (bool, string, error)
+	// Paused returns true if the provider is in maintenance mode and is not
+	// accepting new deals
+	Paused() bool
+	// CheckDenylist returns an error if the deal's payload or piece is on the
+	// provider's content denylist
+	CheckDenylist(deal storagemarket.MinerDeal) error
 	AwaitRestartTimeout() <-chan time.Time
 	network.PeerTagger
 }
@@ -66,117 +75,32 @@ type ProviderStateEntryFunc func(ctx fsm.Context, environment ProviderDealEnviro
 func ValidateDealProposal(ctx fsm.Context, environment ProviderDealEnvironment, deal storagemarket.MinerDeal) error {
 	environment.TagPeer(deal.Client, deal.ProposalCid.String())
 
-	tok, curEpoch, err := environment.Node().GetChainHead(ctx.Context())
-	if err != nil {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("node error getting most recent state id: %w", err))
-	}
-
-	if err := providerutils.VerifyProposal(ctx.Context(), deal.ClientDealProposal, tok, environment.Node().VerifySignature); err != nil {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("verifying StorageDealProposal: %w", err))
-	}
-
-	proposal := deal.Proposal
-
-	if proposal.Provider != environment.Address() {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("incorrect provider for deal"))
-	}
-
-	if proposal.Label.Length() > DealMaxLabelSize {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("deal label can be at most %d bytes, is %d", DealMaxLabelSize, proposal.Label.Length()))
-	}
-
-	if err := proposal.PieceSize.Validate(); err != nil {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("proposal piece size is invalid: %w", err))
+	if environment.Paused() {
+		return ctx.Trigger(storagemarket.ProviderEventDealRejected, storagemarket.NewRejectionError(storagemarket.RejectionMaintenance, drain.MaintenanceMessage))
 	}
 
-	if !proposal.PieceCID.Defined() {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("proposal PieceCID undefined"))
+	if err := environment.CheckDenylist(deal); err != nil {
+		return ctx.Trigger(storagemarket.ProviderEventDealRejected, storagemarket.NewRejectionError(storagemarket.RejectionDenylisted, "content denied: %w", err))
 	}
 
-	if proposal.PieceCID.Prefix() != market.PieceCIDPrefix {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("proposal PieceCID had wrong prefix"))
-	}
-
-	if proposal.EndEpoch <= proposal.StartEpoch {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("proposal end before proposal start"))
-	}
-
-	if curEpoch > proposal.StartEpoch {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("deal start epoch has already elapsed"))
-	}
-
-	// Check that the delta between the start and end epochs (the deal
-	// duration) is within acceptable bounds
-	minDuration, maxDuration := market.DealDurationBounds(proposal.PieceSize)
-	if proposal.Duration() < minDuration || proposal.Duration() > maxDuration {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("deal duration out of bounds (min, max, provided): %d, %d, %d", minDuration, maxDuration, proposal.Duration()))
-	}
-
-	// Check that the proposed end epoch isn't too far beyond the current epoch
-	maxEndEpoch := curEpoch + minertypes.MaxSectorExpirationExtension
-	if proposal.EndEpoch > maxEndEpoch {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("invalid deal end epoch %d: cannot be more than %d past current epoch %d", proposal.EndEpoch, minertypes.MaxSectorExpirationExtension, curEpoch))
-	}
-
-	pcMin, pcMax, err := environment.Node().DealProviderCollateralBounds(ctx.Context(), proposal.PieceSize, proposal.VerifiedDeal)
+	tok, curEpoch, err := environment.Node().GetChainHead(ctx.Context())
 	if err != nil {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("node error getting collateral bounds: %w", err))
+		return ctx.Trigger(storagemarket.ProviderEventDealRejected, storagemarket.NewRejectionError(storagemarket.RejectionProviderError, "node error getting most recent state id: %w", err))
 	}
 
-	if proposal.ProviderCollateral.LessThan(pcMin) {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("proposed provider collateral below minimum: %s < %s", proposal.ProviderCollateral, pcMin))
-	}
-
-	if proposal.ProviderCollateral.GreaterThan(pcMax) {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("proposed provider collateral above maximum: %s > %s", proposal.ProviderCollateral, pcMax))
-	}
-
-	askPrice := environment.Ask().Price
-	if deal.Proposal.VerifiedDeal {
-		askPrice = environment.Ask().VerifiedPrice
-	}
-
-	minPrice := big.Div(big.Mul(askPrice, abi.NewTokenAmount(int64(proposal.PieceSize))), abi.NewTokenAmount(1<<30))
-	if proposal.StoragePricePerEpoch.LessThan(minPrice) {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected,
-			xerrors.Errorf("storage price per epoch less than asking price: %s < %s", proposal.StoragePricePerEpoch, minPrice))
-	}
-
-	if proposal.PieceSize < environment.Ask().MinPieceSize {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected,
-			xerrors.Errorf("piece size less than minimum required size: %d < %d", proposal.PieceSize, environment.Ask().MinPieceSize))
-	}
-
-	if proposal.PieceSize > environment.Ask().MaxPieceSize {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected,
-			xerrors.Errorf("piece size more than maximum allowed size: %d > %d", proposal.PieceSize, environment.Ask().MaxPieceSize))
-	}
-
-	// check market funds
-	clientMarketBalance, err := environment.Node().GetBalance(ctx.Context(), proposal.Client, tok)
-	if err != nil {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("node error getting client market balance failed: %w", err))
+	if err := providerutils.VerifyProposal(ctx.Context(), deal.ClientDealProposal, tok, environment.Node().VerifySignature); err != nil {
+		return ctx.Trigger(storagemarket.ProviderEventDealRejected, storagemarket.NewRejectionError(storagemarket.RejectionInvalidProposal, "verifying StorageDealProposal: %w", err))
 	}
 
-	// This doesn't guarantee that the client won't withdraw / lock those funds
-	// but it's a decent first filter
-	if clientMarketBalance.Available.LessThan(proposal.ClientBalanceRequirement()) {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("clientMarketBalance.Available too small: %d < %d", clientMarketBalance.Available, proposal.ClientBalanceRequirement()))
+	params := dealvalidation.Params{
+		Provider:    environment.Address(),
+		Ask:         environment.Ask(),
+		TipSetToken: tok,
+		Epoch:       curEpoch,
+		GetDataCap:  environment.Node().GetDataCap,
 	}
-
-	// Verified deal checks
-	if proposal.VerifiedDeal {
-		dataCap, err := environment.Node().GetDataCap(ctx.Context(), proposal.Client, tok)
-		if err != nil {
-			return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("node error fetching verified data cap: %w", err))
-		}
-		if dataCap == nil {
-			return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("node error fetching verified data cap: data cap missing -- client not verified"))
-		}
-		pieceSize := big.NewIntUnsigned(uint64(proposal.PieceSize))
-		if dataCap.LessThan(pieceSize) {
-			return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("verified deal DataCap too small for proposed piece size"))
-		}
+	if rerr := dealvalidation.ValidateProposal(ctx.Context(), environment.Node(), params, deal.Proposal); rerr != nil {
+		return ctx.Trigger(storagemarket.ProviderEventDealRejected, rerr)
 	}
 
 	return ctx.Trigger(storagemarket.ProviderEventDealDeciding)
@@ -187,11 +111,11 @@ func ValidateDealProposal(ctx fsm.Context, environment ProviderDealEnvironment,
 func DecideOnProposal(ctx fsm.Context, environment ProviderDealEnvironment, deal storagemarket.MinerDeal) error {
 	accept, reason, err := environment.RunCustomDecisionLogic(ctx.Context(), deal)
 	if err != nil {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, xerrors.Errorf("custom deal decision logic failed: %w", err))
+		return ctx.Trigger(storagemarket.ProviderEventDealRejected, storagemarket.NewRejectionError(storagemarket.RejectionProviderError, "custom deal decision logic failed: %w", err))
 	}
 
 	if !accept {
-		return ctx.Trigger(storagemarket.ProviderEventDealRejected, fmt.Errorf(reason))
+		return ctx.Trigger(storagemarket.ProviderEventDealRejected, storagemarket.NewRejectionError(storagemarket.RejectionPolicyDenied, "%s", reason))
 	}
 
 	// Send intent to accept
@@ -578,9 +502,10 @@ func WaitForDealCompletion(ctx fsm.Context, environment ProviderDealEnvironment,
 // RejectDeal sends a failure response before terminating a deal
 func RejectDeal(ctx fsm.Context, environment ProviderDealEnvironment, deal storagemarket.MinerDeal) error {
 	err := environment.SendSignedResponse(ctx.Context(), &network.Response{
-		State:    storagemarket.StorageDealFailing,
-		Message:  deal.Message,
-		Proposal: deal.ProposalCid,
+		State:     storagemarket.StorageDealFailing,
+		Message:   deal.Message,
+		Proposal:  deal.ProposalCid,
+		Rejection: deal.Rejection,
 	})
 
 	if err != nil {
@@ -613,6 +538,13 @@ func FailDeal(ctx fsm.Context, environment ProviderDealEnvironment, deal storage
 		}
 	}
 
+	// stop the client sending any more data before the CAR file is deleted
+	if deal.TransferChannelId != nil {
+		if err := environment.CloseDataTransfer(ctx.Context(), *deal.TransferChannelId); err != nil {
+			log.Warnf("closing data transfer channel %s: %s", deal.TransferChannelId, err)
+		}
+	}
+
 	if deal.InboundCAR != "" {
 		if err := environment.FinalizeBlockstore(deal.ProposalCid); err != nil {
 			log.Warnf("error finalizing read-write store, car_path=%s: %s", deal.InboundCAR, err)
@@ -67,6 +67,26 @@ func TestValidateDealProposal(t *testing.T) {
 				require.Equal(t, deal.Client, env.peerTagger.TagCalls[0])
 			},
 		},
+		"provider is paused": {
+			environmentParams: environmentParams{
+				Paused: true,
+			},
+			dealInspector: func(t *testing.T, deal storagemarket.MinerDeal, env *fakeEnvironment) {
+				tut.AssertDealState(t, storagemarket.StorageDealRejecting, deal.State)
+				require.Equal(t, "deal rejected: provider is in maintenance mode and is not accepting new deals", deal.Message)
+				require.Equal(t, storagemarket.RejectionMaintenance, deal.Rejection.Code)
+			},
+		},
+		"content is denylisted": {
+			environmentParams: environmentParams{
+				DenylistError: errors.New("payload: content is denylisted"),
+			},
+			dealInspector: func(t *testing.T, deal storagemarket.MinerDeal, env *fakeEnvironment) {
+				tut.AssertDealState(t, storagemarket.StorageDealRejecting, deal.State)
+				require.Equal(t, "deal rejected: content denied: payload: content is denylisted", deal.Message)
+				require.Equal(t, storagemarket.RejectionDenylisted, deal.Rejection.Code)
+			},
+		},
 		"verify signature fails": {
 			nodeParams: nodeParams{
 				VerifySignatureFails: true,
@@ -83,6 +103,7 @@ func TestValidateDealProposal(t *testing.T) {
 			dealInspector: func(t *testing.T, deal storagemarket.MinerDeal, env *fakeEnvironment) {
 				tut.AssertDealState(t, storagemarket.StorageDealRejecting, deal.State)
 				require.Equal(t, "deal rejected: incorrect provider for deal", deal.Message)
+				require.EqualValues(t, storagemarket.RejectionWrongProvider, deal.Rejection.Code)
 			},
 		},
 		"MostRecentStateID errors": {
@@ -101,6 +122,9 @@ func TestValidateDealProposal(t *testing.T) {
 			dealInspector: func(t *testing.T, deal storagemarket.MinerDeal, env *fakeEnvironment) {
 				tut.AssertDealState(t, storagemarket.StorageDealRejecting, deal.State)
 				require.Equal(t, "deal rejected: storage price per epoch less than asking price: 5000 < 9765", deal.Message)
+				require.EqualValues(t, storagemarket.RejectionPriceTooLow, deal.Rejection.Code)
+				require.Equal(t, abi.NewTokenAmount(9765), deal.Rejection.Min)
+				require.Equal(t, abi.NewTokenAmount(5000), deal.Rejection.Proposed)
 			},
 		},
 		"PieceSize < MinPieceSize": {
@@ -110,6 +134,9 @@ func TestValidateDealProposal(t *testing.T) {
 			dealInspector: func(t *testing.T, deal storagemarket.MinerDeal, env *fakeEnvironment) {
 				tut.AssertDealState(t, storagemarket.StorageDealRejecting, deal.State)
 				require.Equal(t, "deal rejected: piece size less than minimum required size: 128 < 256", deal.Message)
+				require.EqualValues(t, storagemarket.RejectionPieceTooSmall, deal.Rejection.Code)
+				require.Equal(t, big.NewInt(256), deal.Rejection.Min)
+				require.Equal(t, big.NewInt(128), deal.Rejection.Proposed)
 			},
 		},
 		"Get balance error": {
@@ -119,6 +146,7 @@ func TestValidateDealProposal(t *testing.T) {
 			dealInspector: func(t *testing.T, deal storagemarket.MinerDeal, env *fakeEnvironment) {
 				tut.AssertDealState(t, storagemarket.StorageDealRejecting, deal.State)
 				require.Equal(t, "deal rejected: node error getting client market balance failed: could not get balance", deal.Message)
+				require.EqualValues(t, storagemarket.RejectionProviderError, deal.Rejection.Code)
 			},
 		},
 		"Not enough funds": {
@@ -297,6 +325,7 @@ func TestDecideOnProposal(t *testing.T) {
 			dealInspector: func(t *testing.T, deal storagemarket.MinerDeal, env *fakeEnvironment) {
 				tut.AssertDealState(t, storagemarket.StorageDealRejecting, deal.State)
 				require.Equal(t, "deal rejected: I just don't like it", deal.Message)
+				require.EqualValues(t, storagemarket.RejectionPolicyDenied, deal.Rejection.Code)
 			},
 		},
 		"Custom Decision Errors": {
@@ -1123,6 +1152,16 @@ func TestFailDeal(t *testing.T) {
 				assert.True(t, deal.FundsReserved.Nil() || deal.FundsReserved.IsZero())
 			},
 		},
+		"succeeds, transfer closed before the CAR file is deleted": {
+			dealParams: dealParams{
+				TransferChannelId: &datatransfer.ChannelID{Initiator: "initiator", Responder: "responder", ID: 1},
+				InboundCAR:        "inbound.car",
+			},
+			dealInspector: func(t *testing.T, deal storagemarket.MinerDeal, env *fakeEnvironment) {
+				tut.AssertDealState(t, storagemarket.StorageDealError, deal.State)
+				require.Equal(t, []string{"CloseDataTransfer", "TerminateBlockstore"}, env.cleanupCalls)
+			},
+		},
 		"succeeds, file deletions": {
 			dealParams: dealParams{
 				PiecePath:    defaultPath,
@@ -1280,6 +1319,7 @@ type dealParams struct {
 	VerifiedDeal         bool
 	ReserveFunds         bool
 	TransferChannelId    *datatransfer.ChannelID
+	InboundCAR           string
 	Label                market.DealLabel
 }
 
@@ -1301,6 +1341,8 @@ type environmentParams struct {
 	RestartDataTransferError error
 	AwaitRestartTimeout      chan time.Time
 	FinalizeBlockstoreError  error
+	Paused                   bool
+	DenylistError            error
 
 	Carv2Reader *carv2.Reader
 	Carv2Error  error
@@ -1449,6 +1491,9 @@ func makeExecutor(ctx context.Context,
 		if dealParams.TransferChannelId != nil {
 			dealState.TransferChannelId = dealParams.TransferChannelId
 		}
+		if dealParams.InboundCAR != "" {
+			dealState.InboundCAR = dealParams.InboundCAR
+		}
 
 		fs := tut.NewTestFileStore(fileStoreParams)
 		pieceStore := tut.NewTestPieceStoreWithParams(pieceStoreParams)
@@ -1473,6 +1518,8 @@ func makeExecutor(ctx context.Context,
 			rejectDeal:              params.RejectDeal,
 			rejectReason:            params.RejectReason,
 			decisionError:           params.DecisionError,
+			paused:                  params.Paused,
+			denylistError:           params.DenylistError,
 			fs:                      fs,
 			pieceStore:              pieceStore,
 			peerTagger:              tut.NewTestPeerTagger(),
@@ -1541,6 +1588,8 @@ type fakeEnvironment struct {
 	rejectDeal              bool
 	rejectReason            string
 	decisionError           error
+	paused                  bool
+	denylistError           error
 	fs                      filestore.FileStore
 	pieceStore              piecestore.PieceStore
 	expectedTags            map[string]struct{}
@@ -1548,6 +1597,8 @@ type fakeEnvironment struct {
 	peerTagger              *tut.TestPeerTagger
 
 	finalizeBlockstoreErr error
+	// cleanupCalls records the order that FailDeal cleans up a deal in
+	cleanupCalls []string
 
 	restartDataTransferCalls []restartDataTransferCall
 	restartDataTransferError error
@@ -1604,6 +1655,14 @@ func (fe *fakeEnvironment) RunCustomDecisionLogic(context.Context, storagemarket
 	return !fe.rejectDeal, fe.rejectReason, fe.decisionError
 }
 
+func (fe *fakeEnvironment) Paused() bool {
+	return fe.paused
+}
+
+func (fe *fakeEnvironment) CheckDenylist(storagemarket.MinerDeal) error {
+	return fe.denylistError
+}
+
 func (fe *fakeEnvironment) TagPeer(id peer.ID, s string) {
 	fe.peerTagger.TagPeer(id, s)
 }
@@ -1617,6 +1676,12 @@ func (fe *fakeEnvironment) RegisterShard(ctx context.Context, pieceCid cid.Cid,
 }
 
 func (fe *fakeEnvironment) TerminateBlockstore(proposalCid cid.Cid, carFilePath string) error {
+	fe.cleanupCalls = append(fe.cleanupCalls, "TerminateBlockstore")
+	return nil
+}
+
+func (fe *fakeEnvironment) CloseDataTransfer(_ context.Context, chid datatransfer.ChannelID) error {
+	fe.cleanupCalls = append(fe.cleanupCalls, "CloseDataTransfer")
 	return nil
 }
 
@@ -0,0 +1,602 @@
+// Package imports manages the data that a storage client imports to make
+// storage deals with.
+//
+// A Store imports files and CARs into CARv2 files keyed by payload root, and
+// is the storagemarket.BlockstoreAccessor that the client reads them through.
+// Once the Store is started with the client, it tracks the state of the
+// client's deals for each import from the client's events, and removes an
+// import after every deal for its root is active or has failed, as the import
+// is no longer needed by then.
+package imports
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ipfs/boxo/blockservice"
+	bstore "github.com/ipfs/boxo/blockstore"
+	chunk "github.com/ipfs/boxo/chunker"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	files "github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	ihelper "github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-cidutil"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log/v2"
+	carv2 "github.com/ipld/go-car/v2"
+	mh "github.com/multiformats/go-multihash"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/stores"
+)
+
+var log = logging.Logger("storagemarket_imports")
+
+const (
+	// unixfsChunkSize is the size of the chunks that imported files are
+	// split into
+	unixfsChunkSize = 1 << 20
+	// unixfsLinksPerLevel is the most links in a node of an imported file
+	unixfsLinksPerLevel = 1024
+	// unixfsHashFunction is the hash function of the blocks of an imported
+	// file
+	unixfsHashFunction = mh.BLAKE2B_MIN + 31
+	// inlineLimit is the largest block that is inlined in an identity CID
+	inlineLimit = 126
+)
+
+// finishedStates are the states of a client deal that no longer needs its
+// import
+var finishedStates = map[storagemarket.StorageDealStatus]struct{}{
+	storagemarket.StorageDealActive:  {},
+	storagemarket.StorageDealExpired: {},
+	storagemarket.StorageDealSlashed: {},
+	storagemarket.StorageDealError:   {},
+}
+
+// Store imports data for storage deals into CARv2 files in a directory, and
+// keeps a record of each import in a datastore
+type Store struct {
+	dir string
+	ds  datastore.Batching
+
+	lk   sync.Mutex
+	open map[cid.Cid]stores.ClosableBlockstore
+	// deals are the states of the client's deals for each payload root
+	deals map[cid.Cid]map[cid.Cid]storagemarket.StorageDealStatus
+
+	unsubscribe shared.Unsubscribe
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+var _ storagemarket.BlockstoreAccessor = (*Store)(nil)
+
+// NewStore returns a Store that keeps imports in dir, and records them in ds
+func NewStore(dir string, ds datastore.Batching) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, xerrors.Errorf("creating import directory: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Store{
+		dir:    dir,
+		ds:     ds,
+		open:   make(map[cid.Cid]stores.ClosableBlockstore),
+		deals:  make(map[cid.Cid]map[cid.Cid]storagemarket.StorageDealStatus),
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// Start begins tracking the deals of the client that reference imports, and
+// removes the imports that are no longer needed by any deal
+func (s *Store) Start(ctx context.Context, client storagemarket.StorageClient) error {
+	s.unsubscribe = client.SubscribeToEvents(s.onDealEvent)
+
+	deals, err := client.ListLocalDeals(ctx)
+	if err != nil {
+		return xerrors.Errorf("listing client deals: %w", err)
+	}
+	s.lk.Lock()
+	for _, deal := range deals {
+		if deal.DataRef == nil {
+			continue
+		}
+		// an event that arrived while listing is newer than the listed state
+		if _, ok := s.deals[deal.DataRef.Root][deal.ProposalCid]; !ok {
+			s.track(deal)
+		}
+	}
+	s.lk.Unlock()
+
+	removed, err := s.Collect(ctx)
+	if err != nil {
+		return xerrors.Errorf("removing unused imports: %w", err)
+	}
+	if len(removed) > 0 {
+		log.Infow("removed unused imports", "count", len(removed))
+	}
+	return nil
+}
+
+// Stop stops tracking deals and closes the blockstores of the imports
+func (s *Store) Stop() error {
+	s.cancel()
+	if s.unsubscribe != nil {
+		s.unsubscribe()
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	var firstErr error
+	for root, bs := range s.open {
+		if err := bs.Close(); err != nil && firstErr == nil {
+			firstErr = xerrors.Errorf("closing blockstore of import %s: %w", root, err)
+		}
+		delete(s.open, root)
+	}
+	return firstErr
+}
+
+// ImportFile imports the file at path as a UnixFS DAG, and returns its root.
+// The CARv2 file of the import refers to the data in the file instead of
+// copying it, so the file must not change until its deals are done.
+func (s *Store) ImportFile(ctx context.Context, path string) (cid.Cid, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("resolving path %s: %w", path, err)
+	}
+
+	// the root is needed to create the CAR, so the DAG is built twice: once
+	// in memory to get the root, and once into the CAR
+	mem, err := stores.FilestoreOf(bstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore())))
+	if err != nil {
+		return cid.Undef, err
+	}
+	root, err := writeUnixFS(ctx, path, mem)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("importing %s: %w", path, err)
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if has, err := s.has(ctx, root); err != nil || has {
+		return root, err
+	}
+
+	carPath := s.carPath(root)
+	if err := os.Remove(carPath); err != nil && !os.IsNotExist(err) {
+		return cid.Undef, xerrors.Errorf("removing old import CAR: %w", err)
+	}
+	rw, err := stores.ReadWriteFilestore(carPath, root)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("creating import CAR: %w", err)
+	}
+	carRoot, err := writeUnixFS(ctx, path, rw)
+	if err != nil {
+		_ = rw.Close()
+		_ = os.Remove(carPath)
+		return cid.Undef, xerrors.Errorf("importing %s: %w", path, err)
+	}
+	if err := rw.Close(); err != nil {
+		_ = os.Remove(carPath)
+		return cid.Undef, xerrors.Errorf("finalizing import CAR: %w", err)
+	}
+	if carRoot != root {
+		_ = os.Remove(carPath)
+		return cid.Undef, xerrors.Errorf("%s changed while it was being imported", path)
+	}
+
+	return root, s.put(ctx, &Import{Root: root, Source: path, CarPath: carPath})
+}
+
+// ImportCAR imports a copy of the CARv1 or CARv2 file at path, which must
+// have a single root, and returns the root
+func (s *Store) ImportCAR(ctx context.Context, path string) (cid.Cid, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("resolving path %s: %w", path, err)
+	}
+
+	r, err := carv2.OpenReader(path)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("opening CAR %s: %w", path, err)
+	}
+	version := r.Version
+	roots, err := r.Roots()
+	_ = r.Close()
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("reading roots of CAR %s: %w", path, err)
+	}
+	if len(roots) != 1 {
+		return cid.Undef, xerrors.Errorf("CAR %s has %d roots, expected 1", path, len(roots))
+	}
+	root := roots[0]
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if has, err := s.has(ctx, root); err != nil || has {
+		return root, err
+	}
+
+	// copy to a temporary file first, so a failed copy doesn't leave a
+	// partial CAR
+	carPath := s.carPath(root)
+	tmp := carPath + ".tmp"
+	switch version {
+	case 1:
+		err = carv2.WrapV1File(path, tmp)
+	case 2:
+		err = copyFile(path, tmp)
+	default:
+		err = xerrors.Errorf("unsupported CAR version %d", version)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return cid.Undef, xerrors.Errorf("copying CAR %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, carPath); err != nil {
+		_ = os.Remove(tmp)
+		return cid.Undef, xerrors.Errorf("copying CAR %s: %w", path, err)
+	}
+
+	// check that the root block is in the CAR
+	bs, err := stores.ReadOnlyFilestore(carPath)
+	if err != nil {
+		_ = os.Remove(carPath)
+		return cid.Undef, xerrors.Errorf("opening imported CAR: %w", err)
+	}
+	has, err := bs.Has(ctx, root)
+	_ = bs.Close()
+	if err != nil {
+		_ = os.Remove(carPath)
+		return cid.Undef, xerrors.Errorf("looking up root block %s of CAR %s: %w", root, path, err)
+	}
+	if !has {
+		_ = os.Remove(carPath)
+		return cid.Undef, xerrors.Errorf("CAR %s does not have its root block %s", path, root)
+	}
+
+	return root, s.put(ctx, &Import{Root: root, Source: path, CarPath: carPath, FromCAR: true})
+}
+
+// List returns the imports in the store, with the deals that reference them
+func (s *Store) List(ctx context.Context) ([]ImportInfo, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	imports, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ImportInfo, 0, len(imports))
+	for _, imp := range imports {
+		info := ImportInfo{Import: imp}
+		for proposalCid := range s.deals[imp.Root] {
+			info.Deals = append(info.Deals, proposalCid)
+		}
+		sort.Slice(info.Deals, func(i, j int) bool {
+			return info.Deals[i].KeyString() < info.Deals[j].KeyString()
+		})
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Remove removes the import with the given root. It fails if a deal that has
+// not finished is using the import.
+func (s *Store) Remove(ctx context.Context, root cid.Cid) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	imp, err := s.get(ctx, root)
+	if err != nil {
+		return err
+	}
+	// a deal may open the import at any time until it finishes
+	if s.inUse(root) {
+		return xerrors.Errorf("import %s is being used by a deal", root)
+	}
+	return s.remove(ctx, imp)
+}
+
+// Collect removes every import that is referenced by deals, all of which are
+// active or have failed, and returns the roots of the removed imports
+func (s *Store) Collect(ctx context.Context) ([]cid.Cid, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	imports, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []cid.Cid
+	for i := range imports {
+		if !collectable(s.deals[imports[i].Root]) {
+			continue
+		}
+		if err := s.remove(ctx, &imports[i]); err != nil {
+			return removed, err
+		}
+		removed = append(removed, imports[i].Root)
+	}
+	return removed, nil
+}
+
+// Get returns the blockstore of the import with the given root
+func (s *Store) Get(root storagemarket.PayloadCID) (bstore.Blockstore, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if bs, ok := s.open[root]; ok {
+		return bs, nil
+	}
+
+	imp, err := s.get(s.ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := stores.ReadOnlyFilestore(imp.CarPath)
+	if err != nil {
+		return nil, xerrors.Errorf("opening import CAR: %w", err)
+	}
+	s.open[root] = bs
+	return bs, nil
+}
+
+// Done closes the blockstore of the import with the given root, unless
+// another deal is still using it
+func (s *Store) Done(root storagemarket.PayloadCID) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	bs, ok := s.open[root]
+	if !ok {
+		return nil
+	}
+	if s.inUse(root) {
+		return nil
+	}
+	delete(s.open, root)
+	if err := bs.Close(); err != nil {
+		return xerrors.Errorf("closing blockstore of import %s: %w", root, err)
+	}
+	return nil
+}
+
+// onDealEvent records the deal's new state, and removes the import of the
+// deal once the deal and the other deals for the same root are finished
+func (s *Store) onDealEvent(_ storagemarket.ClientEvent, deal storagemarket.ClientDeal) {
+	if deal.DataRef == nil {
+		return
+	}
+	root := deal.DataRef.Root
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	s.track(deal)
+	if _, ok := finishedStates[deal.State]; !ok {
+		return
+	}
+	imp, err := s.get(s.ctx, root)
+	if err != nil {
+		// the root was not imported into this store, or has been removed
+		return
+	}
+	if !collectable(s.deals[root]) {
+		return
+	}
+	if err := s.remove(s.ctx, imp); err != nil {
+		log.Errorf("removing import %s: %s", root, err)
+		return
+	}
+	log.Infow("removed import after its deals finished", "root", root)
+}
+
+// track records the state of a deal for its payload root. A deal that failed
+// and was re-proposed leaves the import to the new deal, which is tracked as
+// not finished until its own state is seen, as the old deal may finish first.
+func (s *Store) track(deal storagemarket.ClientDeal) {
+	root := deal.DataRef.Root
+	if s.deals[root] == nil {
+		s.deals[root] = make(map[cid.Cid]storagemarket.StorageDealStatus)
+	}
+	s.deals[root][deal.ProposalCid] = deal.State
+	if deal.ReproposedAs != nil {
+		if _, ok := s.deals[root][*deal.ReproposedAs]; !ok {
+			s.deals[root][*deal.ReproposedAs] = storagemarket.StorageDealUnknown
+		}
+	}
+}
+
+// collectable returns true if there are deals for an import and all of them
+// are finished
+func collectable(deals map[cid.Cid]storagemarket.StorageDealStatus) bool {
+	if len(deals) == 0 {
+		return false
+	}
+	for _, state := range deals {
+		if _, ok := finishedStates[state]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// inUse returns true if a deal that may still read the import with the given
+// root has not finished. A failing deal is cleaning up, and reads the import
+// again through Get if it is proposed again.
+func (s *Store) inUse(root cid.Cid) bool {
+	for _, state := range s.deals[root] {
+		if _, ok := finishedStates[state]; !ok && state != storagemarket.StorageDealFailing {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) remove(ctx context.Context, imp *Import) error {
+	if bs, ok := s.open[imp.Root]; ok {
+		delete(s.open, imp.Root)
+		if err := bs.Close(); err != nil {
+			log.Warnf("closing blockstore of import %s: %s", imp.Root, err)
+		}
+	}
+	if err := os.Remove(imp.CarPath); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("removing CAR of import %s: %w", imp.Root, err)
+	}
+	if err := s.ds.Delete(ctx, key(imp.Root)); err != nil {
+		return xerrors.Errorf("removing record of import %s: %w", imp.Root, err)
+	}
+	return nil
+}
+
+func (s *Store) has(ctx context.Context, root cid.Cid) (bool, error) {
+	has, err := s.ds.Has(ctx, key(root))
+	if err != nil {
+		return false, xerrors.Errorf("looking up import %s: %w", root, err)
+	}
+	return has, nil
+}
+
+func (s *Store) get(ctx context.Context, root cid.Cid) (*Import, error) {
+	data, err := s.ds.Get(ctx, key(root))
+	if err != nil {
+		if xerrors.Is(err, datastore.ErrNotFound) {
+			return nil, xerrors.Errorf("no import with root %s: %w", root, stores.ErrNotFound)
+		}
+		return nil, xerrors.Errorf("getting import %s: %w", root, err)
+	}
+	var imp Import
+	if err := imp.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+		return nil, xerrors.Errorf("decoding import %s: %w", root, err)
+	}
+	return &imp, nil
+}
+
+func (s *Store) put(ctx context.Context, imp *Import) error {
+	var buf bytes.Buffer
+	if err := imp.MarshalCBOR(&buf); err != nil {
+		return xerrors.Errorf("encoding import %s: %w", imp.Root, err)
+	}
+	if err := s.ds.Put(ctx, key(imp.Root), buf.Bytes()); err != nil {
+		return xerrors.Errorf("saving import %s: %w", imp.Root, err)
+	}
+	return nil
+}
+
+func (s *Store) list(ctx context.Context) ([]Import, error) {
+	results, err := s.ds.Query(ctx, query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("listing imports: %w", err)
+	}
+	defer results.Close() //nolint:errcheck
+
+	var imports []Import
+	for res := range results.Next() {
+		if res.Error != nil {
+			return nil, xerrors.Errorf("listing imports: %w", res.Error)
+		}
+		var imp Import
+		if err := imp.UnmarshalCBOR(bytes.NewReader(res.Value)); err != nil {
+			return nil, xerrors.Errorf("decoding import %s: %w", res.Key, err)
+		}
+		imports = append(imports, imp)
+	}
+	return imports, nil
+}
+
+func (s *Store) carPath(root cid.Cid) string {
+	return filepath.Join(s.dir, root.String()+".car")
+}
+
+func key(root cid.Cid) datastore.Key {
+	return datastore.NewKey(root.String())
+}
+
+// writeUnixFS imports the file at path as a UnixFS DAG into the blockstore,
+// referring to the data in the file if the blockstore is a filestore
+func writeUnixFS(ctx context.Context, path string, bs bstore.Blockstore) (cid.Cid, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return cid.Undef, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return cid.Undef, err
+	}
+	rpf, err := files.NewReaderPathFile(path, f, stat)
+	if err != nil {
+		_ = f.Close()
+		return cid.Undef, err
+	}
+	defer rpf.Close() //nolint:errcheck
+
+	prefix, err := merkledag.PrefixForCidVersion(1)
+	if err != nil {
+		return cid.Undef, err
+	}
+	prefix.MhType = unixfsHashFunction
+
+	dagService := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	bufferedDS := ipldformat.NewBufferedDAG(ctx, dagService)
+	params := ihelper.DagBuilderParams{
+		Maxlinks:  unixfsLinksPerLevel,
+		RawLeaves: true,
+		CidBuilder: cidutil.InlineBuilder{
+			Builder: prefix,
+			Limit:   inlineLimit,
+		},
+		Dagserv: bufferedDS,
+		NoCopy:  true,
+	}
+	db, err := params.New(chunk.NewSizeSplitter(rpf, unixfsChunkSize))
+	if err != nil {
+		return cid.Undef, err
+	}
+	nd, err := balanced.Layout(db)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err := bufferedDS.Commit(); err != nil {
+		return cid.Undef, err
+	}
+	return nd.Cid(), nil
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close() //nolint:errcheck
+
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
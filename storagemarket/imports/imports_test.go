@@ -0,0 +1,288 @@
+package imports
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/stores"
+)
+
+func TestImportFile(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+
+	path := writeFile(t, 3<<20)
+	root, err := s.ImportFile(ctx, path)
+	require.NoError(t, err)
+
+	// importing the same file again returns the existing import
+	again, err := s.ImportFile(ctx, path)
+	require.NoError(t, err)
+	require.Equal(t, root, again)
+
+	infos, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	require.Equal(t, root, infos[0].Root)
+	require.Equal(t, path, infos[0].Source)
+	require.False(t, infos[0].FromCAR)
+
+	bs, err := s.Get(root)
+	require.NoError(t, err)
+	has, err := bs.Has(ctx, root)
+	require.NoError(t, err)
+	require.True(t, has)
+	require.NoError(t, s.Done(root))
+
+	require.NoError(t, s.Remove(ctx, root))
+	_, err = s.Get(root)
+	require.True(t, stores.IsNotFound(err))
+	_, err = os.Stat(infos[0].CarPath)
+	require.True(t, os.IsNotExist(err))
+
+	// the imported file is left alone
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+}
+
+func TestImportCAR(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+
+	// an import's CAR can be imported into another store
+	root, err := s.ImportFile(ctx, writeFile(t, 1<<20))
+	require.NoError(t, err)
+	infos, err := s.List(ctx)
+	require.NoError(t, err)
+
+	other := newStore(t)
+	carRoot, err := other.ImportCAR(ctx, infos[0].CarPath)
+	require.NoError(t, err)
+	require.Equal(t, root, carRoot)
+
+	otherInfos, err := other.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, otherInfos, 1)
+	require.True(t, otherInfos[0].FromCAR)
+	require.NotEqual(t, infos[0].CarPath, otherInfos[0].CarPath)
+
+	bs, err := other.Get(root)
+	require.NoError(t, err)
+	has, err := bs.Has(ctx, root)
+	require.NoError(t, err)
+	require.True(t, has)
+	require.NoError(t, other.Done(root))
+
+	// a file that isn't a CAR can't be imported as one
+	_, err = other.ImportCAR(ctx, writeFile(t, 1024))
+	require.Error(t, err)
+}
+
+func TestCollect(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+
+	root, err := s.ImportFile(ctx, writeFile(t, 1<<20))
+	require.NoError(t, err)
+	unused, err := s.ImportFile(ctx, writeFile(t, 1<<20))
+	require.NoError(t, err)
+
+	proposals := generateCids(t, 2)
+	client := &fakeClient{}
+	client.setDeal(proposals[0], root, storagemarket.StorageDealTransferring)
+	client.setDeal(proposals[1], root, storagemarket.StorageDealTransferring)
+	require.NoError(t, s.Start(ctx, client))
+	defer s.Stop() //nolint:errcheck
+
+	// neither import is collected: one has deals in progress, and the other
+	// has no deals yet
+	infos, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	for _, info := range infos {
+		if info.Root == root {
+			require.ElementsMatch(t, proposals, info.Deals)
+		} else {
+			require.Equal(t, unused, info.Root)
+			require.Empty(t, info.Deals)
+		}
+	}
+
+	// the blockstore stays open while another deal is using it
+	_, err = s.Get(root)
+	require.NoError(t, err)
+	require.Error(t, s.Remove(ctx, root))
+	client.fire(proposals[0], root, storagemarket.StorageDealError)
+	require.NoError(t, s.Done(root))
+	_, ok := s.open[root]
+	require.True(t, ok)
+	infos, err = s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+
+	// once all the deals are finished the import is removed
+	client.fire(proposals[1], root, storagemarket.StorageDealActive)
+	infos, err = s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	require.Equal(t, unused, infos[0].Root)
+	_, ok = s.open[root]
+	require.False(t, ok)
+	_, err = s.Get(root)
+	require.True(t, stores.IsNotFound(err))
+}
+
+func TestRemoveInUse(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+
+	root, err := s.ImportFile(ctx, writeFile(t, 1<<20))
+	require.NoError(t, err)
+
+	proposal := generateCids(t, 1)[0]
+	client := &fakeClient{}
+	require.NoError(t, s.Start(ctx, client))
+	defer s.Stop() //nolint:errcheck
+
+	// a deal that has not opened the import yet still needs it
+	client.fire(proposal, root, storagemarket.StorageDealTransferring)
+	require.Error(t, s.Remove(ctx, root))
+
+	// a failing deal no longer reads it
+	client.fire(proposal, root, storagemarket.StorageDealFailing)
+	require.NoError(t, s.Remove(ctx, root))
+
+	// deals are tracked from the events rather than listed again
+	require.Equal(t, 1, client.listings)
+}
+
+func TestCollectReproposed(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+
+	root, err := s.ImportFile(ctx, writeFile(t, 1<<20))
+	require.NoError(t, err)
+
+	proposals := generateCids(t, 2)
+	client := &fakeClient{}
+	require.NoError(t, s.Start(ctx, client))
+	defer s.Stop() //nolint:errcheck
+
+	// the deal fails and is re-proposed, and its failure is seen before the
+	// re-proposal has opened
+	client.fire(proposals[0], root, storagemarket.StorageDealTransferring)
+	deal := client.setDeal(proposals[0], root, storagemarket.StorageDealError)
+	deal.ReproposedAs = &proposals[1]
+	client.fireDeal(deal)
+	_, err = s.Get(root)
+	require.NoError(t, err)
+	require.Error(t, s.Remove(ctx, root))
+	infos, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	require.ElementsMatch(t, proposals, infos[0].Deals)
+
+	// the import is removed once the re-proposal finishes
+	client.fire(proposals[1], root, storagemarket.StorageDealTransferring)
+	client.fire(proposals[1], root, storagemarket.StorageDealActive)
+	infos, err = s.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, infos)
+}
+
+func newStore(t *testing.T) *Store {
+	s, err := NewStore(t.TempDir(), dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, err)
+	return s
+}
+
+func writeFile(t *testing.T, size int64) string {
+	path := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.WriteFile(path, randomBytes(size), 0644))
+	return path
+}
+
+func randomBytes(n int64) []byte {
+	data := make([]byte, n)
+	rand.Read(data) //nolint:gosec
+	return data
+}
+
+func generateCids(t *testing.T, n int) []cid.Cid {
+	cids := make([]cid.Cid, 0, n)
+	for i := 0; i < n; i++ {
+		c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: mh.SHA2_256}.Sum(randomBytes(32))
+		require.NoError(t, err)
+		cids = append(cids, c)
+	}
+	return cids
+}
+
+type fakeClient struct {
+	storagemarket.StorageClient
+
+	lk          sync.Mutex
+	deals       map[cid.Cid]storagemarket.ClientDeal
+	subscribers []storagemarket.ClientSubscriber
+	listings    int
+}
+
+func (c *fakeClient) setDeal(proposalCid cid.Cid, root cid.Cid, state storagemarket.StorageDealStatus) storagemarket.ClientDeal {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if c.deals == nil {
+		c.deals = make(map[cid.Cid]storagemarket.ClientDeal)
+	}
+	deal := storagemarket.ClientDeal{
+		ProposalCid: proposalCid,
+		DataRef:     &storagemarket.DataRef{Root: root},
+		State:       state,
+	}
+	c.deals[proposalCid] = deal
+	return deal
+}
+
+// fire moves a deal to a new state and notifies the subscribers
+func (c *fakeClient) fire(proposalCid cid.Cid, root cid.Cid, state storagemarket.StorageDealStatus) {
+	c.fireDeal(c.setDeal(proposalCid, root, state))
+}
+
+// fireDeal notifies the subscribers of the deal's state
+func (c *fakeClient) fireDeal(deal storagemarket.ClientDeal) {
+	c.lk.Lock()
+	subscribers := c.subscribers
+	c.lk.Unlock()
+	for _, sub := range subscribers {
+		sub(storagemarket.ClientEventDealActivated, deal)
+	}
+}
+
+func (c *fakeClient) ListLocalDeals(context.Context) ([]storagemarket.ClientDeal, error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.listings++
+	deals := make([]storagemarket.ClientDeal, 0, len(c.deals))
+	for _, deal := range c.deals {
+		deals = append(deals, deal)
+	}
+	return deals, nil
+}
+
+func (c *fakeClient) SubscribeToEvents(subscriber storagemarket.ClientSubscriber) shared.Unsubscribe {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.subscribers = append(c.subscribers, subscriber)
+	return func() {}
+}
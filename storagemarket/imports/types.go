@@ -0,0 +1,28 @@
+package imports
+
+import (
+	"github.com/ipfs/go-cid"
+)
+
+//go:generate cbor-gen-for --map-encoding Import
+
+// Import is a payload that has been imported into the store for storage deals
+type Import struct {
+	// Root is the payload root of the import
+	Root cid.Cid
+	// Source is the path of the file or CAR that was imported
+	Source string
+	// CarPath is the path of the CARv2 file that holds the import. For an
+	// imported file, the CAR refers to the data in the source file instead of
+	// holding a copy of it.
+	CarPath string
+	// FromCAR is true if the import is a copy of a CAR
+	FromCAR bool
+}
+
+// ImportInfo is an import and the storage deals that reference it
+type ImportInfo struct {
+	Import
+	// Deals are the proposal CIDs of the client deals for the import's root
+	Deals []cid.Cid
+}
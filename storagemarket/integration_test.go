@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sync"
@@ -338,6 +339,92 @@ func TestMakeDealNonBlocking(t *testing.T) {
 	}, 1*time.Second, 100*time.Millisecond, "actual deal status is %s", storagemarket.DealStates[pd.State])
 }
 
+func TestCheckDeal(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	h := testharness.NewHarness(t, ctx, true, noOpDelay, noOpDelay, false)
+	h.SMState.Epoch = h.Epoch
+	shared_testutil.StartAndWaitForReady(ctx, t, h.Provider)
+	shared_testutil.StartAndWaitForReady(ctx, t, h.Client)
+
+	params := h.DealParams(&storagemarket.DataRef{TransferType: storagemarket.TTGraphsync, Root: h.PayloadCid}, false, false)
+	require.NoError(t, h.Client.ValidateStorageDeal(ctx, params))
+	require.NoError(t, h.Client.QueryStorageDeal(ctx, params))
+
+	// a deal that starts in the past is rejected by both checks
+	params.StartEpoch = h.Epoch - 1
+	var rerr *storagemarket.RejectionError
+	require.True(t, errors.As(h.Client.ValidateStorageDeal(ctx, params), &rerr))
+	assert.Equal(t, storagemarket.RejectionStartEpochElapsed, rerr.Rejection.Code)
+	rerr = nil
+	require.True(t, errors.As(h.Client.QueryStorageDeal(ctx, params), &rerr))
+	assert.Equal(t, storagemarket.RejectionStartEpochElapsed, rerr.Rejection.Code)
+
+	// neither check creates a deal
+	clientDeals, err := h.Client.ListLocalDeals(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, clientDeals)
+	providerDeals, err := h.Provider.ListLocalDeals()
+	require.NoError(t, err)
+	assert.Empty(t, providerDeals)
+}
+
+func TestCancelDeal(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	h := testharness.NewHarness(t, ctx, true, noOpDelay, noOpDelay, false)
+	shared_testutil.StartAndWaitForReady(ctx, t, h.Provider)
+	shared_testutil.StartAndWaitForReady(ctx, t, h.Client)
+
+	commP, size, err := clientutils.CommP(ctx, h.Data, &storagemarket.DataRef{
+		TransferType: storagemarket.TTGraphsync,
+		Root:         h.PayloadCid,
+	}, 2<<29)
+	require.NoError(t, err)
+
+	// an offline deal waits on the provider until its data is imported
+	dataRef := &storagemarket.DataRef{
+		TransferType: storagemarket.TTManual,
+		Root:         h.PayloadCid,
+		PieceCid:     &commP,
+		PieceSize:    size,
+	}
+	result := h.ProposeStorageDeal(t, dataRef, false, false)
+	proposalCid := result.ProposalCid
+
+	wg := sync.WaitGroup{}
+	h.WaitForClientEvent(&wg, storagemarket.ClientEventDataTransferComplete)
+	h.WaitForProviderEvent(&wg, storagemarket.ProviderEventDataRequested)
+	waitGroupWait(ctx, &wg)
+
+	h.WaitForClientEvent(&wg, storagemarket.ClientEventFailed)
+	h.WaitForProviderEvent(&wg, storagemarket.ProviderEventFailed)
+	require.NoError(t, h.Client.CancelDeal(ctx, proposalCid))
+	waitGroupWait(ctx, &wg)
+
+	// subscribers are notified of an event before the new state is saved
+	var cd storagemarket.ClientDeal
+	require.Eventually(t, func() bool {
+		cd, err = h.Client.GetLocalDeal(ctx, proposalCid)
+		require.NoError(t, err)
+		return cd.State == storagemarket.StorageDealError
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "deal cancelled by client", cd.Message)
+
+	var pd storagemarket.MinerDeal
+	require.Eventually(t, func() bool {
+		pd, err = h.Provider.GetLocalDeal(proposalCid)
+		require.NoError(t, err)
+		return pd.State == storagemarket.StorageDealError
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "deal cancelled by client", pd.Message)
+
+	// a deal that has failed can't be cancelled
+	require.Error(t, h.Client.CancelDeal(ctx, proposalCid))
+}
+
 // TestRestartOnlyProviderDataTransfer tests that when the provider is shut
 // down, the connection is broken and then the provider is restarted, the
 // data transfer will resume and the deal will complete successfully.
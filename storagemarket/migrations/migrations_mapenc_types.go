@@ -7,6 +7,7 @@ import (
 
 	datatransfer "github.com/filecoin-project/go-data-transfer/v2"
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
 	marketOld "github.com/filecoin-project/specs-actors/actors/builtin/market"
 
 	"github.com/filecoin-project/go-fil-markets/filestore"
@@ -18,7 +19,7 @@ import (
 // generate directive in a separate file. So we define CBOR map-encoded types
 // in this file
 
-//go:generate cbor-gen-for --map-encoding Proposal1 MinerDeal1
+//go:generate cbor-gen-for --map-encoding Proposal1 MinerDeal1 Response1 SignedResponse1
 
 // Proposal1 is version 1 of Proposal (used by deal proposal protocol v1.1.0)
 type Proposal1 struct {
@@ -53,3 +54,24 @@ type MinerDeal1 struct {
 
 	InboundCAR string
 }
+
+// Response1 is version 1 of Response (used by deal proposal protocols v1.1.0
+// and v1.1.1)
+type Response1 struct {
+	State storagemarket.StorageDealStatus
+
+	// DealProposalRejected
+	Message  string
+	Proposal cid.Cid
+
+	// StorageDealProposalAccepted
+	PublishMessage *cid.Cid
+}
+
+// SignedResponse1 is version 1 of SignedResponse (used by deal proposal
+// protocols v1.1.0 and v1.1.1)
+type SignedResponse1 struct {
+	Response Response1
+
+	Signature *crypto.Signature
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"bufio"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/xerrors"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+)
+
+// batchDealStatusStream is a stream on the batch version of the deal status
+// protocol. Only batch messages are sent on the wire, so a single request is
+// sent as a batch of one.
+type batchDealStatusStream struct {
+	p        peer.ID
+	host     host.Host
+	rw       network.MuxedStream
+	buffered *bufio.Reader
+}
+
+var _ BatchDealStatusStream = (*batchDealStatusStream)(nil)
+
+func (d *batchDealStatusStream) ReadDealStatusRequest() (DealStatusRequest, error) {
+	q, err := d.ReadBatchDealStatusRequest()
+	if err != nil {
+		return DealStatusRequestUndefined, err
+	}
+	if len(q.Proposals) != 1 {
+		return DealStatusRequestUndefined, xerrors.Errorf("expected a request for one deal, got %d", len(q.Proposals))
+	}
+	return DealStatusRequest{Proposal: q.Proposals[0], Signature: q.Signature}, nil
+}
+
+func (d *batchDealStatusStream) WriteDealStatusRequest(q DealStatusRequest) error {
+	return d.WriteBatchDealStatusRequest(BatchDealStatusRequest{
+		Proposals: []cid.Cid{q.Proposal},
+		Signature: q.Signature,
+	})
+}
+
+func (d *batchDealStatusStream) ReadDealStatusResponse() (DealStatusResponse, []byte, error) {
+	qr, origBytes, err := d.ReadBatchDealStatusResponse()
+	if err != nil {
+		return DealStatusResponseUndefined, nil, err
+	}
+	if len(qr.DealStates) != 1 {
+		return DealStatusResponseUndefined, nil, xerrors.Errorf("expected a response for one deal, got %d", len(qr.DealStates))
+	}
+	return qr.DealStates[0], origBytes[0], nil
+}
+
+func (d *batchDealStatusStream) WriteDealStatusResponse(qr DealStatusResponse, resign ResigningFunc) error {
+	return d.WriteBatchDealStatusResponse(BatchDealStatusResponse{DealStates: []DealStatusResponse{qr}}, resign)
+}
+
+func (d *batchDealStatusStream) ReadBatchDealStatusRequest() (BatchDealStatusRequest, error) {
+	var q BatchDealStatusRequest
+
+	if err := q.UnmarshalCBOR(d.buffered); err != nil {
+		log.Warn(err)
+		return BatchDealStatusRequestUndefined, err
+	}
+	return q, nil
+}
+
+func (d *batchDealStatusStream) WriteBatchDealStatusRequest(q BatchDealStatusRequest) error {
+	return cborutil.WriteCborRPC(d.rw, &q)
+}
+
+func (d *batchDealStatusStream) ReadBatchDealStatusResponse() (BatchDealStatusResponse, [][]byte, error) {
+	var qr BatchDealStatusResponse
+
+	if err := qr.UnmarshalCBOR(d.buffered); err != nil {
+		return BatchDealStatusResponseUndefined, nil, err
+	}
+
+	origBytes := make([][]byte, 0, len(qr.DealStates))
+	for i := range qr.DealStates {
+		b, err := cborutil.Dump(&qr.DealStates[i].DealState)
+		if err != nil {
+			return BatchDealStatusResponseUndefined, nil, err
+		}
+		origBytes = append(origBytes, b)
+	}
+	return qr, origBytes, nil
+}
+
+func (d *batchDealStatusStream) WriteBatchDealStatusResponse(qr BatchDealStatusResponse, _ ResigningFunc) error {
+	return cborutil.WriteCborRPC(d.rw, &qr)
+}
+
+func (d *batchDealStatusStream) Close() error {
+	return d.rw.Close()
+}
+
+func (d *batchDealStatusStream) RemotePeer() peer.ID {
+	return d.p
+}
@@ -0,0 +1,54 @@
+package network
+
+import (
+	"bufio"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+)
+
+type dealCancelStream struct {
+	p        peer.ID
+	rw       network.MuxedStream
+	buffered *bufio.Reader
+}
+
+var _ DealCancelStream = (*dealCancelStream)(nil)
+
+func (d *dealCancelStream) ReadDealCancelRequest() (DealCancelRequest, error) {
+	var q DealCancelRequest
+
+	if err := q.UnmarshalCBOR(d.buffered); err != nil {
+		log.Warn(err)
+		return DealCancelRequestUndefined, err
+	}
+	return q, nil
+}
+
+func (d *dealCancelStream) WriteDealCancelRequest(q DealCancelRequest) error {
+	return cborutil.WriteCborRPC(d.rw, &q)
+}
+
+func (d *dealCancelStream) ReadDealCancelResponse() (DealCancelResponse, error) {
+	var qr DealCancelResponse
+
+	if err := qr.UnmarshalCBOR(d.buffered); err != nil {
+		log.Warn(err)
+		return DealCancelResponseUndefined, err
+	}
+	return qr, nil
+}
+
+func (d *dealCancelStream) WriteDealCancelResponse(qr DealCancelResponse) error {
+	return cborutil.WriteCborRPC(d.rw, &qr)
+}
+
+func (d *dealCancelStream) RemotePeer() peer.ID {
+	return d.p
+}
+
+func (d *dealCancelStream) Close() error {
+	return d.rw.Close()
+}
@@ -0,0 +1,54 @@
+package network
+
+import (
+	"bufio"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+)
+
+type dealCheckStream struct {
+	p        peer.ID
+	rw       network.MuxedStream
+	buffered *bufio.Reader
+}
+
+var _ DealCheckStream = (*dealCheckStream)(nil)
+
+func (d *dealCheckStream) ReadDealCheckRequest() (DealCheckRequest, error) {
+	var q DealCheckRequest
+
+	if err := q.UnmarshalCBOR(d.buffered); err != nil {
+		log.Warn(err)
+		return DealCheckRequestUndefined, err
+	}
+	return q, nil
+}
+
+func (d *dealCheckStream) WriteDealCheckRequest(q DealCheckRequest) error {
+	return cborutil.WriteCborRPC(d.rw, &q)
+}
+
+func (d *dealCheckStream) ReadDealCheckResponse() (DealCheckResponse, error) {
+	var qr DealCheckResponse
+
+	if err := qr.UnmarshalCBOR(d.buffered); err != nil {
+		log.Warn(err)
+		return DealCheckResponseUndefined, err
+	}
+	return qr, nil
+}
+
+func (d *dealCheckStream) WriteDealCheckResponse(qr DealCheckResponse) error {
+	return cborutil.WriteCborRPC(d.rw, &qr)
+}
+
+func (d *dealCheckStream) RemotePeer() peer.ID {
+	return d.p
+}
+
+func (d *dealCheckStream) Close() error {
+	return d.rw.Close()
+}
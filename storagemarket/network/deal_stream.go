@@ -13,16 +13,16 @@ import (
 // TagPriority is the priority for deal streams -- they should generally be preserved above all else
 const TagPriority = 100
 
-type dealStreamv111 struct {
+type dealStreamv120 struct {
 	p        peer.ID
 	host     host.Host
 	rw       network.MuxedStream
 	buffered *bufio.Reader
 }
 
-var _ StorageDealStream = (*dealStreamv111)(nil)
+var _ StorageDealStream = (*dealStreamv120)(nil)
 
-func (d *dealStreamv111) ReadDealProposal() (Proposal, error) {
+func (d *dealStreamv120) ReadDealProposal() (Proposal, error) {
 	var ds Proposal
 
 	if err := ds.UnmarshalCBOR(d.buffered); err != nil {
@@ -33,11 +33,11 @@ func (d *dealStreamv111) ReadDealProposal() (Proposal, error) {
 	return ds, nil
 }
 
-func (d *dealStreamv111) WriteDealProposal(dp Proposal) error {
+func (d *dealStreamv120) WriteDealProposal(dp Proposal) error {
 	return cborutil.WriteCborRPC(d.rw, &dp)
 }
 
-func (d *dealStreamv111) ReadDealResponse() (SignedResponse, []byte, error) {
+func (d *dealStreamv120) ReadDealResponse() (SignedResponse, []byte, error) {
 	var dr SignedResponse
 
 	if err := dr.UnmarshalCBOR(d.buffered); err != nil {
@@ -50,14 +50,14 @@ func (d *dealStreamv111) ReadDealResponse() (SignedResponse, []byte, error) {
 	return dr, origBytes, nil
 }
 
-func (d *dealStreamv111) WriteDealResponse(dr SignedResponse, _ ResigningFunc) error {
+func (d *dealStreamv120) WriteDealResponse(dr SignedResponse, _ ResigningFunc) error {
 	return cborutil.WriteCborRPC(d.rw, &dr)
 }
 
-func (d *dealStreamv111) Close() error {
+func (d *dealStreamv120) Close() error {
 	return d.rw.Close()
 }
 
-func (d *dealStreamv111) RemotePeer() peer.ID {
+func (d *dealStreamv120) RemotePeer() peer.ID {
 	return d.p
 }
@@ -69,20 +69,11 @@ func (d *dealStreamv110) WriteDealProposal(dp Proposal) error {
 }
 
 func (d *dealStreamv110) ReadDealResponse() (SignedResponse, []byte, error) {
-	var dr SignedResponse
-
-	if err := dr.UnmarshalCBOR(d.buffered); err != nil {
-		return SignedResponseUndefined, nil, err
-	}
-	origBytes, err := cborutil.Dump(&dr.Response)
-	if err != nil {
-		return SignedResponseUndefined, nil, err
-	}
-	return dr, origBytes, nil
+	return readDealResponse1(d.buffered)
 }
 
-func (d *dealStreamv110) WriteDealResponse(dr SignedResponse, _ ResigningFunc) error {
-	return cborutil.WriteCborRPC(d.rw, &dr)
+func (d *dealStreamv110) WriteDealResponse(dr SignedResponse, resign ResigningFunc) error {
+	return writeDealResponse1(d.rw, dr, resign)
 }
 
 func (d *dealStreamv110) Close() error {
@@ -0,0 +1,96 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket/migrations"
+)
+
+type dealStreamv111 struct {
+	p        peer.ID
+	host     host.Host
+	rw       network.MuxedStream
+	buffered *bufio.Reader
+}
+
+var _ StorageDealStream = (*dealStreamv111)(nil)
+
+func (d *dealStreamv111) ReadDealProposal() (Proposal, error) {
+	var ds Proposal
+
+	if err := ds.UnmarshalCBOR(d.buffered); err != nil {
+		log.Warn(err)
+		return ProposalUndefined, err
+	}
+
+	return ds, nil
+}
+
+func (d *dealStreamv111) WriteDealProposal(dp Proposal) error {
+	return cborutil.WriteCborRPC(d.rw, &dp)
+}
+
+func (d *dealStreamv111) ReadDealResponse() (SignedResponse, []byte, error) {
+	return readDealResponse1(d.buffered)
+}
+
+func (d *dealStreamv111) WriteDealResponse(dr SignedResponse, resign ResigningFunc) error {
+	return writeDealResponse1(d.rw, dr, resign)
+}
+
+func (d *dealStreamv111) Close() error {
+	return d.rw.Close()
+}
+
+func (d *dealStreamv111) RemotePeer() peer.ID {
+	return d.p
+}
+
+// readDealResponse1 reads a version 1 response, which has no rejection
+func readDealResponse1(r io.Reader) (SignedResponse, []byte, error) {
+	var dr migrations.SignedResponse1
+
+	if err := dr.UnmarshalCBOR(r); err != nil {
+		return SignedResponseUndefined, nil, err
+	}
+	origBytes, err := cborutil.Dump(&dr.Response)
+	if err != nil {
+		return SignedResponseUndefined, nil, err
+	}
+	return SignedResponse{
+		Response: Response{
+			State:          dr.Response.State,
+			Message:        dr.Response.Message,
+			Proposal:       dr.Response.Proposal,
+			PublishMessage: dr.Response.PublishMessage,
+		},
+		Signature: dr.Signature,
+	}, origBytes, nil
+}
+
+// writeDealResponse1 writes the response as a version 1 response, without the
+// rejection, re-signing it as the signature covers the encoded response
+func writeDealResponse1(w io.Writer, dr SignedResponse, resign ResigningFunc) error {
+	oldResponse := migrations.Response1{
+		State:          dr.Response.State,
+		Message:        dr.Response.Message,
+		Proposal:       dr.Response.Proposal,
+		PublishMessage: dr.Response.PublishMessage,
+	}
+	oldSig, err := resign(context.TODO(), &oldResponse)
+	if err != nil {
+		return err
+	}
+	return cborutil.WriteCborRPC(w, &migrations.SignedResponse1{
+		Response:  oldResponse,
+		Signature: oldSig,
+	})
+}
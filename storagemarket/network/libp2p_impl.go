@@ -59,11 +59,13 @@ func NewFromLibp2pHost(h host.Host, options ...Option) StorageMarketNetwork {
 			storagemarket.OldAskProtocolID,
 		},
 		supportedDealProtocols: []protocol.ID{
+			storagemarket.DealProtocolID120,
 			storagemarket.DealProtocolID111,
 			storagemarket.DealProtocolID110,
 			storagemarket.DealProtocolID101,
 		},
 		supportedDealStatusProtocols: []protocol.ID{
+			storagemarket.BatchDealStatusProtocolID,
 			storagemarket.DealStatusProtocolID,
 			storagemarket.OldDealStatusProtocolID,
 		},
@@ -110,8 +112,10 @@ func (impl *libp2pStorageMarketNetwork) NewDealStream(ctx context.Context, id pe
 		return &dealStreamv101{p: id, rw: s, buffered: buffered, host: impl.host}, nil
 	case storagemarket.DealProtocolID110:
 		return &dealStreamv110{p: id, rw: s, buffered: buffered, host: impl.host}, nil
-	default:
+	case storagemarket.DealProtocolID111:
 		return &dealStreamv111{p: id, rw: s, buffered: buffered, host: impl.host}, nil
+	default:
+		return &dealStreamv120{p: id, rw: s, buffered: buffered, host: impl.host}, nil
 	}
 }
 
@@ -122,10 +126,34 @@ func (impl *libp2pStorageMarketNetwork) NewDealStatusStream(ctx context.Context,
 		return nil, err
 	}
 	buffered := bufio.NewReaderSize(s, 16)
-	if s.Protocol() == storagemarket.OldDealStatusProtocolID {
+	switch s.Protocol() {
+	case storagemarket.OldDealStatusProtocolID:
 		return &legacyDealStatusStream{p: id, rw: s, buffered: buffered}, nil
+	case storagemarket.DealStatusProtocolID:
+		return &dealStatusStream{p: id, rw: s, buffered: buffered}, nil
+	default:
+		return &batchDealStatusStream{p: id, rw: s, buffered: buffered}, nil
 	}
-	return &dealStatusStream{p: id, rw: s, buffered: buffered}, nil
+}
+
+func (impl *libp2pStorageMarketNetwork) NewDealCheckStream(ctx context.Context, id peer.ID) (DealCheckStream, error) {
+	s, err := impl.retryStream.OpenStream(ctx, id, []protocol.ID{storagemarket.DealCheckProtocolID})
+	if err != nil {
+		log.Warn(err)
+		return nil, err
+	}
+	buffered := bufio.NewReaderSize(s, 16)
+	return &dealCheckStream{p: id, rw: s, buffered: buffered}, nil
+}
+
+func (impl *libp2pStorageMarketNetwork) NewDealCancelStream(ctx context.Context, id peer.ID) (DealCancelStream, error) {
+	s, err := impl.retryStream.OpenStream(ctx, id, []protocol.ID{storagemarket.DealCancelProtocolID})
+	if err != nil {
+		log.Warn(err)
+		return nil, err
+	}
+	buffered := bufio.NewReaderSize(s, 16)
+	return &dealCancelStream{p: id, rw: s, buffered: buffered}, nil
 }
 
 func (impl *libp2pStorageMarketNetwork) SetDelegate(r StorageReceiver) error {
@@ -139,6 +167,12 @@ func (impl *libp2pStorageMarketNetwork) SetDelegate(r StorageReceiver) error {
 	for _, proto := range impl.supportedDealStatusProtocols {
 		impl.host.SetStreamHandler(proto, impl.handleNewDealStatusStream)
 	}
+	if _, ok := r.(DealCheckReceiver); ok {
+		impl.host.SetStreamHandler(storagemarket.DealCheckProtocolID, impl.handleNewDealCheckStream)
+	}
+	if _, ok := r.(DealCancelReceiver); ok {
+		impl.host.SetStreamHandler(storagemarket.DealCancelProtocolID, impl.handleNewDealCancelStream)
+	}
 	return nil
 }
 
@@ -153,6 +187,8 @@ func (impl *libp2pStorageMarketNetwork) StopHandlingRequests() error {
 	for _, proto := range impl.supportedDealStatusProtocols {
 		impl.host.RemoveStreamHandler(proto)
 	}
+	impl.host.RemoveStreamHandler(storagemarket.DealCheckProtocolID)
+	impl.host.RemoveStreamHandler(storagemarket.DealCancelProtocolID)
 	return nil
 }
 
@@ -178,8 +214,10 @@ func (impl *libp2pStorageMarketNetwork) handleNewDealStream(s network.Stream) {
 			ds = &dealStreamv101{s.Conn().RemotePeer(), impl.host, s, reader}
 		case storagemarket.DealProtocolID110:
 			ds = &dealStreamv110{s.Conn().RemotePeer(), impl.host, s, reader}
-		default:
+		case storagemarket.DealProtocolID111:
 			ds = &dealStreamv111{s.Conn().RemotePeer(), impl.host, s, reader}
+		default:
+			ds = &dealStreamv120{s.Conn().RemotePeer(), impl.host, s, reader}
 		}
 		impl.receiver.HandleDealStream(ds)
 	}
@@ -189,15 +227,44 @@ func (impl *libp2pStorageMarketNetwork) handleNewDealStatusStream(s network.Stre
 	reader := impl.getReaderOrReset(s)
 	if reader != nil {
 		var qs DealStatusStream
-		if s.Protocol() == storagemarket.OldDealStatusProtocolID {
+		switch s.Protocol() {
+		case storagemarket.OldDealStatusProtocolID:
 			qs = &legacyDealStatusStream{s.Conn().RemotePeer(), impl.host, s, reader}
-		} else {
+		case storagemarket.DealStatusProtocolID:
 			qs = &dealStatusStream{s.Conn().RemotePeer(), impl.host, s, reader}
+		default:
+			qs = &batchDealStatusStream{s.Conn().RemotePeer(), impl.host, s, reader}
 		}
 		impl.receiver.HandleDealStatusStream(qs)
 	}
 }
 
+func (impl *libp2pStorageMarketNetwork) handleNewDealCheckStream(s network.Stream) {
+	reader := impl.getReaderOrReset(s)
+	if reader == nil {
+		return
+	}
+	cr, ok := impl.receiver.(DealCheckReceiver)
+	if !ok {
+		s.Reset() // nolint: errcheck,gosec
+		return
+	}
+	cr.HandleDealCheckStream(&dealCheckStream{s.Conn().RemotePeer(), s, reader})
+}
+
+func (impl *libp2pStorageMarketNetwork) handleNewDealCancelStream(s network.Stream) {
+	reader := impl.getReaderOrReset(s)
+	if reader == nil {
+		return
+	}
+	cr, ok := impl.receiver.(DealCancelReceiver)
+	if !ok {
+		s.Reset() // nolint: errcheck,gosec
+		return
+	}
+	cr.HandleDealCancelStream(&dealCancelStream{s.Conn().RemotePeer(), s, reader})
+}
+
 func (impl *libp2pStorageMarketNetwork) getReaderOrReset(s network.Stream) *bufio.Reader {
 	if impl.receiver == nil {
 		log.Warn("no receiver set")
@@ -10,6 +10,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/go-state-types/crypto"
 
 	"github.com/filecoin-project/go-fil-markets/shared_testutil"
@@ -22,9 +25,12 @@ type testReceiver struct {
 	dealStreamHandler       func(network.StorageDealStream)
 	askStreamHandler        func(network.StorageAskStream)
 	dealStatusStreamHandler func(stream network.DealStatusStream)
+	dealCheckStreamHandler  func(stream network.DealCheckStream)
+	dealCancelStreamHandler func(stream network.DealCancelStream)
 }
 
-var _ network.StorageReceiver = &testReceiver{}
+var _ network.DealCheckReceiver = &testReceiver{}
+var _ network.DealCancelReceiver = &testReceiver{}
 
 func (tr *testReceiver) HandleDealStream(s network.StorageDealStream) {
 	defer s.Close()
@@ -47,6 +53,20 @@ func (tr *testReceiver) HandleDealStatusStream(s network.DealStatusStream) {
 	}
 }
 
+func (tr *testReceiver) HandleDealCheckStream(s network.DealCheckStream) {
+	defer s.Close()
+	if tr.dealCheckStreamHandler != nil {
+		tr.dealCheckStreamHandler(s)
+	}
+}
+
+func (tr *testReceiver) HandleDealCancelStream(s network.DealCancelStream) {
+	defer s.Close()
+	if tr.dealCancelStreamHandler != nil {
+		tr.dealCancelStreamHandler(s)
+	}
+}
+
 func TestOpenStreamWithRetries(t *testing.T) {
 	ctx := context.Background()
 	td := shared_testutil.NewLibp2pTestData(ctx, t)
@@ -326,6 +346,71 @@ func TestDealStreamSendReceiveDealResponse(t *testing.T) {
 	}
 }
 
+func TestDealStreamRejection(t *testing.T) {
+	bgCtx := context.Background()
+
+	testCases := map[string]struct {
+		protocols       []protocol.ID
+		expectRejection bool
+	}{
+		"current version sends the rejection": {
+			protocols:       []protocol.ID{storagemarket.DealProtocolID120},
+			expectRejection: true,
+		},
+		"v1.1.1 drops the rejection": {
+			protocols: []protocol.ID{storagemarket.DealProtocolID111},
+		},
+		"v1.1.0 drops the rejection": {
+			protocols: []protocol.ID{storagemarket.DealProtocolID110},
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			td := shared_testutil.NewLibp2pTestData(bgCtx, t)
+			fromNetwork := network.NewFromLibp2pHost(td.Host1)
+			toNetwork := network.NewFromLibp2pHost(td.Host2, network.SupportedDealProtocols(data.protocols))
+			toPeer := td.Host2.ID()
+
+			dr := shared_testutil.MakeTestStorageNetworkSignedResponse()
+			dr.Response.State = storagemarket.StorageDealFailing
+			dr.Response.Rejection = &storagemarket.Rejection{
+				Code:     storagemarket.RejectionPriceTooLow,
+				Min:      abi.NewTokenAmount(100),
+				Max:      big.Zero(),
+				Proposed: abi.NewTokenAmount(10),
+			}
+			resigned := shared_testutil.MakeTestSignature()
+			var resigningFunc network.ResigningFunc = func(ctx context.Context, data interface{}) (*crypto.Signature, error) {
+				return resigned, nil
+			}
+			tr2 := &testReceiver{t: t, dealStreamHandler: func(s network.StorageDealStream) {
+				_, err := s.ReadDealProposal()
+				require.NoError(t, err)
+				require.NoError(t, s.WriteDealResponse(dr, resigningFunc))
+			}}
+			require.NoError(t, toNetwork.SetDelegate(tr2))
+
+			ctx, cancel := context.WithTimeout(bgCtx, 10*time.Second)
+			defer cancel()
+
+			ds1, err := fromNetwork.NewDealStream(ctx, toPeer)
+			require.NoError(t, err)
+			require.NoError(t, ds1.WriteDealProposal(shared_testutil.MakeTestStorageNetworkProposal()))
+			resp, _, err := ds1.ReadDealResponse()
+			require.NoError(t, err)
+
+			if data.expectRejection {
+				assert.Equal(t, dr, resp)
+			} else {
+				expected := dr.Response
+				expected.Rejection = nil
+				assert.Equal(t, expected, resp.Response)
+				assert.Equal(t, resigned, resp.Signature)
+			}
+		})
+	}
+}
+
 func TestDealStreamSendReceiveMultipleSuccessful(t *testing.T) {
 	// send proposal, read in handler, send response back,
 	// read response,
@@ -517,6 +602,199 @@ func TestDealStatusStreamSendReceiveMultipleSuccessful(t *testing.T) {
 	assert.Equal(t, ar, resp)
 }
 
+func TestBatchDealStatusStreamSendReceive(t *testing.T) {
+	ctxBg := context.Background()
+	td := shared_testutil.NewLibp2pTestData(ctxBg, t)
+	nw1 := network.NewFromLibp2pHost(td.Host1)
+	nw2 := network.NewFromLibp2pHost(td.Host2)
+	require.NoError(t, td.Host1.Connect(ctxBg, peer.AddrInfo{ID: td.Host2.ID()}))
+
+	// host2 gets a batch query and sends a response for each proposal
+	req := network.BatchDealStatusRequest{
+		Proposals: shared_testutil.GenerateCids(3),
+		Signature: *shared_testutil.MakeTestSignature(),
+	}
+	ar := network.BatchDealStatusResponse{}
+	for range req.Proposals {
+		ar.DealStates = append(ar.DealStates, shared_testutil.MakeTestDealStatusResponse())
+	}
+	reqs := make(chan network.BatchDealStatusRequest, 1)
+	tr2 := &testReceiver{t: t, dealStatusStreamHandler: func(s network.DealStatusStream) {
+		bs, ok := s.(network.BatchDealStatusStream)
+		require.True(t, ok)
+		readq, err := bs.ReadBatchDealStatusRequest()
+		require.NoError(t, err)
+		reqs <- readq
+		require.NoError(t, bs.WriteBatchDealStatusResponse(ar, nil))
+	}}
+	require.NoError(t, nw2.SetDelegate(tr2))
+
+	ctx, cancel := context.WithTimeout(ctxBg, 10*time.Second)
+	defer cancel()
+
+	qs, err := nw1.NewDealStatusStream(ctx, td.Host2.ID())
+	require.NoError(t, err)
+	bs, ok := qs.(network.BatchDealStatusStream)
+	require.True(t, ok)
+	require.NoError(t, bs.WriteBatchDealStatusRequest(req))
+	resp, origBytes, err := bs.ReadBatchDealStatusResponse()
+	require.NoError(t, err)
+
+	select {
+	case <-ctx.Done():
+		t.Error("request not received")
+	case readq := <-reqs:
+		assert.Equal(t, req, readq)
+	}
+	assert.Equal(t, ar, resp)
+	require.Len(t, origBytes, len(ar.DealStates))
+	for i := range ar.DealStates {
+		expected, err := cborutil.Dump(&ar.DealStates[i].DealState)
+		require.NoError(t, err)
+		assert.Equal(t, expected, origBytes[i])
+	}
+
+	// a provider that doesn't support batch queries gets single queries
+	host3, err := td.MockNet.GenPeer()
+	require.NoError(t, err)
+	require.NoError(t, td.MockNet.LinkAll())
+	nw3 := network.NewFromLibp2pHost(host3, network.SupportedDealStatusProtocols([]protocol.ID{storagemarket.DealStatusProtocolID}))
+	single := shared_testutil.MakeTestDealStatusResponse()
+	require.NoError(t, nw3.SetDelegate(&testReceiver{t: t, dealStatusStreamHandler: func(s network.DealStatusStream) {
+		_, ok := s.(network.BatchDealStatusStream)
+		require.False(t, ok)
+		_, err := s.ReadDealStatusRequest()
+		require.NoError(t, err)
+		require.NoError(t, s.WriteDealStatusResponse(single, nil))
+	}}))
+	require.NoError(t, td.Host1.Connect(ctxBg, peer.AddrInfo{ID: host3.ID()}))
+
+	qs, err = nw1.NewDealStatusStream(ctx, host3.ID())
+	require.NoError(t, err)
+	_, ok = qs.(network.BatchDealStatusStream)
+	require.False(t, ok)
+	require.NoError(t, qs.WriteDealStatusRequest(shared_testutil.MakeTestDealStatusRequest()))
+	singleResp, _, err := qs.ReadDealStatusResponse()
+	require.NoError(t, err)
+	assert.Equal(t, single, singleResp)
+}
+
+func TestDealCheckStreamSendReceive(t *testing.T) {
+	ctxBg := context.Background()
+	td := shared_testutil.NewLibp2pTestData(ctxBg, t)
+	nw1 := network.NewFromLibp2pHost(td.Host1)
+	nw2 := network.NewFromLibp2pHost(td.Host2)
+	require.NoError(t, td.Host1.Connect(ctxBg, peer.AddrInfo{ID: td.Host2.ID()}))
+
+	// host2 gets a check request and responds with a rejection
+	req := network.DealCheckRequest{
+		Proposal:      shared_testutil.MakeTestUnsignedDealProposal(),
+		Piece:         shared_testutil.MakeTestDataRef(false),
+		FastRetrieval: true,
+	}
+	ar := network.DealCheckResponse{
+		Message: "price too low",
+		Rejection: &storagemarket.Rejection{
+			Code:     storagemarket.RejectionPriceTooLow,
+			Min:      big.NewInt(100),
+			Max:      big.Zero(),
+			Proposed: big.NewInt(10),
+		},
+	}
+	reqs := make(chan network.DealCheckRequest, 1)
+	tr2 := &testReceiver{t: t, dealCheckStreamHandler: func(s network.DealCheckStream) {
+		readq, err := s.ReadDealCheckRequest()
+		require.NoError(t, err)
+		require.Equal(t, td.Host1.ID(), s.RemotePeer())
+		reqs <- readq
+		require.NoError(t, s.WriteDealCheckResponse(ar))
+	}}
+	require.NoError(t, nw2.SetDelegate(tr2))
+
+	ctx, cancel := context.WithTimeout(ctxBg, 10*time.Second)
+	defer cancel()
+
+	cs, err := nw1.NewDealCheckStream(ctx, td.Host2.ID())
+	require.NoError(t, err)
+	require.NoError(t, cs.WriteDealCheckRequest(req))
+	resp, err := cs.ReadDealCheckResponse()
+	require.NoError(t, err)
+
+	select {
+	case <-ctx.Done():
+		t.Error("request not received")
+	case readq := <-reqs:
+		assert.Equal(t, req, readq)
+	}
+	assert.Equal(t, ar, resp)
+
+	// a receiver that doesn't answer deal checks doesn't handle the protocol
+	host3, err := td.MockNet.GenPeer()
+	require.NoError(t, err)
+	require.NoError(t, td.MockNet.LinkAll())
+	nw3 := network.NewFromLibp2pHost(host3)
+	require.NoError(t, nw3.SetDelegate(struct{ network.StorageReceiver }{tr2}))
+	require.NoError(t, td.Host1.Connect(ctxBg, peer.AddrInfo{ID: host3.ID()}))
+	nw1 = network.NewFromLibp2pHost(td.Host1, network.RetryParameters(0, 0, 0, 0))
+	_, err = nw1.NewDealCheckStream(ctx, host3.ID())
+	require.Error(t, err)
+}
+
+func TestDealCancelStreamSendReceive(t *testing.T) {
+	ctxBg := context.Background()
+	td := shared_testutil.NewLibp2pTestData(ctxBg, t)
+	nw1 := network.NewFromLibp2pHost(td.Host1)
+	nw2 := network.NewFromLibp2pHost(td.Host2)
+	require.NoError(t, td.Host1.Connect(ctxBg, peer.AddrInfo{ID: td.Host2.ID()}))
+
+	// host2 gets a cancel request and refuses it
+	req := network.DealCancelRequest{
+		Proposal:  shared_testutil.GenerateCids(1)[0],
+		Signature: *shared_testutil.MakeTestSignature(),
+	}
+	ar := network.DealCancelResponse{
+		State:   storagemarket.StorageDealPublishing,
+		Message: "deal has been published",
+	}
+	reqs := make(chan network.DealCancelRequest, 1)
+	tr2 := &testReceiver{t: t, dealCancelStreamHandler: func(s network.DealCancelStream) {
+		readq, err := s.ReadDealCancelRequest()
+		require.NoError(t, err)
+		require.Equal(t, td.Host1.ID(), s.RemotePeer())
+		reqs <- readq
+		require.NoError(t, s.WriteDealCancelResponse(ar))
+	}}
+	require.NoError(t, nw2.SetDelegate(tr2))
+
+	ctx, cancel := context.WithTimeout(ctxBg, 10*time.Second)
+	defer cancel()
+
+	cs, err := nw1.NewDealCancelStream(ctx, td.Host2.ID())
+	require.NoError(t, err)
+	require.NoError(t, cs.WriteDealCancelRequest(req))
+	resp, err := cs.ReadDealCancelResponse()
+	require.NoError(t, err)
+
+	select {
+	case <-ctx.Done():
+		t.Error("request not received")
+	case readq := <-reqs:
+		assert.Equal(t, req, readq)
+	}
+	assert.Equal(t, ar, resp)
+
+	// a receiver that doesn't cancel deals doesn't handle the protocol
+	host3, err := td.MockNet.GenPeer()
+	require.NoError(t, err)
+	require.NoError(t, td.MockNet.LinkAll())
+	nw3 := network.NewFromLibp2pHost(host3)
+	require.NoError(t, nw3.SetDelegate(struct{ network.StorageReceiver }{tr2}))
+	require.NoError(t, td.Host1.Connect(ctxBg, peer.AddrInfo{ID: host3.ID()}))
+	nw1 = network.NewFromLibp2pHost(td.Host1, network.RetryParameters(0, 0, 0, 0))
+	_, err = nw1.NewDealCancelStream(ctx, host3.ID())
+	require.Error(t, err)
+}
+
 func TestLibp2pStorageMarketNetwork_StopHandlingRequests(t *testing.T) {
 	bgCtx := context.Background()
 	td := shared_testutil.NewLibp2pTestData(bgCtx, t)
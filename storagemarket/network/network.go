@@ -46,6 +46,39 @@ type DealStatusStream interface {
 	Close() error
 }
 
+// BatchDealStatusStream is a deal status stream that can also query the status
+// of many deals in one request. Deal status streams on the batch version of the
+// protocol implement it.
+type BatchDealStatusStream interface {
+	DealStatusStream
+	ReadBatchDealStatusRequest() (BatchDealStatusRequest, error)
+	WriteBatchDealStatusRequest(BatchDealStatusRequest) error
+	ReadBatchDealStatusResponse() (BatchDealStatusResponse, [][]byte, error)
+	WriteBatchDealStatusResponse(BatchDealStatusResponse, ResigningFunc) error
+}
+
+// DealCheckStream is a stream for reading and writing requests
+// and responses on the deal check protocol
+type DealCheckStream interface {
+	ReadDealCheckRequest() (DealCheckRequest, error)
+	WriteDealCheckRequest(DealCheckRequest) error
+	ReadDealCheckResponse() (DealCheckResponse, error)
+	WriteDealCheckResponse(DealCheckResponse) error
+	RemotePeer() peer.ID
+	Close() error
+}
+
+// DealCancelStream is a stream for reading and writing requests
+// and responses on the deal cancel protocol
+type DealCancelStream interface {
+	ReadDealCancelRequest() (DealCancelRequest, error)
+	WriteDealCancelRequest(DealCancelRequest) error
+	ReadDealCancelResponse() (DealCancelResponse, error)
+	WriteDealCancelResponse(DealCancelResponse) error
+	RemotePeer() peer.ID
+	Close() error
+}
+
 // StorageReceiver implements functions for receiving
 // incoming data on storage protocols
 type StorageReceiver interface {
@@ -54,11 +87,29 @@ type StorageReceiver interface {
 	HandleDealStatusStream(DealStatusStream)
 }
 
+// DealCheckReceiver is a StorageReceiver that also answers deal check
+// requests. The deal check protocol is only handled for receivers that
+// implement it.
+type DealCheckReceiver interface {
+	StorageReceiver
+	HandleDealCheckStream(DealCheckStream)
+}
+
+// DealCancelReceiver is a StorageReceiver that also lets clients cancel their
+// deals. The deal cancel protocol is only handled for receivers that
+// implement it.
+type DealCancelReceiver interface {
+	StorageReceiver
+	HandleDealCancelStream(DealCancelStream)
+}
+
 // StorageMarketNetwork is a network abstraction for the storage market
 type StorageMarketNetwork interface {
 	NewAskStream(context.Context, peer.ID) (StorageAskStream, error)
 	NewDealStream(context.Context, peer.ID) (StorageDealStream, error)
 	NewDealStatusStream(context.Context, peer.ID) (DealStatusStream, error)
+	NewDealCheckStream(context.Context, peer.ID) (DealCheckStream, error)
+	NewDealCancelStream(context.Context, peer.ID) (DealCancelStream, error)
 	SetDelegate(StorageReceiver) error
 	StopHandlingRequests() error
 	ID() peer.ID
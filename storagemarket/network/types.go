@@ -4,13 +4,14 @@ import (
 	"github.com/ipfs/go-cid"
 
 	"github.com/filecoin-project/go-address"
+	cborutil "github.com/filecoin-project/go-cbor-util"
 	"github.com/filecoin-project/go-state-types/builtin/v9/market"
 	"github.com/filecoin-project/go-state-types/crypto"
 
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
 )
 
-//go:generate cbor-gen-for --map-encoding AskRequest AskResponse Proposal Response SignedResponse DealStatusRequest DealStatusResponse
+//go:generate cbor-gen-for --map-encoding AskRequest AskResponse Proposal Response SignedResponse DealStatusRequest DealStatusResponse BatchDealStatusRequest BatchDealStatusResponse DealCheckRequest DealCheckResponse DealCancelRequest DealCancelResponse
 
 // Proposal is the data sent over the network from client to provider when proposing
 // a deal
@@ -33,6 +34,10 @@ type Response struct {
 
 	// StorageDealProposalAccepted
 	PublishMessage *cid.Cid
+
+	// Rejection is the reason the proposal was rejected, in a machine-readable
+	// form. It is only sent on version 1.2.0 of the deal protocol.
+	Rejection *storagemarket.Rejection
 }
 
 // SignedResponse is a response that is signed
@@ -79,3 +84,101 @@ type DealStatusResponse struct {
 
 // DealStatusResponseUndefined represents an empty DealStatusResponse message
 var DealStatusResponseUndefined = DealStatusResponse{}
+
+// BatchDealStatusRequest is sent by a client to query the status of many deals
+// with the same client address in one request
+type BatchDealStatusRequest struct {
+	Proposals []cid.Cid
+	Signature crypto.Signature
+}
+
+// BatchDealStatusRequestUndefined represents an empty BatchDealStatusRequest message
+var BatchDealStatusRequestUndefined = BatchDealStatusRequest{}
+
+// SigningBytes returns the bytes that the client signs for the request, which
+// are the CBOR encodings of the proposal CIDs one after another. A request for
+// a single proposal is signed the same way as a DealStatusRequest for it.
+func (r *BatchDealStatusRequest) SigningBytes() ([]byte, error) {
+	var buf []byte
+	for i := range r.Proposals {
+		b, err := cborutil.Dump(&r.Proposals[i])
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, b...)
+	}
+	return buf, nil
+}
+
+// BatchDealStatusResponse is a provider's response to BatchDealStatusRequest,
+// with a signed deal state for each proposal in the same order as the request
+type BatchDealStatusResponse struct {
+	DealStates []DealStatusResponse
+}
+
+// BatchDealStatusResponseUndefined represents an empty BatchDealStatusResponse message
+var BatchDealStatusResponseUndefined = BatchDealStatusResponse{}
+
+// DealCheckRequest is sent by a client to ask a provider whether it would
+// accept a deal proposal. The proposal is not signed, and the provider keeps
+// no state for it.
+type DealCheckRequest struct {
+	Proposal      market.DealProposal
+	Piece         *storagemarket.DataRef
+	FastRetrieval bool
+}
+
+// DealCheckRequestUndefined represents an empty DealCheckRequest message
+var DealCheckRequestUndefined = DealCheckRequest{}
+
+// DealCheckResponse is a provider's response to DealCheckRequest
+type DealCheckResponse struct {
+	// Accepted is true if the provider would accept the proposal
+	Accepted bool
+	// Message is the reason the provider would reject the proposal
+	Message string
+	// Rejection is the reason the provider would reject the proposal, in a
+	// machine-readable form
+	Rejection *storagemarket.Rejection
+}
+
+// DealCheckResponseUndefined represents an empty DealCheckResponse message
+var DealCheckResponseUndefined = DealCheckResponse{}
+
+// DealCancelRequest is sent by a client to cancel a deal before the provider
+// publishes it
+type DealCancelRequest struct {
+	Proposal  cid.Cid
+	Signature crypto.Signature
+}
+
+// DealCancelRequestUndefined represents an empty DealCancelRequest message
+var DealCancelRequestUndefined = DealCancelRequest{}
+
+// dealCancelSigningPrefix is signed with the proposal CID, so that the
+// signature on a deal status request can't be used to cancel the deal
+const dealCancelSigningPrefix = "/fil/storage/cancel"
+
+// SigningBytes returns the bytes that the client signs for the request, which
+// are a prefix for the cancel protocol followed by the CBOR encoding of the
+// proposal CID
+func (r *DealCancelRequest) SigningBytes() ([]byte, error) {
+	b, err := cborutil.Dump(&r.Proposal)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(dealCancelSigningPrefix), b...), nil
+}
+
+// DealCancelResponse is a provider's response to DealCancelRequest
+type DealCancelResponse struct {
+	// Cancelled is true if the provider has cancelled the deal
+	Cancelled bool
+	// State is the state of the deal on the provider, after it is cancelled
+	State storagemarket.StorageDealStatus
+	// Message is the reason the provider did not cancel the deal
+	Message string
+}
+
+// DealCancelResponseUndefined represents an empty DealCancelResponse message
+var DealCancelResponseUndefined = DealCancelResponse{}
@@ -3,12 +3,15 @@ package storagemarket
 import (
 	"context"
 	"io"
+	"time"
 
 	"github.com/ipfs/go-cid"
 
 	"github.com/filecoin-project/go-state-types/abi"
 
 	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/shared/denylist"
+	"github.com/filecoin-project/go-fil-markets/shared/drain"
 )
 
 // ProviderSubscriber is a callback that is run when events are emitted on a StorageProvider
@@ -62,9 +65,30 @@ type StorageProvider interface {
 	// SubscribeToEvents listens for events that happen related to storage deals on a provider
 	SubscribeToEvents(subscriber ProviderSubscriber) shared.Unsubscribe
 
+	// SubscribeToDenylistHits subscribes to the deal proposals that the
+	// provider refuses because their payload or piece is on its denylist
+	SubscribeToDenylistHits(subscriber denylist.Subscriber) shared.Unsubscribe
+
 	RetryDealPublishing(propCid cid.Cid) error
 
 	AnnounceDealToIndexer(ctx context.Context, proposalCid cid.Cid) error
 
 	AnnounceAllDealsToIndexer(ctx context.Context) error
+
+	// Pause stops the provider accepting new deals, while deals in progress carry on.
+	// The provider stays paused across restarts until it is resumed.
+	Pause() error
+
+	// Resume lets the provider accept new deals again
+	Resume() error
+
+	// Paused returns true if the provider is not accepting new deals
+	Paused() bool
+
+	// DrainProgress returns the number of deals in flight in each state
+	DrainProgress(ctx context.Context) (drain.Progress, error)
+
+	// Drain pauses the provider and waits until it has no deals in flight, or returns
+	// the deals still in flight when the context is done or the timeout elapses
+	Drain(ctx context.Context, timeout time.Duration, onProgress func(drain.Progress)) ([]drain.Deal, error)
 }
@@ -0,0 +1,169 @@
+package storagemarket
+
+import (
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/big"
+)
+
+// RejectionCode is a machine-readable reason that a provider rejected a deal
+// proposal, so that clients can react to a rejection without parsing its
+// message
+type RejectionCode = uint64
+
+const (
+	// RejectionOther means the proposal was rejected for a reason that has no
+	// specific code
+	RejectionOther = RejectionCode(iota)
+
+	// RejectionInvalidProposal means the proposal is malformed or is not
+	// properly signed by the client
+	RejectionInvalidProposal
+
+	// RejectionWrongProvider means the proposal is for a different provider
+	RejectionWrongProvider
+
+	// RejectionLabelTooLong means the deal label is too long. Max is the
+	// longest label allowed, in bytes.
+	RejectionLabelTooLong
+
+	// RejectionStartEpochElapsed means the deal's start epoch has passed. Min
+	// is the current epoch.
+	RejectionStartEpochElapsed
+
+	// RejectionDurationOutOfBounds means the deal is too short or too long.
+	// Min and Max are the bounds of the duration, in epochs.
+	RejectionDurationOutOfBounds
+
+	// RejectionEndEpochTooLate means the deal's end epoch is too far in the
+	// future. Max is the latest end epoch allowed.
+	RejectionEndEpochTooLate
+
+	// RejectionCollateralTooLow means the provider collateral is below the
+	// minimum. Min and Max are the bounds of the collateral.
+	RejectionCollateralTooLow
+
+	// RejectionCollateralTooHigh means the provider collateral is above the
+	// maximum. Min and Max are the bounds of the collateral.
+	RejectionCollateralTooHigh
+
+	// RejectionPriceTooLow means the storage price per epoch is below the
+	// provider's ask. Min is the lowest price per epoch the provider accepts
+	// for the proposal.
+	RejectionPriceTooLow
+
+	// RejectionPieceTooSmall means the piece is smaller than the provider's
+	// minimum. Min is the minimum piece size.
+	RejectionPieceTooSmall
+
+	// RejectionPieceTooLarge means the piece is larger than the provider's
+	// maximum. Max is the maximum piece size.
+	RejectionPieceTooLarge
+
+	// RejectionInsufficientClientBalance means the client's available
+	// market balance doesn't cover the deal. Min is the balance required.
+	RejectionInsufficientClientBalance
+
+	// RejectionNoDataCap means a verified deal's client has no DataCap, or
+	// not enough for the piece. Min is the DataCap required.
+	RejectionNoDataCap
+
+	// RejectionPolicyDenied means the provider's own deal decision logic
+	// declined the deal
+	RejectionPolicyDenied
+
+	// RejectionProviderError means the provider couldn't check the proposal
+	// because of an error on its side, so it may be accepted if it is proposed
+	// again later
+	RejectionProviderError
+
+	// RejectionMaintenance means the provider is in maintenance mode and is
+	// not accepting new deals for now
+	RejectionMaintenance
+
+	// RejectionDenylisted means the deal's payload or piece is on the
+	// provider's content denylist
+	RejectionDenylisted
+
+	// RejectionRateLimited means the client has asked the provider to check
+	// too many deals recently, and can check again later
+	RejectionRateLimited
+)
+
+// RejectionCodes maps rejection codes to their names
+var RejectionCodes = map[RejectionCode]string{
+	RejectionOther:                     "RejectionOther",
+	RejectionInvalidProposal:           "RejectionInvalidProposal",
+	RejectionWrongProvider:             "RejectionWrongProvider",
+	RejectionLabelTooLong:              "RejectionLabelTooLong",
+	RejectionStartEpochElapsed:         "RejectionStartEpochElapsed",
+	RejectionDurationOutOfBounds:       "RejectionDurationOutOfBounds",
+	RejectionEndEpochTooLate:           "RejectionEndEpochTooLate",
+	RejectionCollateralTooLow:          "RejectionCollateralTooLow",
+	RejectionCollateralTooHigh:         "RejectionCollateralTooHigh",
+	RejectionPriceTooLow:               "RejectionPriceTooLow",
+	RejectionPieceTooSmall:             "RejectionPieceTooSmall",
+	RejectionPieceTooLarge:             "RejectionPieceTooLarge",
+	RejectionInsufficientClientBalance: "RejectionInsufficientClientBalance",
+	RejectionNoDataCap:                 "RejectionNoDataCap",
+	RejectionPolicyDenied:              "RejectionPolicyDenied",
+	RejectionProviderError:             "RejectionProviderError",
+	RejectionMaintenance:               "RejectionMaintenance",
+	RejectionDenylisted:                "RejectionDenylisted",
+	RejectionRateLimited:               "RejectionRateLimited",
+}
+
+// Rejection describes why a provider rejected a deal proposal. The code says
+// which of the bounds are set: a bound that doesn't apply to the code is zero.
+type Rejection struct {
+	Code RejectionCode
+	// Min is the lowest value the provider accepts for the rejected field
+	Min big.Int
+	// Max is the highest value the provider accepts for the rejected field
+	Max big.Int
+	// Proposed is the value in the proposal for the rejected field
+	Proposed big.Int
+}
+
+// RejectionError is an error rejecting a deal proposal, which carries the
+// reason for the rejection in a machine-readable form
+type RejectionError struct {
+	Rejection Rejection
+	Err       error
+}
+
+// NewRejectionError returns an error rejecting a proposal for the reason
+// given by the code and message. Use the bound setters to add the bounds that
+// apply to the code.
+func NewRejectionError(code RejectionCode, format string, args ...interface{}) *RejectionError {
+	return &RejectionError{
+		Rejection: Rejection{Code: code, Min: big.Zero(), Max: big.Zero(), Proposed: big.Zero()},
+		Err:       xerrors.Errorf(format, args...),
+	}
+}
+
+// WithMin sets the lowest value the provider accepts
+func (e *RejectionError) WithMin(min big.Int) *RejectionError {
+	e.Rejection.Min = min
+	return e
+}
+
+// WithMax sets the highest value the provider accepts
+func (e *RejectionError) WithMax(max big.Int) *RejectionError {
+	e.Rejection.Max = max
+	return e
+}
+
+// WithProposed sets the value in the proposal
+func (e *RejectionError) WithProposed(proposed big.Int) *RejectionError {
+	e.Rejection.Proposed = proposed
+	return e
+}
+
+func (e *RejectionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RejectionError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,293 @@
+// Package sharding splits a dataset that is too large for a single storage
+// deal into shards that each fit in a piece, and proposes a deal for each
+// shard.
+//
+// The shards are written as CAR files to a directory, along with a manifest
+// that maps the dataset root to the shard roots and their deals. The Sharder
+// is a storagemarket.BlockstoreAccessor for the shard roots, so it can be
+// given to the storage client to transfer the shards to the provider.
+package sharding
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	bstore "github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/clientutils"
+	"github.com/filecoin-project/go-fil-markets/stores"
+)
+
+// DefaultMaxTraversalLinks is the default budget of links to traverse when
+// computing the CommP of a shard
+const DefaultMaxTraversalLinks = 2 << 29
+
+// Sharder splits datasets into shards that fit in a piece, and keeps the
+// shards and their manifests in a directory
+type Sharder struct {
+	dir               string
+	next              storagemarket.BlockstoreAccessor
+	maxTraversalLinks uint64
+	bstores           *stores.ReadOnlyBlockstores
+}
+
+var _ storagemarket.BlockstoreAccessor = (*Sharder)(nil)
+
+// Option configures a Sharder
+type Option func(*Sharder)
+
+// MaxTraversalLinks sets the budget of links to traverse when computing the
+// CommP of a shard
+func MaxTraversalLinks(m uint64) Option {
+	return func(s *Sharder) {
+		s.maxTraversalLinks = m
+	}
+}
+
+// NewSharder returns a Sharder that keeps shards in dir. As a
+// BlockstoreAccessor it returns the blockstores of shards, and passes other
+// payloads on to next, which may be nil.
+func NewSharder(dir string, next storagemarket.BlockstoreAccessor, options ...Option) *Sharder {
+	s := &Sharder{
+		dir:               dir,
+		next:              next,
+		maxTraversalLinks: DefaultMaxTraversalLinks,
+		bstores:           stores.NewReadOnlyBlockstores(),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// MaxPieceSize returns the largest piece that a provider accepts in a deal,
+// which is the smaller of its sector size and the max piece size in its ask
+func MaxPieceSize(info storagemarket.StorageProviderInfo, ask storagemarket.StorageAsk) abi.PaddedPieceSize {
+	size := abi.PaddedPieceSize(info.SectorSize)
+	if ask.MaxPieceSize != 0 && ask.MaxPieceSize < size {
+		size = ask.MaxPieceSize
+	}
+	return size
+}
+
+// Split splits the DAG under root in the blockstore into shards that each fit
+// in a piece no larger than maxPieceSize. It writes the shards as CAR files,
+// computes the CommP of each, and saves and returns the dataset's manifest.
+// A DAG that fits in a single piece has one shard, whose root is the DAG root.
+func (s *Sharder) Split(ctx context.Context, bs bstore.Blockstore, root cid.Cid, maxPieceSize abi.PaddedPieceSize) (*Manifest, error) {
+	if err := maxPieceSize.Validate(); err != nil {
+		return nil, xerrors.Errorf("invalid max piece size: %w", err)
+	}
+	limit := uint64(maxPieceSize.Unpadded())
+
+	sp, err := newSplitter(ctx, bs, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, xerrors.Errorf("creating shard directory: %w", err)
+	}
+
+	manifest := &Manifest{Root: root, MaxPieceSize: maxPieceSize}
+
+	size, err := sp.treeSize(root)
+	if err != nil {
+		return nil, xerrors.Errorf("measuring DAG: %w", err)
+	}
+	if sp.emptySize+size <= limit {
+		// the DAG fits in one piece as it is
+		shard, err := s.writeShard(ctx, bs, root, nil, []part{{root: root}})
+		if err != nil {
+			return nil, err
+		}
+		manifest.Shards = append(manifest.Shards, *shard)
+		return manifest, s.saveManifest(manifest)
+	}
+
+	if err := sp.split(root); err != nil {
+		return nil, xerrors.Errorf("splitting DAG: %w", err)
+	}
+	for i, planned := range sp.shards {
+		rootBlock, err := shardRootBlock(planned.parts)
+		if err != nil {
+			return nil, err
+		}
+		shard, err := s.writeShard(ctx, bs, rootBlock.Cid(), rootBlock, planned.parts)
+		if err != nil {
+			return nil, xerrors.Errorf("writing shard %d: %w", i, err)
+		}
+		manifest.Shards = append(manifest.Shards, *shard)
+	}
+	return manifest, s.saveManifest(manifest)
+}
+
+// writeShard writes a shard to a CAR file and computes its CommP
+func (s *Sharder) writeShard(ctx context.Context, bs bstore.Blockstore, root cid.Cid, rootBlock blocks.Block, parts []part) (*Shard, error) {
+	carPath := s.carPath(root)
+	// a CAR left over from an earlier attempt is overwritten
+	if err := os.Remove(carPath); err != nil && !os.IsNotExist(err) {
+		return nil, xerrors.Errorf("removing old shard CAR: %w", err)
+	}
+
+	rw, err := stores.ReadWriteFilestore(carPath, root)
+	if err != nil {
+		return nil, xerrors.Errorf("creating shard CAR: %w", err)
+	}
+	if err := putShardBlocks(ctx, bs, rw, rootBlock, parts); err != nil {
+		_ = rw.Close()
+		return nil, err
+	}
+	if err := rw.Close(); err != nil {
+		return nil, xerrors.Errorf("finalizing shard CAR: %w", err)
+	}
+
+	ro, err := stores.ReadOnlyFilestore(carPath)
+	if err != nil {
+		return nil, xerrors.Errorf("opening shard CAR: %w", err)
+	}
+	defer ro.Close() //nolint:errcheck
+
+	pieceCid, pieceSize, err := clientutils.CommP(ctx, ro, &storagemarket.DataRef{
+		TransferType: storagemarket.TTGraphsync,
+		Root:         root,
+	}, s.maxTraversalLinks)
+	if err != nil {
+		return nil, xerrors.Errorf("computing CommP of shard: %w", err)
+	}
+
+	shard := &Shard{
+		Root:      root,
+		PieceCid:  pieceCid,
+		PieceSize: pieceSize,
+		CarPath:   carPath,
+	}
+	for _, p := range parts {
+		shard.Parts = append(shard.Parts, p.root)
+	}
+	return shard, nil
+}
+
+// Propose proposes a deal for each shard in the manifest that hasn't been
+// proposed yet, with the given deal parameters, and records the deals in the
+// manifest. The client must get the shards' blockstores from this Sharder.
+// If proposing a shard fails, Propose can be called again to propose the rest.
+func (s *Sharder) Propose(ctx context.Context, client storagemarket.StorageClient, params storagemarket.ProposeStorageDealParams, manifest *Manifest) error {
+	transferType := storagemarket.TTGraphsync
+	if params.Data != nil && params.Data.TransferType != "" {
+		transferType = params.Data.TransferType
+	}
+
+	for i := range manifest.Shards {
+		shard := &manifest.Shards[i]
+		if shard.ProposalCid != nil {
+			continue
+		}
+
+		pieceCid := shard.PieceCid
+		shardParams := params
+		shardParams.Data = &storagemarket.DataRef{
+			TransferType: transferType,
+			Root:         shard.Root,
+			PieceCid:     &pieceCid,
+			PieceSize:    shard.PieceSize,
+		}
+		result, err := client.ProposeStorageDeal(ctx, shardParams)
+		if err != nil {
+			return xerrors.Errorf("proposing shard %d of %s: %w", i, manifest.Root, err)
+		}
+
+		proposalCid := result.ProposalCid
+		provider := params.Info.Address
+		shard.Provider = &provider
+		shard.ProposalCid = &proposalCid
+		if err := s.saveManifest(manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Manifest returns the saved manifest of the dataset with the given root
+func (s *Sharder) Manifest(root cid.Cid) (*Manifest, error) {
+	data, err := os.ReadFile(s.manifestPath(root))
+	if err != nil {
+		return nil, xerrors.Errorf("reading manifest of %s: %w", root, err)
+	}
+	var manifest Manifest
+	if err := manifest.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+		return nil, xerrors.Errorf("decoding manifest of %s: %w", root, err)
+	}
+	return &manifest, nil
+}
+
+func (s *Sharder) saveManifest(manifest *Manifest) error {
+	var buf bytes.Buffer
+	if err := manifest.MarshalCBOR(&buf); err != nil {
+		return xerrors.Errorf("encoding manifest: %w", err)
+	}
+	// write to a temporary file first, so a crash doesn't leave a partial manifest
+	tmp := s.manifestPath(manifest.Root) + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return xerrors.Errorf("writing manifest: %w", err)
+	}
+	if err := os.Rename(tmp, s.manifestPath(manifest.Root)); err != nil {
+		return xerrors.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
+
+// Get returns the blockstore of the shard with the given root, or gets the
+// blockstore of any other payload from the next BlockstoreAccessor
+func (s *Sharder) Get(root storagemarket.PayloadCID) (bstore.Blockstore, error) {
+	if bs, err := s.bstores.Get(root.String()); err == nil {
+		return bs, nil
+	}
+
+	carPath := s.carPath(root)
+	if _, err := os.Stat(carPath); err != nil {
+		if os.IsNotExist(err) && s.next != nil {
+			return s.next.Get(root)
+		}
+		return nil, xerrors.Errorf("no shard with root %s: %w", root, err)
+	}
+
+	bs, err := stores.ReadOnlyFilestore(carPath)
+	if err != nil {
+		return nil, xerrors.Errorf("opening shard CAR: %w", err)
+	}
+	if ok, err := s.bstores.Track(root.String(), bs); err != nil || !ok {
+		// another caller opened the shard at the same time
+		_ = bs.Close()
+		return s.bstores.Get(root.String())
+	}
+	return bs, nil
+}
+
+// Done closes the blockstore of the shard with the given root, or passes the
+// call on to the next BlockstoreAccessor
+func (s *Sharder) Done(root storagemarket.PayloadCID) error {
+	if _, err := s.bstores.Get(root.String()); err == nil {
+		return s.bstores.Untrack(root.String())
+	}
+	if s.next != nil {
+		return s.next.Done(root)
+	}
+	return nil
+}
+
+func (s *Sharder) carPath(root cid.Cid) string {
+	return filepath.Join(s.dir, root.String()+".car")
+}
+
+func (s *Sharder) manifestPath(root cid.Cid) string {
+	return filepath.Join(s.dir, root.String()+".manifest")
+}
@@ -0,0 +1,198 @@
+package sharding
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ipfs/boxo/blockservice"
+	bstore "github.com/ipfs/boxo/blockstore"
+	chunk "github.com/ipfs/boxo/chunker"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	files "github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	unixfile "github.com/ipfs/boxo/ipld/unixfs/file"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	ihelper "github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/go-fil-markets/shared_testutil"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+)
+
+func TestSplit(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("dataset larger than a piece", func(t *testing.T) {
+		bs, root, data := importFile(t, 256<<10)
+		maxPieceSize := abi.PaddedPieceSize(64 << 10)
+
+		s := NewSharder(t.TempDir(), nil)
+		manifest, err := s.Split(ctx, bs, root, maxPieceSize)
+		require.NoError(t, err)
+		require.Equal(t, root, manifest.Root)
+		require.Greater(t, len(manifest.Shards), 1)
+
+		// the blocks of all the shards together make up the original DAG
+		combined := newBlockstore()
+		for _, shard := range manifest.Shards {
+			require.NotEqual(t, root, shard.Root)
+			require.LessOrEqual(t, shard.PieceSize.Padded(), maxPieceSize)
+
+			shardBs, err := s.Get(shard.Root)
+			require.NoError(t, err)
+			has, err := shardBs.Has(ctx, shard.Root)
+			require.NoError(t, err)
+			require.True(t, has)
+			copyBlocks(t, shardBs, combined)
+			require.NoError(t, s.Done(shard.Root))
+		}
+		require.Equal(t, data, readFile(t, combined, root))
+
+		saved, err := s.Manifest(root)
+		require.NoError(t, err)
+		require.Equal(t, manifest, saved)
+	})
+
+	t.Run("dataset that fits in a piece", func(t *testing.T) {
+		bs, root, data := importFile(t, 16<<10)
+
+		s := NewSharder(t.TempDir(), nil)
+		manifest, err := s.Split(ctx, bs, root, abi.PaddedPieceSize(64<<10))
+		require.NoError(t, err)
+		require.Len(t, manifest.Shards, 1)
+		require.Equal(t, root, manifest.Shards[0].Root)
+
+		shardBs, err := s.Get(root)
+		require.NoError(t, err)
+		require.Equal(t, data, readFile(t, shardBs, root))
+		require.NoError(t, s.Done(root))
+	})
+
+	t.Run("max piece size too small", func(t *testing.T) {
+		bs, root, _ := importFile(t, 16<<10)
+
+		s := NewSharder(t.TempDir(), nil)
+		_, err := s.Split(ctx, bs, root, abi.PaddedPieceSize(128))
+		require.Error(t, err)
+	})
+}
+
+// proposingClient records the deals proposed to it
+type proposingClient struct {
+	storagemarket.StorageClient
+	proposed []storagemarket.ProposeStorageDealParams
+}
+
+func (c *proposingClient) ProposeStorageDeal(_ context.Context, params storagemarket.ProposeStorageDealParams) (*storagemarket.ProposeStorageDealResult, error) {
+	c.proposed = append(c.proposed, params)
+	return &storagemarket.ProposeStorageDealResult{ProposalCid: shared_testutil.GenerateCids(1)[0]}, nil
+}
+
+func TestPropose(t *testing.T) {
+	ctx := context.Background()
+	bs, root, _ := importFile(t, 256<<10)
+	s := NewSharder(t.TempDir(), nil)
+	manifest, err := s.Split(ctx, bs, root, abi.PaddedPieceSize(64<<10))
+	require.NoError(t, err)
+
+	client := &proposingClient{}
+	params := storagemarket.ProposeStorageDealParams{Info: &storagemarket.StorageProviderInfo{Address: address.TestAddress2}}
+	require.NoError(t, s.Propose(ctx, client, params, manifest))
+	require.Len(t, client.proposed, len(manifest.Shards))
+
+	// the saved manifest records each shard's deal
+	saved, err := s.Manifest(root)
+	require.NoError(t, err)
+	for i, shard := range saved.Shards {
+		require.Equal(t, shard.Root, client.proposed[i].Data.Root)
+		require.Equal(t, address.TestAddress2, *shard.Provider)
+		require.NotNil(t, shard.ProposalCid)
+	}
+
+	// shards that have been proposed are not proposed again
+	require.NoError(t, s.Propose(ctx, client, params, saved))
+	require.Len(t, client.proposed, len(manifest.Shards))
+}
+
+func TestGetFallsBackToNext(t *testing.T) {
+	next := &testAccessor{bs: newBlockstore()}
+	s := NewSharder(t.TempDir(), next)
+
+	root := shared_testutil.GenerateCids(1)[0]
+	bs, err := s.Get(root)
+	require.NoError(t, err)
+	require.Equal(t, next.bs, bs)
+	require.NoError(t, s.Done(root))
+	require.Equal(t, []cid.Cid{root}, next.done)
+}
+
+type testAccessor struct {
+	bs   bstore.Blockstore
+	done []cid.Cid
+}
+
+func (a *testAccessor) Get(storagemarket.PayloadCID) (bstore.Blockstore, error) {
+	return a.bs, nil
+}
+
+func (a *testAccessor) Done(root storagemarket.PayloadCID) error {
+	a.done = append(a.done, root)
+	return nil
+}
+
+func newBlockstore() bstore.Blockstore {
+	return bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+}
+
+// importFile imports random data of the given size as a UnixFS file with a
+// narrow tree, so that it is deep enough to be split
+func importFile(t *testing.T, size int) (bstore.Blockstore, cid.Cid, []byte) {
+	bs := newBlockstore()
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	data := shared_testutil.RandomBytes(int64(size))
+
+	prefix, err := merkledag.PrefixForCidVersion(1)
+	require.NoError(t, err)
+	params := ihelper.DagBuilderParams{
+		Maxlinks:   8,
+		RawLeaves:  true,
+		CidBuilder: prefix,
+		Dagserv:    dag,
+	}
+	db, err := params.New(chunk.NewSizeSplitter(bytes.NewReader(data), 1024))
+	require.NoError(t, err)
+	nd, err := balanced.Layout(db)
+	require.NoError(t, err)
+	return bs, nd.Cid(), data
+}
+
+func copyBlocks(t *testing.T, from, to bstore.Blockstore) {
+	ctx := context.Background()
+	keys, err := from.AllKeysChan(ctx)
+	require.NoError(t, err)
+	for c := range keys {
+		blk, err := from.Get(ctx, c)
+		require.NoError(t, err)
+		require.NoError(t, to.Put(ctx, blk))
+	}
+}
+
+func readFile(t *testing.T, bs bstore.Blockstore, root cid.Cid) []byte {
+	ctx := context.Background()
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	nd, err := dag.Get(ctx, root)
+	require.NoError(t, err)
+	f, err := unixfile.NewUnixfsFile(ctx, dag, nd)
+	require.NoError(t, err)
+	data, err := io.ReadAll(f.(files.File))
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,327 @@
+package sharding
+
+import (
+	"bytes"
+	"context"
+
+	bstore "github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	_ "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime"
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	_ "github.com/ipld/go-ipld-prime/codec/raw"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/multiformats/go-multihash"
+	"github.com/multiformats/go-varint"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/stores"
+)
+
+// shardRootPrefix is the CID prefix of the DAG-CBOR list of links at the root
+// of a shard
+var shardRootPrefix = cid.Prefix{
+	Version:  1,
+	Codec:    cid.DagCBOR,
+	MhType:   multihash.SHA2_256,
+	MhLength: -1,
+}
+
+// linkOverhead is the most bytes that a link to a part adds to the shard root
+const linkOverhead = 8
+
+// part is a sub-DAG that is stored in a shard in full, or an intermediate
+// block that is stored on its own
+type part struct {
+	root cid.Cid
+	// block is true if the part is only the root block
+	block bool
+}
+
+// plannedShard is the parts of a shard, and an upper bound on the size of the
+// shard's CARv1 payload
+type plannedShard struct {
+	parts []part
+	size  uint64
+}
+
+// splitter plans how to split a DAG into shards whose CARv1 payloads are no
+// larger than limit. A sub-DAG that fits in the space left in a shard is added
+// to it in full, and one that doesn't fit in an empty shard is split by
+// storing its root block on its own and splitting each of its children.
+type splitter struct {
+	ctx   context.Context
+	bs    bstore.Blockstore
+	limit uint64
+	// emptySize is the size of the CARv1 payload of a shard with no parts
+	emptySize uint64
+	// treeSizes are the sizes of the sub-DAGs that have been measured,
+	// counting shared blocks once for each link to them
+	treeSizes map[cid.Cid]uint64
+	shards    []*plannedShard
+}
+
+func newSplitter(ctx context.Context, bs bstore.Blockstore, limit uint64) (*splitter, error) {
+	// a placeholder root with the same length as a shard root
+	placeholder, err := shardRootPrefix.Sum(nil)
+	if err != nil {
+		return nil, err
+	}
+	headerSize, err := stores.HeaderSize(&stores.CarHeader{Roots: []cid.Cid{placeholder}, Version: 1})
+	if err != nil {
+		return nil, xerrors.Errorf("computing CAR header size: %w", err)
+	}
+	// the empty DAG-CBOR list and its section
+	emptySize := headerSize + stores.LdSize(placeholder.Bytes(), []byte{0x80}) + linkOverhead
+	if emptySize >= limit {
+		return nil, xerrors.Errorf("max piece size is too small to hold a shard")
+	}
+
+	return &splitter{
+		ctx:       ctx,
+		bs:        bs,
+		limit:     limit,
+		emptySize: emptySize,
+		treeSizes: make(map[cid.Cid]uint64),
+	}, nil
+}
+
+// split adds the DAG under c to the shards
+func (s *splitter) split(c cid.Cid) error {
+	size, err := s.treeSize(c)
+	if err != nil {
+		return err
+	}
+	if s.emptySize+size+uint64(len(c.Bytes()))+linkOverhead <= s.limit {
+		s.add(part{root: c}, size)
+		return nil
+	}
+
+	data, links, err := s.load(c)
+	if err != nil {
+		return err
+	}
+	rawCid := cid.NewCidV1(cid.Raw, c.Hash())
+	blockSize := sectionSize(rawCid, len(data))
+	if s.emptySize+blockSize+uint64(len(rawCid.Bytes()))+linkOverhead > s.limit {
+		return xerrors.Errorf("block %s of %d bytes does not fit in a piece", c, len(data))
+	}
+	s.add(part{root: c, block: true}, blockSize)
+
+	for _, link := range links {
+		if err := s.split(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add adds a part to the last shard if there is space for it, or else to a
+// new shard
+func (s *splitter) add(p part, size uint64) {
+	size += uint64(len(p.root.Bytes())) + linkOverhead
+	if len(s.shards) == 0 || s.shards[len(s.shards)-1].size+size > s.limit {
+		s.shards = append(s.shards, &plannedShard{size: s.emptySize})
+	}
+	shard := s.shards[len(s.shards)-1]
+	shard.parts = append(shard.parts, p)
+	shard.size += size
+}
+
+// treeSize returns the size of the CAR sections of the blocks in the DAG
+// under c. Blocks that are linked more than once are counted each time, so it
+// is an upper bound on the size of the DAG in a CAR.
+func (s *splitter) treeSize(c cid.Cid) (uint64, error) {
+	if size, ok := s.treeSizes[c]; ok {
+		return size, nil
+	}
+
+	var size uint64
+	if c.Prefix().Codec == cid.Raw && c.Prefix().MhType != multihash.IDENTITY {
+		// raw blocks have no links, so there's no need to read them
+		blockSize, err := s.bs.GetSize(s.ctx, c)
+		if err != nil {
+			return 0, xerrors.Errorf("getting size of block %s: %w", c, err)
+		}
+		size = sectionSize(c, blockSize)
+	} else {
+		data, links, err := s.load(c)
+		if err != nil {
+			return 0, err
+		}
+		if c.Prefix().MhType != multihash.IDENTITY {
+			size = sectionSize(c, len(data))
+		}
+		for _, link := range links {
+			linkSize, err := s.treeSize(link)
+			if err != nil {
+				return 0, err
+			}
+			size += linkSize
+		}
+	}
+
+	s.treeSizes[c] = size
+	return size, nil
+}
+
+// sectionSize returns the size of the CAR section for a block
+func sectionSize(c cid.Cid, blockSize int) uint64 {
+	size := uint64(len(c.Bytes()) + blockSize)
+	return size + uint64(varint.UvarintSize(size))
+}
+
+// load returns the data of a block and the CIDs it links to
+func (s *splitter) load(c cid.Cid) ([]byte, []cid.Cid, error) {
+	data, err := loadBlock(s.ctx, s.bs, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	links, err := blockLinks(c, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, links, nil
+}
+
+func loadBlock(ctx context.Context, bs bstore.Blockstore, c cid.Cid) ([]byte, error) {
+	if c.Prefix().MhType == multihash.IDENTITY {
+		decoded, err := multihash.Decode(c.Hash())
+		if err != nil {
+			return nil, xerrors.Errorf("decoding identity CID %s: %w", c, err)
+		}
+		return decoded.Digest, nil
+	}
+	blk, err := bs.Get(ctx, c)
+	if err != nil {
+		return nil, xerrors.Errorf("getting block %s: %w", c, err)
+	}
+	return blk.RawData(), nil
+}
+
+// blockLinks returns the CIDs that a block links to
+func blockLinks(c cid.Cid, data []byte) ([]cid.Cid, error) {
+	if c.Prefix().Codec == cid.Raw {
+		return nil, nil
+	}
+	decoder, err := cidlink.DefaultLinkSystem().DecoderChooser(cidlink.Link{Cid: c})
+	if err != nil {
+		return nil, xerrors.Errorf("choosing decoder for block %s: %w", c, err)
+	}
+	node, err := ipld.Decode(data, decoder)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding block %s: %w", c, err)
+	}
+	links, err := traversal.SelectLinks(node)
+	if err != nil {
+		return nil, xerrors.Errorf("collecting links from block %s: %w", c, err)
+	}
+	cids := make([]cid.Cid, 0, len(links))
+	for _, link := range links {
+		cids = append(cids, link.(cidlink.Link).Cid)
+	}
+	return cids, nil
+}
+
+// shardRootBlock returns the DAG-CBOR list of links to a shard's parts
+func shardRootBlock(parts []part) (blocks.Block, error) {
+	node, err := qp.BuildList(basicnode.Prototype.List, int64(len(parts)), func(la datamodel.ListAssembler) {
+		for _, p := range parts {
+			qp.ListEntry(la, qp.Link(cidlink.Link{Cid: partLink(p)}))
+		}
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("building shard root: %w", err)
+	}
+
+	encoder, err := cidlink.DefaultLinkSystem().EncoderChooser(cidlink.LinkPrototype{Prefix: shardRootPrefix})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := encoder(node, &buf); err != nil {
+		return nil, xerrors.Errorf("encoding shard root: %w", err)
+	}
+	c, err := shardRootPrefix.Sum(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return blocks.NewBlockWithCid(buf.Bytes(), c)
+}
+
+// partLink returns the CID that a shard root links to a part with
+func partLink(p part) cid.Cid {
+	if p.block {
+		return cid.NewCidV1(cid.Raw, p.root.Hash())
+	}
+	return p.root
+}
+
+// putShardBlocks writes the blocks of a shard to the blockstore
+func putShardBlocks(ctx context.Context, from bstore.Blockstore, to bstore.Blockstore, root blocks.Block, parts []part) error {
+	if root != nil {
+		if err := to.Put(ctx, root); err != nil {
+			return xerrors.Errorf("writing shard root: %w", err)
+		}
+	}
+
+	written := make(map[cid.Cid]struct{})
+	var write func(c cid.Cid) error
+	write = func(c cid.Cid) error {
+		if _, ok := written[c]; ok {
+			return nil
+		}
+		written[c] = struct{}{}
+
+		data, err := loadBlock(ctx, from, c)
+		if err != nil {
+			return err
+		}
+		if c.Prefix().MhType != multihash.IDENTITY {
+			blk, err := blocks.NewBlockWithCid(data, c)
+			if err != nil {
+				return err
+			}
+			if err := to.Put(ctx, blk); err != nil {
+				return xerrors.Errorf("writing block %s: %w", c, err)
+			}
+		}
+		links, err := blockLinks(c, data)
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if err := write(link); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, p := range parts {
+		if !p.block {
+			if err := write(p.root); err != nil {
+				return err
+			}
+			continue
+		}
+
+		data, err := loadBlock(ctx, from, p.root)
+		if err != nil {
+			return err
+		}
+		blk, err := blocks.NewBlockWithCid(data, partLink(p))
+		if err != nil {
+			return err
+		}
+		if err := to.Put(ctx, blk); err != nil {
+			return xerrors.Errorf("writing block %s: %w", p.root, err)
+		}
+	}
+	return nil
+}
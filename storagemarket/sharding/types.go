@@ -0,0 +1,47 @@
+package sharding
+
+import (
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+//go:generate cbor-gen-for --map-encoding Manifest Shard
+
+// Manifest records how a dataset was split into shards, and the deal made for
+// each shard. A dataset is retrieved by retrieving every shard root; the
+// blocks of all the shards together make up the original DAG.
+type Manifest struct {
+	// Root is the root of the original dataset
+	Root cid.Cid
+	// MaxPieceSize is the largest piece that the shards were split to fit in
+	MaxPieceSize abi.PaddedPieceSize
+	// Shards are the shards the dataset was split into
+	Shards []Shard
+}
+
+// Shard is a part of a dataset that fits in a single deal.
+//
+// If the whole dataset fits in one piece, the only shard's root is the
+// dataset root. Otherwise a shard's root is a DAG-CBOR list of links to the
+// shard's parts. A part is either the root of a sub-DAG that is stored in the
+// shard in full, or a block on the path from the dataset root to the sub-DAGs,
+// which is linked with the raw codec so that the blocks it links to are not
+// part of the shard. The raw block has the same multihash as the original
+// block, so a blockstore keyed by multihash returns it for the original CID.
+type Shard struct {
+	// Root is the payload root of the shard's deal
+	Root cid.Cid
+	// Parts are the CIDs of the sub-DAG roots and intermediate blocks in the
+	// shard, with their original codecs
+	Parts []cid.Cid
+	// PieceCid and PieceSize are the shard's piece
+	PieceCid  cid.Cid
+	PieceSize abi.UnpaddedPieceSize
+	// CarPath is the path of the CAR file with the shard's blocks
+	CarPath string
+	// Provider and ProposalCid identify the shard's deal, once it is proposed
+	Provider    *address.Address
+	ProposalCid *cid.Cid
+}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	bstore "github.com/ipfs/boxo/blockstore"
 	"github.com/ipfs/go-cid"
@@ -124,6 +125,7 @@ func NewHarnessWithTestData(t *testing.T, td *shared_testutil.Libp2pTestData, de
 		deps.ProviderAddr,
 		deps.StoredAsk,
 		&MeshCreatorStub{},
+		storageimpl.DealChecks(100, time.Minute),
 	)
 	assert.NoError(t, err)
 
@@ -169,9 +171,16 @@ func (h *StorageHarness) CreateNewProvider(t *testing.T, ctx context.Context, td
 }
 
 func (h *StorageHarness) ProposeStorageDeal(t *testing.T, dataRef *storagemarket.DataRef, fastRetrieval, verifiedDeal bool) *storagemarket.ProposeStorageDealResult {
+	result, err := h.Client.ProposeStorageDeal(h.Ctx, h.DealParams(dataRef, fastRetrieval, verifiedDeal))
+	require.NoError(t, err)
+	return result
+}
+
+// DealParams returns the parameters of a deal that the provider accepts
+func (h *StorageHarness) DealParams(dataRef *storagemarket.DataRef, fastRetrieval, verifiedDeal bool) storagemarket.ProposeStorageDealParams {
 	var dealDuration = abi.ChainEpoch(180 * builtin.EpochsInDay)
 
-	result, err := h.Client.ProposeStorageDeal(h.Ctx, storagemarket.ProposeStorageDealParams{
+	return storagemarket.ProposeStorageDealParams{
 		Addr:          h.ClientAddr,
 		Info:          &h.ProviderInfo,
 		Data:          dataRef,
@@ -182,9 +191,7 @@ func (h *StorageHarness) ProposeStorageDeal(t *testing.T, dataRef *storagemarket
 		Rt:            abi.RegisteredSealProof_StackedDrg2KiBV1,
 		FastRetrieval: fastRetrieval,
 		VerifiedDeal:  verifiedDeal,
-	})
-	require.NoError(t, err)
-	return result
+	}
 }
 
 func (h *StorageHarness) WaitForProviderEvent(wg *sync.WaitGroup, waitEvent storagemarket.ProviderEvent) {
@@ -21,12 +21,13 @@ import (
 
 var log = logging.Logger("storagemrkt")
 
-//go:generate cbor-gen-for --map-encoding ClientDeal MinerDeal Balance SignedStorageAsk StorageAsk DataRef ProviderDealState DealStages DealStage Log
+//go:generate cbor-gen-for --map-encoding ClientDeal MinerDeal Balance SignedStorageAsk StorageAsk DataRef ProviderDealState DealStages DealStage Log Rejection DealNegotiation
 
 // The ID for the libp2p protocol for proposing storage deals.
 const DealProtocolID101 = "/fil/storage/mk/1.0.1"
 const DealProtocolID110 = "/fil/storage/mk/1.1.0"
 const DealProtocolID111 = "/fil/storage/mk/1.1.1"
+const DealProtocolID120 = "/fil/storage/mk/1.2.0"
 
 // AskProtocolID is the ID for the libp2p protocol for querying miners for their current StorageAsk.
 const OldAskProtocolID = "/fil/storage/ask/1.0.1"
@@ -36,6 +37,18 @@ const AskProtocolID = "/fil/storage/ask/1.1.0"
 const OldDealStatusProtocolID = "/fil/storage/status/1.0.1"
 const DealStatusProtocolID = "/fil/storage/status/1.1.0"
 
+// BatchDealStatusProtocolID is the ID for the version of the deal status protocol that
+// queries the status of many deals in one request.
+const BatchDealStatusProtocolID = "/fil/storage/status/1.2.0"
+
+// DealCheckProtocolID is the ID for the libp2p protocol for asking miners whether they would
+// accept a deal proposal, without proposing the deal.
+const DealCheckProtocolID = "/fil/storage/check/1.0.0"
+
+// DealCancelProtocolID is the ID for the libp2p protocol for clients to cancel a deal
+// with a miner before it is published.
+const DealCancelProtocolID = "/fil/storage/cancel/1.0.0"
+
 // Balance represents a current balance of funds in the StorageMarketActor.
 type Balance struct {
 	Locked    abi.TokenAmount
@@ -115,6 +128,10 @@ type MinerDeal struct {
 	SectorNumber      abi.SectorNumber
 
 	InboundCAR string
+
+	// Rejection is the reason the deal was rejected, if it was rejected
+	// while validating the proposal
+	Rejection *Rejection
 }
 
 // NewDealStages creates a new DealStages object ready to be used.
@@ -250,6 +267,32 @@ type ClientDeal struct {
 	CreationTime      cbg.CborTime
 	TransferChannelID *datatransfer.ChannelID
 	SectorNumber      abi.SectorNumber
+	// Rejection is the provider's reason for rejecting the proposal, if it
+	// rejected it and gave a reason
+	Rejection *Rejection
+	// Negotiation is the limits within which the deal is re-proposed if the
+	// provider rejects it because of its price or collateral
+	Negotiation *DealNegotiation
+	// ReproposalOf is the proposal that this deal re-proposes
+	ReproposalOf *cid.Cid
+	// ReproposedAs is the proposal that re-proposed this deal after the
+	// provider rejected it
+	ReproposedAs *cid.Cid
+}
+
+// DealNegotiation sets the limits within which a client re-proposes a deal
+// that the provider rejected because of its price or collateral. The client
+// fetches the provider's current ask and re-proposes the deal with the price
+// or collateral that the provider requires, if it is within the limits.
+type DealNegotiation struct {
+	// MaxStoragePricePerEpoch is the highest storage price per epoch that
+	// the client proposes for the deal
+	MaxStoragePricePerEpoch abi.TokenAmount
+	// MaxProviderCollateral is the highest provider collateral that the
+	// client proposes for the deal
+	MaxProviderCollateral abi.TokenAmount
+	// MaxReproposals is how many more times the deal is re-proposed at most
+	MaxReproposals uint64
 }
 
 // StorageProviderInfo describes on chain information about a StorageProvider
@@ -280,6 +323,9 @@ type ProposeStorageDealParams struct {
 	Rt            abi.RegisteredSealProof
 	FastRetrieval bool
 	VerifiedDeal  bool
+	// Negotiation is optional. If it is set, the deal is re-proposed within
+	// its limits if the provider rejects it because of its price or collateral.
+	Negotiation *DealNegotiation
 }
 
 const (
@@ -32,7 +32,7 @@ func (t *ClientDeal) MarshalCBOR(w io.Writer) error {
 
 	cw := cbg.NewCborWriter(w)
 
-	if _, err := cw.Write([]byte{179}); err != nil {
+	if _, err := cw.Write([]byte{183}); err != nil {
 		return err
 	}
 
@@ -130,6 +130,22 @@ func (t *ClientDeal) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
+	// t.Rejection (storagemarket.Rejection) (struct)
+	if len("Rejection") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Rejection\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Rejection"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Rejection")); err != nil {
+		return err
+	}
+
+	if err := t.Rejection.MarshalCBOR(cw); err != nil {
+		return err
+	}
+
 	// t.DealStages (storagemarket.DealStages) (struct)
 	if len("DealStages") > cbg.MaxLength {
 		return xerrors.Errorf("Value in field \"DealStages\" was too long")
@@ -206,6 +222,22 @@ func (t *ClientDeal) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
+	// t.Negotiation (storagemarket.DealNegotiation) (struct)
+	if len("Negotiation") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Negotiation\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Negotiation"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Negotiation")); err != nil {
+		return err
+	}
+
+	if err := t.Negotiation.MarshalCBOR(cw); err != nil {
+		return err
+	}
+
 	// t.ProposalCid (cid.Cid) (struct)
 	if len("ProposalCid") > cbg.MaxLength {
 		return xerrors.Errorf("Value in field \"ProposalCid\" was too long")
@@ -238,6 +270,50 @@ func (t *ClientDeal) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
+	// t.ReproposalOf (cid.Cid) (struct)
+	if len("ReproposalOf") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"ReproposalOf\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("ReproposalOf"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("ReproposalOf")); err != nil {
+		return err
+	}
+
+	if t.ReproposalOf == nil {
+		if _, err := cw.Write(cbg.CborNull); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteCid(cw, *t.ReproposalOf); err != nil {
+			return xerrors.Errorf("failed to write cid field t.ReproposalOf: %w", err)
+		}
+	}
+
+	// t.ReproposedAs (cid.Cid) (struct)
+	if len("ReproposedAs") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"ReproposedAs\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("ReproposedAs"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("ReproposedAs")); err != nil {
+		return err
+	}
+
+	if t.ReproposedAs == nil {
+		if _, err := cw.Write(cbg.CborNull); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteCid(cw, *t.ReproposedAs); err != nil {
+			return xerrors.Errorf("failed to write cid field t.ReproposedAs: %w", err)
+		}
+	}
+
 	// t.SectorNumber (abi.SectorNumber) (uint64)
 	if len("SectorNumber") > cbg.MaxLength {
 		return xerrors.Errorf("Value in field \"SectorNumber\" was too long")
@@ -484,6 +560,26 @@ func (t *ClientDeal) UnmarshalCBOR(r io.Reader) (err error) {
 
 				t.Message = string(sval)
 			}
+			// t.Rejection (storagemarket.Rejection) (struct)
+		case "Rejection":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+					t.Rejection = new(Rejection)
+					if err := t.Rejection.UnmarshalCBOR(cr); err != nil {
+						return xerrors.Errorf("unmarshaling t.Rejection pointer: %w", err)
+					}
+				}
+
+			}
 			// t.DealStages (storagemarket.DealStages) (struct)
 		case "DealStages":
 
@@ -562,6 +658,26 @@ func (t *ClientDeal) UnmarshalCBOR(r io.Reader) (err error) {
 					return xerrors.Errorf("unmarshaling t.MinerWorker: %w", err)
 				}
 
+			}
+			// t.Negotiation (storagemarket.DealNegotiation) (struct)
+		case "Negotiation":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+					t.Negotiation = new(DealNegotiation)
+					if err := t.Negotiation.UnmarshalCBOR(cr); err != nil {
+						return xerrors.Errorf("unmarshaling t.Negotiation pointer: %w", err)
+					}
+				}
+
 			}
 			// t.ProposalCid (cid.Cid) (struct)
 		case "ProposalCid":
@@ -585,6 +701,52 @@ func (t *ClientDeal) UnmarshalCBOR(r io.Reader) (err error) {
 					return xerrors.Errorf("unmarshaling t.CreationTime: %w", err)
 				}
 
+			}
+			// t.ReproposalOf (cid.Cid) (struct)
+		case "ReproposalOf":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+
+					c, err := cbg.ReadCid(cr)
+					if err != nil {
+						return xerrors.Errorf("failed to read cid field t.ReproposalOf: %w", err)
+					}
+
+					t.ReproposalOf = &c
+				}
+
+			}
+			// t.ReproposedAs (cid.Cid) (struct)
+		case "ReproposedAs":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+
+					c, err := cbg.ReadCid(cr)
+					if err != nil {
+						return xerrors.Errorf("failed to read cid field t.ReproposedAs: %w", err)
+					}
+
+					t.ReproposedAs = &c
+				}
+
 			}
 			// t.SectorNumber (abi.SectorNumber) (uint64)
 		case "SectorNumber":
@@ -729,7 +891,7 @@ func (t *MinerDeal) MarshalCBOR(w io.Writer) error {
 
 	cw := cbg.NewCborWriter(w)
 
-	if _, err := cw.Write([]byte{180}); err != nil {
+	if _, err := cw.Write([]byte{181}); err != nil {
 		return err
 	}
 
@@ -873,6 +1035,22 @@ func (t *MinerDeal) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
+	// t.Rejection (storagemarket.Rejection) (struct)
+	if len("Rejection") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Rejection\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Rejection"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Rejection")); err != nil {
+		return err
+	}
+
+	if err := t.Rejection.MarshalCBOR(cw); err != nil {
+		return err
+	}
+
 	// t.InboundCAR (string) (string)
 	if len("InboundCAR") > cbg.MaxLength {
 		return xerrors.Errorf("Value in field \"InboundCAR\" was too long")
@@ -1247,6 +1425,26 @@ func (t *MinerDeal) UnmarshalCBOR(r io.Reader) (err error) {
 
 				t.PiecePath = filestore.Path(sval)
 			}
+			// t.Rejection (storagemarket.Rejection) (struct)
+		case "Rejection":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+					t.Rejection = new(Rejection)
+					if err := t.Rejection.UnmarshalCBOR(cr); err != nil {
+						return xerrors.Errorf("unmarshaling t.Rejection pointer: %w", err)
+					}
+				}
+
+			}
 			// t.InboundCAR (string) (string)
 		case "InboundCAR":
 
@@ -3137,3 +3335,317 @@ func (t *Log) UnmarshalCBOR(r io.Reader) (err error) {
 
 	return nil
 }
+func (t *Rejection) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+
+	cw := cbg.NewCborWriter(w)
+
+	if _, err := cw.Write([]byte{164}); err != nil {
+		return err
+	}
+
+	// t.Max (big.Int) (struct)
+	if len("Max") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Max\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Max"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Max")); err != nil {
+		return err
+	}
+
+	if err := t.Max.MarshalCBOR(cw); err != nil {
+		return err
+	}
+
+	// t.Min (big.Int) (struct)
+	if len("Min") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Min\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Min"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Min")); err != nil {
+		return err
+	}
+
+	if err := t.Min.MarshalCBOR(cw); err != nil {
+		return err
+	}
+
+	// t.Code (uint64) (uint64)
+	if len("Code") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Code\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Code"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Code")); err != nil {
+		return err
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.Code)); err != nil {
+		return err
+	}
+
+	// t.Proposed (big.Int) (struct)
+	if len("Proposed") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Proposed\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("Proposed"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Proposed")); err != nil {
+		return err
+	}
+
+	if err := t.Proposed.MarshalCBOR(cw); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *Rejection) UnmarshalCBOR(r io.Reader) (err error) {
+	*t = Rejection{}
+
+	cr := cbg.NewCborReader(r)
+
+	maj, extra, err := cr.ReadHeader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("Rejection: map struct too large (%d)", extra)
+	}
+
+	var name string
+	n := extra
+
+	for i := uint64(0); i < n; i++ {
+
+		{
+			sval, err := cbg.ReadString(cr)
+			if err != nil {
+				return err
+			}
+
+			name = string(sval)
+		}
+
+		switch name {
+		// t.Max (big.Int) (struct)
+		case "Max":
+
+			{
+
+				if err := t.Max.UnmarshalCBOR(cr); err != nil {
+					return xerrors.Errorf("unmarshaling t.Max: %w", err)
+				}
+
+			}
+			// t.Min (big.Int) (struct)
+		case "Min":
+
+			{
+
+				if err := t.Min.UnmarshalCBOR(cr); err != nil {
+					return xerrors.Errorf("unmarshaling t.Min: %w", err)
+				}
+
+			}
+			// t.Code (uint64) (uint64)
+		case "Code":
+
+			{
+
+				maj, extra, err = cr.ReadHeader()
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.Code = uint64(extra)
+
+			}
+			// t.Proposed (big.Int) (struct)
+		case "Proposed":
+
+			{
+
+				if err := t.Proposed.UnmarshalCBOR(cr); err != nil {
+					return xerrors.Errorf("unmarshaling t.Proposed: %w", err)
+				}
+
+			}
+
+		default:
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
+		}
+	}
+
+	return nil
+}
+func (t *DealNegotiation) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+
+	cw := cbg.NewCborWriter(w)
+
+	if _, err := cw.Write([]byte{163}); err != nil {
+		return err
+	}
+
+	// t.MaxReproposals (uint64) (uint64)
+	if len("MaxReproposals") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"MaxReproposals\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("MaxReproposals"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("MaxReproposals")); err != nil {
+		return err
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.MaxReproposals)); err != nil {
+		return err
+	}
+
+	// t.MaxProviderCollateral (big.Int) (struct)
+	if len("MaxProviderCollateral") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"MaxProviderCollateral\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("MaxProviderCollateral"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("MaxProviderCollateral")); err != nil {
+		return err
+	}
+
+	if err := t.MaxProviderCollateral.MarshalCBOR(cw); err != nil {
+		return err
+	}
+
+	// t.MaxStoragePricePerEpoch (big.Int) (struct)
+	if len("MaxStoragePricePerEpoch") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"MaxStoragePricePerEpoch\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("MaxStoragePricePerEpoch"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("MaxStoragePricePerEpoch")); err != nil {
+		return err
+	}
+
+	if err := t.MaxStoragePricePerEpoch.MarshalCBOR(cw); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *DealNegotiation) UnmarshalCBOR(r io.Reader) (err error) {
+	*t = DealNegotiation{}
+
+	cr := cbg.NewCborReader(r)
+
+	maj, extra, err := cr.ReadHeader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("DealNegotiation: map struct too large (%d)", extra)
+	}
+
+	var name string
+	n := extra
+
+	for i := uint64(0); i < n; i++ {
+
+		{
+			sval, err := cbg.ReadString(cr)
+			if err != nil {
+				return err
+			}
+
+			name = string(sval)
+		}
+
+		switch name {
+		// t.MaxReproposals (uint64) (uint64)
+		case "MaxReproposals":
+
+			{
+
+				maj, extra, err = cr.ReadHeader()
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.MaxReproposals = uint64(extra)
+
+			}
+			// t.MaxProviderCollateral (big.Int) (struct)
+		case "MaxProviderCollateral":
+
+			{
+
+				if err := t.MaxProviderCollateral.UnmarshalCBOR(cr); err != nil {
+					return xerrors.Errorf("unmarshaling t.MaxProviderCollateral: %w", err)
+				}
+
+			}
+			// t.MaxStoragePricePerEpoch (big.Int) (struct)
+		case "MaxStoragePricePerEpoch":
+
+			{
+
+				if err := t.MaxStoragePricePerEpoch.UnmarshalCBOR(cr); err != nil {
+					return xerrors.Errorf("unmarshaling t.MaxStoragePricePerEpoch: %w", err)
+				}
+
+			}
+
+		default:
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
+		}
+	}
+
+	return nil
+}